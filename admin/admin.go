@@ -0,0 +1,352 @@
+// Package admin serves an HTTP API for support tools to list the limiters of a
+// config.Registry, inspect and reset the state of their keys, and grant keys temporary
+// extra quota. The handler has no authentication of its own: mount it behind the
+// authentication of the admin endpoints of the application.
+//
+// Paths are relative to where the handler is mounted, such as with http.StripPrefix:
+//
+//	GET    /limiters                          List the limiters
+//	GET    /limiters/{name}                   Describe a limiter
+//	GET    /limiters/{name}/keys/{key}        Inspect a key, with its grant
+//	DELETE /limiters/{name}/keys/{key}        Reset a key
+//	GET    /limiters/{name}/keys/{key}/grant  Read the grant of a key
+//	PUT    /limiters/{name}/keys/{key}/grant  Grant a key extra quota, as {"quota": 100, "duration": "1h"}
+//	DELETE /limiters/{name}/keys/{key}/grant  Revoke the grant of a key
+//
+// Keys are path segments, so they must be escaped with url.PathEscape. Responses are JSON,
+// and errors are reported as {"error": "..."}.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/neelp03/throttlex/config"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// maxBodySize bounds the request bodies the handler reads.
+const maxBodySize = 1 << 16
+
+// errNoGrants is reported by the grant endpoints of a handler created without WithGrants.
+var errNoGrants = errors.New("grants are not enabled")
+
+// Handler serves the admin API for the limiters of a registry.
+type Handler struct {
+	registry *config.Registry
+	grants   *Grants // Grants of extra quota; nil if disabled
+}
+
+// Option configures optional behavior of a Handler.
+type Option func(*Handler)
+
+// WithGrants enables the grant endpoints, which give and revoke grants in g. The limiters
+// must be wrapped with g.WrapLimiter under their name in the registry for the grants to
+// apply.
+func WithGrants(g *Grants) Option {
+	return func(h *Handler) {
+		h.grants = g
+	}
+}
+
+// NewHandler returns a handler serving the admin API for the limiters of registry.
+func NewHandler(registry *config.Registry, opts ...Option) *Handler {
+	h := &Handler{registry: registry}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// limiterInfo describes a limiter in responses.
+type limiterInfo struct {
+	Name   string                 `json:"name"`
+	Policy ratelimiter.PolicyType `json:"policy"`
+	Spec   config.LimiterSpec     `json:"spec"`
+}
+
+// keyInfo describes the state of a key in responses.
+type keyInfo struct {
+	Limiter     string                 `json:"limiter"`
+	Key         string                 `json:"key"`
+	Policy      ratelimiter.PolicyType `json:"policy"`
+	StoreKey    string                 `json:"store_key"`
+	Exists      bool                   `json:"exists"`
+	TTL         config.Duration        `json:"ttl,omitempty"`
+	Count       *int64                 `json:"count,omitempty"`
+	TokenBucket *tokenBucketInfo       `json:"token_bucket,omitempty"`
+	LeakyBucket *leakyBucketInfo       `json:"leaky_bucket,omitempty"`
+	TAT         *time.Time             `json:"tat,omitempty"`
+	Grant       *grantInfo             `json:"grant,omitempty"`
+}
+
+// tokenBucketInfo describes a store.TokenBucketState in responses.
+type tokenBucketInfo struct {
+	Tokens     float64   `json:"tokens"`
+	LastUpdate time.Time `json:"last_update"`
+}
+
+// leakyBucketInfo describes a store.LeakyBucketState in responses.
+type leakyBucketInfo struct {
+	Queue    int       `json:"queue"`
+	LastLeak time.Time `json:"last_leak"`
+}
+
+// grantInfo describes a Grant in responses.
+type grantInfo struct {
+	Quota     int64           `json:"quota"`
+	Used      int64           `json:"used"`
+	ExpiresIn config.Duration `json:"expires_in"`
+}
+
+// grantRequest is the body of a request granting extra quota.
+type grantRequest struct {
+	Quota    int64           `json:"quota"`
+	Duration config.Duration `json:"duration"`
+}
+
+// ServeHTTP serves a request of the admin API.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments, err := pathSegments(r.URL)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(segments) == 0 || segments[0] != "limiters" {
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+
+	switch {
+	case len(segments) == 1:
+		if allowMethods(w, r, http.MethodGet) {
+			h.listLimiters(w)
+		}
+	case len(segments) == 2:
+		if allowMethods(w, r, http.MethodGet) {
+			h.describeLimiter(w, segments[1])
+		}
+	case len(segments) == 4 && segments[2] == "keys":
+		if allowMethods(w, r, http.MethodGet, http.MethodDelete) {
+			h.serveKey(w, r, segments[1], segments[3])
+		}
+	case len(segments) == 5 && segments[2] == "keys" && segments[4] == "grant":
+		if allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+			h.serveGrant(w, r, segments[1], segments[3])
+		}
+	default:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// listLimiters writes the limiters of the registry.
+func (h *Handler) listLimiters(w http.ResponseWriter) {
+	limiters := []limiterInfo{}
+	for _, name := range h.registry.Names() {
+		if spec, ok := h.registry.Spec(name); ok {
+			limiters = append(limiters, limiterInfo{Name: name, Policy: spec.Policy, Spec: spec})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"limiters": limiters})
+}
+
+// describeLimiter writes the limiter of the given name.
+func (h *Handler) describeLimiter(w http.ResponseWriter, name string) {
+	spec, ok := h.registry.Spec(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, config.ErrUnknownLimiter)
+		return
+	}
+	writeJSON(w, http.StatusOK, limiterInfo{Name: name, Policy: spec.Policy, Spec: spec})
+}
+
+// serveKey inspects or resets a key of the named limiter.
+func (h *Handler) serveKey(w http.ResponseWriter, r *http.Request, name, key string) {
+	inspector, ok := h.inspector(w, name)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		if err := inspector.Reset(r.Context(), key); err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	state, err := inspector.Inspect(r.Context(), key)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	info := keyInfo{
+		Limiter:  name,
+		Key:      key,
+		Policy:   state.Policy,
+		StoreKey: state.StoreKey,
+		Exists:   state.Exists,
+		TTL:      config.Duration(state.TTL),
+	}
+	switch state.Policy {
+	case ratelimiter.FixedWindowPolicy, ratelimiter.SlidingWindowPolicy, ratelimiter.SlidingWindowCounterPolicy, ratelimiter.ConcurrencyPolicy:
+		info.Count = &state.Count
+	}
+	if b := state.TokenBucket; b != nil {
+		info.TokenBucket = &tokenBucketInfo{Tokens: b.Tokens, LastUpdate: time.Unix(0, b.LastUpdateTime).UTC()}
+	}
+	if b := state.LeakyBucket; b != nil {
+		info.LeakyBucket = &leakyBucketInfo{Queue: b.Queue, LastLeak: b.LastLeakTime.UTC()}
+	}
+	if !state.TAT.IsZero() {
+		tat := state.TAT.UTC()
+		info.TAT = &tat
+	}
+	if h.grants != nil {
+		grant, err := h.grants.Get(r.Context(), name, key)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		info.Grant = newGrantInfo(grant)
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// serveGrant reads, gives or revokes the grant of a key of the named limiter.
+func (h *Handler) serveGrant(w http.ResponseWriter, r *http.Request, name, key string) {
+	if h.grants == nil {
+		writeError(w, http.StatusNotImplemented, errNoGrants)
+		return
+	}
+	if _, ok := h.registry.Spec(name); !ok {
+		writeError(w, http.StatusNotFound, config.ErrUnknownLimiter)
+		return
+	}
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		grant, err := h.grants.Get(ctx, name, key)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		if grant == nil {
+			writeError(w, http.StatusNotFound, errors.New("key has no grant"))
+			return
+		}
+		writeJSON(w, http.StatusOK, newGrantInfo(grant))
+	case http.MethodPut:
+		var req grantRequest
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := h.grants.Grant(ctx, name, key, req.Quota, time.Duration(req.Duration)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		grant, err := h.grants.Get(ctx, name, key)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newGrantInfo(grant))
+	case http.MethodDelete:
+		if err := h.grants.Revoke(ctx, name, key); err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// inspector returns the named limiter as a ratelimiter.Inspector, or writes an error.
+func (h *Handler) inspector(w http.ResponseWriter, name string) (ratelimiter.Inspector, bool) {
+	limiter, ok := h.registry.Get(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, config.ErrUnknownLimiter)
+		return nil, false
+	}
+	inspector, ok := limiter.(ratelimiter.Inspector)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, ratelimiter.ErrInspectionUnsupported)
+		return nil, false
+	}
+	return inspector, true
+}
+
+// newGrantInfo returns the description of a grant, or nil if there is none.
+func newGrantInfo(grant *Grant) *grantInfo {
+	if grant == nil {
+		return nil
+	}
+	return &grantInfo{Quota: grant.Quota, Used: grant.Used, ExpiresIn: config.Duration(grant.ExpiresIn)}
+}
+
+// pathSegments returns the unescaped segments of the path of u.
+func pathSegments(u *url.URL) ([]string, error) {
+	path := strings.Trim(u.EscapedPath(), "/")
+	if path == "" {
+		return nil, nil
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		unescaped, err := url.PathUnescape(segment)
+		if err != nil {
+			return nil, err
+		}
+		segments[i] = unescaped
+	}
+	return segments, nil
+}
+
+// allowMethods reports whether the method of r is one of methods, and otherwise writes a
+// 405 Method Not Allowed response.
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	return false
+}
+
+// statusOf returns the status code of the response reporting err.
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ratelimiter.ErrInvalidKey):
+		return http.StatusBadRequest
+	case errors.Is(err, config.ErrUnknownLimiter):
+		return http.StatusNotFound
+	case errors.Is(err, ratelimiter.ErrInspectionUnsupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, ratelimiter.ErrClosed), errors.Is(err, store.ErrClosed):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes err as a JSON response with the given status code.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
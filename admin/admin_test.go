@@ -0,0 +1,169 @@
+// admin/admin_test.go
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/config"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// newTestRegistry returns a registry with a TokenBucket limiter named api and a
+// FixedWindow limiter named login, on a memory store following the fake clock.
+func newTestRegistry(t *testing.T, fake *clock.Fake) *config.Registry {
+	t.Helper()
+	registry, err := config.NewRegistry(&config.Config{Limiters: map[string]config.LimiterSpec{
+		"api":   {Policy: ratelimiter.TokenBucketPolicy, Capacity: 2, RefillRate: 1},
+		"login": {Policy: ratelimiter.FixedWindowPolicy, Limit: 5, Interval: config.Duration(time.Minute)},
+	}}, config.WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	t.Cleanup(func() { registry.Close() })
+	return registry
+}
+
+// serve sends a request to the handler and returns the response, decoding its JSON body
+// into v if not nil.
+func serve(t *testing.T, h http.Handler, method, path, body string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: invalid response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+func TestHandler_Limiters(t *testing.T) {
+	h := NewHandler(newTestRegistry(t, clock.NewFake(time.Unix(1700000000, 0))))
+
+	var list struct {
+		Limiters []limiterInfo `json:"limiters"`
+	}
+	if rec := serve(t, h, http.MethodGet, "/limiters", "", &list); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if len(list.Limiters) != 2 || list.Limiters[0].Name != "api" || list.Limiters[1].Policy != ratelimiter.FixedWindowPolicy {
+		t.Errorf("Expected limiters api and login, got %+v", list.Limiters)
+	}
+
+	var login limiterInfo
+	serve(t, h, http.MethodGet, "/limiters/login", "", &login)
+	if login.Spec.Limit != 5 || time.Duration(login.Spec.Interval) != time.Minute {
+		t.Errorf("Expected the spec of login, got %+v", login)
+	}
+}
+
+func TestHandler_Keys(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	registry := newTestRegistry(t, fake)
+	h := NewHandler(registry)
+	login, _ := registry.Get("login")
+	for i := 0; i < 3; i++ {
+		login.Allow("alice")
+	}
+
+	var info keyInfo
+	if rec := serve(t, h, http.MethodGet, "/limiters/login/keys/alice", "", &info); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if !info.Exists || info.Count == nil || *info.Count != 3 || time.Duration(info.TTL) != time.Minute {
+		t.Errorf("Expected a count of 3 expiring in a minute, got %+v", info)
+	}
+
+	if rec := serve(t, h, http.MethodDelete, "/limiters/login/keys/alice", "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", rec.Code)
+	}
+	info = keyInfo{}
+	serve(t, h, http.MethodGet, "/limiters/login/keys/alice", "", &info)
+	if info.Exists || info.Grant != nil {
+		t.Errorf("Expected no state after the reset, got %+v", info)
+	}
+	if result, err := login.Decide("alice"); err != nil || result.Remaining != 4 {
+		t.Errorf("Expected the full quota after the reset, got %+v, %v", result, err)
+	}
+}
+
+func TestHandler_Grants(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	registry := newTestRegistry(t, fake)
+	grants, err := NewGrants(store.NewMemoryStore(store.WithClock(fake)), "grants")
+	if err != nil {
+		t.Fatalf("Failed to create grants: %v", err)
+	}
+	h := NewHandler(registry, WithGrants(grants))
+	inner, _ := registry.Get("api")
+	api := grants.WrapLimiter("api", inner)
+
+	for i := 0; i < 2; i++ {
+		api.Allow("alice")
+	}
+	if allowed, _ := api.Allow("alice"); allowed {
+		t.Fatal("Expected the third request to be denied")
+	}
+
+	var grant grantInfo
+	rec := serve(t, h, http.MethodPut, "/limiters/api/keys/alice/grant", `{"quota": 2, "duration": "1h"}`, &grant)
+	if rec.Code != http.StatusOK || grant.Quota != 2 || time.Duration(grant.ExpiresIn) != time.Hour {
+		t.Fatalf("Expected a grant of 2 for an hour, got %d %+v", rec.Code, grant)
+	}
+	for i := 0; i < 2; i++ {
+		if allowed, err := api.Allow("alice"); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed from the grant, got %v, %v", i+1, allowed, err)
+		}
+	}
+	if allowed, _ := api.Allow("alice"); allowed {
+		t.Error("Expected the request to be denied once the grant is used")
+	}
+
+	var info keyInfo
+	serve(t, h, http.MethodGet, "/limiters/api/keys/alice", "", &info)
+	if info.TokenBucket == nil || info.Grant == nil || info.Grant.Used != 2 {
+		t.Errorf("Expected the token bucket and the used grant, got %+v", info)
+	}
+
+	if rec := serve(t, h, http.MethodDelete, "/limiters/api/keys/alice/grant", "", nil); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", rec.Code)
+	}
+	if rec := serve(t, h, http.MethodGet, "/limiters/api/keys/alice/grant", "", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after the grant is revoked, got %d", rec.Code)
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	h := NewHandler(newTestRegistry(t, clock.NewFake(time.Unix(1700000000, 0))))
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{method: http.MethodGet, path: "/", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/limiters/missing", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/limiters/missing/keys/alice", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/limiters/login/keys/a%20b", status: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/limiters/login/other/alice", status: http.StatusNotFound},
+		{method: http.MethodPost, path: "/limiters", status: http.StatusMethodNotAllowed},
+		{method: http.MethodPut, path: "/limiters/login/keys/alice", status: http.StatusMethodNotAllowed},
+		{method: http.MethodPut, path: "/limiters/login/keys/alice/grant", body: `{"quota": 1, "duration": "1h"}`, status: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		var body map[string]string
+		rec := serve(t, h, tt.method, tt.path, tt.body, &body)
+		if rec.Code != tt.status || body["error"] == "" {
+			t.Errorf("%s %s: expected status %d with an error, got %d %v", tt.method, tt.path, tt.status, rec.Code, body)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// Grants gives keys of limiters temporary extra quota, kept in a store so that every
+// process sharing the store honors it. Limiters wrapped with WrapLimiter admit the requests
+// they would deny while their key has granted quota left.
+type Grants struct {
+	store     store.Store
+	inspector store.KeyInspector
+	namespace string // Prefix of the store keys of the grants
+}
+
+// Grant is the extra quota granted to a key of a limiter.
+type Grant struct {
+	Quota     int64         // Units granted
+	Used      int64         // Units used so far
+	ExpiresIn time.Duration // Time before the grant expires
+}
+
+// NewGrants returns grants kept in s under keys prefixed with namespace. s must implement
+// store.KeyInspector, like MemoryStore and RedisStore.
+func NewGrants(s store.Store, namespace string) (*Grants, error) {
+	if s == nil {
+		return nil, errors.New("store cannot be nil")
+	}
+	inspector, ok := s.(store.KeyInspector)
+	if !ok {
+		return nil, errors.New("store does not implement store.KeyInspector")
+	}
+	if namespace == "" {
+		return nil, errors.New("namespace cannot be empty")
+	}
+	return &Grants{store: s, inspector: inspector, namespace: namespace}, nil
+}
+
+// Grant gives the key of the named limiter quota extra units for d, replacing any grant it
+// had. Keys are matched as given, before the key policy of the limiter applies.
+func (g *Grants) Grant(ctx context.Context, limiter, key string, quota int64, d time.Duration) error {
+	if quota <= 0 {
+		return errors.New("quota must be greater than zero")
+	}
+	if d <= 0 {
+		return errors.New("duration must be greater than zero")
+	}
+	quotaKey, usedKey := g.storeKeys(limiter, key)
+	if err := g.inspector.Delete(ctx, quotaKey, usedKey); err != nil {
+		return err
+	}
+	_, err := g.store.IncrementContext(ctx, quotaKey, quota, d)
+	return err
+}
+
+// Get returns the grant of the key of the named limiter, or nil if it has none.
+func (g *Grants) Get(ctx context.Context, limiter, key string) (*Grant, error) {
+	quotaKey, usedKey := g.storeKeys(limiter, key)
+	ttl, exists, err := g.inspector.TTL(ctx, quotaKey)
+	if err != nil || !exists {
+		return nil, err
+	}
+	quota, err := g.store.GetCounterContext(ctx, quotaKey)
+	if err != nil {
+		return nil, err
+	}
+	used, err := g.store.GetCounterContext(ctx, usedKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Grant{Quota: quota, Used: min(used, quota), ExpiresIn: ttl}, nil
+}
+
+// Revoke deletes the grant of the key of the named limiter.
+func (g *Grants) Revoke(ctx context.Context, limiter, key string) error {
+	quotaKey, usedKey := g.storeKeys(limiter, key)
+	return g.inspector.Delete(ctx, quotaKey, usedKey)
+}
+
+// take uses n units of the grant of the key of the named limiter if it has them left, and
+// returns the units left.
+func (g *Grants) take(ctx context.Context, limiter, key string, n int64) (remaining int64, taken bool, err error) {
+	quotaKey, usedKey := g.storeKeys(limiter, key)
+	quota, err := g.store.GetCounterContext(ctx, quotaKey)
+	if err != nil || quota == 0 {
+		return 0, false, err
+	}
+	ttl, exists, err := g.inspector.TTL(ctx, quotaKey)
+	if err != nil || !exists || ttl <= 0 {
+		return 0, false, err
+	}
+
+	// Count the units first so that concurrent requests see each other, and give them
+	// back if the grant cannot cover them
+	used, err := g.store.IncrementContext(ctx, usedKey, n, ttl)
+	if err != nil {
+		return 0, false, err
+	}
+	if used > quota {
+		_, err := g.store.IncrementContext(context.WithoutCancel(ctx), usedKey, -n, ttl)
+		return 0, false, err
+	}
+	return quota - used, true, nil
+}
+
+// storeKeys returns the store keys of the quota and the used units of a grant.
+func (g *Grants) storeKeys(limiter, key string) (quotaKey, usedKey string) {
+	prefix := g.namespace + ":" + limiter + ":" + key
+	return prefix + ":quota", prefix + ":used"
+}
+
+// Limiter is a rate limiter that admits the requests its wrapped limiter denies while their
+// key has granted quota left. It implements ratelimiter.RateLimiter, ratelimiter.Reserver
+// and ratelimiter.Inspector, forwarding reservations, waits and inspections to the wrapped
+// limiter, so it can be a child of a CompositeLimiter, be waited on by an
+// httplimit.Transport and be inspected by the Handler.
+type Limiter struct {
+	limiter ratelimiter.RateLimiter // Limiter making the decisions
+	name    string                  // Name the grants are given under
+	grants  *Grants
+	mu      sync.Mutex       // Guards granted
+	granted map[string]int64 // Units admitted from grants and not yet released, by key
+}
+
+// WrapLimiter returns a limiter that makes its decisions with l, and admits the requests l
+// denies from the grants given under the given name, which is that of the limiter in the
+// Handler. If the grants cannot be read, the decision of l stands. Requests admitted from
+// a grant hold no slot of a Concurrency limiter, so releasing them frees none. Closing the
+// returned limiter closes l.
+func (g *Grants) WrapLimiter(name string, l ratelimiter.RateLimiter) *Limiter {
+	return &Limiter{limiter: l, name: name, grants: g, granted: make(map[string]int64)}
+}
+
+// Name returns the name the grants are given under.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Unwrap returns the limiter making the decisions.
+func (l *Limiter) Unwrap() ratelimiter.RateLimiter {
+	return l.limiter
+}
+
+// Policy returns the policy of the wrapped limiter, as named by ratelimiter.PolicyName.
+func (l *Limiter) Policy() ratelimiter.PolicyType {
+	return ratelimiter.PolicyType(ratelimiter.PolicyName(l.limiter))
+}
+
+// decide makes a decision for a request of cost n with the wrapped limiter, and admits it
+// from the grant of its key if the wrapped limiter denies it.
+func (l *Limiter) decide(ctx context.Context, key string, n int64) (*ratelimiter.Result, error) {
+	result, err := l.limiter.DecideNContext(ctx, key, n)
+	if err != nil || result.Allowed {
+		return result, err
+	}
+	remaining, taken := l.take(ctx, key, n)
+	if !taken {
+		return result, nil
+	}
+
+	granted := *result
+	granted.Allowed = true
+	granted.Remaining = remaining
+	granted.RetryAfter = 0
+	granted.RejectedBy = ""
+	return &granted, nil
+}
+
+// take admits a request of cost n from the grant of its key if it has the units left, and
+// returns the units left. Units admitted are remembered until released if the wrapped
+// limiter is a Concurrency limiter, whose requests hold a slot until released.
+func (l *Limiter) take(ctx context.Context, key string, n int64) (remaining int64, taken bool) {
+	remaining, taken, err := l.grants.take(ctx, l.name, key, n)
+	if err != nil || !taken {
+		return 0, false
+	}
+	if l.holdsSlots() {
+		l.mu.Lock()
+		l.granted[key] += n
+		l.mu.Unlock()
+	}
+	return remaining, true
+}
+
+// holdsSlots reports whether the wrapped limiter is a Concurrency limiter. Wrappers such
+// as metrics.Limiter have a ReleaseN method whatever the policy of the limiter they wrap,
+// so the policy is checked rather than the method.
+func (l *Limiter) holdsSlots() bool {
+	return ratelimiter.PolicyName(l.limiter) == string(ratelimiter.ConcurrencyPolicy)
+}
+
+// Allow checks if a request associated with the given key is allowed to proceed.
+func (l *Limiter) Allow(key string) (bool, error) {
+	return l.AllowContext(context.Background(), key)
+}
+
+// AllowN checks if a request of cost n associated with the given key is allowed to proceed.
+func (l *Limiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.decide(context.Background(), key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the store.
+func (l *Limiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.decide(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Decide checks if a request associated with the given key is allowed to proceed and
+// reports the remaining quota, which is that of the grant for requests admitted from it.
+func (l *Limiter) Decide(key string) (*ratelimiter.Result, error) {
+	return l.decide(context.Background(), key, 1)
+}
+
+// DecideN is like Decide for a request of cost n.
+func (l *Limiter) DecideN(key string, n int64) (*ratelimiter.Result, error) {
+	return l.decide(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store.
+func (l *Limiter) DecideNContext(ctx context.Context, key string, n int64) (*ratelimiter.Result, error) {
+	return l.decide(ctx, key, n)
+}
+
+// Release releases a slot of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) Release(key string) error {
+	return l.ReleaseN(key, 1)
+}
+
+// ReserveN reserves capacity from the wrapped limiter for a request of cost n associated
+// with the given key. Reservations do not draw on grants.
+func (l *Limiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*ratelimiter.Reservation, error) {
+	return ratelimiter.ReserveN(ctx, l.limiter, key, n, maxDelay)
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until the wrapped limiter allows a request of cost n associated with the
+// given key, or the context is done. A request the wrapped limiter cannot admit before the
+// context deadline is admitted from the grant of its key if it has the units left.
+func (l *Limiter) WaitN(ctx context.Context, key string, n int64) error {
+	err := ratelimiter.WaitN(ctx, l.limiter, key, n)
+	if errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		if _, taken := l.take(ctx, key, n); taken {
+			return nil
+		}
+	}
+	return err
+}
+
+// Inspect returns the state of key in the wrapped limiter. Grants are not part of it;
+// Grants.Get reports them.
+func (l *Limiter) Inspect(ctx context.Context, key string) (*ratelimiter.KeyState, error) {
+	return ratelimiter.Inspect(ctx, l.limiter, key)
+}
+
+// Reset deletes the state of key in the wrapped limiter, leaving its grant.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return ratelimiter.Reset(ctx, l.limiter, key)
+}
+
+// ReleaseN releases n slots of a Concurrency limiter after processing. Units admitted from
+// a grant, which hold no slot, are released first and free nothing. It does nothing for
+// other policies.
+func (l *Limiter) ReleaseN(key string, n int64) error {
+	if !l.holdsSlots() {
+		return ratelimiter.ReleaseN(l.limiter, key, n)
+	}
+
+	l.mu.Lock()
+	granted := max(min(n, l.granted[key]), 0)
+	if granted > 0 {
+		if l.granted[key] -= granted; l.granted[key] == 0 {
+			delete(l.granted, key)
+		}
+	}
+	l.mu.Unlock()
+
+	if granted > 0 && granted == n {
+		return nil
+	}
+	return ratelimiter.ReleaseN(l.limiter, key, n-granted)
+}
+
+// Close closes the wrapped limiter.
+func (l *Limiter) Close() error {
+	return l.limiter.Close()
+}
@@ -0,0 +1,207 @@
+// admin/grants_test.go
+
+package admin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+func TestGrants(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	grants, err := NewGrants(store.NewMemoryStore(store.WithClock(fake)), "grants")
+	if err != nil {
+		t.Fatalf("Failed to create grants: %v", err)
+	}
+	ctx := context.Background()
+
+	if err := grants.Grant(ctx, "api", "alice", 3, time.Minute); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if remaining, taken, err := grants.take(ctx, "api", "alice", 2); err != nil || !taken || remaining != 1 {
+		t.Errorf("Expected 2 units to be taken with 1 left, got %d, %v, %v", remaining, taken, err)
+	}
+	if _, taken, err := grants.take(ctx, "api", "alice", 2); err != nil || taken {
+		t.Errorf("Expected 2 units not to be taken with 1 left, got %v, %v", taken, err)
+	}
+	if _, taken, _ := grants.take(ctx, "login", "alice", 1); taken {
+		t.Error("Expected the grant to apply to its limiter only")
+	}
+	grant, err := grants.Get(ctx, "api", "alice")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if expected := (Grant{Quota: 3, Used: 2, ExpiresIn: time.Minute}); grant == nil || *grant != expected {
+		t.Errorf("Expected %+v, got %+v", expected, grant)
+	}
+
+	// A new grant replaces the old one
+	if err := grants.Grant(ctx, "api", "alice", 5, time.Hour); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if grant, _ := grants.Get(ctx, "api", "alice"); grant == nil || grant.Quota != 5 || grant.Used != 0 {
+		t.Errorf("Expected a fresh grant of 5, got %+v", grant)
+	}
+
+	fake.Advance(time.Hour)
+	if grant, err := grants.Get(ctx, "api", "alice"); err != nil || grant != nil {
+		t.Errorf("Expected the grant to expire, got %+v, %v", grant, err)
+	}
+	if _, taken, _ := grants.take(ctx, "api", "alice", 1); taken {
+		t.Error("Expected no units from an expired grant")
+	}
+}
+
+func TestNewGrants_Validation(t *testing.T) {
+	if _, err := NewGrants(struct{ store.Store }{store.NewMemoryStore()}, "grants"); err == nil {
+		t.Error("Expected an error for a store without key inspection")
+	}
+	if _, err := NewGrants(store.NewMemoryStore(), ""); err == nil {
+		t.Error("Expected an error for an empty namespace")
+	}
+
+	grants, err := NewGrants(store.NewMemoryStore(), "grants")
+	if err != nil {
+		t.Fatalf("Failed to create grants: %v", err)
+	}
+	if err := grants.Grant(context.Background(), "api", "alice", 0, time.Minute); err == nil {
+		t.Error("Expected an error for a zero quota")
+	}
+	if err := grants.Grant(context.Background(), "api", "alice", 1, 0); err == nil {
+		t.Error("Expected an error for a zero duration")
+	}
+}
+
+func TestLimiter_ReleaseGranted(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	grants, err := NewGrants(memStore, "grants")
+	if err != nil {
+		t.Fatalf("Failed to create grants: %v", err)
+	}
+	inner, err := ratelimiter.NewConcurrencyLimiter(memStore, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := grants.WrapLimiter("uploads", inner)
+	defer limiter.Close()
+	if err := grants.Grant(context.Background(), "uploads", "alice", 1, time.Minute); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if allowed, err := limiter.Allow("alice"); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+
+	// Releasing the request admitted from the grant frees no slot
+	if err := limiter.Release("alice"); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if allowed, err := limiter.Allow("alice"); err != nil || allowed {
+		t.Errorf("Expected the request to be denied while the slot is held, got %v, %v", allowed, err)
+	}
+	if err := limiter.Release("alice"); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if allowed, err := limiter.Allow("alice"); err != nil || !allowed {
+		t.Errorf("Expected the request to be allowed once the slot is released, got %v, %v", allowed, err)
+	}
+}
+
+// releasing is a limiter with a ReleaseN method whatever its policy, as wrappers such as
+// metrics.Limiter are.
+type releasing struct {
+	ratelimiter.RateLimiter
+	released int64
+}
+
+func (r *releasing) ReleaseN(key string, n int64) error {
+	r.released += n
+	return nil
+}
+
+func TestLimiter_ReleaseNotConcurrency(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	grants, err := NewGrants(memStore, "grants")
+	if err != nil {
+		t.Fatalf("Failed to create grants: %v", err)
+	}
+	inner, err := ratelimiter.NewFixedWindowLimiter(memStore, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	wrapped := &releasing{RateLimiter: inner}
+	limiter := grants.WrapLimiter("api", wrapped)
+	defer limiter.Close()
+	if err := grants.Grant(context.Background(), "api", "alice", 1, time.Minute); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if allowed, err := limiter.Allow("alice"); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+	if len(limiter.granted) != 0 {
+		t.Errorf("Expected no granted units to be remembered, got %v", limiter.granted)
+	}
+
+	// Releases are forwarded as they are
+	if err := limiter.Release("alice"); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if wrapped.released != 1 {
+		t.Errorf("Expected 1 unit released by the wrapped limiter, got %d", wrapped.released)
+	}
+}
+
+func TestLimiter_Reservations(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := store.NewMemoryStore(store.WithClock(fake))
+	grants, err := NewGrants(memStore, "grants")
+	if err != nil {
+		t.Fatalf("Failed to create grants: %v", err)
+	}
+	inner, err := ratelimiter.NewFixedWindowLimiter(memStore, 1, time.Minute, ratelimiter.WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := grants.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	composite, err := ratelimiter.NewCompositeLimiter([]ratelimiter.CompositeChild{{Name: "api", Limiter: limiter}})
+	if err != nil {
+		t.Fatalf("Expected the wrapped limiter to be a composite child, got %v", err)
+	}
+	if allowed, err := composite.Allow("alice"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := limiter.Wait(ctx, "alice"); !errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		t.Errorf("Expected ErrWaitExceedsDeadline without a grant, got %v", err)
+	}
+	if err := grants.Grant(context.Background(), "api", "alice", 1, time.Minute); err != nil {
+		t.Fatalf("Grant failed: %v", err)
+	}
+	if err := limiter.Wait(ctx, "alice"); err != nil {
+		t.Errorf("Expected the wait to be admitted from the grant, got %v", err)
+	}
+
+	state, err := limiter.Inspect(context.Background(), "alice")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if state.Count != 1 {
+		t.Errorf("Expected a count of 1, got %d", state.Count)
+	}
+
+}
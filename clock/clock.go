@@ -0,0 +1,98 @@
+// Package clock provides the source of time used by rate limiters and stores, so that a
+// fake clock can replace the real one in tests and simulations.
+package clock
+
+import "time"
+
+// Clock tells the time and schedules work after a duration.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a timer that sends the time on its channel after d.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker creates a ticker that sends the time on its channel every d.
+	NewTicker(d time.Duration) Ticker
+
+	// AfterFunc calls f in its own goroutine after d, or on the goroutine advancing a fake
+	// clock. The returned timer has no channel and can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single event scheduled by a Clock, like time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is sent when the timer fires. It is nil for
+	// timers created by AfterFunc.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It returns false if the timer has already fired
+	// or been stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after d. It returns true if the timer was active.
+	Reset(d time.Duration) bool
+}
+
+// Ticker is a periodic event scheduled by a Clock, like time.Ticker.
+type Ticker interface {
+	// C returns the channel on which the ticks are sent.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker. No more ticks are sent after it returns.
+	Stop()
+}
+
+// New returns a Clock backed by the time package.
+func New() Clock {
+	return realClock{}
+}
+
+// realClock implements Clock with the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return realTimer{time.AfterFunc(d, f)}
+}
+
+// realTimer adapts time.Timer to Timer.
+type realTimer struct {
+	timer *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+func (t realTimer) Reset(d time.Duration) bool {
+	return t.timer.Reset(d)
+}
+
+// realTicker adapts time.Ticker to Ticker.
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.ticker.C
+}
+
+func (t realTicker) Stop() {
+	t.ticker.Stop()
+}
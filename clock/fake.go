@@ -0,0 +1,177 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves when it is advanced, firing the timers, tickers and
+// AfterFunc calls that come due in order. It is safe for concurrent use.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond    // Signalled when waiters are added or removed
+	now     time.Time     // Current time of the clock
+	waiters []*fakeWaiter // Pending timers, tickers and AfterFunc calls
+}
+
+// fakeWaiter is a timer, ticker or AfterFunc call scheduled on a Fake clock.
+type fakeWaiter struct {
+	clock  *Fake
+	at     time.Time      // When the waiter fires next
+	period time.Duration  // Interval between ticks; zero for timers
+	ch     chan time.Time // Channel the time is sent on; nil for AfterFunc
+	f      func()         // Function called when the waiter fires; nil for channels
+}
+
+// NewFake returns a Fake clock set to the given time.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the current time of the clock.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTimer creates a timer that fires once the clock has been advanced by d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	w := &fakeWaiter{clock: f, ch: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return w
+}
+
+// NewTicker creates a ticker that fires each time the clock passes a multiple of d. Like
+// time.Ticker, it drops ticks the receiver is not ready for.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	w := &fakeWaiter{clock: f, period: d, ch: make(chan time.Time, 1)}
+	f.schedule(w, d)
+	return fakeTicker{w}
+}
+
+// AfterFunc schedules f to be called, on the goroutine advancing the clock, once the clock
+// has been advanced by d.
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	w := &fakeWaiter{clock: f, f: fn}
+	f.schedule(w, d)
+	return w
+}
+
+// Advance moves the clock forward by d, firing in order everything that comes due. The
+// clock reads the time each waiter was due while it fires.
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock forward to t, firing in order everything that comes due. It does
+// nothing if t is not after the current time.
+func (f *Fake) Set(t time.Time) {
+	for {
+		f.mu.Lock()
+		if len(f.waiters) == 0 || f.waiters[0].at.After(t) {
+			if t.After(f.now) {
+				f.now = t
+			}
+			f.mu.Unlock()
+			return
+		}
+
+		w := f.waiters[0]
+		f.now = w.at
+		f.remove(w)
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+			f.insert(w)
+		}
+		now := f.now
+		f.mu.Unlock()
+
+		// Fire without holding the lock, so that the waiter can use the clock
+		if w.f != nil {
+			w.f()
+		} else {
+			select {
+			case w.ch <- now:
+			default:
+			}
+		}
+	}
+}
+
+// BlockUntil blocks until at least n timers, tickers or AfterFunc calls are pending. It lets
+// a test wait for the code under test to start waiting before advancing the clock.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// schedule adds w to fire after d.
+func (f *Fake) schedule(w *fakeWaiter, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.at = f.now.Add(d)
+	f.insert(w)
+}
+
+// insert adds w to the waiters, keeping them ordered by when they fire. The caller holds f.mu.
+func (f *Fake) insert(w *fakeWaiter) {
+	i := sort.Search(len(f.waiters), func(i int) bool { return f.waiters[i].at.After(w.at) })
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = w
+	f.cond.Broadcast()
+}
+
+// remove removes w from the waiters and reports whether it was pending. The caller holds f.mu.
+func (f *Fake) remove(w *fakeWaiter) bool {
+	for i, pending := range f.waiters {
+		if pending == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// C returns the channel of the timer or ticker.
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.ch
+}
+
+// Stop prevents the waiter from firing again.
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	return w.clock.remove(w)
+}
+
+// Reset reschedules the waiter to fire after d.
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	active := w.clock.remove(w)
+	w.at = w.clock.now.Add(d)
+	w.clock.insert(w)
+	return active
+}
+
+// fakeTicker adapts a periodic fakeWaiter to Ticker.
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+// Stop turns off the ticker.
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
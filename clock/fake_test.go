@@ -0,0 +1,143 @@
+// clock/fake_test.go
+
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Unix(1700000000, 0)
+
+// TestFake_Timer tests that a timer fires only once the clock reaches its time.
+func TestFake_Timer(t *testing.T) {
+	clock := NewFake(epoch)
+	timer := clock.NewTimer(time.Second)
+
+	clock.Advance(999 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal("Timer fired before its time")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+	select {
+	case at := <-timer.C():
+		if !at.Equal(epoch.Add(time.Second)) {
+			t.Errorf("Expected the timer to fire at %v, got %v", epoch.Add(time.Second), at)
+		}
+	default:
+		t.Fatal("Timer did not fire at its time")
+	}
+
+	if timer.Stop() {
+		t.Error("Expected Stop to report a fired timer as inactive")
+	}
+}
+
+// TestFake_StopAndReset tests that a stopped timer does not fire and a reset one fires at its new time.
+func TestFake_StopAndReset(t *testing.T) {
+	clock := NewFake(epoch)
+	timer := clock.NewTimer(time.Second)
+
+	if !timer.Stop() {
+		t.Error("Expected Stop to report a pending timer as active")
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("Stopped timer fired")
+	default:
+	}
+
+	if timer.Reset(time.Second) {
+		t.Error("Expected Reset to report a stopped timer as inactive")
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("Reset timer did not fire")
+	}
+}
+
+// TestFake_Ticker tests that a ticker fires once per interval and drops ticks nobody receives.
+func TestFake_Ticker(t *testing.T) {
+	clock := NewFake(epoch)
+	ticker := clock.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Second)
+		select {
+		case at := <-ticker.C():
+			if want := epoch.Add(time.Duration(i) * time.Second); !at.Equal(want) {
+				t.Errorf("Expected tick %d at %v, got %v", i, want, at)
+			}
+		default:
+			t.Fatalf("Ticker did not fire on tick %d", i)
+		}
+	}
+
+	// Only one tick is buffered when the receiver falls behind
+	clock.Advance(5 * time.Second)
+	<-ticker.C()
+	select {
+	case <-ticker.C():
+		t.Error("Expected missed ticks to be dropped")
+	default:
+	}
+
+	ticker.Stop()
+	clock.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Error("Stopped ticker fired")
+	default:
+	}
+}
+
+// TestFake_AfterFunc tests that functions are called in order with the clock set to their time.
+func TestFake_AfterFunc(t *testing.T) {
+	clock := NewFake(epoch)
+	var calls []time.Duration
+	for _, d := range []time.Duration{3 * time.Second, time.Second, 2 * time.Second} {
+		d := d
+		clock.AfterFunc(d, func() {
+			if now := clock.Now(); !now.Equal(epoch.Add(d)) {
+				t.Errorf("Expected the clock to read %v while firing, got %v", epoch.Add(d), now)
+			}
+			calls = append(calls, d)
+		})
+	}
+	cancelled := clock.AfterFunc(time.Second, func() { t.Error("Stopped function was called") })
+	cancelled.Stop()
+
+	clock.Advance(10 * time.Second)
+	if len(calls) != 3 || calls[0] != time.Second || calls[1] != 2*time.Second || calls[2] != 3*time.Second {
+		t.Errorf("Expected calls at 1s, 2s and 3s, got %v", calls)
+	}
+	if now := clock.Now(); !now.Equal(epoch.Add(10 * time.Second)) {
+		t.Errorf("Expected the clock to read %v, got %v", epoch.Add(10*time.Second), now)
+	}
+}
+
+// TestFake_BlockUntil tests that BlockUntil returns once another goroutine starts waiting.
+func TestFake_BlockUntil(t *testing.T) {
+	clock := NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := clock.NewTimer(time.Minute)
+		<-timer.C()
+	}()
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Waiting goroutine was not woken up")
+	}
+}
@@ -0,0 +1,567 @@
+// Package config loads ThrottleX rate limiters from declarative YAML or JSON files.
+//
+// A configuration names the stores and the limiters to create, such as:
+//
+//	stores:
+//	  shared:
+//	    type: redis
+//	    address: localhost:6379
+//	limiters:
+//	  api:
+//	    policy: TokenBucket
+//	    store: shared
+//	    capacity: 100
+//	    refill_rate: 10
+//	  login:
+//	    policy: FixedWindow
+//	    store: shared
+//	    limit: 5
+//	    interval: 1m
+//	    keys:
+//	      normalize: [trim, lower]
+//	      validate: utf8
+//	      hash_over: 64
+//
+// NewRegistry creates the limiters of a configuration, and the Registry can swap them for
+// those of a new configuration while they are in use.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a configuration file.
+type Format string
+
+const (
+	YAML Format = "yaml"
+	JSON Format = "json"
+)
+
+// Store types of StoreSpec.
+const (
+	MemoryStore = "memory"
+	RedisStore  = "redis"
+)
+
+// DefaultStore is the name of the in-memory store used by limiters that do not name a
+// store. Configurations may define a store of that name to replace it.
+const DefaultStore = "memory"
+
+// Config describes the stores and limiters to create, by name.
+type Config struct {
+	Stores   map[string]StoreSpec   `json:"stores,omitempty" yaml:"stores,omitempty"`
+	Limiters map[string]LimiterSpec `json:"limiters" yaml:"limiters"`
+}
+
+// StoreSpec describes a store.
+type StoreSpec struct {
+	Type     string `json:"type" yaml:"type"`                             // MemoryStore or RedisStore
+	Address  string `json:"address,omitempty" yaml:"address,omitempty"`   // host:port of the Redis server
+	Username string `json:"username,omitempty" yaml:"username,omitempty"` // Redis ACL user
+	Password string `json:"password,omitempty" yaml:"password,omitempty"` // Redis password
+	DB       int    `json:"db,omitempty" yaml:"db,omitempty"`             // Redis database number
+}
+
+// LimiterSpec describes a limiter. Only the parameters of its policy may be set:
+// limit and interval for FixedWindow, SlidingWindow and SlidingWindowCounter, capacity and
+// refill_rate for TokenBucket, capacity and leak_rate for LeakyBucket, concurrency for
+// Concurrency, and burst and rate for GCRA. Rates are per second.
+type LimiterSpec struct {
+	Policy      ratelimiter.PolicyType `json:"policy" yaml:"policy"`
+	Store       string                 `json:"store,omitempty" yaml:"store,omitempty"` // Name of the store; DefaultStore if empty
+	Limit       int                    `json:"limit,omitempty" yaml:"limit,omitempty"`
+	Interval    Duration               `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Capacity    float64                `json:"capacity,omitempty" yaml:"capacity,omitempty"` // A whole number for LeakyBucket
+	RefillRate  float64                `json:"refill_rate,omitempty" yaml:"refill_rate,omitempty"`
+	LeakRate    float64                `json:"leak_rate,omitempty" yaml:"leak_rate,omitempty"`
+	Concurrency int64                  `json:"concurrency,omitempty" yaml:"concurrency,omitempty"`
+	Burst       int                    `json:"burst,omitempty" yaml:"burst,omitempty"`
+	Rate        float64                `json:"rate,omitempty" yaml:"rate,omitempty"`
+
+	// Namespace is the prefix of the store keys of the limiter. If empty, it is the name
+	// of the limiter and its policy, such as "api:TokenBucket", so that limiters never
+	// share state and keep it when their parameters change.
+	Namespace string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	Keys      *KeySpec `json:"keys,omitempty" yaml:"keys,omitempty"` // Key rules; ratelimiter.DefaultKeyPolicy if nil
+}
+
+// KeySpec describes the ratelimiter.KeyPolicy of a limiter.
+type KeySpec struct {
+	Normalize []string `json:"normalize,omitempty" yaml:"normalize,omitempty"` // Applied in order: "trim" spaces, "lower" case
+	Validate  string   `json:"validate,omitempty" yaml:"validate,omitempty"`   // "default", "utf8" or "none"; "default" if empty
+	HashOver  int      `json:"hash_over,omitempty" yaml:"hash_over,omitempty"`
+	HashAll   bool     `json:"hash_all,omitempty" yaml:"hash_all,omitempty"`
+}
+
+// normalizers are the key normalizations of KeySpec, by name.
+var normalizers = map[string]func(string) string{
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+}
+
+// validators are the key validators of KeySpec, by name.
+var validators = map[string]func(string) error{
+	"":        ratelimiter.ValidateKey,
+	"default": ratelimiter.ValidateKey,
+	"utf8":    ratelimiter.ValidateUTF8Key,
+	"none":    nil,
+}
+
+// Duration is a time.Duration written as a string such as "1m" or "1h30m", in the syntax
+// of time.ParseDuration.
+type Duration time.Duration
+
+// durationType is the type of Duration, reported in JSON type errors.
+var durationType = reflect.TypeOf(Duration(0))
+
+// String returns the duration in the syntax of time.Duration.
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// duration returns d as a time.Duration.
+func (d Duration) duration() time.Duration {
+	return time.Duration(d)
+}
+
+// MarshalText encodes the duration as a string such as "1m0s".
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON decodes a duration from a JSON string such as "1m".
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return &json.UnmarshalTypeError{Value: string(data), Type: durationType}
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: strconv.Quote(s), Type: durationType}
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalYAML decodes a duration from a YAML scalar such as 1m.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if node.Kind != yaml.ScalarNode || err != nil {
+		got := strconv.Quote(node.Value)
+		if node.Kind != yaml.ScalarNode {
+			got = yamlTagNames[strings.TrimPrefix(node.ShortTag(), "!!")]
+		}
+		// A TypeError lets the decoder go on and report the errors of the other fields
+		return &yaml.TypeError{Errors: []string{
+			fmt.Sprintf("line %d: expected %s, got %s", node.Line, describeType(durationType), got),
+		}}
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// describeType returns the name of a type expected by a configuration field.
+func describeType(t reflect.Type) string {
+	if t == durationType {
+		return `a duration such as "1m"`
+	}
+	return t.String()
+}
+
+// FieldError reports an invalid field of a configuration.
+type FieldError struct {
+	Field string // Path of the field, such as "limiters.api.interval"
+	Err   error  // What is wrong with it
+}
+
+// Error returns the path of the field followed by what is wrong with it.
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+// Unwrap returns the error of the field.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Load reads and validates the configuration file at path. Its format is chosen by its
+// extension: .yaml, .yml or .json.
+func Load(path string) (*Config, error) {
+	format, err := formatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// formatOf returns the format of the configuration file at path, chosen by its extension.
+func formatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".json":
+		return JSON, nil
+	default:
+		return "", fmt.Errorf("%s: unknown configuration format, expected .yaml, .yml or .json", path)
+	}
+}
+
+// Parse decodes and validates a configuration. Unknown fields are rejected, so that typos
+// are not silently ignored.
+func Parse(data []byte, format Format) (*Config, error) {
+	var c Config
+	switch format {
+	case YAML:
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, yamlError(data, err)
+		}
+	case JSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&c); err != nil {
+			return nil, jsonError(data, dec.InputOffset(), err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown configuration format %q", format)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// jsonError points a JSON decoding error to the offending field, or to its line if the
+// decoder does not report the field, as for unknown fields and invalid durations.
+func jsonError(data []byte, offset int64, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		err = fmt.Errorf("expected %s, got %s", describeType(typeErr.Type), typeErr.Value)
+		if typeErr.Field != "" {
+			return &FieldError{Field: typeErr.Field, Err: err}
+		}
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		offset = syntaxErr.Offset
+	}
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return fmt.Errorf("line %d: %w", 1+bytes.Count(data[:offset], []byte("\n")), err)
+}
+
+// yamlLineError matches the errors listed by a yaml.TypeError, such as
+// "line 4: cannot unmarshal !!str `ten` into int".
+var yamlLineError = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// yamlTypeMismatch and yamlUnknownField match the errors of yaml.v3 for a value of the
+// wrong type and for an unknown field.
+var (
+	yamlTypeMismatch = regexp.MustCompile("^cannot unmarshal !!(\\w+)(?: `.*`)? into (.+)$")
+	yamlUnknownField = regexp.MustCompile(`^field \S+ not found in type `)
+)
+
+// yamlError points the errors of a YAML decoding error to the offending fields, found by
+// their line, as jsonError does for JSON. Errors on lines without a field, and syntax
+// errors, keep their line.
+func yamlError(data []byte, err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+
+	// The document is valid YAML, or decoding would have failed with a syntax error
+	var root yaml.Node
+	if yaml.Unmarshal(data, &root) != nil {
+		return err
+	}
+	fields := make(map[int]string)
+	fieldLines(&root, "", fields)
+
+	errs := make([]error, 0, len(typeErr.Errors))
+	for _, message := range typeErr.Errors {
+		match := yamlLineError.FindStringSubmatch(message)
+		if match == nil {
+			errs = append(errs, errors.New(message))
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		message = match[2]
+		if m := yamlTypeMismatch.FindStringSubmatch(message); m != nil {
+			message = fmt.Sprintf("expected %s, got %s", m[2], yamlTagNames[m[1]])
+		} else if yamlUnknownField.MatchString(message) {
+			message = "unknown field"
+		}
+		if field, ok := fields[line]; ok {
+			errs = append(errs, &FieldError{Field: field, Err: errors.New(message)})
+		} else {
+			errs = append(errs, fmt.Errorf("line %d: %s", line, message))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// yamlTagNames names the YAML tags of mismatched values as JSON errors name their types.
+var yamlTagNames = map[string]string{
+	"str":   "string",
+	"int":   "number",
+	"float": "number",
+	"bool":  "bool",
+	"null":  "null",
+	"map":   "object",
+	"seq":   "array",
+}
+
+// fieldLines records in fields the path of the field on each line of the YAML node at
+// path, such as "limiters.api.interval" or "limiters.api.keys.normalize[1]". A line gets
+// the first field on it, so that a value given on the line of its key, such as a list in
+// place of a duration, is reported as that key.
+func fieldLines(node *yaml.Node, path string, fields map[int]string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			fieldLines(child, path, fields)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			field := key.Value
+			if path != "" {
+				field = path + "." + key.Value
+			}
+			if _, ok := fields[key.Line]; !ok {
+				fields[key.Line] = field
+			}
+			fieldLines(value, field, fields)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			field := fmt.Sprintf("%s[%d]", path, i)
+			if _, ok := fields[item.Line]; !ok {
+				fields[item.Line] = field
+			}
+			fieldLines(item, field, fields)
+		}
+	}
+}
+
+// Validate checks the configuration, returning a FieldError for each invalid field. It
+// does not check that the stores named by limiters exist, as NewRegistry may be given
+// stores of its own.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, name := range sortedKeys(c.Stores) {
+		errs = append(errs, c.Stores[name].validate("stores."+name)...)
+	}
+	for _, name := range sortedKeys(c.Limiters) {
+		errs = append(errs, c.Limiters[name].validate("limiters."+name)...)
+	}
+	return errors.Join(errs...)
+}
+
+// clone returns a copy of the configuration that later changes to c do not affect.
+func (c *Config) clone() *Config {
+	clone := &Config{
+		Stores:   make(map[string]StoreSpec, len(c.Stores)),
+		Limiters: make(map[string]LimiterSpec, len(c.Limiters)),
+	}
+	for name, spec := range c.Stores {
+		clone.Stores[name] = spec
+	}
+	for name, spec := range c.Limiters {
+		if spec.Keys != nil {
+			keys := *spec.Keys
+			keys.Normalize = append([]string(nil), keys.Normalize...)
+			spec.Keys = &keys
+		}
+		clone.Limiters[name] = spec
+	}
+	return clone
+}
+
+// validate returns the errors of the fields of a store at path.
+func (s StoreSpec) validate(path string) []error {
+	var errs []error
+	if err := validateName(path); err != nil {
+		errs = append(errs, err)
+	}
+	switch s.Type {
+	case MemoryStore:
+		if s.Address != "" || s.Username != "" || s.Password != "" || s.DB != 0 {
+			errs = append(errs, &FieldError{Field: path, Err: errors.New("memory stores take no connection settings")})
+		}
+	case RedisStore:
+		if s.Address == "" {
+			errs = append(errs, &FieldError{Field: path + ".address", Err: errors.New("is required for redis stores")})
+		}
+		if s.DB < 0 {
+			errs = append(errs, &FieldError{Field: path + ".db", Err: errors.New("cannot be negative")})
+		}
+	case "":
+		errs = append(errs, &FieldError{Field: path + ".type", Err: errors.New("is required")})
+	default:
+		errs = append(errs, &FieldError{Field: path + ".type", Err: fmt.Errorf("unknown store type %q, expected %q or %q", s.Type, MemoryStore, RedisStore)})
+	}
+	return errs
+}
+
+// param is a policy parameter of LimiterSpec.
+type param struct {
+	name  string                    // Field name in configuration files
+	value func(LimiterSpec) float64 // Value of the field; zero if unset
+}
+
+// params are the policy parameters of LimiterSpec, in the order they are checked.
+var params = []param{
+	{name: "limit", value: func(s LimiterSpec) float64 { return float64(s.Limit) }},
+	{name: "interval", value: func(s LimiterSpec) float64 { return float64(s.Interval) }},
+	{name: "capacity", value: func(s LimiterSpec) float64 { return s.Capacity }},
+	{name: "refill_rate", value: func(s LimiterSpec) float64 { return s.RefillRate }},
+	{name: "leak_rate", value: func(s LimiterSpec) float64 { return s.LeakRate }},
+	{name: "concurrency", value: func(s LimiterSpec) float64 { return float64(s.Concurrency) }},
+	{name: "burst", value: func(s LimiterSpec) float64 { return float64(s.Burst) }},
+	{name: "rate", value: func(s LimiterSpec) float64 { return s.Rate }},
+}
+
+// policyParams are the parameters each policy requires. The others must be unset.
+var policyParams = map[ratelimiter.PolicyType][]string{
+	ratelimiter.FixedWindowPolicy:          {"limit", "interval"},
+	ratelimiter.SlidingWindowPolicy:        {"limit", "interval"},
+	ratelimiter.SlidingWindowCounterPolicy: {"limit", "interval"},
+	ratelimiter.TokenBucketPolicy:          {"capacity", "refill_rate"},
+	ratelimiter.LeakyBucketPolicy:          {"capacity", "leak_rate"},
+	ratelimiter.ConcurrencyPolicy:          {"concurrency"},
+	ratelimiter.GCRAPolicy:                 {"burst", "rate"},
+}
+
+// validate returns the errors of the fields of a limiter at path.
+func (s LimiterSpec) validate(path string) []error {
+	var errs []error
+	if err := validateName(path); err != nil {
+		errs = append(errs, err)
+	}
+
+	required, ok := policyParams[s.Policy]
+	if !ok {
+		err := errors.New("is required")
+		if s.Policy != "" {
+			err = fmt.Errorf("unknown policy %q", s.Policy)
+		}
+		return append(errs, &FieldError{Field: path + ".policy", Err: err})
+	}
+	for _, p := range params {
+		field := path + "." + p.name
+		value := p.value(s)
+		switch {
+		case !contains(required, p.name):
+			if value != 0 {
+				errs = append(errs, &FieldError{Field: field, Err: fmt.Errorf("is not used by the %s policy", s.Policy)})
+			}
+		case value == 0:
+			errs = append(errs, &FieldError{Field: field, Err: fmt.Errorf("is required by the %s policy", s.Policy)})
+		case value < 0:
+			errs = append(errs, &FieldError{Field: field, Err: errors.New("must be greater than zero")})
+		}
+	}
+	if s.Policy == ratelimiter.LeakyBucketPolicy && s.Capacity != float64(int(s.Capacity)) {
+		errs = append(errs, &FieldError{Field: path + ".capacity", Err: errors.New("must be a whole number for the LeakyBucket policy")})
+	}
+
+	if s.Keys != nil {
+		errs = append(errs, s.Keys.validate(path+".keys")...)
+	}
+	return errs
+}
+
+// validate returns the errors of the fields of key rules at path.
+func (k KeySpec) validate(path string) []error {
+	var errs []error
+	for i, name := range k.Normalize {
+		if _, ok := normalizers[name]; !ok {
+			errs = append(errs, &FieldError{Field: fmt.Sprintf("%s.normalize[%d]", path, i), Err: fmt.Errorf("unknown normalization %q, expected \"trim\" or \"lower\"", name)})
+		}
+	}
+	if _, ok := validators[k.Validate]; !ok {
+		errs = append(errs, &FieldError{Field: path + ".validate", Err: fmt.Errorf("unknown validator %q, expected \"default\", \"utf8\" or \"none\"", k.Validate)})
+	}
+	if k.HashOver < 0 {
+		errs = append(errs, &FieldError{Field: path + ".hash_over", Err: errors.New("cannot be negative")})
+	}
+	return errs
+}
+
+// KeyPolicy returns the key policy the rules describe.
+func (k KeySpec) KeyPolicy() ratelimiter.KeyPolicy {
+	policy := ratelimiter.KeyPolicy{
+		Validate: validators[k.Validate],
+		HashOver: k.HashOver,
+		HashAll:  k.HashAll,
+	}
+	if len(k.Normalize) > 0 {
+		normalize := append([]string(nil), k.Normalize...)
+		policy.Normalize = func(key string) string {
+			for _, name := range normalize {
+				key = normalizers[name](key)
+			}
+			return key
+		}
+	}
+	return policy
+}
+
+// validateName checks the name ending the path of a store or limiter, which becomes part
+// of store keys.
+func validateName(path string) error {
+	name := path[strings.IndexByte(path, '.')+1:]
+	if err := ratelimiter.ValidateKey(name); err != nil {
+		return &FieldError{Field: path, Err: errors.New("names may only contain letters, digits, '.', '_' and '-'")}
+	}
+	return nil
+}
+
+// contains reports whether s is in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of m in order, so that errors are reported in a stable order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,267 @@
+// config/config_test.go
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+)
+
+const testYAML = `
+stores:
+  shared:
+    type: redis
+    address: localhost:6379
+    db: 2
+limiters:
+  api:
+    policy: TokenBucket
+    store: shared
+    capacity: 100
+    refill_rate: 10
+  login:
+    policy: FixedWindow
+    limit: 5
+    interval: 1m30s
+    keys:
+      normalize: [trim, lower]
+      validate: utf8
+      hash_over: 64
+`
+
+const testJSON = `{
+  "stores": {
+    "shared": {"type": "redis", "address": "localhost:6379", "db": 2}
+  },
+  "limiters": {
+    "api": {"policy": "TokenBucket", "store": "shared", "capacity": 100, "refill_rate": 10},
+    "login": {
+      "policy": "FixedWindow",
+      "limit": 5,
+      "interval": "1m30s",
+      "keys": {"normalize": ["trim", "lower"], "validate": "utf8", "hash_over": 64}
+    }
+  }
+}`
+
+func TestParse(t *testing.T) {
+	expected := &Config{
+		Stores: map[string]StoreSpec{
+			"shared": {Type: RedisStore, Address: "localhost:6379", DB: 2},
+		},
+		Limiters: map[string]LimiterSpec{
+			"api": {Policy: ratelimiter.TokenBucketPolicy, Store: "shared", Capacity: 100, RefillRate: 10},
+			"login": {
+				Policy:   ratelimiter.FixedWindowPolicy,
+				Limit:    5,
+				Interval: Duration(90 * time.Second),
+				Keys:     &KeySpec{Normalize: []string{"trim", "lower"}, Validate: "utf8", HashOver: 64},
+			},
+		},
+	}
+
+	for _, tt := range []struct {
+		format Format
+		data   string
+	}{
+		{format: YAML, data: testYAML},
+		{format: JSON, data: testJSON},
+	} {
+		t.Run(string(tt.format), func(t *testing.T) {
+			c, err := Parse([]byte(tt.data), tt.format)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(c, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, c)
+			}
+		})
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		data     string
+		expected []string // Substrings of the error, such as the path of the offending field
+	}{
+		{
+			name:     "Missing parameter",
+			format:   YAML,
+			data:     "limiters:\n  api:\n    policy: TokenBucket\n    capacity: 10\n",
+			expected: []string{"limiters.api.refill_rate: is required by the TokenBucket policy"},
+		},
+		{
+			name:     "Unused parameter",
+			format:   YAML,
+			data:     "limiters:\n  api:\n    policy: FixedWindow\n    limit: 10\n    interval: 1s\n    rate: 5\n",
+			expected: []string{"limiters.api.rate: is not used by the FixedWindow policy"},
+		},
+		{
+			name:     "Negative parameter",
+			format:   JSON,
+			data:     `{"limiters": {"api": {"policy": "GCRA", "burst": -1, "rate": 1}}}`,
+			expected: []string{"limiters.api.burst: must be greater than zero"},
+		},
+		{
+			name:     "Fractional leaky bucket capacity",
+			format:   YAML,
+			data:     "limiters:\n  api:\n    policy: LeakyBucket\n    capacity: 2.5\n    leak_rate: 1\n",
+			expected: []string{"limiters.api.capacity: must be a whole number"},
+		},
+		{
+			name:     "Unknown policy",
+			format:   YAML,
+			data:     "limiters:\n  api:\n    policy: Bucket\n",
+			expected: []string{`limiters.api.policy: unknown policy "Bucket"`},
+		},
+		{
+			name:     "Missing policy",
+			format:   YAML,
+			data:     "limiters:\n  api:\n    limit: 1\n",
+			expected: []string{"limiters.api.policy: is required"},
+		},
+		{
+			name:     "Invalid name",
+			format:   YAML,
+			data:     "limiters:\n  my api:\n    policy: Concurrency\n    concurrency: 1\n",
+			expected: []string{"limiters.my api: names may only contain"},
+		},
+		{
+			name:   "Invalid key rules",
+			format: YAML,
+			data:   "limiters:\n  api:\n    policy: Concurrency\n    concurrency: 1\n    keys:\n      normalize: [lower, upper]\n      validate: ascii\n",
+			expected: []string{
+				`limiters.api.keys.normalize[1]: unknown normalization "upper"`,
+				`limiters.api.keys.validate: unknown validator "ascii"`,
+			},
+		},
+		{
+			name:   "Invalid stores",
+			format: YAML,
+			data:   "stores:\n  a:\n    type: redis\n  b:\n    type: memory\n    address: localhost:6379\n  c:\n    type: etcd\n",
+			expected: []string{
+				"stores.a.address: is required for redis stores",
+				"stores.b: memory stores take no connection settings",
+				`stores.c.type: unknown store type "etcd"`,
+			},
+		},
+		{
+			name:     "YAML invalid duration",
+			format:   YAML,
+			data:     "limiters:\n  api:\n    policy: FixedWindow\n    limit: 1\n    interval: 60\n",
+			expected: []string{`limiters.api.interval: expected a duration such as "1m", got "60"`},
+		},
+		{
+			name:     "JSON invalid duration",
+			format:   JSON,
+			data:     "{\"limiters\": {\"api\": {\n  \"policy\": \"FixedWindow\",\n  \"limit\": 1,\n  \"interval\": \"1x\"}}}",
+			expected: []string{`line 4: expected a duration such as "1m", got "1x"`},
+		},
+		{
+			name:     "JSON wrong type",
+			format:   JSON,
+			data:     `{"limiters": {"api": {"policy": "FixedWindow", "limit": "ten", "interval": "1s"}}}`,
+			expected: []string{"limiters.api.limit: expected int, got string"},
+		},
+		{
+			name:     "YAML unknown field",
+			format:   YAML,
+			data:     "limiters:\n  api:\n    policy: FixedWindow\n    limt: 1\n",
+			expected: []string{"limiters.api.limt: unknown field"},
+		},
+		{
+			name:     "YAML wrong type",
+			format:   YAML,
+			data:     "limiters:\n  api:\n    policy: FixedWindow\n    limit: ten\n    interval: 1s\n",
+			expected: []string{"limiters.api.limit: expected int, got string"},
+		},
+		{
+			name:   "YAML several decoding errors",
+			format: YAML,
+			data:   "limiters:\n  api:\n    policy: FixedWindow\n    limit: [1]\n    interval: {a: 1}\n    keys:\n      normalize:\n        - lower\n        - [upper]\n",
+			expected: []string{
+				"limiters.api.limit: expected int, got array",
+				`limiters.api.interval: expected a duration such as "1m", got object`,
+				"limiters.api.keys.normalize[1]: expected string, got array",
+			},
+		},
+		{
+			name:     "JSON unknown field",
+			format:   JSON,
+			data:     "{\"limiters\": {\n  \"api\": {\n    \"limt\": 1}}}",
+			expected: []string{"line 3", "limt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), tt.format)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("Expected the error to contain %q, got %q", expected, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParse_FieldError(t *testing.T) {
+	_, err := Parse([]byte("limiters:\n  api:\n    policy: Concurrency\n"), YAML)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Fatalf("Expected a FieldError, got %v", err)
+	}
+	if fieldErr.Field != "limiters.api.concurrency" {
+		t.Errorf("Expected the error to point to limiters.api.concurrency, got %q", fieldErr.Field)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range map[string]string{"limits.yaml": testYAML, "limits.json": testJSON, "limits.toml": ""} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"limits.yaml", "limits.json"} {
+		c, err := Load(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if len(c.Limiters) != 2 {
+			t.Errorf("%s: expected 2 limiters, got %d", name, len(c.Limiters))
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "limits.toml")); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestKeySpec_KeyPolicy(t *testing.T) {
+	policy := KeySpec{Normalize: []string{"trim", "lower"}, Validate: "utf8", HashOver: 64}.KeyPolicy()
+
+	key, err := policy.StoreKey("  Alice@Example.com ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if key != "alice@example.com" {
+		t.Errorf("Expected %q, got %q", "alice@example.com", key)
+	}
+	if _, err := (KeySpec{}).KeyPolicy().StoreKey("alice@example.com"); !errors.Is(err, ratelimiter.ErrInvalidKey) {
+		t.Errorf("Expected the default validator to reject the key, got %v", err)
+	}
+}
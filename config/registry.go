@@ -0,0 +1,612 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// ErrUnknownLimiter is returned by the limiters of a Registry whose name is no longer in
+// its configuration.
+var ErrUnknownLimiter = errors.New("no limiter of that name in the configuration")
+
+// Registry holds the limiters of a configuration, by name. Its configuration can be
+// replaced while it is in use, with Update, Reload or Watch.
+//
+// An update swaps every limiter at once: each call to a limiter of the registry runs
+// against either the old or the new configuration, never a mix of both. Limiters whose
+// description is unchanged are kept as they are, and limiters whose parameters change keep
+// the state of their keys as long as their policy, store and namespace are unchanged. The
+// limiters and stores an update replaces are closed once the calls still using them
+// return.
+type Registry struct {
+	current   atomic.Pointer[generation] // Configuration in use
+	mu        sync.Mutex                 // Serializes updates
+	options   registryOptions            // Optional settings
+	path      string                     // File the configuration was loaded from, if any
+	watchStop chan struct{}              // Closed to stop Watch; nil if not watching
+}
+
+// generation is a configuration of a Registry and the limiters and stores created for it.
+type generation struct {
+	config   *Config                            // Configuration the limiters were created from
+	limiters map[string]ratelimiter.RateLimiter // Limiters, by name
+	storeOf  map[string]store.Store             // Store of each limiter, by limiter name
+	stores   map[string]*ownedStore             // Stores created by the registry, by name
+	closed   bool                               // Set on the generation installed by Close
+
+	inflight  atomic.Int64  // Calls using the generation
+	retired   atomic.Bool   // Set once the generation is replaced
+	cleanup   func() error  // Closes what the next generation does not reuse; set before retired
+	cleanOnce sync.Once     // Guards the cleanup
+	cleanErr  error         // Error of the cleanup
+	cleaned   chan struct{} // Closed once the cleanup is done
+}
+
+// ownedStore is a store created by a Registry.
+type ownedStore struct {
+	spec   StoreSpec     // Description the store was created from
+	store  store.Store   // The store
+	client *redis.Client // Client of a Redis store; nil for memory stores
+}
+
+// RegistryOption configures optional behavior of a Registry.
+type RegistryOption func(*registryOptions)
+
+// registryOptions holds the optional settings of a Registry.
+type registryOptions struct {
+	stores map[string]store.Store // Stores provided by the caller, by name
+	clock  clock.Clock            // Source of time of the limiters; the real clock if nil
+}
+
+// WithStore makes limiters naming the store use s, in place of any store of that name in
+// the configuration. The registry does not close s.
+func WithStore(name string, s store.Store) RegistryOption {
+	return func(o *registryOptions) {
+		o.stores[name] = s
+	}
+}
+
+// WithClock makes the limiters read the time from c instead of the real clock. Watch
+// checks the configuration file on c as well.
+func WithClock(c clock.Clock) RegistryOption {
+	return func(o *registryOptions) {
+		o.clock = c
+	}
+}
+
+// getClock returns the clock of the registry.
+func (o *registryOptions) getClock() clock.Clock {
+	if o.clock == nil {
+		return clock.New()
+	}
+	return o.clock
+}
+
+// LoadRegistry loads the configuration file at path and creates its limiters. The
+// registry can then reload the file with Reload or Watch.
+func LoadRegistry(path string, opts ...RegistryOption) (*Registry, error) {
+	c, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewRegistry(c, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	r.path = path
+	return r, nil
+}
+
+// NewRegistry validates the configuration and creates its limiters, along with the stores
+// they use. Limiters that name no store share an in-memory store.
+func NewRegistry(c *Config, opts ...RegistryOption) (*Registry, error) {
+	r := &Registry{options: registryOptions{stores: make(map[string]store.Store)}}
+	for _, opt := range opts {
+		opt(&r.options)
+	}
+
+	g, err := r.build(c, &generation{})
+	if err != nil {
+		return nil, err
+	}
+	r.current.Store(g)
+	return r, nil
+}
+
+// Update validates the configuration and swaps the limiters of the registry for those it
+// describes. If the configuration is invalid, the registry keeps its limiters.
+func (r *Registry) Update(c *Config) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.current.Load()
+	if old.closed {
+		return ratelimiter.ErrClosed
+	}
+	g, err := r.build(c, old)
+	if err != nil {
+		return err
+	}
+	r.swap(old, g)
+	return nil
+}
+
+// Reload reads the configuration file the registry was loaded from and applies it as
+// Update does.
+func (r *Registry) Reload() error {
+	if r.path == "" {
+		return errors.New("registry was not loaded from a file")
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	return r.apply(data)
+}
+
+// Watch reloads the configuration file the registry was loaded from whenever its content
+// changes, checking it every interval until the registry is closed. Errors are passed to
+// onError, if not nil: those applying the file once per content, and those reading it once
+// until it can be read again. The registry keeps its limiters in the meantime.
+func (r *Registry) Watch(interval time.Duration, onError func(error)) error {
+	if interval <= 0 {
+		return errors.New("interval must be greater than zero")
+	}
+	if r.path == "" {
+		return errors.New("registry was not loaded from a file")
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current.Load().closed {
+		return ratelimiter.ErrClosed
+	}
+	if r.watchStop != nil {
+		return errors.New("registry is already watching its configuration file")
+	}
+	r.watchStop = make(chan struct{})
+
+	ticker := r.options.getClock().NewTicker(interval)
+	go r.watch(ticker, r.watchStop, data, onError)
+	return nil
+}
+
+// watch reloads the configuration file on every tick if its content differs from last,
+// until stop is closed.
+func (r *Registry) watch(ticker clock.Ticker, stop chan struct{}, last []byte, onError func(error)) {
+	defer ticker.Stop()
+	unreadable := false // Whether the last read failed, so that its error was reported
+	for {
+		select {
+		case <-ticker.C():
+			data, err := os.ReadFile(r.path)
+			if err != nil {
+				if !unreadable && onError != nil {
+					onError(err)
+				}
+				unreadable = true
+				continue
+			}
+			unreadable = false
+			if bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+			if err := r.apply(data); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// apply parses the content of the configuration file and applies it as Update does.
+func (r *Registry) apply(data []byte) error {
+	format, err := formatOf(r.path)
+	if err != nil {
+		return err
+	}
+	c, err := Parse(data, format)
+	if err == nil {
+		err = r.Update(c)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", r.path, err)
+	}
+	return nil
+}
+
+// build creates the generation for the configuration c, reusing the limiters and stores of
+// old that c describes the same way.
+func (r *Registry) build(c *Config, old *generation) (*generation, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	c = c.clone()
+	g := &generation{
+		config:   c,
+		limiters: make(map[string]ratelimiter.RateLimiter, len(c.Limiters)),
+		storeOf:  make(map[string]store.Store, len(c.Limiters)),
+		stores:   make(map[string]*ownedStore),
+		cleaned:  make(chan struct{}),
+	}
+
+	var errs []error
+	for _, name := range sortedKeys(c.Limiters) {
+		spec := c.Limiters[name]
+		path := "limiters." + name
+		storeName := spec.Store
+		if storeName == "" {
+			storeName = DefaultStore
+		}
+
+		s, ok := r.options.stores[storeName]
+		if !ok {
+			storeSpec, defined := c.Stores[storeName]
+			if !defined && storeName != DefaultStore {
+				errs = append(errs, &FieldError{Field: path + ".store", Err: fmt.Errorf("undefined store %q", storeName)})
+				continue
+			}
+			if !defined {
+				storeSpec = StoreSpec{Type: MemoryStore}
+			}
+			s = g.store(storeName, storeSpec, old, r.options.clock)
+		}
+		g.storeOf[name] = s
+
+		if limiter, ok := old.limiters[name]; ok && old.storeOf[name] == s && reflect.DeepEqual(old.config.Limiters[name], spec) {
+			g.limiters[name] = limiter
+			continue
+		}
+		limiter, err := ratelimiter.NewRateLimiter(spec.limiterConfig(name, s, r.options.clock))
+		if err != nil {
+			errs = append(errs, &FieldError{Field: path, Err: err})
+			continue
+		}
+		g.limiters[name] = limiter
+	}
+
+	if len(errs) > 0 {
+		g.closeUnused(old)
+		return nil, errors.Join(errs...)
+	}
+	return g, nil
+}
+
+// store returns the store of the given name and description, reusing that of old if it
+// has the same description.
+func (g *generation) store(name string, spec StoreSpec, old *generation, c clock.Clock) store.Store {
+	if owned, ok := g.stores[name]; ok {
+		return owned.store
+	}
+	if owned, ok := old.stores[name]; ok && owned.spec == spec {
+		g.stores[name] = owned
+		return owned.store
+	}
+
+	owned := &ownedStore{spec: spec}
+	switch spec.Type {
+	case RedisStore:
+		owned.client = redis.NewClient(&redis.Options{
+			Addr:     spec.Address,
+			Username: spec.Username,
+			Password: spec.Password,
+			DB:       spec.DB,
+		})
+		owned.store = store.NewRedisStore(owned.client)
+	default:
+		owned.store = store.NewMemoryStore(store.WithClock(c))
+	}
+	g.stores[name] = owned
+	return owned.store
+}
+
+// limiterConfig returns the configuration of the limiter the spec describes.
+func (s LimiterSpec) limiterConfig(name string, st store.Store, c clock.Clock) ratelimiter.LimiterConfig {
+	config := ratelimiter.LimiterConfig{
+		Policy:      s.Policy,
+		Store:       st,
+		Limit:       s.Limit,
+		Interval:    s.Interval.duration(),
+		Capacity:    s.Capacity,
+		RefillRate:  s.RefillRate,
+		LeakRate:    s.LeakRate,
+		Concurrency: s.Concurrency,
+		Burst:       s.Burst,
+		Rate:        s.Rate,
+		Clock:       c,
+		Namespace:   s.Namespace,
+	}
+	if config.Namespace == "" {
+		config.Namespace = name + ":" + string(s.Policy)
+	}
+	if s.Keys != nil {
+		policy := s.Keys.KeyPolicy()
+		config.KeyPolicy = &policy
+	}
+	return config
+}
+
+// closeUnused closes the limiters and stores of g that next does not use.
+func (g *generation) closeUnused(next *generation) error {
+	used := make(map[interface{}]bool, len(next.limiters)+len(next.stores))
+	for _, limiter := range next.limiters {
+		used[limiter] = true
+	}
+	for _, owned := range next.stores {
+		used[owned] = true
+	}
+
+	var errs []error
+	for _, limiter := range g.limiters {
+		if !used[limiter] {
+			errs = append(errs, limiter.Close())
+		}
+	}
+	for _, owned := range g.stores {
+		if used[owned] {
+			continue
+		}
+		errs = append(errs, owned.store.Close())
+		if owned.client != nil {
+			errs = append(errs, owned.client.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// swap makes next the generation in use, and closes what it does not reuse from old once
+// the calls using old return. The caller holds r.mu.
+func (r *Registry) swap(old, next *generation) {
+	r.current.Store(next)
+	old.retire(func() error { return old.closeUnused(next) })
+}
+
+// acquire returns the generation in use, which stays usable until release is called.
+func (r *Registry) acquire() *generation {
+	for {
+		g := r.current.Load()
+		g.inflight.Add(1)
+		if r.current.Load() == g {
+			return g
+		}
+		// Swapped before the call was counted, so the generation may be cleaned up already
+		g.release()
+	}
+}
+
+// release ends a call using the generation, cleaning it up if it was the last call of a
+// retired generation.
+func (g *generation) release() {
+	if g.inflight.Add(-1) == 0 && g.retired.Load() {
+		g.clean()
+	}
+}
+
+// retire marks the generation as replaced, running cleanup once no call uses it.
+func (g *generation) retire(cleanup func() error) {
+	g.cleanup = cleanup
+	g.retired.Store(true)
+	if g.inflight.Load() == 0 {
+		g.clean()
+	}
+}
+
+// clean runs the cleanup of the generation unless it has run before.
+func (g *generation) clean() {
+	g.cleanOnce.Do(func() {
+		g.cleanErr = g.cleanup()
+		close(g.cleaned)
+	})
+}
+
+// Get returns the limiter of the given name, and whether the configuration has one. The
+// limiter follows updates of the registry: each call uses the limiter of that name in the
+// configuration at the time, or fails with ErrUnknownLimiter if there is none.
+func (r *Registry) Get(name string) (ratelimiter.RateLimiter, bool) {
+	_, ok := r.current.Load().limiters[name]
+	return &Limiter{registry: r, name: name}, ok
+}
+
+// Spec returns the description of the limiter of the given name, and whether the
+// configuration has one.
+func (r *Registry) Spec(name string) (LimiterSpec, bool) {
+	g := r.current.Load()
+	if g.closed {
+		return LimiterSpec{}, false
+	}
+	spec, ok := g.config.Limiters[name]
+	return spec, ok
+}
+
+// Names returns the names of the limiters, in order.
+func (r *Registry) Names() []string {
+	return sortedKeys(r.current.Load().limiters)
+}
+
+// Close stops Watch, waits for the calls using the limiters to return, then closes the
+// limiters and the stores and Redis clients the registry created. It does not close stores
+// given with WithStore. Later calls to the limiters fail with ratelimiter.ErrClosed.
+// Closing a closed registry does nothing.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	old := r.current.Load()
+	if old.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	if r.watchStop != nil {
+		close(r.watchStop)
+	}
+	r.swap(old, &generation{closed: true})
+	r.mu.Unlock()
+
+	<-old.cleaned
+	return old.cleanErr
+}
+
+// Limiter is a limiter of a Registry, which follows updates of its configuration. It
+// implements ratelimiter.RateLimiter, ratelimiter.Reserver and ratelimiter.Inspector, so it
+// can be a child of a CompositeLimiter or be waited on by an httplimit.Transport.
+type Limiter struct {
+	registry *Registry
+	name     string
+}
+
+// Name returns the name of the limiter in the configuration.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Policy returns the policy of the limiter in the configuration in use, or an empty policy
+// if the configuration has no limiter of that name.
+func (l *Limiter) Policy() ratelimiter.PolicyType {
+	spec, _ := l.registry.Spec(l.name)
+	return spec.Policy
+}
+
+// do calls fn with the limiter of the configuration in use, which is not closed before fn
+// returns.
+func (l *Limiter) do(fn func(ratelimiter.RateLimiter) error) error {
+	g := l.registry.acquire()
+	defer g.release()
+	if g.closed {
+		return ratelimiter.ErrClosed
+	}
+	limiter, ok := g.limiters[l.name]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownLimiter, l.name)
+	}
+	return fn(limiter)
+}
+
+// Allow checks if a request associated with the given key is allowed to proceed.
+func (l *Limiter) Allow(key string) (allowed bool, err error) {
+	err = l.do(func(limiter ratelimiter.RateLimiter) error {
+		allowed, err = limiter.Allow(key)
+		return err
+	})
+	return allowed, err
+}
+
+// AllowN checks if a request of cost n associated with the given key is allowed to proceed.
+func (l *Limiter) AllowN(key string, n int64) (allowed bool, err error) {
+	err = l.do(func(limiter ratelimiter.RateLimiter) error {
+		allowed, err = limiter.AllowN(key, n)
+		return err
+	})
+	return allowed, err
+}
+
+// AllowContext is like Allow but passes the context on to the store.
+func (l *Limiter) AllowContext(ctx context.Context, key string) (allowed bool, err error) {
+	err = l.do(func(limiter ratelimiter.RateLimiter) error {
+		allowed, err = limiter.AllowContext(ctx, key)
+		return err
+	})
+	return allowed, err
+}
+
+// Decide checks if a request associated with the given key is allowed to proceed and
+// reports the remaining quota.
+func (l *Limiter) Decide(key string) (result *ratelimiter.Result, err error) {
+	err = l.do(func(limiter ratelimiter.RateLimiter) error {
+		result, err = limiter.Decide(key)
+		return err
+	})
+	return result, err
+}
+
+// DecideN is like Decide for a request of cost n.
+func (l *Limiter) DecideN(key string, n int64) (result *ratelimiter.Result, err error) {
+	err = l.do(func(limiter ratelimiter.RateLimiter) error {
+		result, err = limiter.DecideN(key, n)
+		return err
+	})
+	return result, err
+}
+
+// DecideNContext is like DecideN but passes the context on to the store.
+func (l *Limiter) DecideNContext(ctx context.Context, key string, n int64) (result *ratelimiter.Result, err error) {
+	err = l.do(func(limiter ratelimiter.RateLimiter) error {
+		result, err = limiter.DecideNContext(ctx, key, n)
+		return err
+	})
+	return result, err
+}
+
+// ReserveN reserves capacity for a request of cost n associated with the given key from
+// the limiter of the configuration in use.
+func (l *Limiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (reservation *ratelimiter.Reservation, err error) {
+	err = l.do(func(limiter ratelimiter.RateLimiter) error {
+		reservation, err = ratelimiter.ReserveN(ctx, limiter, key, n, maxDelay)
+		return err
+	})
+	return reservation, err
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until the limiter of the configuration in use allows a request of cost n
+// associated with the given key, or the context is done. That limiter is not closed by an
+// update while the request waits.
+func (l *Limiter) WaitN(ctx context.Context, key string, n int64) error {
+	return l.do(func(limiter ratelimiter.RateLimiter) error {
+		return ratelimiter.WaitN(ctx, limiter, key, n)
+	})
+}
+
+// Release releases a slot of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) Release(key string) error {
+	return l.ReleaseN(key, 1)
+}
+
+// ReleaseN releases n slots of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) ReleaseN(key string, n int64) error {
+	return l.do(func(limiter ratelimiter.RateLimiter) error {
+		return ratelimiter.ReleaseN(limiter, key, n)
+	})
+}
+
+// Inspect returns the state of key in the limiter of the configuration in use.
+func (l *Limiter) Inspect(ctx context.Context, key string) (state *ratelimiter.KeyState, err error) {
+	err = l.do(func(limiter ratelimiter.RateLimiter) error {
+		state, err = ratelimiter.Inspect(ctx, limiter, key)
+		return err
+	})
+	return state, err
+}
+
+// Reset deletes the state of key in the limiter of the configuration in use.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return l.do(func(limiter ratelimiter.RateLimiter) error {
+		return ratelimiter.Reset(ctx, limiter, key)
+	})
+}
+
+// Close does nothing: the limiter belongs to the registry, which closes it.
+func (l *Limiter) Close() error {
+	return nil
+}
@@ -0,0 +1,408 @@
+// config/registry_test.go
+
+package config
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/httplimit"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+func TestNewRegistry(t *testing.T) {
+	c, err := Parse([]byte(testYAML), YAML)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The shared Redis store is replaced by a memory store
+	registry, err := NewRegistry(c, WithStore("shared", store.NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	if names := registry.Names(); len(names) != 2 || names[0] != "api" || names[1] != "login" {
+		t.Errorf("Expected limiters api and login, got %v", names)
+	}
+	if _, ok := registry.Get("missing"); ok {
+		t.Error("Expected no limiter named missing")
+	}
+
+	login, ok := registry.Get("login")
+	if !ok {
+		t.Fatal("Expected a limiter named login")
+	}
+	for i := 0; i < 5; i++ {
+		if allowed, err := login.Allow("Alice@Example.com"); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+	// Keys are normalized as configured, so they share the quota
+	if allowed, err := login.Allow(" alice@example.com"); err != nil || allowed {
+		t.Errorf("Expected the normalized key to be rejected, got %v, %v", allowed, err)
+	}
+
+	spec, _ := registry.Spec("login")
+	if spec.Limit != 5 {
+		t.Errorf("Expected the spec of login, got %+v", spec)
+	}
+}
+
+// TestNewRegistry_Namespaces tests that limiters with the same parameters on the same store
+// keep separate state.
+func TestNewRegistry_Namespaces(t *testing.T) {
+	spec := LimiterSpec{Policy: ratelimiter.FixedWindowPolicy, Limit: 1, Interval: Duration(time.Hour)}
+	registry, err := NewRegistry(&Config{Limiters: map[string]LimiterSpec{"login": spec, "signup": spec}})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+
+	for _, name := range []string{"login", "signup"} {
+		limiter, _ := registry.Get(name)
+		if allowed, err := limiter.Allow("user1"); err != nil || !allowed {
+			t.Errorf("%s: expected the request to be allowed, got %v, %v", name, allowed, err)
+		}
+	}
+}
+
+func TestNewRegistry_Clock(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	registry, err := NewRegistry(&Config{Limiters: map[string]LimiterSpec{
+		"api": {Policy: ratelimiter.TokenBucketPolicy, Capacity: 1, RefillRate: 1},
+	}}, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+	limiter, _ := registry.Get("api")
+
+	limiter.Allow("user1")
+	if allowed, _ := limiter.Allow("user1"); allowed {
+		t.Fatal("Expected the bucket to be empty")
+	}
+	fake.Advance(time.Second)
+	if allowed, _ := limiter.Allow("user1"); !allowed {
+		t.Error("Expected the bucket to refill on the fake clock")
+	}
+}
+
+// TestLimiter_Reservations tests that a limiter of a registry can be a composite child and
+// be waited on by a transport.
+func TestLimiter_Reservations(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	registry, err := NewRegistry(&Config{Limiters: map[string]LimiterSpec{
+		"api": {Policy: ratelimiter.FixedWindowPolicy, Limit: 2, Interval: Duration(time.Minute)},
+	}}, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+	limiter, _ := registry.Get("api")
+
+	composite, err := ratelimiter.NewCompositeLimiter([]ratelimiter.CompositeChild{{Name: "api", Limiter: limiter}})
+	if err != nil {
+		t.Fatalf("Expected the registry limiter to be a composite child, got %v", err)
+	}
+	if allowed, err := composite.Allow("example.com"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	transport, err := httplimit.NewTransport(nil, limiter, httplimit.WithWait(true), httplimit.WithTransportClock(fake),
+		httplimit.WithTransportKeyFunc(func(*http.Request) (string, error) { return "example.com", nil }))
+	if err != nil {
+		t.Fatalf("Expected the registry limiter to be waited on, got %v", err)
+	}
+	client := &http.Client{Transport: transport}
+
+	for i, expected := range []error{nil, httplimit.ErrRateLimited} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		cancel()
+		if resp != nil {
+			resp.Body.Close()
+		}
+		if !errors.Is(err, expected) {
+			t.Errorf("Request %d: expected %v, got %v", i+1, expected, err)
+		}
+	}
+}
+
+func TestNewRegistry_Errors(t *testing.T) {
+	c := &Config{Limiters: map[string]LimiterSpec{
+		"api":   {Policy: ratelimiter.ConcurrencyPolicy, Concurrency: 1, Store: "shared"},
+		"login": {Policy: ratelimiter.ConcurrencyPolicy},
+	}}
+	if _, err := NewRegistry(c); err == nil || !strings.Contains(err.Error(), "limiters.login.concurrency") {
+		t.Errorf("Expected a validation error, got %v", err)
+	}
+
+	delete(c.Limiters, "login")
+	_, err := NewRegistry(c)
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "limiters.api.store" {
+		t.Errorf("Expected an error pointing to limiters.api.store, got %v", err)
+	}
+}
+
+func TestRegistry_Close(t *testing.T) {
+	registry, err := NewRegistry(&Config{Limiters: map[string]LimiterSpec{
+		"api": {Policy: ratelimiter.ConcurrencyPolicy, Concurrency: 1},
+	}})
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	limiter, _ := registry.Get("api")
+
+	if err := registry.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := limiter.Allow("user1"); !errors.Is(err, ratelimiter.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if err := registry.Close(); err != nil {
+		t.Errorf("Expected closing twice to do nothing, got %v", err)
+	}
+}
+
+// tokenBucket returns a config with a token bucket named api of the given capacity, refilled
+// once an hour.
+func tokenBucket(capacity float64) *Config {
+	return &Config{Limiters: map[string]LimiterSpec{
+		"api": {Policy: ratelimiter.TokenBucketPolicy, Capacity: capacity, RefillRate: 1.0 / 3600},
+	}}
+}
+
+func TestRegistry_Update(t *testing.T) {
+	registry, err := NewRegistry(tokenBucket(2))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+	// The limiter is obtained once and follows the updates
+	limiter, _ := registry.Get("api")
+
+	for i := 0; i < 2; i++ {
+		if allowed, err := limiter.Allow("user1"); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+
+	// A larger capacity keeps the state of the bucket, which is empty
+	if err := registry.Update(tokenBucket(3)); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if spec, _ := registry.Spec("api"); spec.Capacity != 3 {
+		t.Errorf("Expected capacity 3 after the update, got %v", spec.Capacity)
+	}
+	if allowed, err := limiter.Allow("user1"); err != nil || allowed {
+		t.Errorf("Expected the bucket state to be kept, got %v, %v", allowed, err)
+	}
+
+	// A new policy starts afresh
+	err = registry.Update(&Config{Limiters: map[string]LimiterSpec{
+		"api": {Policy: ratelimiter.FixedWindowPolicy, Limit: 1, Interval: Duration(time.Hour)},
+	}})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if allowed, err := limiter.Allow("user1"); err != nil || !allowed {
+		t.Errorf("Expected the new policy to start afresh, got %v, %v", allowed, err)
+	}
+}
+
+func TestRegistry_UpdateReuse(t *testing.T) {
+	c := &Config{Limiters: map[string]LimiterSpec{
+		"api":   {Policy: ratelimiter.ConcurrencyPolicy, Concurrency: 1},
+		"login": {Policy: ratelimiter.FixedWindowPolicy, Limit: 1, Interval: Duration(time.Hour)},
+	}}
+	registry, err := NewRegistry(c)
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+	before := registry.current.Load()
+
+	// Changing the config afterwards does not change the registry
+	delete(c.Limiters, "login")
+	if names := registry.Names(); len(names) != 2 {
+		t.Fatalf("Expected 2 limiters, got %v", names)
+	}
+
+	if err := registry.Update(c); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	after := registry.current.Load()
+	if after.limiters["api"] != before.limiters["api"] {
+		t.Error("Expected the unchanged limiter to be reused")
+	}
+	if after.stores[DefaultStore] != before.stores[DefaultStore] {
+		t.Error("Expected the unchanged store to be reused")
+	}
+
+	// The removed limiter is closed, and its name is unknown
+	if _, err := before.limiters["login"].Allow("user1"); !errors.Is(err, ratelimiter.ErrClosed) {
+		t.Errorf("Expected the removed limiter to be closed, got %v", err)
+	}
+	login, ok := registry.Get("login")
+	if ok {
+		t.Error("Expected no limiter named login")
+	}
+	if _, err := login.Allow("user1"); !errors.Is(err, ErrUnknownLimiter) {
+		t.Errorf("Expected ErrUnknownLimiter, got %v", err)
+	}
+}
+
+func TestRegistry_UpdateInvalid(t *testing.T) {
+	registry, err := NewRegistry(tokenBucket(1))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+	limiter, _ := registry.Get("api")
+
+	if err := registry.Update(tokenBucket(-1)); err == nil || !strings.Contains(err.Error(), "limiters.api.capacity") {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	if allowed, err := limiter.Allow("user1"); err != nil || !allowed {
+		t.Errorf("Expected the limiter to be kept, got %v, %v", allowed, err)
+	}
+}
+
+// TestRegistry_UpdateInFlight tests that calls running during updates never see a closed
+// limiter.
+func TestRegistry_UpdateInFlight(t *testing.T) {
+	registry, err := NewRegistry(tokenBucket(1000))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	defer registry.Close()
+	limiter, _ := registry.Get("api")
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if _, err := limiter.Allow("user1"); err != nil {
+					t.Errorf("Unexpected error during updates: %v", err)
+					return
+				}
+			}
+		}()
+	}
+
+	// Alternate between policies, so that every update replaces the limiter
+	for i := 0; i < 200; i++ {
+		c := tokenBucket(1000)
+		if i%2 == 0 {
+			c.Limiters["api"] = LimiterSpec{Policy: ratelimiter.GCRAPolicy, Burst: 1000, Rate: 1}
+		}
+		if err := registry.Update(c); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestRegistry_Watch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("Failed to write the configuration: %v", err)
+		}
+	}
+	write("limiters:\n  api:\n    policy: Concurrency\n    concurrency: 1\n")
+
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	registry, err := LoadRegistry(path, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to load registry: %v", err)
+	}
+	defer registry.Close()
+	errs := make(chan error, 10)
+	if err := registry.Watch(time.Second, func(err error) { errs <- err }); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	fake.BlockUntil(1)
+
+	// tick advances the clock past a check of the file and waits for it to be applied
+	tick := func(applied func() bool) {
+		t.Helper()
+		fake.Advance(time.Second)
+		deadline := time.Now().Add(5 * time.Second)
+		for !applied() {
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for the configuration file to be checked")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	write("limiters:\n  api:\n    policy: Concurrency\n    concurrency: 5\n")
+	tick(func() bool {
+		spec, _ := registry.Spec("api")
+		return spec.Concurrency == 5
+	})
+
+	// An invalid file is reported, and leaves the limiters in place
+	write("limiters:\n  api:\n    policy: Concurrency\n")
+	var reported error
+	tick(func() bool {
+		select {
+		case reported = <-errs:
+			return true
+		default:
+			return false
+		}
+	})
+	if !strings.Contains(reported.Error(), "limiters.api.concurrency") {
+		t.Errorf("Expected the error to point to limiters.api.concurrency, got %v", reported)
+	}
+	if spec, _ := registry.Spec("api"); spec.Concurrency != 5 {
+		t.Errorf("Expected the limiters to be kept, got %+v", spec)
+	}
+
+	if err := registry.Watch(time.Second, nil); err == nil {
+		t.Error("Expected an error watching twice")
+	}
+}
+
+func TestRegistry_UpdateClosed(t *testing.T) {
+	registry, err := NewRegistry(tokenBucket(1))
+	if err != nil {
+		t.Fatalf("Failed to create registry: %v", err)
+	}
+	if err := registry.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := registry.Update(tokenBucket(2)); !errors.Is(err, ratelimiter.ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if names := registry.Names(); len(names) != 0 {
+		t.Errorf("Expected no limiters after Close, got %v", names)
+	}
+}
@@ -0,0 +1,264 @@
+// Package grpclimit provides gRPC server interceptors backed by ThrottleX rate limiters.
+package grpclimit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/neelp03/throttlex/httplimit"
+	"github.com/neelp03/throttlex/ratelimiter"
+)
+
+// KeyFunc returns the rate limiting key of a call to the given method, in the form
+// "/package.Service/Method". An error with a gRPC status is returned to the client as is;
+// other errors are returned as codes.Internal.
+type KeyFunc func(ctx context.Context, fullMethod string) (string, error)
+
+// FailurePolicy decides what happens to a call when the store of the limiter fails, for
+// example because it is unreachable. Errors of the limiter itself do not depend on it:
+// keys and costs the limiter rejects fail the call with codes.InvalidArgument, and a closed
+// limiter with codes.Unavailable, so that clients cannot pass the limit with keys the
+// limiter rejects.
+type FailurePolicy int
+
+const (
+	// FailClosed fails the call with codes.Unavailable.
+	FailClosed FailurePolicy = iota
+
+	// FailOpen lets the call through as if the limiter had allowed it.
+	FailOpen
+)
+
+// Interceptor rate limits gRPC calls with a RateLimiter, charging each call one unit under
+// the key returned by its KeyFunc. It can also limit the messages clients send on streams.
+// If the limiter has a ReleaseN method, as concurrency limiters do, the unit of each
+// accepted call is released once its handler returns.
+type Interceptor struct {
+	limiter        ratelimiter.RateLimiter // Limiter deciding whether calls are accepted
+	messageLimiter ratelimiter.RateLimiter // Limiter for messages received on streams; nil if none
+	keyFunc        KeyFunc                 // Extracts the key of a call
+	failurePolicy  FailurePolicy           // What to do with calls when the limiter fails
+}
+
+// Option configures optional behavior of an Interceptor.
+type Option func(*Interceptor)
+
+// WithKeyFunc sets how the key of a call is extracted. The default is PeerKey.
+func WithKeyFunc(f KeyFunc) Option {
+	return func(i *Interceptor) {
+		i.keyFunc = f
+	}
+}
+
+// WithFailurePolicy sets what happens to calls when the limiter fails. The default is
+// FailClosed.
+func WithFailurePolicy(p FailurePolicy) Option {
+	return func(i *Interceptor) {
+		i.failurePolicy = p
+	}
+}
+
+// WithMessageLimiter makes the stream interceptor also charge every message a client sends
+// on a stream to limiter, under the key of the stream. A message over the limit fails
+// RecvMsg with codes.ResourceExhausted, which ends the stream when the handler returns the
+// error. Without it, only the creation of streams is limited.
+func WithMessageLimiter(limiter ratelimiter.RateLimiter) Option {
+	return func(i *Interceptor) {
+		i.messageLimiter = limiter
+	}
+}
+
+// releaser is implemented by limiters holding slots for calls until they are released,
+// such as ratelimiter.ConcurrencyLimiter and composites with concurrency children.
+type releaser interface {
+	ReleaseN(key string, n int64) error
+}
+
+// New creates an Interceptor rate limiting calls with the given limiter.
+func New(limiter ratelimiter.RateLimiter, opts ...Option) (*Interceptor, error) {
+	if limiter == nil {
+		return nil, errors.New("limiter cannot be nil")
+	}
+
+	i := &Interceptor{
+		limiter: limiter,
+		keyFunc: PeerKey,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i, nil
+}
+
+// Unary returns a unary server interceptor that fails calls over the limit with
+// codes.ResourceExhausted, carrying a RetryInfo detail when the limiter knows when to retry.
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		key, err := i.key(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		if err := i.check(ctx, i.limiter, key); err != nil {
+			return nil, err
+		}
+		defer i.release(key)
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns a stream server interceptor that fails streams over the limit with
+// codes.ResourceExhausted, like Unary, and limits the messages received on accepted
+// streams if a message limiter is set.
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		key, err := i.key(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		if err := i.check(ss.Context(), i.limiter, key); err != nil {
+			return err
+		}
+		defer i.release(key)
+		if i.messageLimiter != nil {
+			ss = &limitedStream{ServerStream: ss, interceptor: i, key: key}
+		}
+		return handler(srv, ss)
+	}
+}
+
+// key extracts the key of a call, giving errors without a status codes.Internal.
+func (i *Interceptor) key(ctx context.Context, fullMethod string) (string, error) {
+	key, err := i.keyFunc(ctx, fullMethod)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return "", err
+		}
+		return "", status.Errorf(codes.Internal, "rate limit key: %v", err)
+	}
+	return key, nil
+}
+
+// check charges one unit to limiter under key, returning the status error the call fails
+// with, if any.
+func (i *Interceptor) check(ctx context.Context, limiter ratelimiter.RateLimiter, key string) error {
+	result, err := limiter.DecideNContext(ctx, key, 1)
+	switch {
+	case errors.Is(err, ratelimiter.ErrInvalidKey), errors.Is(err, ratelimiter.ErrInvalidCost), errors.Is(err, ratelimiter.ErrCostExceedsCapacity):
+		return status.Error(codes.InvalidArgument, "invalid rate limit key")
+	case errors.Is(err, ratelimiter.ErrClosed):
+		return status.Error(codes.Unavailable, "rate limiter unavailable")
+	case err != nil:
+		if i.failurePolicy == FailOpen {
+			return nil
+		}
+		return status.Error(codes.Unavailable, "rate limiter unavailable")
+	}
+	if !result.Allowed {
+		return resourceExhausted(result)
+	}
+	return nil
+}
+
+// release releases the unit of an accepted call if the limiter holds it until then.
+func (i *Interceptor) release(key string) {
+	if releaser, ok := i.limiter.(releaser); ok {
+		releaser.ReleaseN(key, 1)
+	}
+}
+
+// resourceExhausted returns the error of a call rejected with the given result.
+func resourceExhausted(result *ratelimiter.Result) error {
+	st := status.New(codes.ResourceExhausted, "rate limit exceeded")
+	if result.RetryAfter > 0 {
+		if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(result.RetryAfter)}); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// limitedStream charges every message received on a stream to the message limiter.
+type limitedStream struct {
+	grpc.ServerStream
+	interceptor *Interceptor // Interceptor that accepted the stream
+	key         string       // Key of the stream
+}
+
+// RecvMsg receives a message and fails if it is over the limit.
+func (s *limitedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.interceptor.check(s.Context(), s.interceptor.messageLimiter, s.key)
+}
+
+// PeerKey returns the IP address of the peer that made the call, as a key returned by
+// httplimit.IPKey.
+func PeerKey(ctx context.Context, fullMethod string) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "", errors.New("no peer address")
+	}
+
+	var addr netip.Addr
+	if tcpAddr, ok := p.Addr.(*net.TCPAddr); ok {
+		addr = tcpAddr.AddrPort().Addr()
+	} else {
+		addrPort, err := netip.ParseAddrPort(p.Addr.String())
+		if err != nil {
+			return "", err
+		}
+		addr = addrPort.Addr()
+	}
+	return httplimit.IPKey(addr, 128), nil
+}
+
+// MethodKey returns the name of the method called, as "package.Service.Method", so that
+// every method has its own quota shared by all clients.
+func MethodKey(ctx context.Context, fullMethod string) (string, error) {
+	return strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", "."), nil
+}
+
+// MetadataKey returns a KeyFunc reading the key from the first value of the given metadata
+// entry sent by the client, as is. Calls without it, or with a value the key policy of the
+// limiter rejects, fail with codes.InvalidArgument; a limiter with a KeyPolicy validating
+// keys with ratelimiter.ValidateUTF8Key accepts most values, such as email addresses.
+func MetadataKey(name string) KeyFunc {
+	return func(ctx context.Context, fullMethod string) (string, error) {
+		values := metadata.ValueFromIncomingContext(ctx, name)
+		if len(values) == 0 || values[0] == "" {
+			return "", status.Errorf(codes.InvalidArgument, "missing %s metadata", name)
+		}
+		return values[0], nil
+	}
+}
+
+// JoinKeys returns a KeyFunc joining the keys returned by funcs, such as a per-method quota
+// for each tenant. Each key is prefixed with its length and a dot, and the keys are joined
+// with underscores, as in "4.acme_18.pkg.Service.Method", so that keys from client metadata
+// cannot make two different combinations share a quota.
+func JoinKeys(funcs ...KeyFunc) KeyFunc {
+	return func(ctx context.Context, fullMethod string) (string, error) {
+		keys := make([]string, 0, len(funcs))
+		for _, f := range funcs {
+			key, err := f(ctx, fullMethod)
+			if err != nil {
+				return "", err
+			}
+			keys = append(keys, strconv.Itoa(len(key))+"."+key)
+		}
+		return strings.Join(keys, "_"), nil
+	}
+}
@@ -0,0 +1,348 @@
+// grpclimit/interceptor_test.go
+
+package grpclimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// echoService describes a service with a unary Ping method and a bidirectional Chat
+// stream, both exchanging empty messages, so that no generated code is needed.
+var echoService = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Ping",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(emptypb.Empty)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &emptypb.Empty{}, nil
+			}
+			if interceptor == nil {
+				return handler(ctx, in)
+			}
+			return interceptor(ctx, in, &grpc.UnaryServerInfo{FullMethod: "/test.Echo/Ping"}, handler)
+		},
+	}},
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Chat",
+		ServerStreams: true,
+		ClientStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			for {
+				if err := stream.RecvMsg(new(emptypb.Empty)); err != nil {
+					if errors.Is(err, io.EOF) {
+						return nil
+					}
+					return err
+				}
+				if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+					return err
+				}
+			}
+		},
+	}},
+}
+
+// newTestLimiter returns a fixed window limiter admitting limit calls per hour.
+func newTestLimiter(t *testing.T, memStore store.Store, limit int) ratelimiter.RateLimiter {
+	t.Helper()
+	limiter, err := ratelimiter.NewFixedWindowLimiter(memStore, limit, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	t.Cleanup(func() { limiter.Close() })
+	return limiter
+}
+
+// startServer serves the echo service in process through the interceptor and returns a
+// connection to it.
+func startServer(t *testing.T, interceptor *Interceptor) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(interceptor.Unary()),
+		grpc.StreamInterceptor(interceptor.Stream()),
+	)
+	server.RegisterService(&echoService, nil)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// withKey returns a context sending the given client key as metadata.
+func withKey(key string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "client-key", key)
+}
+
+// ping calls the unary method.
+func ping(ctx context.Context, conn *grpc.ClientConn) error {
+	return conn.Invoke(ctx, "/test.Echo/Ping", &emptypb.Empty{}, &emptypb.Empty{})
+}
+
+// retryDelay returns the retry delay carried by the status of err, or zero if none.
+func retryDelay(err error) time.Duration {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.RetryDelay.AsDuration()
+		}
+	}
+	return 0
+}
+
+func TestInterceptor_Unary(t *testing.T) {
+	interceptor, err := New(newTestLimiter(t, store.NewMemoryStore(), 2), WithKeyFunc(MetadataKey("client-key")))
+	if err != nil {
+		t.Fatalf("Failed to create interceptor: %v", err)
+	}
+	conn := startServer(t, interceptor)
+
+	for i := 0; i < 2; i++ {
+		if err := ping(withKey("client1"), conn); err != nil {
+			t.Fatalf("Call %d should be accepted, got %v", i+1, err)
+		}
+	}
+
+	err = ping(withKey("client1"), conn)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted, got %v", err)
+	}
+	if delay := retryDelay(err); delay <= 0 || delay > time.Hour {
+		t.Errorf("Expected a retry delay within the window, got %v", delay)
+	}
+
+	// Other clients have their own quota
+	if err := ping(withKey("client2"), conn); err != nil {
+		t.Errorf("Call from another client should be accepted, got %v", err)
+	}
+
+	// Calls without the metadata are invalid
+	if err := ping(context.Background(), conn); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Expected InvalidArgument without a key, got %v", err)
+	}
+}
+
+func TestInterceptor_Stream(t *testing.T) {
+	interceptor, err := New(newTestLimiter(t, store.NewMemoryStore(), 1),
+		WithKeyFunc(MetadataKey("client-key")),
+		WithMessageLimiter(newTestLimiter(t, store.NewMemoryStore(), 3)),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create interceptor: %v", err)
+	}
+	conn := startServer(t, interceptor)
+	desc := &echoService.Streams[0]
+
+	stream, err := conn.NewStream(withKey("client1"), desc, "/test.Echo/Chat")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+			t.Fatalf("Message %d: send failed: %v", i+1, err)
+		}
+		if err := stream.RecvMsg(new(emptypb.Empty)); err != nil {
+			t.Fatalf("Message %d should be echoed, got %v", i+1, err)
+		}
+	}
+
+	// The fourth message is over the per-message limit and ends the stream
+	if err := stream.SendMsg(&emptypb.Empty{}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	err = stream.RecvMsg(new(emptypb.Empty))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Expected ResourceExhausted on the fourth message, got %v", err)
+	}
+	if retryDelay(err) <= 0 {
+		t.Error("Expected a retry delay on the rejected message")
+	}
+
+	// Creating a second stream is over the stream limit
+	stream, err = conn.NewStream(withKey("client1"), desc, "/test.Echo/Chat")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	if err := stream.RecvMsg(new(emptypb.Empty)); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("Expected ResourceExhausted for a second stream, got %v", err)
+	}
+}
+
+func TestInterceptor_FailurePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     FailurePolicy
+		expectCode codes.Code
+	}{
+		{name: "FailClosed", policy: FailClosed, expectCode: codes.Unavailable},
+		{name: "FailOpen", policy: FailOpen, expectCode: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A closed store makes every decision fail
+			memStore := store.NewMemoryStore()
+			memStore.Close()
+			interceptor, err := New(newTestLimiter(t, memStore, 1),
+				WithKeyFunc(MethodKey),
+				WithFailurePolicy(tt.policy),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create interceptor: %v", err)
+			}
+			conn := startServer(t, interceptor)
+
+			if err := ping(context.Background(), conn); status.Code(err) != tt.expectCode {
+				t.Errorf("Expected %v, got %v", tt.expectCode, err)
+			}
+		})
+	}
+}
+
+func TestInterceptor_InvalidKey(t *testing.T) {
+	interceptor, err := New(newTestLimiter(t, store.NewMemoryStore(), 1),
+		WithKeyFunc(MetadataKey("client-key")),
+		// Keys rejected by the limiter are not store failures, so they are never let through
+		WithFailurePolicy(FailOpen),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create interceptor: %v", err)
+	}
+	conn := startServer(t, interceptor)
+
+	for i := 0; i < 2; i++ {
+		if err := ping(withKey("user@example.com"), conn); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Call %d: expected InvalidArgument for a key the limiter rejects, got %v", i+1, err)
+		}
+	}
+}
+
+func TestInterceptor_ReleasesConcurrency(t *testing.T) {
+	limiter, err := ratelimiter.NewConcurrencyLimiter(store.NewMemoryStore(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.Close()
+	interceptor, err := New(limiter, WithKeyFunc(MetadataKey("client-key")))
+	if err != nil {
+		t.Fatalf("Failed to create interceptor: %v", err)
+	}
+	conn := startServer(t, interceptor)
+
+	// Each call holds the only slot until it returns
+	for i := 0; i < 3; i++ {
+		if err := ping(withKey("client1"), conn); err != nil {
+			t.Fatalf("Call %d should be accepted, got %v", i+1, err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		stream, err := conn.NewStream(withKey("client1"), &echoService.Streams[0], "/test.Echo/Chat")
+		if err != nil {
+			t.Fatalf("Failed to open stream: %v", err)
+		}
+		if err := stream.CloseSend(); err != nil {
+			t.Fatalf("CloseSend failed: %v", err)
+		}
+		if err := stream.RecvMsg(new(emptypb.Empty)); !errors.Is(err, io.EOF) {
+			t.Fatalf("Stream %d should end normally, got %v", i+1, err)
+		}
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50051},
+	})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("tenant", "acme"))
+
+	tests := []struct {
+		name     string
+		keyFunc  KeyFunc
+		expected string
+	}{
+		{name: "PeerKey", keyFunc: PeerKey, expected: "2001-db8--1"},
+		{name: "MethodKey", keyFunc: MethodKey, expected: "pkg.Service.Method"},
+		{name: "MetadataKey", keyFunc: MetadataKey("tenant"), expected: "acme"},
+		{name: "JoinKeys", keyFunc: JoinKeys(MetadataKey("tenant"), MethodKey), expected: "4.acme_18.pkg.Service.Method"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.keyFunc(ctx, "/pkg.Service/Method")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if key != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, key)
+			}
+		})
+	}
+
+	if _, err := PeerKey(context.Background(), "/pkg.Service/Method"); err == nil {
+		t.Error("Expected an error without a peer")
+	}
+}
+
+func TestJoinKeys_Collisions(t *testing.T) {
+	join := func(parts ...string) string {
+		funcs := make([]KeyFunc, len(parts))
+		for i, part := range parts {
+			part := part
+			funcs[i] = func(context.Context, string) (string, error) { return part, nil }
+		}
+		key, err := JoinKeys(funcs...)(context.Background(), "/pkg.Service/Method")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return key
+	}
+
+	tests := [][2][]string{
+		{{"a_b", "c"}, {"a", "b_c"}},
+		{{"1.a_1.b"}, {"a", "b"}},
+		{{"a.", "b"}, {"a", ".b"}},
+	}
+	for _, tt := range tests {
+		if first, second := join(tt[0]...), join(tt[1]...); first == second {
+			t.Errorf("Expected %q and %q to be joined into different keys, got %q", tt[0], tt[1], first)
+		}
+	}
+}
+
+func TestNew_NilLimiter(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Error("Expected an error for a nil limiter")
+	}
+}
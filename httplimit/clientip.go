@@ -0,0 +1,236 @@
+package httplimit
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Forwarding headers understood by ClientIP.
+const (
+	HeaderForwarded     = "Forwarded"
+	HeaderXForwardedFor = "X-Forwarded-For"
+	HeaderXRealIP       = "X-Real-IP"
+)
+
+// ClientIP extracts the IP address of the client that sent a request. It trusts the
+// forwarding headers only on requests whose remote address is a trusted proxy, and
+// otherwise uses the remote address, so clients cannot pick their own key by sending the
+// headers themselves.
+//
+// In the list headers, Forwarded and X-Forwarded-For, the client is the rightmost address
+// that is not a trusted proxy, so that entries a client puts in front of the list are
+// ignored. Each trusted proxy must therefore append the address it received the request
+// from.
+type ClientIP struct {
+	trustedProxies []netip.Prefix // Networks whose forwarding headers are trusted
+	headers        []string       // Forwarding headers consulted, in order
+	ipv6PrefixBits int            // Length of the prefix IPv6 clients are grouped by
+}
+
+// ClientIPOption configures optional behavior of a ClientIP.
+type ClientIPOption func(*ClientIP)
+
+// WithForwardingHeaders sets the forwarding headers consulted on requests from trusted
+// proxies, in order of preference, among HeaderForwarded, HeaderXForwardedFor and
+// HeaderXRealIP. Only headers that the trusted proxies set or overwrite should be listed.
+// The default is X-Forwarded-For alone.
+func WithForwardingHeaders(headers ...string) ClientIPOption {
+	return func(c *ClientIP) {
+		c.headers = headers
+	}
+}
+
+// WithIPv6Prefix groups IPv6 clients by their prefix of the given length, such as 64, since
+// a single client usually controls a whole /64. The default of 128 keys each address.
+func WithIPv6Prefix(bits int) ClientIPOption {
+	return func(c *ClientIP) {
+		c.ipv6PrefixBits = bits
+	}
+}
+
+// NewClientIP creates a ClientIP trusting the given proxies, each in CIDR notation such as
+// "10.0.0.0/8" or a single address.
+func NewClientIP(trustedProxies []string, opts ...ClientIPOption) (*ClientIP, error) {
+	c := &ClientIP{
+		headers:        []string{HeaderXForwardedFor},
+		ipv6PrefixBits: 128,
+	}
+	for _, proxy := range trustedProxies {
+		prefix, err := parsePrefix(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+		}
+		c.trustedProxies = append(c.trustedProxies, prefix)
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// Canonicalize a copy, since the headers may be the caller's slice
+	headers := make([]string, len(c.headers))
+	for i, header := range c.headers {
+		header = http.CanonicalHeaderKey(header)
+		if header != HeaderForwarded && header != HeaderXForwardedFor && header != http.CanonicalHeaderKey(HeaderXRealIP) {
+			return nil, fmt.Errorf("unsupported forwarding header %q", header)
+		}
+		headers[i] = header
+	}
+	c.headers = headers
+	if c.ipv6PrefixBits <= 0 || c.ipv6PrefixBits > 128 {
+		return nil, errors.New("IPv6 prefix length must be between 1 and 128")
+	}
+	return c, nil
+}
+
+// Addr returns the IP address of the client that sent the request.
+func (c *ClientIP) Addr(r *http.Request) (netip.Addr, error) {
+	remote, err := remoteAddr(r)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	if !c.trusted(remote) {
+		return remote, nil
+	}
+
+	for _, header := range c.headers {
+		values := r.Header.Values(header)
+		if len(values) == 0 {
+			continue
+		}
+		switch header {
+		case HeaderForwarded:
+			return c.rightmostUntrusted(forwardedFor(values), remote), nil
+		case HeaderXForwardedFor:
+			return c.rightmostUntrusted(splitList(values), remote), nil
+		default:
+			if addr, ok := parseAddr(values[0]); ok {
+				return addr, nil
+			}
+		}
+	}
+	return remote, nil
+}
+
+// Key returns the rate limiting key of the client that sent the request, as returned by
+// IPKey. It is a KeyFunc.
+func (c *ClientIP) Key(r *http.Request) (string, error) {
+	addr, err := c.Addr(r)
+	if err != nil {
+		return "", err
+	}
+	return IPKey(addr, c.ipv6PrefixBits), nil
+}
+
+// IPKey returns a rate limiting key for addr that the limiters accept. IPv6 addresses are
+// first reduced to their prefix of the given length, and their colons replaced by dashes;
+// IPv4 addresses are used as is.
+func IPKey(addr netip.Addr, ipv6PrefixBits int) string {
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return addr.String()
+	}
+	if prefix, err := addr.WithZone("").Prefix(ipv6PrefixBits); err == nil {
+		addr = prefix.Addr()
+	}
+	return strings.ReplaceAll(addr.String(), ":", "-")
+}
+
+// trusted reports whether addr is a trusted proxy.
+func (c *ClientIP) trusted(addr netip.Addr) bool {
+	for _, prefix := range c.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// rightmostUntrusted walks the forwarding chain from the proxy nearest to us and returns
+// the first address that is not a trusted proxy. If the chain is made only of trusted
+// proxies, the leftmost one is returned. Walking stops at an entry that is not an
+// address, which a trusted proxy would not have added, and returns the address after it.
+func (c *ClientIP) rightmostUntrusted(chain []string, remote netip.Addr) netip.Addr {
+	client := remote
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(chain[i])
+		if !ok {
+			break
+		}
+		client = addr
+		if !c.trusted(addr) {
+			break
+		}
+	}
+	return client
+}
+
+// remoteAddr returns the IP address of the peer that sent the request.
+func remoteAddr(r *http.Request) (netip.Addr, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	return addr.Unmap(), nil
+}
+
+// parsePrefix parses a network in CIDR notation, or a single address.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// parseAddr parses an address from a forwarding header, which may carry a port and, for
+// IPv6, brackets.
+func parseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// splitList splits the comma separated values of a header into their elements.
+func splitList(values []string) []string {
+	var elements []string
+	for _, value := range values {
+		elements = append(elements, strings.Split(value, ",")...)
+	}
+	return elements
+}
+
+// forwardedFor returns the "for" parameter of each element of Forwarded headers, as
+// defined by RFC 7239. Elements without one yield an empty string.
+func forwardedFor(values []string) []string {
+	var nodes []string
+	for _, element := range splitList(values) {
+		node := ""
+		for _, pair := range strings.Split(element, ";") {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(name, "for") {
+				node = strings.Trim(value, `"`)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
@@ -0,0 +1,191 @@
+// httplimit/clientip_test.go
+
+package httplimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP_Addr(t *testing.T) {
+	clientIP, err := NewClientIP([]string{"10.0.0.0/8", "2001:db8:ffff::1"},
+		WithForwardingHeaders(HeaderForwarded, HeaderXForwardedFor, HeaderXRealIP))
+	if err != nil {
+		t.Fatalf("Failed to create ClientIP: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{
+			name:       "Untrusted peer headers are ignored",
+			remoteAddr: "203.0.113.9:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Real-IP": "198.51.100.2"},
+			expected:   "203.0.113.9",
+		},
+		{
+			name:       "Trusted peer without headers",
+			remoteAddr: "10.0.0.1:1234",
+			expected:   "10.0.0.1",
+		},
+		{
+			name:       "X-Forwarded-For from trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "X-Forwarded-For skips trusted hops and spoofed entries",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 10.0.0.2"},
+			expected:   "198.51.100.1",
+		},
+		{
+			name:       "X-Forwarded-For of trusted proxies only",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			expected:   "10.0.0.3",
+		},
+		{
+			name:       "X-Forwarded-For stops at garbage",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1, garbage, 10.0.0.2"},
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "Forwarded takes precedence",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       `for=192.0.2.60;proto=http, For="[2001:db8:cafe::17]:4711"`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			expected: "2001:db8:cafe::17",
+		},
+		{
+			name:       "Forwarded with port",
+			remoteAddr: "[2001:db8:ffff::1]:443",
+			headers:    map[string]string{"Forwarded": `for="192.0.2.43:47011";by=10.0.0.1`},
+			expected:   "192.0.2.43",
+		},
+		{
+			name:       "X-Real-IP from trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.2"},
+			expected:   "198.51.100.2",
+		},
+		{
+			name:       "IPv4-mapped remote address",
+			remoteAddr: "[::ffff:203.0.113.9]:1234",
+			expected:   "203.0.113.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			addr, err := clientIP.Addr(req)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if addr.String() != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, addr)
+			}
+		})
+	}
+}
+
+func TestClientIP_DefaultHeaders(t *testing.T) {
+	clientIP, err := NewClientIP([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("Failed to create ClientIP: %v", err)
+	}
+
+	// Only X-Forwarded-For is consulted unless configured otherwise
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Real-IP", "198.51.100.2")
+	req.Header.Set("Forwarded", "for=198.51.100.3")
+	addr, err := clientIP.Addr(req)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if addr.String() != "10.0.0.1" {
+		t.Errorf("Expected the remote address, got %s", addr)
+	}
+}
+
+func TestNewClientIP_Errors(t *testing.T) {
+	if _, err := NewClientIP([]string{"not-a-cidr"}); err == nil {
+		t.Error("Expected an error for an invalid trusted proxy")
+	}
+	if _, err := NewClientIP(nil, WithForwardingHeaders("True-Client-IP")); err == nil {
+		t.Error("Expected an error for an unsupported header")
+	}
+	if _, err := NewClientIP(nil, WithIPv6Prefix(0)); err == nil {
+		t.Error("Expected an error for an invalid IPv6 prefix length")
+	}
+}
+
+func TestNewClientIP_KeepsHeaders(t *testing.T) {
+	headers := []string{"x-real-ip", "forwarded"}
+	if _, err := NewClientIP(nil, WithForwardingHeaders(headers...)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if headers[0] != "x-real-ip" || headers[1] != "forwarded" {
+		t.Errorf("Expected the caller's headers to be unchanged, got %v", headers)
+	}
+}
+
+func TestIPKey(t *testing.T) {
+	tests := []struct {
+		addr     string
+		bits     int
+		expected string
+	}{
+		{addr: "192.0.2.1", bits: 64, expected: "192.0.2.1"},
+		{addr: "::ffff:192.0.2.1", bits: 64, expected: "192.0.2.1"},
+		{addr: "2001:db8::1", bits: 128, expected: "2001-db8--1"},
+		{addr: "2001:db8:1:2:3:4:5:6", bits: 64, expected: "2001-db8-1-2--"},
+		{addr: "fe80::1%eth0", bits: 128, expected: "fe80--1"},
+	}
+
+	for _, tt := range tests {
+		if got := IPKey(netip.MustParseAddr(tt.addr), tt.bits); got != tt.expected {
+			t.Errorf("IPKey(%s, %d): expected %q, got %q", tt.addr, tt.bits, tt.expected, got)
+		}
+	}
+}
+
+func TestClientIP_IPv6Keys(t *testing.T) {
+	limiter, _ := newTestLimiter(t, 1)
+	clientIP, err := NewClientIP(nil, WithIPv6Prefix(64))
+	if err != nil {
+		t.Fatalf("Failed to create ClientIP: %v", err)
+	}
+	m, err := New(limiter, WithKeyFunc(clientIP.Key))
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+	handler := m.Handler(okHandler)
+
+	// IPv6 keys are accepted by the limiter, and a /64 shares one quota
+	if rec := serve(handler, "[2001:db8:1:2::1]:1234"); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if rec := serve(handler, "[2001:db8:1:2::ffff]:1234"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the same /64 to be rate limited, got %d", rec.Code)
+	}
+	if rec := serve(handler, "[2001:db8:1:3::1]:1234"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another /64 to be served, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,225 @@
+// Package httplimit provides net/http integration for ThrottleX rate limiters.
+package httplimit
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+)
+
+// Header names set by the middleware. The RateLimit-* headers follow the IETF draft
+// "RateLimit header fields for HTTP".
+const (
+	HeaderRetryAfter         = "Retry-After"
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+)
+
+// KeyFunc returns the rate limiting key of a request.
+type KeyFunc func(r *http.Request) (string, error)
+
+// RejectFunc writes the response to a request the limiter did not allow. The rate limit
+// headers are already set when it is called.
+type RejectFunc func(w http.ResponseWriter, r *http.Request, result *ratelimiter.Result)
+
+// ErrorFunc writes the response to a request whose key could not be extracted or was
+// rejected by the limiter, or that could not be checked against the limit under the
+// FailClosed policy.
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+// FailurePolicy decides what happens to a request when the store of the limiter fails,
+// for example because it is unreachable. Errors of the limiter itself, such as a key its
+// key policy rejects or the limiter being closed, always go to the ErrorFunc, so that
+// clients cannot pass the limit by sending keys the limiter rejects.
+type FailurePolicy int
+
+const (
+	// FailClosed passes the error to the ErrorFunc instead of serving the request.
+	FailClosed FailurePolicy = iota
+
+	// FailOpen serves the request as if the limiter had allowed it, without rate limit
+	// headers.
+	FailOpen
+)
+
+// releaser is implemented by limiters holding slots for requests until they are released,
+// such as ratelimiter.ConcurrencyLimiter and composites with concurrency children.
+type releaser interface {
+	ReleaseN(key string, n int64) error
+}
+
+// Middleware rate limits HTTP requests with a RateLimiter, charging each request one unit
+// under the key returned by its KeyFunc. If the limiter has a ReleaseN method, as
+// concurrency limiters do, the unit of each served request is released once the wrapped
+// handler returns.
+type Middleware struct {
+	limiter       ratelimiter.RateLimiter // Limiter deciding whether requests are served
+	keyFunc       KeyFunc                 // Extracts the key of a request
+	onReject      RejectFunc              // Writes the response to rejected requests
+	onError       ErrorFunc               // Writes the response to requests that failed
+	failurePolicy FailurePolicy           // What to do with requests when the limiter fails
+	clock         clock.Clock             // Source of time for the reset header
+}
+
+// Option configures optional behavior of a Middleware.
+type Option func(*Middleware)
+
+// WithKeyFunc sets how the key of a request is extracted. The default is RemoteAddrKey.
+func WithKeyFunc(f KeyFunc) Option {
+	return func(m *Middleware) {
+		m.keyFunc = f
+	}
+}
+
+// WithRejectFunc sets how rejected requests are answered. The default writes a plain
+// text 429 Too Many Requests response.
+func WithRejectFunc(f RejectFunc) Option {
+	return func(m *Middleware) {
+		m.onReject = f
+	}
+}
+
+// WithErrorFunc sets how requests that could not be checked are answered. The default
+// is DefaultError.
+func WithErrorFunc(f ErrorFunc) Option {
+	return func(m *Middleware) {
+		m.onError = f
+	}
+}
+
+// WithFailurePolicy sets what happens to requests when the limiter fails. The default is
+// FailClosed.
+func WithFailurePolicy(p FailurePolicy) Option {
+	return func(m *Middleware) {
+		m.failurePolicy = p
+	}
+}
+
+// WithClock sets the clock the RateLimit-Reset header is computed with. It should be the
+// clock of the limiter. A nil clock selects the real clock.
+func WithClock(c clock.Clock) Option {
+	return func(m *Middleware) {
+		m.clock = c
+	}
+}
+
+// New creates a Middleware rate limiting requests with the given limiter.
+func New(limiter ratelimiter.RateLimiter, opts ...Option) (*Middleware, error) {
+	if limiter == nil {
+		return nil, errors.New("limiter cannot be nil")
+	}
+
+	m := &Middleware{
+		limiter:  limiter,
+		keyFunc:  RemoteAddrKey,
+		onReject: DefaultReject,
+		onError:  DefaultError,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.clock == nil {
+		m.clock = clock.New()
+	}
+	return m, nil
+}
+
+// Handler wraps next so that it only serves requests the limiter allows. Every decided
+// request gets the RateLimit-* headers, and rejected ones also get Retry-After when the
+// limiter knows when to retry.
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, err := m.keyFunc(r)
+		if err != nil {
+			m.onError(w, r, err)
+			return
+		}
+
+		result, err := m.limiter.DecideNContext(r.Context(), key, 1)
+		if err != nil {
+			if m.failurePolicy == FailOpen && !isLimiterError(err) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			m.onError(w, r, err)
+			return
+		}
+
+		setHeaders(w.Header(), result, m.clock.Now())
+		if !result.Allowed {
+			m.onReject(w, r, result)
+			return
+		}
+		if releaser, ok := m.limiter.(releaser); ok {
+			defer releaser.ReleaseN(key, 1)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RemoteAddrKey returns the IP address of the peer that sent the request, as a key returned
+// by IPKey. Behind a proxy, that is the address of the proxy; use ClientIP to key requests
+// by the address of the client instead.
+func RemoteAddrKey(r *http.Request) (string, error) {
+	addr, err := remoteAddr(r)
+	if err != nil {
+		return "", err
+	}
+	return IPKey(addr, 128), nil
+}
+
+// DefaultReject writes a plain text 429 Too Many Requests response.
+func DefaultReject(w http.ResponseWriter, r *http.Request, result *ratelimiter.Result) {
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+// DefaultError writes a plain text 400 Bad Request response for keys and costs the limiter
+// rejects, and a 500 Internal Server Error response otherwise, without revealing the error
+// to the client.
+func DefaultError(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	if isRequestError(err) {
+		status = http.StatusBadRequest
+	}
+	http.Error(w, http.StatusText(status), status)
+}
+
+// isRequestError reports whether err is the limiter rejecting the key or cost of a request.
+func isRequestError(err error) bool {
+	return errors.Is(err, ratelimiter.ErrInvalidKey) ||
+		errors.Is(err, ratelimiter.ErrInvalidCost) ||
+		errors.Is(err, ratelimiter.ErrCostExceedsCapacity)
+}
+
+// isLimiterError reports whether err comes from the limiter itself rather than its store,
+// so that the failure policy does not apply to it.
+func isLimiterError(err error) bool {
+	return isRequestError(err) || errors.Is(err, ratelimiter.ErrClosed)
+}
+
+// setHeaders sets the rate limit headers describing result at time now. Durations are
+// rounded up to whole seconds so that clients never retry too early.
+func setHeaders(h http.Header, result *ratelimiter.Result, now time.Time) {
+	h.Set(HeaderRateLimitLimit, strconv.FormatInt(result.Limit, 10))
+	h.Set(HeaderRateLimitRemaining, strconv.FormatInt(result.Remaining, 10))
+	if !result.ResetAt.IsZero() {
+		h.Set(HeaderRateLimitReset, strconv.FormatInt(ceilSeconds(result.ResetAt.Sub(now)), 10))
+	}
+	if !result.Allowed && result.RetryAfter > 0 {
+		h.Set(HeaderRetryAfter, strconv.FormatInt(ceilSeconds(result.RetryAfter), 10))
+	}
+}
+
+// ceilSeconds returns d in whole seconds, rounded up, or zero if d is negative.
+func ceilSeconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,248 @@
+// httplimit/middleware_test.go
+
+package httplimit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// okHandler answers every request with 200 OK.
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+// newTestLimiter returns a fixed window limiter admitting limit requests per minute on a fake clock.
+func newTestLimiter(t *testing.T, limit int) (ratelimiter.RateLimiter, *clock.Fake) {
+	t.Helper()
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	limiter, err := ratelimiter.NewFixedWindowLimiter(store.NewMemoryStore(store.WithClock(fake)), limit, time.Minute, ratelimiter.WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	t.Cleanup(func() { limiter.Close() })
+	return limiter, fake
+}
+
+// serve sends a GET request from the given remote address through handler.
+func serve(handler http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_Headers(t *testing.T) {
+	// The fake clock starts 20s into a minute, so the window resets in 40s
+	limiter, fake := newTestLimiter(t, 2)
+	m, err := New(limiter, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+	handler := m.Handler(okHandler)
+
+	for i, remaining := range []string{"1", "0"} {
+		rec := serve(handler, "192.0.2.1:1234")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, rec.Code)
+		}
+		if got := rec.Header().Get(HeaderRateLimitLimit); got != "2" {
+			t.Errorf("Request %d: expected RateLimit-Limit 2, got %q", i+1, got)
+		}
+		if got := rec.Header().Get(HeaderRateLimitRemaining); got != remaining {
+			t.Errorf("Request %d: expected RateLimit-Remaining %s, got %q", i+1, remaining, got)
+		}
+		if got := rec.Header().Get(HeaderRateLimitReset); got != "40" {
+			t.Errorf("Request %d: expected RateLimit-Reset 40, got %q", i+1, got)
+		}
+		if got := rec.Header().Get(HeaderRetryAfter); got != "" {
+			t.Errorf("Request %d: expected no Retry-After on an allowed request, got %q", i+1, got)
+		}
+	}
+
+	rec := serve(handler, "192.0.2.1:1234")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429, got %d", rec.Code)
+	}
+	if got := rec.Header().Get(HeaderRetryAfter); got != "40" {
+		t.Errorf("Expected Retry-After 40, got %q", got)
+	}
+	if got := rec.Header().Get(HeaderRateLimitRemaining); got != "0" {
+		t.Errorf("Expected RateLimit-Remaining 0, got %q", got)
+	}
+
+	// Other clients have their own quota
+	if rec := serve(handler, "192.0.2.2:1234"); rec.Code != http.StatusOK {
+		t.Errorf("Expected another client to be served, got %d", rec.Code)
+	}
+}
+
+func TestMiddleware_CustomReject(t *testing.T) {
+	limiter, _ := newTestLimiter(t, 1)
+	var rejected *ratelimiter.Result
+	m, err := New(limiter,
+		WithKeyFunc(func(r *http.Request) (string, error) { return r.Header.Get("X-Api-Key"), nil }),
+		WithRejectFunc(func(w http.ResponseWriter, r *http.Request, result *ratelimiter.Result) {
+			rejected = result
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"slow down"}`))
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+	handler := m.Handler(okHandler)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Api-Key", "key1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected the custom status 503, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); body != `{"error":"slow down"}` {
+		t.Errorf("Expected the custom body, got %q", body)
+	}
+	if rec.Header().Get(HeaderRetryAfter) == "" {
+		t.Error("Expected Retry-After to be set before the custom rejection")
+	}
+	if rejected == nil || rejected.Allowed {
+		t.Errorf("Expected the reject func to get the rejected result, got %+v", rejected)
+	}
+}
+
+func TestMiddleware_FailurePolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     FailurePolicy
+		expectCode int
+	}{
+		{name: "FailClosed", policy: FailClosed, expectCode: http.StatusInternalServerError},
+		{name: "FailOpen", policy: FailOpen, expectCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A closed store makes every decision fail
+			memStore := store.NewMemoryStore()
+			memStore.Close()
+			limiter, err := ratelimiter.NewFixedWindowLimiter(memStore, 1, time.Minute)
+			if err != nil {
+				t.Fatalf("Failed to create rate limiter: %v", err)
+			}
+			m, err := New(limiter, WithFailurePolicy(tt.policy))
+			if err != nil {
+				t.Fatalf("Failed to create middleware: %v", err)
+			}
+
+			rec := serve(m.Handler(okHandler), "192.0.2.1:1234")
+			if rec.Code != tt.expectCode {
+				t.Errorf("Expected status %d, got %d", tt.expectCode, rec.Code)
+			}
+			if got := rec.Header().Get(HeaderRateLimitLimit); got != "" {
+				t.Errorf("Expected no rate limit headers, got RateLimit-Limit %q", got)
+			}
+		})
+	}
+}
+
+func TestMiddleware_ErrorFunc(t *testing.T) {
+	limiter, _ := newTestLimiter(t, 1)
+	keyErr := errors.New("no key")
+	var got error
+	m, err := New(limiter,
+		WithKeyFunc(func(r *http.Request) (string, error) { return "", keyErr }),
+		WithErrorFunc(func(w http.ResponseWriter, r *http.Request, err error) {
+			got = err
+			w.WriteHeader(http.StatusBadRequest)
+		}),
+		// Key errors are not limiter failures, so they are never served
+		WithFailurePolicy(FailOpen),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+
+	rec := serve(m.Handler(okHandler), "192.0.2.1:1234")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rec.Code)
+	}
+	if !errors.Is(got, keyErr) {
+		t.Errorf("Expected the key error, got %v", got)
+	}
+}
+
+func TestMiddleware_LimiterErrors(t *testing.T) {
+	limiter, _ := newTestLimiter(t, 1)
+	served := false
+	m, err := New(limiter,
+		WithKeyFunc(func(r *http.Request) (string, error) { return r.Header.Get("X-Api-Key"), nil }),
+		// Keys rejected by the limiter are not store failures, so they are never served
+		WithFailurePolicy(FailOpen),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Api-Key", "user@example.com")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || served {
+		t.Errorf("Expected status 400 without serving the request, got %d, served=%v", rec.Code, served)
+	}
+
+	limiter.Close()
+	rec = serve(handler, "192.0.2.1:1234")
+	if rec.Code != http.StatusInternalServerError || served {
+		t.Errorf("Expected status 500 from a closed limiter without serving the request, got %d, served=%v", rec.Code, served)
+	}
+}
+
+func TestMiddleware_ReleasesConcurrency(t *testing.T) {
+	limiter, err := ratelimiter.NewConcurrencyLimiter(store.NewMemoryStore(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.Close()
+	m, err := New(limiter)
+	if err != nil {
+		t.Fatalf("Failed to create middleware: %v", err)
+	}
+
+	// The slot is held while the request is served, and released once it returns
+	var inner *httptest.ResponseRecorder
+	handler := m.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inner == nil {
+			inner = serve(m.Handler(okHandler), r.RemoteAddr)
+		}
+	}))
+	for i := 0; i < 3; i++ {
+		if rec := serve(handler, "192.0.2.1:1234"); rec.Code != http.StatusOK {
+			t.Fatalf("Request %d: expected status 200, got %d", i+1, rec.Code)
+		}
+	}
+	if inner == nil || inner.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a concurrent request to be rejected, got %v", inner)
+	}
+}
+
+func TestNew_NilLimiter(t *testing.T) {
+	if _, err := New(nil); err == nil {
+		t.Error("Expected an error for a nil limiter")
+	}
+}
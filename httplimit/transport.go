@@ -0,0 +1,317 @@
+package httplimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// ErrRateLimited is returned by Transport when a request is not sent because it is over
+// the limit or the server asked to back off.
+var ErrRateLimited = errors.New("outbound request rate limited")
+
+// defaultMaxBackoff is the longest a Transport backs off for by default.
+const defaultMaxBackoff = 5 * time.Minute
+
+// defaultBackoffNamespace prefixes the store keys of backoffs by default.
+const defaultBackoffNamespace = "httplimit.backoff"
+
+// Transport is an http.RoundTripper that applies a RateLimiter to outbound requests before
+// sending them with a base RoundTripper.
+//
+// It also backs off when servers ask it to: after a response with status 429 or 503 and a
+// Retry-After header, or with RateLimit-Remaining 0 and a RateLimit-Reset header, requests
+// with the same key are held until the time given. The backoff is kept in the backoff
+// store as an entry expiring when it ends, so Transports sharing a RedisStore, such as a
+// fleet of workers calling the same API, back off together.
+type Transport struct {
+	base          http.RoundTripper       // RoundTripper sending the requests
+	limiter       ratelimiter.RateLimiter // Limiter deciding whether requests are sent
+	backoffStore  store.Store             // Store keeping the backoffs
+	backoffs      store.KeyInspector      // Backoff store, reading how long backoffs last
+	namespace     string                  // Prefix of the store keys of the backoffs
+	keyFunc       KeyFunc                 // Extracts the key of a request
+	wait          bool                    // Whether to wait for the limit instead of failing
+	maxBackoff    time.Duration           // Longest backoff accepted from a server
+	failurePolicy FailurePolicy           // What to do with requests when the limiter fails
+	clock         clock.Clock             // Source of time for backoff deadlines
+}
+
+// TransportOption configures optional behavior of a Transport.
+type TransportOption func(*Transport)
+
+// WithTransportKeyFunc sets how the key of an outbound request is extracted. The default
+// is HostKey.
+func WithTransportKeyFunc(f KeyFunc) TransportOption {
+	return func(t *Transport) {
+		t.keyFunc = f
+	}
+}
+
+// WithWait makes the Transport wait, within the deadline of the request context, until a
+// request is allowed and any backoff is over, instead of failing with ErrRateLimited. The
+// limiter must then have a Wait method, as all limiters of the ratelimiter package do.
+func WithWait(wait bool) TransportOption {
+	return func(t *Transport) {
+		t.wait = wait
+	}
+}
+
+// WithBackoffStore sets the store backoffs are kept in, which must implement
+// store.KeyInspector, as MemoryStore and RedisStore do. Sharing a RedisStore makes all
+// Transports using it back off together. The default is a MemoryStore of the Transport's
+// own.
+func WithBackoffStore(s store.Store) TransportOption {
+	return func(t *Transport) {
+		t.backoffStore = s
+	}
+}
+
+// WithBackoffNamespace sets the prefix of the store keys of the backoffs, so that
+// Transports calling different APIs through one backoff store, or a backoff store shared
+// with limiters, keep their keys apart. Transports that should back off together must use
+// the same namespace. The default is "httplimit.backoff".
+func WithBackoffNamespace(ns string) TransportOption {
+	return func(t *Transport) {
+		t.namespace = ns
+	}
+}
+
+// WithMaxBackoff caps how long a server can make the Transport back off for. The default
+// is 5 minutes.
+func WithMaxBackoff(d time.Duration) TransportOption {
+	return func(t *Transport) {
+		t.maxBackoff = d
+	}
+}
+
+// WithTransportFailurePolicy sets what happens to requests when the store of the limiter
+// or the backoff store fails. The default is FailClosed, which returns the error; FailOpen
+// sends the request anyway. Errors of the limiter itself, such as a key it rejects, are
+// always returned.
+func WithTransportFailurePolicy(p FailurePolicy) TransportOption {
+	return func(t *Transport) {
+		t.failurePolicy = p
+	}
+}
+
+// WithTransportClock sets the clock backoff deadlines are computed and waited for with. A
+// nil clock selects the real clock.
+func WithTransportClock(c clock.Clock) TransportOption {
+	return func(t *Transport) {
+		t.clock = c
+	}
+}
+
+// NewTransport creates a Transport sending requests with base, or http.DefaultTransport if
+// base is nil, once limiter allows them.
+func NewTransport(base http.RoundTripper, limiter ratelimiter.RateLimiter, opts ...TransportOption) (*Transport, error) {
+	if limiter == nil {
+		return nil, errors.New("limiter cannot be nil")
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	t := &Transport{
+		base:       base,
+		limiter:    limiter,
+		keyFunc:    HostKey,
+		maxBackoff: defaultMaxBackoff,
+		namespace:  defaultBackoffNamespace,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.clock == nil {
+		t.clock = clock.New()
+	}
+	if t.backoffStore == nil {
+		t.backoffStore = store.NewMemoryStore(store.WithClock(t.clock))
+	}
+	backoffs, ok := t.backoffStore.(store.KeyInspector)
+	if !ok {
+		return nil, errors.New("backoff store does not implement store.KeyInspector")
+	}
+	t.backoffs = backoffs
+	if _, ok := t.limiter.(waiter); t.wait && !ok {
+		return nil, errors.New("limiter does not support waiting")
+	}
+	if t.maxBackoff <= 0 {
+		return nil, errors.New("max backoff must be greater than zero")
+	}
+	if t.namespace == "" {
+		return nil, errors.New("backoff namespace cannot be empty")
+	}
+	return t, nil
+}
+
+// waiter is implemented by limiters that can wait until a request is allowed.
+type waiter interface {
+	Wait(ctx context.Context, key string) error
+}
+
+// RoundTrip sends the request once it is allowed, and records the backoff asked for by the
+// response, if any. The request body is closed if the request is not sent.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := t.keyFunc(req)
+	if err == nil {
+		err = t.admit(req.Context(), key)
+	}
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if delay := t.backoffFor(resp); delay > 0 {
+		// The response is returned whether or not the backoff could be recorded
+		_ = t.backOff(req.Context(), key, delay)
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the base RoundTripper, if it
+// supports it.
+func (t *Transport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// admit returns once the request may be sent, or with the reason it may not.
+func (t *Transport) admit(ctx context.Context, key string) error {
+	if err := t.waitBackoff(ctx, key); err != nil {
+		if errors.Is(err, ErrRateLimited) || ctx.Err() != nil || t.failurePolicy == FailClosed {
+			return err
+		}
+	}
+
+	if t.wait {
+		err := t.limiter.(waiter).Wait(ctx, key)
+		if errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+			return fmt.Errorf("%w: %v", ErrRateLimited, err)
+		}
+		if err != nil && (ctx.Err() != nil || t.failurePolicy == FailClosed || isLimiterError(err)) {
+			return err
+		}
+		return nil
+	}
+
+	result, err := t.limiter.DecideNContext(ctx, key, 1)
+	if err != nil {
+		if t.failurePolicy == FailOpen && !isLimiterError(err) {
+			return nil
+		}
+		return err
+	}
+	if !result.Allowed {
+		return fmt.Errorf("%w: retry after %v", ErrRateLimited, result.RetryAfter)
+	}
+	return nil
+}
+
+// waitBackoff returns once no backoff is pending for the key, waiting for it to end if the
+// Transport waits and the context deadline allows, and failing with ErrRateLimited
+// otherwise. Context deadlines are in real time, so the delay is compared with the time
+// left until the deadline.
+func (t *Transport) waitBackoff(ctx context.Context, key string) error {
+	for {
+		delay, pending, err := t.backoffs.TTL(ctx, t.backoffKey(key))
+		if err != nil || !pending || delay <= 0 {
+			return err
+		}
+
+		if !t.wait {
+			return fmt.Errorf("%w: backing off for %v", ErrRateLimited, delay)
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return fmt.Errorf("%w: backoff would exceed context deadline", ErrRateLimited)
+		}
+
+		timer := t.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// backOff records that requests with the key must wait for delay, capped at the maximum
+// backoff, unless they already wait longer. The backoff is a timestamp set expiring after
+// delay: AddTimestamp extends the expiration of a set but never shortens it, in a single
+// atomic operation, so concurrent responses on a shared store keep the longest backoff.
+func (t *Transport) backOff(ctx context.Context, key string, delay time.Duration) error {
+	return t.backoffStore.AddTimestampContext(context.WithoutCancel(ctx), t.backoffKey(key),
+		t.clock.Now().UnixNano(), min(delay, t.maxBackoff))
+}
+
+// backoffFor returns how long the response asks clients to wait before sending another
+// request, or zero if it does not.
+func (t *Transport) backoffFor(resp *http.Response) time.Duration {
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if delay, ok := parseRetryAfter(resp.Header.Get(HeaderRetryAfter), t.clock.Now()); ok {
+			return delay
+		}
+	}
+	if strings.TrimSpace(resp.Header.Get(HeaderRateLimitRemaining)) == "0" {
+		if seconds, err := strconv.ParseInt(strings.TrimSpace(resp.Header.Get(HeaderRateLimitReset)), 10, 64); err == nil && seconds > 0 {
+			return time.Duration(min(seconds, math.MaxInt64/int64(time.Second))) * time.Second
+		}
+	}
+	return 0
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as an HTTP date, into the
+// delay from now.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds <= 0 {
+			return 0, false
+		}
+		return time.Duration(min(seconds, math.MaxInt64/int64(time.Second))) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now), true
+	}
+	return 0, false
+}
+
+// backoffKey returns the store key of the backoff for a key.
+func (t *Transport) backoffKey(key string) string {
+	return t.namespace + ":" + key
+}
+
+// HostKey returns the host name the request is sent to, so that each API has its own
+// quota. IP addresses are returned as keys by IPKey.
+func HostKey(r *http.Request) (string, error) {
+	host := r.URL.Hostname()
+	if host == "" {
+		return "", errors.New("request has no host")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return IPKey(addr, 128), nil
+	}
+	return strings.ToLower(host), nil
+}
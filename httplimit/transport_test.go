@@ -0,0 +1,339 @@
+// httplimit/transport_test.go
+
+package httplimit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// countingServer starts a server answering with the given headers and status, and counts
+// the requests it receives.
+func countingServer(t *testing.T, status int, headers map[string]string) (*httptest.Server, *int64) {
+	t.Helper()
+	var received int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&received, 1)
+		for name, value := range headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &received
+}
+
+// newTokenBucket returns a token bucket limiter on the real clock.
+func newTokenBucket(t *testing.T, capacity, refillRate float64) ratelimiter.RateLimiter {
+	t.Helper()
+	limiter, err := ratelimiter.NewTokenBucketLimiter(store.NewMemoryStore(), capacity, refillRate)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	t.Cleanup(func() { limiter.Close() })
+	return limiter
+}
+
+// get sends a GET request to url through transport.
+func get(ctx context.Context, transport http.RoundTripper, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := transport.RoundTrip(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestTransport_Limit(t *testing.T) {
+	server, received := countingServer(t, http.StatusOK, nil)
+	transport, err := NewTransport(nil, newTokenBucket(t, 2, 0.001))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := get(context.Background(), transport, server.URL); err != nil {
+			t.Fatalf("Request %d should be sent, got %v", i+1, err)
+		}
+	}
+	if _, err := get(context.Background(), transport, server.URL); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if n := atomic.LoadInt64(received); n != 2 {
+		t.Errorf("Expected 2 requests to reach the server, got %d", n)
+	}
+}
+
+func TestTransport_Wait(t *testing.T) {
+	server, received := countingServer(t, http.StatusOK, nil)
+	transport, err := NewTransport(nil, newTokenBucket(t, 1, 20), WithWait(true))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := get(context.Background(), transport, server.URL); err != nil {
+			t.Fatalf("Request %d should be sent after waiting, got %v", i+1, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Expected requests to wait for tokens, took %v", elapsed)
+	}
+	if n := atomic.LoadInt64(received); n != 3 {
+		t.Errorf("Expected 3 requests to reach the server, got %d", n)
+	}
+
+	// A deadline too short to wait for a token fails without sending
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := get(ctx, transport, server.URL); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestTransport_RetryAfterSharedBackoff(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	backoffStore := store.NewMemoryStore(store.WithClock(fake))
+	server, received := countingServer(t, http.StatusTooManyRequests, map[string]string{"Retry-After": "30"})
+
+	// Two workers sharing the backoff store
+	newWorker := func() *Transport {
+		transport, err := NewTransport(nil, newTokenBucket(t, 100, 100),
+			WithBackoffStore(backoffStore), WithTransportClock(fake))
+		if err != nil {
+			t.Fatalf("Failed to create transport: %v", err)
+		}
+		return transport
+	}
+	worker1, worker2 := newWorker(), newWorker()
+
+	resp, err := get(context.Background(), worker1, server.URL)
+	if err != nil {
+		t.Fatalf("First request should be sent, got %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("Expected the 429 response to be returned, got %d", resp.StatusCode)
+	}
+
+	// Both workers back off until the Retry-After has passed
+	for _, worker := range []*Transport{worker1, worker2} {
+		if _, err := get(context.Background(), worker, server.URL); !errors.Is(err, ErrRateLimited) {
+			t.Errorf("Expected ErrRateLimited during the backoff, got %v", err)
+		}
+	}
+	fake.Advance(30 * time.Second)
+	if n := backoffStore.Len(); n != 0 {
+		t.Errorf("Expected the backoff to expire from the store, got %d entries", n)
+	}
+	if _, err := get(context.Background(), worker2, server.URL); err != nil {
+		t.Errorf("Expected the request to be sent after the backoff, got %v", err)
+	}
+	if n := atomic.LoadInt64(received); n != 2 {
+		t.Errorf("Expected 2 requests to reach the server, got %d", n)
+	}
+}
+
+func TestTransport_BackoffKeepsLongest(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	backoffStore := store.NewMemoryStore(store.WithClock(fake))
+	transport, err := NewTransport(nil, newTokenBucket(t, 100, 100),
+		WithBackoffStore(backoffStore), WithTransportClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+	other, err := NewTransport(nil, newTokenBucket(t, 100, 100),
+		WithBackoffStore(backoffStore), WithTransportClock(fake), WithBackoffNamespace("other"))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	// Concurrent backoffs of different lengths keep the longest
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(1)
+		go func(delay time.Duration) {
+			defer wg.Done()
+			if err := transport.backOff(context.Background(), "api.example.com", delay); err != nil {
+				t.Errorf("backOff failed: %v", err)
+			}
+		}(time.Duration(i) * time.Second)
+	}
+	wg.Wait()
+
+	ctx := context.Background()
+	if ttl, pending, err := backoffStore.TTL(ctx, "httplimit.backoff:api.example.com"); err != nil || !pending || ttl != 20*time.Second {
+		t.Errorf("Expected a backoff of 20s under the namespace, got %v, %v, %v", ttl, pending, err)
+	}
+	if _, pending, _ := backoffStore.TTL(ctx, "api.example.com"); pending {
+		t.Error("Expected no backoff under the bare key")
+	}
+	if err := other.waitBackoff(ctx, "api.example.com"); err != nil {
+		t.Errorf("Expected a transport with another namespace not to back off, got %v", err)
+	}
+}
+
+func TestTransport_RateLimitHeadersBackoff(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	server, _ := countingServer(t, http.StatusOK, map[string]string{
+		"RateLimit-Limit":     "10",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "7200",
+	})
+	transport, err := NewTransport(nil, newTokenBucket(t, 100, 100),
+		WithTransportClock(fake), WithMaxBackoff(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	if _, err := get(context.Background(), transport, server.URL); err != nil {
+		t.Fatalf("First request should be sent, got %v", err)
+	}
+	if _, err := get(context.Background(), transport, server.URL); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited once the quota is used up, got %v", err)
+	}
+
+	// The backoff is capped at the maximum
+	fake.Advance(time.Minute)
+	if _, err := get(context.Background(), transport, server.URL); err != nil {
+		t.Errorf("Expected the request to be sent after the maximum backoff, got %v", err)
+	}
+}
+
+func TestTransport_WaitBackoff(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	var received int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt64(&received, 1) == 1 {
+			w.Header().Set("Retry-After", "10")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	transport, err := NewTransport(nil, newTokenBucket(t, 100, 100),
+		WithTransportClock(fake), WithWait(true))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	if _, err := get(context.Background(), transport, server.URL); err != nil {
+		t.Fatalf("First request should be sent, got %v", err)
+	}
+
+	// A deadline before the end of the backoff fails at once
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := get(ctx, transport, server.URL); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		resp, err := get(context.Background(), transport, server.URL)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = errors.New(resp.Status)
+		}
+		done <- err
+	}()
+	fake.BlockUntil(1)
+	select {
+	case err := <-done:
+		t.Fatalf("Request was sent during the backoff: %v", err)
+	default:
+	}
+
+	fake.Advance(10 * time.Second)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected the request to succeed after the backoff, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Request was not sent after the backoff")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "120", expected: 2 * time.Minute, ok: true},
+		{value: " 5 ", expected: 5 * time.Second, ok: true},
+		{value: "Mon, 01 Jan 2024 12:01:30 GMT", expected: 90 * time.Second, ok: true},
+		{value: "Mon, 01 Jan 2024 11:59:00 GMT", ok: false},
+		{value: "0", ok: false},
+		{value: "soon", ok: false},
+		{value: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		delay, ok := parseRetryAfter(tt.value, now)
+		if ok != tt.ok || delay != tt.expected {
+			t.Errorf("parseRetryAfter(%q): expected %v, %v, got %v, %v", tt.value, tt.expected, tt.ok, delay, ok)
+		}
+	}
+}
+
+func TestNewTransport_Errors(t *testing.T) {
+	if _, err := NewTransport(nil, nil); err == nil {
+		t.Error("Expected an error for a nil limiter")
+	}
+	if _, err := NewTransport(nil, newTokenBucket(t, 1, 1), WithMaxBackoff(0)); err == nil {
+		t.Error("Expected an error for a non-positive max backoff")
+	}
+	if _, err := NewTransport(nil, newTokenBucket(t, 1, 1), WithBackoffStore(struct{ store.Store }{store.NewMemoryStore()})); err == nil {
+		t.Error("Expected an error for a backoff store without key inspection")
+	}
+	if _, err := NewTransport(nil, newTokenBucket(t, 1, 1), WithBackoffNamespace("")); err == nil {
+		t.Error("Expected an error for an empty backoff namespace")
+	}
+}
+
+// closeRecorder is a request body recording whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (b *closeRecorder) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestTransport_ClosesBodyOnKeyError(t *testing.T) {
+	transport, err := NewTransport(nil, newTokenBucket(t, 1, 1),
+		WithTransportKeyFunc(func(r *http.Request) (string, error) { return "", errors.New("no key") }))
+	if err != nil {
+		t.Fatalf("Failed to create transport: %v", err)
+	}
+
+	body := &closeRecorder{Reader: strings.NewReader("payload")}
+	req, err := http.NewRequest(http.MethodPost, "http://example.com", body)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatal("Expected the key error")
+	}
+	if !body.closed {
+		t.Error("Expected the request body to be closed")
+	}
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+)
+
+// Limiter is a rate limiter whose decisions are recorded by a Metrics. It implements
+// ratelimiter.RateLimiter, ratelimiter.Reserver and ratelimiter.Inspector, forwarding
+// reservations, waits and inspections to the wrapped limiter, so it can be a child of a
+// CompositeLimiter or be waited on by an httplimit.Transport.
+type Limiter struct {
+	limiter ratelimiter.RateLimiter // Limiter making the decisions
+	name    string                  // Value of the limiter label
+	metrics *Metrics
+}
+
+// WrapLimiter returns a limiter that makes its decisions with l and records them under
+// the given name, which should be unique among the limiters of m. The policy label is
+// given by ratelimiter.PolicyName. Closing the returned limiter closes l.
+func (m *Metrics) WrapLimiter(name string, l ratelimiter.RateLimiter) *Limiter {
+	limiter := &Limiter{limiter: l, name: name, metrics: m}
+	m.track(limiter)
+	return limiter
+}
+
+// Name returns the name the decisions are recorded under.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Unwrap returns the limiter making the decisions.
+func (l *Limiter) Unwrap() ratelimiter.RateLimiter {
+	return l.limiter
+}
+
+// Policy returns the policy of the wrapped limiter, as named by ratelimiter.PolicyName.
+func (l *Limiter) Policy() ratelimiter.PolicyType {
+	return ratelimiter.PolicyType(ratelimiter.PolicyName(l.limiter))
+}
+
+// observe records a decision for key that started at start.
+func (l *Limiter) observe(key string, start time.Time, allowed bool, err error) {
+	elapsed := time.Since(start)
+	policy := string(l.Policy())
+
+	decision := decisionDenied
+	switch {
+	case err != nil:
+		decision = decisionError
+	case allowed:
+		decision = decisionAllowed
+	}
+
+	l.metrics.decisions.WithLabelValues(l.name, policy, decision).Inc()
+	l.metrics.decisionTime.WithLabelValues(l.name, policy).Observe(elapsed.Seconds())
+	if l.metrics.keyDecisions != nil {
+		l.metrics.keyDecisions.WithLabelValues(l.name, l.metrics.keyLabel(l.name, key), decision).Inc()
+	}
+}
+
+// Allow checks if a request associated with the given key is allowed to proceed.
+func (l *Limiter) Allow(key string) (bool, error) {
+	start := time.Now()
+	allowed, err := l.limiter.Allow(key)
+	l.observe(key, start, allowed, err)
+	return allowed, err
+}
+
+// AllowN checks if a request of cost n associated with the given key is allowed to proceed.
+func (l *Limiter) AllowN(key string, n int64) (bool, error) {
+	start := time.Now()
+	allowed, err := l.limiter.AllowN(key, n)
+	l.observe(key, start, allowed, err)
+	return allowed, err
+}
+
+// AllowContext is like Allow but passes the context on to the store.
+func (l *Limiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	allowed, err := l.limiter.AllowContext(ctx, key)
+	l.observe(key, start, allowed, err)
+	return allowed, err
+}
+
+// Decide checks if a request associated with the given key is allowed to proceed and
+// reports the remaining quota.
+func (l *Limiter) Decide(key string) (*ratelimiter.Result, error) {
+	start := time.Now()
+	result, err := l.limiter.Decide(key)
+	l.observe(key, start, err == nil && result.Allowed, err)
+	return result, err
+}
+
+// DecideN is like Decide for a request of cost n.
+func (l *Limiter) DecideN(key string, n int64) (*ratelimiter.Result, error) {
+	start := time.Now()
+	result, err := l.limiter.DecideN(key, n)
+	l.observe(key, start, err == nil && result.Allowed, err)
+	return result, err
+}
+
+// DecideNContext is like DecideN but passes the context on to the store.
+func (l *Limiter) DecideNContext(ctx context.Context, key string, n int64) (*ratelimiter.Result, error) {
+	start := time.Now()
+	result, err := l.limiter.DecideNContext(ctx, key, n)
+	l.observe(key, start, err == nil && result.Allowed, err)
+	return result, err
+}
+
+// ReserveN reserves capacity from the wrapped limiter for a request of cost n associated
+// with the given key, recording an OK reservation as allowed.
+func (l *Limiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*ratelimiter.Reservation, error) {
+	start := time.Now()
+	reservation, err := ratelimiter.ReserveN(ctx, l.limiter, key, n, maxDelay)
+	l.observe(key, start, err == nil && reservation.OK(), err)
+	return reservation, err
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until the wrapped limiter allows a request of cost n associated with the
+// given key, or the context is done. A request that cannot be admitted before the context
+// deadline is recorded as denied; the decision time includes the time spent waiting.
+func (l *Limiter) WaitN(ctx context.Context, key string, n int64) error {
+	start := time.Now()
+	err := ratelimiter.WaitN(ctx, l.limiter, key, n)
+	if errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		l.observe(key, start, false, nil)
+	} else {
+		l.observe(key, start, err == nil, err)
+	}
+	return err
+}
+
+// Inspect returns the state of key in the wrapped limiter. Inspections are not recorded.
+func (l *Limiter) Inspect(ctx context.Context, key string) (*ratelimiter.KeyState, error) {
+	return ratelimiter.Inspect(ctx, l.limiter, key)
+}
+
+// Reset deletes the state of key in the wrapped limiter.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return ratelimiter.Reset(ctx, l.limiter, key)
+}
+
+// Release releases a slot of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) Release(key string) error {
+	return l.ReleaseN(key, 1)
+}
+
+// ReleaseN releases n slots of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) ReleaseN(key string, n int64) error {
+	return ratelimiter.ReleaseN(l.limiter, key, n)
+}
+
+// Close closes the wrapped limiter and stops reporting its tracked keys.
+func (l *Limiter) Close() error {
+	l.metrics.untrack(l)
+	return l.limiter.Close()
+}
@@ -0,0 +1,163 @@
+// metrics/limiter_test.go
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// gather registers m with a pedantic registry and returns the metric families it exports,
+// by name.
+func gather(t *testing.T, m *Metrics) map[string]*dto.MetricFamily {
+	t.Helper()
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(m); err != nil {
+		t.Fatalf("Failed to register metrics: %v", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+func TestLimiter_Decisions(t *testing.T) {
+	m := New()
+	inner, err := ratelimiter.NewFixedWindowLimiter(store.NewMemoryStore(), 2, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := m.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	for i := 0; i < 3; i++ {
+		limiter.Allow("alice")
+	}
+	if _, err := limiter.Decide(""); err == nil {
+		t.Fatal("Expected an error for an empty key")
+	}
+
+	for decision, expected := range map[string]float64{"allowed": 2, "denied": 1, "error": 1} {
+		got := testutil.ToFloat64(m.decisions.WithLabelValues("api", "FixedWindow", decision))
+		if got != expected {
+			t.Errorf("Expected %v %s decisions, got %v", expected, decision, got)
+		}
+	}
+
+	family := gather(t, m)["throttlex_decision_duration_seconds"]
+	if family == nil || len(family.GetMetric()) != 1 {
+		t.Fatalf("Expected one decision latency histogram, got %v", family)
+	}
+	if count := family.GetMetric()[0].GetHistogram().GetSampleCount(); count != 4 {
+		t.Errorf("Expected 4 latency samples, got %d", count)
+	}
+}
+
+// policyLimiter is a limiter that reports its policy.
+type policyLimiter struct {
+	ratelimiter.RateLimiter
+	policy ratelimiter.PolicyType
+}
+
+func (l *policyLimiter) Policy() ratelimiter.PolicyType {
+	return l.policy
+}
+
+func TestLimiter_Policy(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	gcra, err := ratelimiter.NewGCRALimiter(memStore, 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	defer gcra.Close()
+	composite, err := ratelimiter.NewCompositeLimiter([]ratelimiter.CompositeChild{{Name: "gcra", Limiter: gcra}})
+	if err != nil {
+		t.Fatalf("Failed to create composite limiter: %v", err)
+	}
+	defer composite.Close()
+
+	m := New()
+	tests := []struct {
+		limiter  ratelimiter.RateLimiter
+		expected string
+	}{
+		{limiter: gcra, expected: "GCRA"},
+		{limiter: composite, expected: "Composite"},
+		{limiter: &policyLimiter{RateLimiter: gcra, policy: ratelimiter.TokenBucketPolicy}, expected: "TokenBucket"},
+		{limiter: &policyLimiter{RateLimiter: gcra}, expected: ""},
+		{limiter: struct{ ratelimiter.RateLimiter }{gcra}, expected: "unknown"},
+		{limiter: m.WrapLimiter("inner", gcra), expected: "GCRA"},
+	}
+
+	for _, tt := range tests {
+		if policy := string(m.WrapLimiter("test", tt.limiter).Policy()); policy != tt.expected {
+			t.Errorf("Expected policy %q for %T, got %q", tt.expected, tt.limiter, policy)
+		}
+	}
+}
+
+func TestLimiter_Release(t *testing.T) {
+	inner, err := ratelimiter.NewConcurrencyLimiter(store.NewMemoryStore(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := New().WrapLimiter("uploads", inner)
+	defer limiter.Close()
+
+	if allowed, err := limiter.Allow("alice"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+	if err := limiter.Release("alice"); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if allowed, err := limiter.Allow("alice"); err != nil || !allowed {
+		t.Errorf("Expected the request to be allowed after Release, got %v, %v", allowed, err)
+	}
+}
+
+func TestLimiter_Reservations(t *testing.T) {
+	m := New()
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	inner, err := ratelimiter.NewFixedWindowLimiter(store.NewMemoryStore(store.WithClock(fake)), 1, time.Minute, ratelimiter.WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := m.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	composite, err := ratelimiter.NewCompositeLimiter([]ratelimiter.CompositeChild{{Name: "api", Limiter: limiter}})
+	if err != nil {
+		t.Fatalf("Expected the wrapped limiter to be a composite child, got %v", err)
+	}
+	if allowed, err := composite.Allow("alice"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := limiter.Wait(ctx, "alice"); !errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		t.Errorf("Expected ErrWaitExceedsDeadline, got %v", err)
+	}
+
+	for decision, expected := range map[string]float64{"allowed": 1, "denied": 1} {
+		got := testutil.ToFloat64(m.decisions.WithLabelValues("api", "FixedWindow", decision))
+		if got != expected {
+			t.Errorf("Expected %v %s decisions, got %v", expected, decision, got)
+		}
+	}
+}
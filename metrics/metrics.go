@@ -0,0 +1,266 @@
+// Package metrics exports Prometheus metrics for ThrottleX rate limiters and stores.
+//
+// A Metrics is a prometheus.Collector. Register it, then wrap the limiters and stores to
+// observe:
+//
+//	m := metrics.New()
+//	prometheus.MustRegister(m)
+//
+//	st := m.WrapStore("redis", store.NewRedisStore(client))
+//	limiter, err := ratelimiter.NewTokenBucketLimiter(st, 100, 10)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	api := m.WrapLimiter("api", limiter)
+//
+// The metrics are labeled by the names given to WrapLimiter and WrapStore, by policy and
+// by store method, so their cardinality does not grow with traffic. Per-key metrics are
+// only exported with WithKeyLabels, for a bounded number of keys.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultNamespace is the Prometheus namespace of the metrics unless WithNamespace is given.
+const DefaultNamespace = "throttlex"
+
+// OtherKey is the key label of the decisions for keys beyond the limit of WithKeyLabels.
+const OtherKey = "other"
+
+// Values of the decision label.
+const (
+	decisionAllowed = "allowed"
+	decisionDenied  = "denied"
+	decisionError   = "error"
+)
+
+// DefaultBuckets are the latency histogram buckets, in seconds, unless WithBuckets is
+// given. They range from 100µs, a decision served from memory, to 1s.
+var DefaultBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// Metrics records the decisions of rate limiters and the operations of stores, and exports
+// them as Prometheus metrics:
+//
+//   - throttlex_decisions_total{limiter, policy, decision}: decisions by outcome, one of
+//     "allowed", "denied" and "error".
+//   - throttlex_decision_duration_seconds{limiter, policy}: latency of the decisions.
+//   - throttlex_store_operation_duration_seconds{store, method}: latency of the store calls.
+//   - throttlex_store_errors_total{store, method}: store calls that failed.
+//   - throttlex_tracked_keys{limiter, policy}: keys a limiter holds in-process state for,
+//     for limiters that report it, such as TokenBucketLimiter.
+//   - throttlex_store_entries{store}: entries held by a store that reports it, such as
+//     MemoryStore.
+//   - throttlex_key_decisions_total{limiter, key, decision}: decisions by key, only
+//     exported with WithKeyLabels.
+type Metrics struct {
+	decisions    *prometheus.CounterVec   // Decisions by limiter, policy and outcome
+	decisionTime *prometheus.HistogramVec // Latency of the decisions by limiter and policy
+	keyDecisions *prometheus.CounterVec   // Decisions by limiter, key and outcome; nil unless enabled
+	storeTime    *prometheus.HistogramVec // Latency of the store calls by store and method
+	storeErrors  *prometheus.CounterVec   // Failed store calls by store and method
+	trackedKeys  *prometheus.Desc         // Keys with in-process state by limiter and policy
+	storeEntries *prometheus.Desc         // Entries by store
+
+	mu       sync.Mutex
+	limiters map[string]*Limiter      // Wrapped limiters by name
+	stores   map[string]*metricsStore // Wrapped stores by name
+	keys     map[keyLabel]struct{}    // Keys with their own label
+	maxKeys  int                      // Maximum size of keys
+}
+
+// keyLabel identifies the key of a limiter in throttlex_key_decisions_total.
+type keyLabel struct {
+	limiter string
+	key     string
+}
+
+// options holds the settings of New.
+type options struct {
+	namespace string
+	buckets   []float64
+	maxKeys   int
+}
+
+// Option configures optional behavior of a Metrics.
+type Option func(*options)
+
+// WithNamespace sets the Prometheus namespace, the prefix of the metric names. The default
+// is DefaultNamespace.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithBuckets sets the buckets of the latency histograms, in seconds. The default is
+// DefaultBuckets.
+func WithBuckets(buckets []float64) Option {
+	return func(o *options) {
+		o.buckets = buckets
+	}
+}
+
+// WithKeyLabels exports throttlex_key_decisions_total for the first maxKeys keys seen
+// across the wrapped limiters. Decisions for later keys are counted under OtherKey, which
+// bounds the number of series. Keys are exported as given to the limiter, so they should
+// not hold personal data. A maxKeys that is not positive disables the metric, the default.
+func WithKeyLabels(maxKeys int) Option {
+	return func(o *options) {
+		o.maxKeys = maxKeys
+	}
+}
+
+// New returns a Metrics with the given options. It must be registered with a
+// prometheus.Registerer for its metrics to be exported.
+func New(opts ...Option) *Metrics {
+	o := options{namespace: DefaultNamespace, buckets: DefaultBuckets}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	m := &Metrics{
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Name:      "decisions_total",
+			Help:      "Rate limiting decisions by limiter, policy and outcome.",
+		}, []string{"limiter", "policy", "decision"}),
+		decisionTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Name:      "decision_duration_seconds",
+			Help:      "Latency of rate limiting decisions by limiter and policy.",
+			Buckets:   o.buckets,
+		}, []string{"limiter", "policy"}),
+		storeTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Name:      "store_operation_duration_seconds",
+			Help:      "Latency of store operations by store and method.",
+			Buckets:   o.buckets,
+		}, []string{"store", "method"}),
+		storeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Name:      "store_errors_total",
+			Help:      "Failed store operations by store and method.",
+		}, []string{"store", "method"}),
+		trackedKeys: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, "", "tracked_keys"),
+			"Keys a limiter holds in-process state for.",
+			[]string{"limiter", "policy"}, nil,
+		),
+		storeEntries: prometheus.NewDesc(
+			prometheus.BuildFQName(o.namespace, "", "store_entries"),
+			"Entries held by a store.",
+			[]string{"store"}, nil,
+		),
+		limiters: make(map[string]*Limiter),
+		stores:   make(map[string]*metricsStore),
+		maxKeys:  o.maxKeys,
+	}
+	if o.maxKeys > 0 {
+		m.keyDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Name:      "key_decisions_total",
+			Help:      "Rate limiting decisions by limiter, key and outcome.",
+		}, []string{"limiter", "key", "decision"})
+		m.keys = make(map[keyLabel]struct{})
+	}
+	return m
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.decisions.Describe(ch)
+	m.decisionTime.Describe(ch)
+	if m.keyDecisions != nil {
+		m.keyDecisions.Describe(ch)
+	}
+	m.storeTime.Describe(ch)
+	m.storeErrors.Describe(ch)
+	ch <- m.trackedKeys
+	ch <- m.storeEntries
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.decisions.Collect(ch)
+	m.decisionTime.Collect(ch)
+	if m.keyDecisions != nil {
+		m.keyDecisions.Collect(ch)
+	}
+	m.storeTime.Collect(ch)
+	m.storeErrors.Collect(ch)
+
+	// The gauges are read without holding m.mu, so a slow count does not hold up decisions
+	m.mu.Lock()
+	limiters := make([]*Limiter, 0, len(m.limiters))
+	for _, l := range m.limiters {
+		limiters = append(limiters, l)
+	}
+	stores := make([]*metricsStore, 0, len(m.stores))
+	for _, s := range m.stores {
+		stores = append(stores, s)
+	}
+	m.mu.Unlock()
+
+	for _, l := range limiters {
+		if tracker, ok := l.limiter.(interface{ TrackedKeys() int }); ok {
+			ch <- prometheus.MustNewConstMetric(m.trackedKeys, prometheus.GaugeValue,
+				float64(tracker.TrackedKeys()), l.name, string(l.Policy()))
+		}
+	}
+	for _, s := range stores {
+		if counter, ok := s.store.(interface{ Len() int }); ok {
+			ch <- prometheus.MustNewConstMetric(m.storeEntries, prometheus.GaugeValue,
+				float64(counter.Len()), s.name)
+		}
+	}
+}
+
+// keyLabel returns the key label of a decision of the named limiter for key.
+func (m *Metrics) keyLabel(limiter, key string) string {
+	label := keyLabel{limiter: limiter, key: key}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.keys[label]; ok {
+		return key
+	}
+	if len(m.keys) < m.maxKeys {
+		m.keys[label] = struct{}{}
+		return key
+	}
+	return OtherKey
+}
+
+// track makes the gauges report the wrapped limiter, replacing any limiter of the same name.
+func (m *Metrics) track(l *Limiter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limiters[l.name] = l
+}
+
+// untrack stops the gauges reporting the wrapped limiter.
+func (m *Metrics) untrack(l *Limiter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.limiters[l.name] == l {
+		delete(m.limiters, l.name)
+	}
+}
+
+// trackStore makes the gauges report the wrapped store, replacing any store of the same name.
+func (m *Metrics) trackStore(s *metricsStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stores[s.name] = s
+}
+
+// untrackStore stops the gauges reporting the wrapped store.
+func (m *Metrics) untrackStore(s *metricsStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stores[s.name] == s {
+		delete(m.stores, s.name)
+	}
+}
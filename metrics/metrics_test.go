@@ -0,0 +1,106 @@
+// metrics/metrics_test.go
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+func TestMetrics_KeyLabelsOff(t *testing.T) {
+	m := New()
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := m.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	limiter.Allow("alice")
+	if _, ok := gather(t, m)["throttlex_key_decisions_total"]; ok {
+		t.Error("Expected no per-key metrics by default")
+	}
+}
+
+func TestMetrics_KeyLabels(t *testing.T) {
+	m := New(WithKeyLabels(2))
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := m.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	for _, key := range []string{"alice", "bob", "carol", "alice", "dave"} {
+		limiter.Allow(key)
+	}
+
+	for key, expected := range map[string]float64{"alice": 2, "bob": 1, OtherKey: 2} {
+		got := testutil.ToFloat64(m.keyDecisions.WithLabelValues("api", key, "allowed"))
+		if got != expected {
+			t.Errorf("Expected %v decisions for %s, got %v", expected, key, got)
+		}
+	}
+	if series := len(gather(t, m)["throttlex_key_decisions_total"].GetMetric()); series != 3 {
+		t.Errorf("Expected 3 per-key series, got %d", series)
+	}
+}
+
+func TestMetrics_TrackedKeys(t *testing.T) {
+	m := New()
+	memStore := m.WrapStore("memory", store.NewMemoryStore())
+	inner, err := ratelimiter.NewTokenBucketLimiter(memStore, 10, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := m.WrapLimiter("api", inner)
+
+	for _, key := range []string{"alice", "bob", "carol", "alice"} {
+		limiter.Allow(key)
+	}
+
+	families := gather(t, m)
+	tracked := families["throttlex_tracked_keys"].GetMetric()
+	if len(tracked) != 1 || tracked[0].GetGauge().GetValue() != 3 {
+		t.Errorf("Expected 3 tracked keys, got %v", tracked)
+	}
+	entries := families["throttlex_store_entries"].GetMetric()
+	if len(entries) != 1 || entries[0].GetGauge().GetValue() != 3 {
+		t.Errorf("Expected 3 store entries, got %v", entries)
+	}
+
+	// Closed limiters and stores are no longer reported
+	limiter.Close()
+	memStore.Close()
+	families = gather(t, m)
+	if _, ok := families["throttlex_tracked_keys"]; ok {
+		t.Error("Expected no tracked keys after Close")
+	}
+	if _, ok := families["throttlex_store_entries"]; ok {
+		t.Error("Expected no store entries after Close")
+	}
+}
+
+func TestMetrics_Options(t *testing.T) {
+	m := New(WithNamespace("api"), WithBuckets([]float64{time.Second.Seconds()}))
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := m.WrapLimiter("login", inner)
+	defer limiter.Close()
+
+	limiter.Allow("alice")
+	family := gather(t, m)["api_decision_duration_seconds"]
+	if family == nil {
+		t.Fatal("Expected the metrics to use the namespace")
+	}
+	if buckets := family.GetMetric()[0].GetHistogram().GetBucket(); len(buckets) != 1 {
+		t.Errorf("Expected 1 bucket, got %d", len(buckets))
+	}
+}
@@ -0,0 +1,34 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/neelp03/throttlex/store"
+)
+
+// metricsStore is a store wrapped by a Metrics.
+type metricsStore struct {
+	store store.Store // Store serving the operations
+	name  string      // Value of the store label
+}
+
+// WrapStore returns a store that serves its operations with s and records their latency
+// and errors under the given name, which should be unique among the stores of m. Closing
+// the returned store closes s.
+//
+// As with store.Instrument, the returned store implements each optional store interface,
+// such as store.TokenBucketTaker, that s implements.
+func (m *Metrics) WrapStore(name string, s store.Store) store.Store {
+	wrapped := &metricsStore{store: s, name: name}
+	m.trackStore(wrapped)
+	return store.Instrument(s, func(_ context.Context, op store.Operation) {
+		if op.Method == "Close" {
+			m.untrackStore(wrapped)
+			return
+		}
+		m.storeTime.WithLabelValues(name, op.Method).Observe(op.Duration.Seconds())
+		if op.Err != nil {
+			m.storeErrors.WithLabelValues(name, op.Method).Inc()
+		}
+	})
+}
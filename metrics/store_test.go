@@ -0,0 +1,85 @@
+// metrics/store_test.go
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// latencySamples returns the latency samples recorded for a method of the named store.
+func latencySamples(t *testing.T, m *Metrics, name, method string) uint64 {
+	t.Helper()
+	for _, metric := range gather(t, m)["throttlex_store_operation_duration_seconds"].GetMetric() {
+		labels := map[string]string{}
+		for _, label := range metric.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		if labels["store"] == name && labels["method"] == method {
+			return metric.GetHistogram().GetSampleCount()
+		}
+	}
+	return 0
+}
+
+func TestWrapStore_AtomicOperations(t *testing.T) {
+	m := New()
+	memStore := m.WrapStore("memory", store.NewMemoryStore())
+	defer memStore.Close()
+
+	// GCRA requires the store to implement store.GCRAUpdater
+	limiter, err := ratelimiter.NewGCRALimiter(memStore, 2, 1)
+	if err != nil {
+		t.Fatalf("Expected the wrapped store to support GCRA, got %v", err)
+	}
+	defer limiter.Close()
+
+	for i := 0; i < 3; i++ {
+		limiter.Allow("alice")
+	}
+	if samples := latencySamples(t, m, "memory", "UpdateGCRA"); samples != 3 {
+		t.Errorf("Expected 3 UpdateGCRA samples, got %d", samples)
+	}
+}
+
+func TestWrapStore_Operations(t *testing.T) {
+	m := New()
+	memStore := m.WrapStore("memory", store.NewMemoryStore())
+
+	memStore.Increment("a", 1, time.Minute)
+	memStore.Increment("a", 1, time.Minute)
+	if count, err := memStore.GetCounter("a"); err != nil || count != 2 {
+		t.Fatalf("Expected a count of 2, got %d, %v", count, err)
+	}
+	if samples := latencySamples(t, m, "memory", "Increment"); samples != 2 {
+		t.Errorf("Expected 2 Increment samples, got %d", samples)
+	}
+
+	memStore.Close()
+	if _, err := memStore.Increment("a", 1, time.Minute); !errors.Is(err, store.ErrClosed) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+	if failures := testutil.ToFloat64(m.storeErrors.WithLabelValues("memory", "Increment")); failures != 1 {
+		t.Errorf("Expected 1 failed Increment, got %v", failures)
+	}
+}
+
+func TestWrapStore_BasicStore(t *testing.T) {
+	// Only the methods of store.Store are promoted
+	basic := struct{ store.Store }{store.NewMemoryStore()}
+	wrapped := New().WrapStore("basic", basic)
+	defer wrapped.Close()
+
+	if _, ok := wrapped.(store.TokenBucketTaker); ok {
+		t.Error("Expected the wrapped store not to implement the optional interfaces")
+	}
+	if _, err := ratelimiter.NewGCRALimiter(wrapped, 1, 1); err == nil {
+		t.Error("Expected GCRA to reject the wrapped store")
+	}
+}
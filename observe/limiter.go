@@ -0,0 +1,178 @@
+package observe
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// Limiter is a rate limiter whose decisions are reported to the observer of a Notifier.
+// It implements ratelimiter.RateLimiter, ratelimiter.Reserver and ratelimiter.Inspector,
+// forwarding reservations, waits and inspections to the wrapped limiter, so it can be a
+// child of a CompositeLimiter or be waited on by an httplimit.Transport.
+type Limiter struct {
+	limiter  ratelimiter.RateLimiter // Limiter making the decisions
+	name     string                  // Name reported in the decisions
+	notifier *Notifier
+}
+
+// WrapLimiter returns a limiter that makes its decisions with l and reports them under
+// the given name. Closing the returned limiter closes l.
+func (n *Notifier) WrapLimiter(name string, l ratelimiter.RateLimiter) *Limiter {
+	return &Limiter{limiter: l, name: name, notifier: n}
+}
+
+// WrapStore returns a store that serves its operations with s and reports those that fail
+// under the given name. Closing the returned store closes s. As with store.Instrument, the
+// returned store implements each optional store interface that s implements.
+func (n *Notifier) WrapStore(name string, s store.Store) store.Store {
+	return store.Instrument(s, func(_ context.Context, op store.Operation) {
+		if op.Err != nil {
+			n.notify(StoreError{Time: time.Now(), Store: name, Method: op.Method, Key: op.Key, Err: op.Err})
+		}
+	})
+}
+
+// Name returns the name reported in the decisions.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Unwrap returns the limiter making the decisions.
+func (l *Limiter) Unwrap() ratelimiter.RateLimiter {
+	return l.limiter
+}
+
+// Policy returns the policy of the wrapped limiter, as named by ratelimiter.PolicyName.
+func (l *Limiter) Policy() ratelimiter.PolicyType {
+	return ratelimiter.PolicyType(ratelimiter.PolicyName(l.limiter))
+}
+
+// decide makes a decision for a request of cost n and reports it.
+func (l *Limiter) decide(ctx context.Context, key string, n int64) (*ratelimiter.Result, error) {
+	result, err := l.limiter.DecideNContext(ctx, key, n)
+
+	d := l.decision(key, n, err)
+	if err == nil {
+		d.Allowed = result.Allowed
+		d.Remaining = result.Remaining
+		d.RetryAfter = result.RetryAfter
+		d.RejectedBy = result.RejectedBy
+	}
+	l.notifier.notify(d)
+	return result, err
+}
+
+// decision returns the decision for a request of cost n that failed with err, if not nil.
+func (l *Limiter) decision(key string, n int64, err error) Decision {
+	return Decision{
+		Time:    time.Now(),
+		Limiter: l.name,
+		Policy:  string(l.Policy()),
+		Key:     key,
+		Cost:    n,
+		Err:     err,
+	}
+}
+
+// Allow checks if a request associated with the given key is allowed to proceed.
+func (l *Limiter) Allow(key string) (bool, error) {
+	return l.AllowContext(context.Background(), key)
+}
+
+// AllowN checks if a request of cost n associated with the given key is allowed to proceed.
+func (l *Limiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.decide(context.Background(), key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the store.
+func (l *Limiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.decide(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Decide checks if a request associated with the given key is allowed to proceed and
+// reports the remaining quota.
+func (l *Limiter) Decide(key string) (*ratelimiter.Result, error) {
+	return l.decide(context.Background(), key, 1)
+}
+
+// DecideN is like Decide for a request of cost n.
+func (l *Limiter) DecideN(key string, n int64) (*ratelimiter.Result, error) {
+	return l.decide(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store.
+func (l *Limiter) DecideNContext(ctx context.Context, key string, n int64) (*ratelimiter.Result, error) {
+	return l.decide(ctx, key, n)
+}
+
+// ReserveN reserves capacity from the wrapped limiter for a request of cost n associated
+// with the given key, reporting an OK reservation as allowed.
+func (l *Limiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*ratelimiter.Reservation, error) {
+	reservation, err := ratelimiter.ReserveN(ctx, l.limiter, key, n, maxDelay)
+
+	d := l.decision(key, n, err)
+	d.Allowed = err == nil && reservation.OK()
+	l.notifier.notify(d)
+	return reservation, err
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until the wrapped limiter allows a request of cost n associated with the
+// given key, or the context is done, and reports the outcome once it returns. A request
+// that cannot be admitted before the context deadline is reported as denied.
+func (l *Limiter) WaitN(ctx context.Context, key string, n int64) error {
+	err := ratelimiter.WaitN(ctx, l.limiter, key, n)
+
+	var d Decision
+	if errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		d = l.decision(key, n, nil)
+	} else {
+		d = l.decision(key, n, err)
+		d.Allowed = err == nil
+	}
+	l.notifier.notify(d)
+	return err
+}
+
+// Inspect returns the state of key in the wrapped limiter. Inspections are not reported.
+func (l *Limiter) Inspect(ctx context.Context, key string) (*ratelimiter.KeyState, error) {
+	return ratelimiter.Inspect(ctx, l.limiter, key)
+}
+
+// Reset deletes the state of key in the wrapped limiter.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return ratelimiter.Reset(ctx, l.limiter, key)
+}
+
+// Release releases a slot of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) Release(key string) error {
+	return l.ReleaseN(key, 1)
+}
+
+// ReleaseN releases n slots of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) ReleaseN(key string, n int64) error {
+	return ratelimiter.ReleaseN(l.limiter, key, n)
+}
+
+// Close closes the wrapped limiter.
+func (l *Limiter) Close() error {
+	return l.limiter.Close()
+}
@@ -0,0 +1,198 @@
+// Package observe reports the decisions of ThrottleX rate limiters and the errors of
+// stores to an Observer, to alert on, audit or block the keys that get rejected.
+//
+// A Notifier delivers the events to its Observer from a goroutine of its own, so an
+// observer that is slow, blocks or panics never holds up a decision:
+//
+//	notifier := observe.NewNotifier(observe.NewSlogObserver(slog.Default()))
+//	defer notifier.Close()
+//
+//	st := notifier.WrapStore("redis", store.NewRedisStore(client))
+//	limiter, err := ratelimiter.NewTokenBucketLimiter(st, 100, 10)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	api := notifier.WrapLimiter("api", limiter)
+package observe
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBufferSize is the number of events a Notifier holds for its observer unless
+// WithBufferSize is given.
+const DefaultBufferSize = 1024
+
+// Decision describes a decision of a limiter wrapped by a Notifier.
+type Decision struct {
+	Time       time.Time     // When the decision was made
+	Limiter    string        // Name given to WrapLimiter
+	Policy     string        // Policy of the limiter, as named by ratelimiter.PolicyName
+	Key        string        // Key of the request
+	Cost       int64         // Cost of the request
+	Allowed    bool          // Whether the request was allowed
+	Remaining  int64         // Requests that can still be admitted
+	RetryAfter time.Duration // How long to wait before retrying; zero when allowed
+	RejectedBy string        // Child or level that rejected the request, if any
+	Err        error         // Error of the decision, in which case Allowed is false
+}
+
+// StoreError describes a failed operation of a store wrapped by a Notifier.
+type StoreError struct {
+	Time   time.Time // When the operation failed
+	Store  string    // Name given to WrapStore
+	Method string    // Store method, such as "Increment"
+	Key    string    // Key of the operation
+	Err    error     // Error returned by the store
+}
+
+// Observer is notified of decisions and store errors.
+type Observer interface {
+	// ObserveDecision is called for each decision of a wrapped limiter.
+	ObserveDecision(d Decision)
+
+	// ObserveStoreError is called for each failed operation of a wrapped store.
+	ObserveStoreError(e StoreError)
+}
+
+// Funcs is an Observer that calls its functions. Nil functions are skipped.
+type Funcs struct {
+	Decision   func(d Decision)
+	StoreError func(e StoreError)
+}
+
+// ObserveDecision calls f.Decision if not nil.
+func (f Funcs) ObserveDecision(d Decision) {
+	if f.Decision != nil {
+		f.Decision(d)
+	}
+}
+
+// ObserveStoreError calls f.StoreError if not nil.
+func (f Funcs) ObserveStoreError(e StoreError) {
+	if f.StoreError != nil {
+		f.StoreError(e)
+	}
+}
+
+// Notifier delivers the events of the limiters and stores it wraps to an Observer, one
+// at a time, from a goroutine of its own. Events are buffered; an event that arrives while
+// the buffer is full is dropped rather than waited for, and a panic of the observer is
+// recovered, so that neither can hold up or crash a decision.
+type Notifier struct {
+	observer Observer
+	events   chan interface{} // Buffered Decision and StoreError events
+	dropped  atomic.Uint64    // Events not delivered
+	done     chan struct{}    // Closed by Close
+	stopped  chan struct{}    // Closed when the delivery goroutine returns
+	mu       sync.RWMutex     // Held by notify while it queues an event, and by Close to set closed
+	closed   bool             // Whether Close was called
+}
+
+// Option configures optional behavior of a Notifier.
+type Option func(*notifierOptions)
+
+// notifierOptions holds the settings of NewNotifier.
+type notifierOptions struct {
+	bufferSize int
+}
+
+// WithBufferSize sets the number of events the notifier holds while the observer is busy.
+// The default is DefaultBufferSize.
+func WithBufferSize(n int) Option {
+	return func(o *notifierOptions) {
+		o.bufferSize = n
+	}
+}
+
+// NewNotifier returns a Notifier delivering events to o, and starts its delivery goroutine.
+// Close stops it.
+func NewNotifier(o Observer, opts ...Option) *Notifier {
+	options := notifierOptions{bufferSize: DefaultBufferSize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	n := &Notifier{
+		observer: o,
+		events:   make(chan interface{}, max(options.bufferSize, 0)),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+// Dropped returns the number of events that were not delivered because the buffer was
+// full, the notifier was closed or the observer panicked.
+func (n *Notifier) Dropped() uint64 {
+	return n.dropped.Load()
+}
+
+// Close delivers the buffered events, then stops the delivery goroutine. Later events are
+// dropped. It does not close the wrapped limiters and stores. Closing a closed notifier
+// does nothing.
+func (n *Notifier) Close() error {
+	n.mu.Lock()
+	if !n.closed {
+		n.closed = true
+		close(n.done)
+	}
+	n.mu.Unlock()
+	<-n.stopped
+	return nil
+}
+
+// notify queues an event for delivery, or drops it if the buffer is full or the notifier
+// is closed. It never blocks on the observer. Queueing under n.mu ensures that an event
+// queued before Close is in the buffer when the delivery goroutine drains it.
+func (n *Notifier) notify(event interface{}) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.closed {
+		n.dropped.Add(1)
+		return
+	}
+	select {
+	case n.events <- event:
+	default:
+		n.dropped.Add(1)
+	}
+}
+
+// run delivers events until the notifier is closed, then delivers those left in the buffer.
+func (n *Notifier) run() {
+	defer close(n.stopped)
+	for {
+		select {
+		case event := <-n.events:
+			n.deliver(event)
+		case <-n.done:
+			for {
+				select {
+				case event := <-n.events:
+					n.deliver(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver passes an event to the observer, recovering from its panics.
+func (n *Notifier) deliver(event interface{}) {
+	defer func() {
+		if recover() != nil {
+			n.dropped.Add(1)
+		}
+	}()
+	switch event := event.(type) {
+	case Decision:
+		n.observer.ObserveDecision(event)
+	case StoreError:
+		n.observer.ObserveStoreError(event)
+	}
+}
@@ -0,0 +1,241 @@
+// observe/observe_test.go
+
+package observe
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// recorder is an Observer that records the events it is notified of.
+type recorder struct {
+	mu          sync.Mutex
+	decisions   []Decision
+	storeErrors []StoreError
+}
+
+func (r *recorder) ObserveDecision(d Decision) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decisions = append(r.decisions, d)
+}
+
+func (r *recorder) ObserveStoreError(e StoreError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.storeErrors = append(r.storeErrors, e)
+}
+
+func TestNotifier_Decisions(t *testing.T) {
+	rec := &recorder{}
+	notifier := NewNotifier(rec)
+	inner, err := ratelimiter.NewFixedWindowLimiter(store.NewMemoryStore(), 1, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := notifier.WrapLimiter("login", inner)
+	defer limiter.Close()
+
+	limiter.Allow("alice")
+	limiter.Allow("alice")
+	limiter.AllowN("", 2)
+	notifier.Close()
+
+	if len(rec.decisions) != 3 {
+		t.Fatalf("Expected 3 decisions, got %d", len(rec.decisions))
+	}
+	allowed, denied, failed := rec.decisions[0], rec.decisions[1], rec.decisions[2]
+	if !allowed.Allowed || allowed.Limiter != "login" || allowed.Policy != "FixedWindow" || allowed.Key != "alice" || allowed.Cost != 1 {
+		t.Errorf("Expected an allowed decision for alice, got %+v", allowed)
+	}
+	if denied.Allowed || denied.Remaining != 0 || denied.RetryAfter <= 0 {
+		t.Errorf("Expected a denied decision with a retry-after, got %+v", denied)
+	}
+	if !errors.Is(failed.Err, ratelimiter.ErrInvalidKey) || failed.Cost != 2 {
+		t.Errorf("Expected a failed decision of cost 2, got %+v", failed)
+	}
+}
+
+func TestNotifier_StoreErrors(t *testing.T) {
+	rec := &recorder{}
+	notifier := NewNotifier(rec)
+	memStore := notifier.WrapStore("memory", store.NewMemoryStore())
+	inner, err := ratelimiter.NewGCRALimiter(memStore, 5, 1, ratelimiter.WithNamespace("test"))
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := notifier.WrapLimiter("login", inner)
+	defer limiter.Close()
+
+	memStore.Close()
+	if _, err := limiter.Allow("alice"); !errors.Is(err, store.ErrClosed) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+	notifier.Close()
+
+	expected := StoreError{Store: "memory", Method: "UpdateGCRA", Key: "test:alice", Err: store.ErrClosed}
+	if len(rec.storeErrors) != 1 {
+		t.Fatalf("Expected 1 store error, got %+v", rec.storeErrors)
+	}
+	got := rec.storeErrors[0]
+	got.Time = time.Time{}
+	if got != expected {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+	if len(rec.decisions) != 1 || rec.decisions[0].Err == nil {
+		t.Errorf("Expected a failed decision, got %+v", rec.decisions)
+	}
+}
+
+func TestNotifier_PanickingObserver(t *testing.T) {
+	notifier := NewNotifier(Funcs{Decision: func(Decision) { panic("observer bug") }})
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := notifier.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	for i := 0; i < 3; i++ {
+		if allowed, err := limiter.Allow("alice"); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+	notifier.Close()
+	if dropped := notifier.Dropped(); dropped != 3 {
+		t.Errorf("Expected 3 dropped events, got %d", dropped)
+	}
+}
+
+func TestNotifier_BlockingObserver(t *testing.T) {
+	unblock := make(chan struct{})
+	var delivered int
+	notifier := NewNotifier(Funcs{Decision: func(Decision) {
+		<-unblock
+		delivered++
+	}}, WithBufferSize(1))
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 100, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := notifier.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	// The decisions return while the observer is blocked
+	for i := 0; i < 10; i++ {
+		limiter.Allow("alice")
+	}
+	close(unblock)
+	notifier.Close()
+
+	if dropped := notifier.Dropped(); dropped < 8 || int(dropped)+delivered != 10 {
+		t.Errorf("Expected at least 8 of 10 events to be dropped, got %d dropped and %d delivered", dropped, delivered)
+	}
+}
+
+func TestNotifier_Close(t *testing.T) {
+	rec := &recorder{}
+	notifier := NewNotifier(rec)
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := notifier.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	limiter.Allow("alice")
+	if err := notifier.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	limiter.Allow("alice")
+	if err := notifier.Close(); err != nil {
+		t.Errorf("Expected closing twice to do nothing, got %v", err)
+	}
+
+	if len(rec.decisions) != 1 {
+		t.Errorf("Expected the decision made before Close to be delivered, got %d", len(rec.decisions))
+	}
+	if dropped := notifier.Dropped(); dropped != 1 {
+		t.Errorf("Expected the decision made after Close to be dropped, got %d dropped", dropped)
+	}
+}
+
+func TestNotifier_CloseWhileNotifying(t *testing.T) {
+	var delivered atomic.Uint64
+	notifier := NewNotifier(Funcs{Decision: func(Decision) { delivered.Add(1) }})
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 1000, 1000)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := notifier.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	const goroutines, requests = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requests; j++ {
+				limiter.Allow("alice")
+			}
+		}()
+	}
+	notifier.Close()
+	wg.Wait()
+
+	// Every event is either delivered or counted as dropped, even those racing Close
+	if total := delivered.Load() + notifier.Dropped(); total != goroutines*requests {
+		t.Errorf("Expected %d events delivered or dropped, got %d", goroutines*requests, total)
+	}
+}
+
+func TestNotifier_Reservations(t *testing.T) {
+	rec := &recorder{}
+	notifier := NewNotifier(rec)
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	inner, err := ratelimiter.NewFixedWindowLimiter(store.NewMemoryStore(store.WithClock(fake)), 1, time.Minute, ratelimiter.WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := notifier.WrapLimiter("login", inner)
+	defer limiter.Close()
+
+	composite, err := ratelimiter.NewCompositeLimiter([]ratelimiter.CompositeChild{{Name: "login", Limiter: limiter}})
+	if err != nil {
+		t.Fatalf("Expected the wrapped limiter to be a composite child, got %v", err)
+	}
+	if allowed, err := composite.Allow("alice"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := limiter.Wait(ctx, "alice"); !errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		t.Errorf("Expected ErrWaitExceedsDeadline, got %v", err)
+	}
+	if err := limiter.Reset(context.Background(), "alice"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if err := limiter.Wait(context.Background(), "alice"); err != nil {
+		t.Errorf("Expected the request to be allowed after Reset, got %v", err)
+	}
+	notifier.Close()
+
+	if len(rec.decisions) != 3 {
+		t.Fatalf("Expected 3 decisions, got %d", len(rec.decisions))
+	}
+	for i, expected := range []bool{true, false, true} {
+		if d := rec.decisions[i]; d.Allowed != expected || d.Err != nil || d.Key != "alice" {
+			t.Errorf("Decision %d: expected allowed %v, got %+v", i+1, expected, d)
+		}
+	}
+
+}
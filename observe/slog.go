@@ -0,0 +1,212 @@
+package observe
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+)
+
+// Default sampling of a SlogObserver: the first DefaultSample events of each limiter, key
+// and outcome are logged in each DefaultSamplePeriod.
+const (
+	DefaultSample       = 10
+	DefaultSamplePeriod = time.Minute
+)
+
+// maxSampledKeys bounds the keys a SlogObserver counts events for in a period. Events of
+// further keys share a single count.
+const maxSampledKeys = 10000
+
+// Levels the events are logged at.
+const (
+	allowedLevel = slog.LevelDebug
+	deniedLevel  = slog.LevelInfo
+	errorLevel   = slog.LevelError
+)
+
+// SlogObserver is an Observer that logs events with a slog.Logger. Allowed requests are
+// logged at the debug level, denied requests at the info level, and failed decisions and
+// store operations at the error level.
+//
+// Events are sampled so that a noisy key does not flood the logs: only the first events of
+// each limiter or store, key and outcome are logged in each period, and the next event
+// logged for them reports how many were dropped in its "dropped" attribute.
+type SlogObserver struct {
+	logger *slog.Logger
+	sample int           // Events logged per sample key in each period; every event if not positive
+	period time.Duration // Length of the sampling periods
+	clock  clock.Clock   // Source of time for the sampling periods; the real clock if nil
+
+	mu          sync.Mutex
+	periodStart time.Time                  // Start of the current period
+	counts      map[sampleKey]*sampleCount // Events of the current period
+}
+
+// sampleKey identifies the events sampled together.
+type sampleKey struct {
+	source  string // Name of the limiter or store
+	key     string
+	outcome string
+}
+
+// sampleCount counts the events of a sample key.
+type sampleCount struct {
+	seen    int // Events in the current period
+	dropped int // Events dropped and not reported yet
+}
+
+// SlogOption configures optional behavior of a SlogObserver.
+type SlogOption func(*SlogObserver)
+
+// WithSampling logs the first n events of each limiter or store, key and outcome in each
+// period. An n that is not positive logs every event. The default is DefaultSample events
+// per DefaultSamplePeriod.
+func WithSampling(n int, period time.Duration) SlogOption {
+	return func(o *SlogObserver) {
+		o.sample = n
+		o.period = period
+	}
+}
+
+// WithClock makes the observer measure the sampling periods with c instead of the real
+// clock. A nil clock selects the real clock.
+func WithClock(c clock.Clock) SlogOption {
+	return func(o *SlogObserver) {
+		o.clock = c
+	}
+}
+
+// NewSlogObserver returns a SlogObserver logging with logger, or slog.Default if nil.
+func NewSlogObserver(logger *slog.Logger, opts ...SlogOption) *SlogObserver {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	o := &SlogObserver{
+		logger: logger,
+		sample: DefaultSample,
+		period: DefaultSamplePeriod,
+		counts: make(map[sampleKey]*sampleCount),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// ObserveDecision logs a decision.
+func (o *SlogObserver) ObserveDecision(d Decision) {
+	level, outcome, msg := deniedLevel, "denied", "request denied"
+	switch {
+	case d.Err != nil:
+		level, outcome, msg = errorLevel, "error", "rate limit decision failed"
+	case d.Allowed:
+		level, outcome, msg = allowedLevel, "allowed", "request allowed"
+	}
+
+	attrs := []slog.Attr{
+		slog.String("limiter", d.Limiter),
+		slog.String("policy", d.Policy),
+		slog.String("key", d.Key),
+		slog.Int64("cost", d.Cost),
+	}
+	switch {
+	case d.Err != nil:
+		attrs = append(attrs, slog.Any("error", d.Err))
+	case d.Allowed:
+		attrs = append(attrs, slog.Int64("remaining", d.Remaining))
+	default:
+		attrs = append(attrs, slog.Duration("retry_after", d.RetryAfter))
+		if d.RejectedBy != "" {
+			attrs = append(attrs, slog.String("rejected_by", d.RejectedBy))
+		}
+	}
+	o.log(d.Time, level, msg, sampleKey{source: d.Limiter, key: d.Key, outcome: outcome}, attrs)
+}
+
+// ObserveStoreError logs a failed store operation.
+func (o *SlogObserver) ObserveStoreError(e StoreError) {
+	attrs := []slog.Attr{
+		slog.String("store", e.Store),
+		slog.String("method", e.Method),
+		slog.String("key", e.Key),
+		slog.Any("error", e.Err),
+	}
+	o.log(e.Time, errorLevel, "store operation failed", sampleKey{source: e.Store, key: e.Key, outcome: e.Method}, attrs)
+}
+
+// log logs an event that happened at t, unless its level is disabled or it is sampled out.
+func (o *SlogObserver) log(t time.Time, level slog.Level, msg string, key sampleKey, attrs []slog.Attr) {
+	ctx := context.Background()
+	if !o.logger.Enabled(ctx, level) {
+		return
+	}
+	dropped, ok := o.admit(key)
+	if !ok {
+		return
+	}
+	if dropped > 0 {
+		attrs = append(attrs, slog.Int("dropped", dropped))
+	}
+
+	record := slog.NewRecord(t, level, msg, 0)
+	record.AddAttrs(attrs...)
+	_ = o.logger.Handler().Handle(ctx, record)
+}
+
+// admit counts an event of the sample key and reports whether to log it, with the events
+// dropped since the last one logged.
+func (o *SlogObserver) admit(key sampleKey) (dropped int, ok bool) {
+	if o.sample <= 0 {
+		return 0, true
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := o.now()
+	if now.Sub(o.periodStart) >= o.period {
+		o.startPeriod(now)
+	}
+
+	count, exists := o.counts[key]
+	if !exists {
+		if len(o.counts) >= maxSampledKeys {
+			key = sampleKey{}
+			count = o.counts[key]
+		}
+		if count == nil {
+			count = &sampleCount{}
+			o.counts[key] = count
+		}
+	}
+	count.seen++
+	if count.seen > o.sample {
+		count.dropped++
+		return 0, false
+	}
+	dropped, count.dropped = count.dropped, 0
+	return dropped, true
+}
+
+// startPeriod starts a sampling period at now, carrying over the dropped events not
+// reported yet for the keys seen in the last period. The caller holds o.mu.
+func (o *SlogObserver) startPeriod(now time.Time) {
+	counts := make(map[sampleKey]*sampleCount)
+	for key, count := range o.counts {
+		if count.seen > 0 && count.dropped > 0 {
+			counts[key] = &sampleCount{dropped: count.dropped}
+		}
+	}
+	o.counts = counts
+	o.periodStart = now
+}
+
+// now returns the current time of the clock of the observer.
+func (o *SlogObserver) now() time.Time {
+	if o.clock == nil {
+		return time.Now()
+	}
+	return o.clock.Now()
+}
@@ -0,0 +1,119 @@
+// observe/slog_test.go
+
+package observe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+)
+
+// newTestLogger returns a logger writing JSON lines at the given level to the returned
+// buffer.
+func newTestLogger(level slog.Level) (*slog.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})), &buf
+}
+
+// logLines returns the lines logged to buf.
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("Invalid log line %q: %v", line, err)
+		}
+		lines = append(lines, fields)
+	}
+	buf.Reset()
+	return lines
+}
+
+func TestSlogObserver_Decisions(t *testing.T) {
+	logger, buf := newTestLogger(slog.LevelInfo)
+	observer := NewSlogObserver(logger)
+	at := time.Unix(1700000000, 0).UTC()
+
+	observer.ObserveDecision(Decision{Time: at, Limiter: "api", Policy: "GCRA", Key: "alice", Cost: 1, Allowed: true})
+	observer.ObserveDecision(Decision{Time: at, Limiter: "api", Policy: "GCRA", Key: "alice", Cost: 1, RetryAfter: time.Second})
+	observer.ObserveDecision(Decision{Time: at, Limiter: "api", Policy: "GCRA", Key: "", Cost: 1, Err: errors.New("invalid key")})
+	observer.ObserveStoreError(StoreError{Time: at, Store: "redis", Method: "UpdateGCRA", Key: "api:alice", Err: errors.New("connection refused")})
+
+	lines := logLines(t, buf)
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines with allowed requests at the debug level, got %v", lines)
+	}
+	tests := []struct {
+		level string
+		msg   string
+		attr  string
+	}{
+		{level: "INFO", msg: "request denied", attr: "retry_after"},
+		{level: "ERROR", msg: "rate limit decision failed", attr: "error"},
+		{level: "ERROR", msg: "store operation failed", attr: "method"},
+	}
+	for i, tt := range tests {
+		line := lines[i]
+		if line["level"] != tt.level || line["msg"] != tt.msg {
+			t.Errorf("Line %d: expected %s %q, got %v", i+1, tt.level, tt.msg, line)
+		}
+		if _, ok := line[tt.attr]; !ok {
+			t.Errorf("Line %d: expected the %s attribute, got %v", i+1, tt.attr, line)
+		}
+		if line["time"] != at.Format(time.RFC3339) {
+			t.Errorf("Line %d: expected the time of the event, got %v", i+1, line["time"])
+		}
+	}
+}
+
+func TestSlogObserver_Sampling(t *testing.T) {
+	logger, buf := newTestLogger(slog.LevelDebug)
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	observer := NewSlogObserver(logger, WithSampling(2, time.Minute), WithClock(fake))
+	denied := func(key string) Decision {
+		return Decision{Time: fake.Now(), Limiter: "api", Key: key, Cost: 1}
+	}
+
+	for i := 0; i < 5; i++ {
+		observer.ObserveDecision(denied("alice"))
+	}
+	observer.ObserveDecision(denied("bob"))
+	observer.ObserveDecision(Decision{Time: fake.Now(), Limiter: "api", Key: "alice", Cost: 1, Allowed: true})
+	if lines := logLines(t, buf); len(lines) != 4 {
+		t.Errorf("Expected 2 denials of alice, 1 of bob and 1 allowed request, got %d lines", len(lines))
+	}
+
+	// The next period reports the dropped events
+	fake.Advance(time.Minute)
+	observer.ObserveDecision(denied("alice"))
+	lines := logLines(t, buf)
+	if len(lines) != 1 || lines[0]["dropped"] != float64(3) {
+		t.Errorf("Expected the 3 dropped denials of alice to be reported, got %v", lines)
+	}
+	observer.ObserveDecision(denied("alice"))
+	if lines := logLines(t, buf); len(lines) != 1 || lines[0]["dropped"] != nil {
+		t.Errorf("Expected the dropped count to be reported once, got %v", lines)
+	}
+}
+
+func TestSlogObserver_NoSampling(t *testing.T) {
+	logger, buf := newTestLogger(slog.LevelInfo)
+	observer := NewSlogObserver(logger, WithSampling(0, 0))
+
+	for i := 0; i < 20; i++ {
+		observer.ObserveDecision(Decision{Limiter: "api", Key: "alice", Cost: 1})
+	}
+	if lines := logLines(t, buf); len(lines) != 20 {
+		t.Errorf("Expected every event to be logged, got %d lines", len(lines))
+	}
+}
@@ -0,0 +1,301 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+)
+
+// CompositeChild is a limiter enforced by a CompositeLimiter. The name identifies it in the
+// RejectedBy field of results.
+type CompositeChild struct {
+	Name    string      // Name reported when the child rejects a request
+	Limiter RateLimiter // Limiter enforced; it must implement Reserver, as all limiters of this package do
+}
+
+// reservingLimiter is a limiter that can take capacity ahead of time and give it back.
+type reservingLimiter interface {
+	RateLimiter
+	Reserver
+}
+
+// CompositeLimiter enforces several limiters on the same key at once, such as 10 requests
+// per second and 1000 per hour and 5 concurrent requests. A request is charged to every
+// child, in order, and only admitted if all of them admit it; otherwise the capacity taken
+// from the children that did is given back, and the result reports the child that rejected
+// it in RejectedBy.
+//
+// Children are tried in order and the first rejection ends the decision, so its RetryAfter
+// is that of the rejecting child only, and listing the most restrictive children first
+// saves store round trips. The capacity given back is briefly unavailable to concurrent
+// requests, and is lost if the store fails while it is given back.
+//
+// Slots of ConcurrencyLimiter children stay held until the request is released with
+// Release or ReleaseN. Keys are validated and namespaced by each child.
+type CompositeLimiter struct {
+	children  []CompositeChild   // Children enforced, in the order they are tried
+	limiters  []reservingLimiter // Limiters of the children
+	lifecycle                    // Tracks whether the limiter is closed
+	options                      // Optional settings such as the clock
+}
+
+// NewCompositeLimiter creates a CompositeLimiter enforcing the given children. Their names
+// must be unique. Of the options, only WithClock applies, to the waits of Wait and WaitN.
+func NewCompositeLimiter(children []CompositeChild, opts ...Option) (*CompositeLimiter, error) {
+	if len(children) == 0 {
+		return nil, errors.New("composite limiter needs at least one child")
+	}
+
+	limiters := make([]reservingLimiter, len(children))
+	names := make(map[string]bool, len(children))
+	for i, child := range children {
+		if child.Limiter == nil {
+			return nil, fmt.Errorf("child %q: limiter cannot be nil", child.Name)
+		}
+		limiter, ok := child.Limiter.(reservingLimiter)
+		if !ok {
+			return nil, fmt.Errorf("child %q: limiter does not support reservations", child.Name)
+		}
+		if names[child.Name] {
+			return nil, fmt.Errorf("duplicate child name %q", child.Name)
+		}
+		names[child.Name] = true
+		limiters[i] = limiter
+	}
+
+	return &CompositeLimiter{
+		children: append([]CompositeChild(nil), children...),
+		limiters: limiters,
+		options:  newOptions("", opts),
+	}, nil
+}
+
+// Allow checks if a request associated with the given key is admitted by every child.
+func (l *CompositeLimiter) Allow(key string) (bool, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks if a request of cost n associated with the given key is admitted by every
+// child.
+func (l *CompositeLimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.DecideN(key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the children, so its
+// cancellation and deadline apply to store calls.
+func (l *CompositeLimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.DecideNContext(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Decide checks if a request associated with the given key is admitted by every child.
+// An admitted request reports the quota of the child with the least remaining; a rejected
+// one reports the result of the child that rejected it.
+func (l *CompositeLimiter) Decide(key string) (*Result, error) {
+	return l.DecideN(key, 1)
+}
+
+// DecideN is like Decide for a request of cost n, charged n units by every child.
+func (l *CompositeLimiter) DecideN(key string, n int64) (*Result, error) {
+	return l.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the children, so its
+// cancellation and deadline apply to store calls.
+func (l *CompositeLimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := l.reserveN(ctx, key, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
+
+// Reserve reserves capacity from every child for a request associated with the given key,
+// waiting as long as needed.
+func (l *CompositeLimiter) Reserve(key string) (*Reservation, error) {
+	return l.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN reserves n units of capacity from every child, to be used no later than
+// maxDelay from now. The request may proceed once every child allows it. If a child cannot
+// provide the capacity within maxDelay, nothing is consumed and the reservation is not OK.
+// Cancelling the reservation gives the capacity back to every child.
+func (l *CompositeLimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.reserveN(ctx, key, n, maxDelay)
+}
+
+// Wait blocks until a request associated with the given key is admitted by every child, or
+// the context is done.
+func (l *CompositeLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until a request of cost n associated with the given key is admitted by
+// every child, or the context is done. It fails immediately with ErrWaitExceedsDeadline,
+// without consuming capacity, if a child cannot admit it before the context deadline.
+func (l *CompositeLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	return waitN(ctx, l, l.getClock(), key, n)
+}
+
+// Release releases a slot of every ConcurrencyLimiter child after processing.
+func (l *CompositeLimiter) Release(key string) error {
+	return l.ReleaseN(key, 1)
+}
+
+// ReleaseN releases n slots of every ConcurrencyLimiter child after processing.
+func (l *CompositeLimiter) ReleaseN(key string, n int64) error {
+	if err := l.checkOpen(); err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, limiter := range l.limiters {
+		if releaser, ok := limiter.(interface {
+			ReleaseN(key string, n int64) error
+		}); ok {
+			if err := releaser.ReleaseN(key, n); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", l.children[i].Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close makes later calls fail with ErrClosed. It does not close the children. Closing a
+// closed limiter does nothing.
+func (l *CompositeLimiter) Close() error {
+	l.shutdown(nil)
+	return nil
+}
+
+// reserveN reserves capacity from every child in turn, giving it back to all of them as
+// soon as one cannot provide it.
+func (l *CompositeLimiter) reserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := l.checkOpen(); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, ErrInvalidCost
+	}
+
+	steps := make([]reservationStep, len(l.limiters))
+	for i, limiter := range l.limiters {
+		steps[i] = reservationStep{name: l.children[i].Name, limiter: limiter, key: key}
+	}
+	return reserveAll(ctx, l.getClock(), steps, n, maxDelay)
+}
+
+// reservationStep is a limiter charged by reserveAll and the key it is charged under.
+type reservationStep struct {
+	name    string           // Name reported if the limiter rejects the request
+	limiter reservingLimiter // Limiter charged
+	key     string           // Key charged
+}
+
+// reserveAll reserves n units from the limiter of every step in turn, giving the capacity
+// back to all of them as soon as one cannot provide it, and reporting the name of that one
+// in RejectedBy.
+func reserveAll(ctx context.Context, c clock.Clock, steps []reservationStep, n int64, maxDelay time.Duration) (*Reservation, error) {
+	reservations := make([]*Reservation, 0, len(steps))
+	for _, step := range steps {
+		reservation, err := step.limiter.ReserveN(ctx, step.key, n, maxDelay)
+		if err != nil {
+			if rollbackErr := rollback(reservations); rollbackErr != nil {
+				err = errors.Join(err, rollbackErr)
+			}
+			return nil, fmt.Errorf("%s: %w", step.name, err)
+		}
+
+		if !reservation.OK() {
+			if err := rollback(reservations); err != nil {
+				return nil, err
+			}
+			rejected := &Reservation{
+				clock:     c,
+				timeToAct: reservation.timeToAct,
+				result:    reservation.result,
+			}
+			rejected.result.RejectedBy = joinChildName(step.name, reservation.result.RejectedBy)
+			return rejected, nil
+		}
+		reservations = append(reservations, reservation)
+	}
+
+	// The request may proceed once the slowest limiter allows it, and reports the quota
+	// of the limiter closest to rejecting requests. Delays are measured by each limiter,
+	// on its own clock
+	var delay time.Duration
+	result := reservations[0].result
+	result.RetryAfter = 0
+	for _, reservation := range reservations {
+		if stepDelay := reservation.Delay(); stepDelay > delay {
+			delay = stepDelay
+		}
+		if !reservation.result.Allowed {
+			result.Allowed = false
+		}
+		if reservation.result.RetryAfter > result.RetryAfter {
+			result.RetryAfter = reservation.result.RetryAfter
+		}
+		if tighter(reservation.result, result) {
+			result.Limit = reservation.result.Limit
+			result.Remaining = reservation.result.Remaining
+			result.ResetAt = reservation.result.ResetAt
+		}
+	}
+	result.RejectedBy = ""
+
+	return &Reservation{
+		clock:     c,
+		ok:        true,
+		timeToAct: c.Now().Add(delay),
+		result:    result,
+		cancel:    func() error { return rollback(reservations) },
+	}, nil
+}
+
+// rollback cancels the given reservations, last first, returning the errors of those that
+// could not be cancelled.
+func rollback(reservations []*Reservation) error {
+	var errs []error
+	for i := len(reservations) - 1; i >= 0; i-- {
+		if err := reservations[i].Cancel(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("rolling back reservations: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// tighter reports whether a leaves less quota than b, so that it should be reported in
+// place of b.
+func tighter(a, b Result) bool {
+	if a.Remaining != b.Remaining {
+		return a.Remaining < b.Remaining
+	}
+	return a.ResetAt.After(b.ResetAt)
+}
+
+// joinChildName returns the name a rejection is reported under, prefixing the name given
+// by a nested CompositeLimiter with the name of the child.
+func joinChildName(name, nested string) string {
+	if nested == "" {
+		return name
+	}
+	return name + "/" + nested
+}
@@ -0,0 +1,242 @@
+// ratelimiter/composite_test.go
+
+package ratelimiter
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/store"
+)
+
+// newTestComposite returns a composite of a burst of 2 tokens refilled every second and a
+// limit of 5 requests per hour, on a fake clock and a store shared by both.
+func newTestComposite(t *testing.T) (*CompositeLimiter, *clock.Fake) {
+	t.Helper()
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := store.NewMemoryStore(store.WithClock(fake))
+
+	burst, err := NewTokenBucketLimiter(memStore, 2, 1, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	hourly, err := NewFixedWindowLimiter(memStore, 5, time.Hour, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	t.Cleanup(func() {
+		burst.Close()
+		hourly.Close()
+	})
+
+	limiter, err := NewCompositeLimiter([]CompositeChild{
+		{Name: "burst", Limiter: burst},
+		{Name: "hourly", Limiter: hourly},
+	}, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create composite limiter: %v", err)
+	}
+	return limiter, fake
+}
+
+func TestCompositeLimiter_Rollback(t *testing.T) {
+	limiter, fake := newTestComposite(t)
+	key := "user1"
+
+	for i := 0; i < 2; i++ {
+		if allowed, err := limiter.Allow(key); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed || result.RejectedBy != "burst" {
+		t.Fatalf("Expected a rejection by burst, got %+v", result)
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("Expected the retry-after of burst, got %v", result.RetryAfter)
+	}
+
+	// The rejected requests were not charged to the hourly limit, so 3 more fit in the hour
+	for i := 0; i < 3; i++ {
+		fake.Advance(time.Second)
+		if allowed, err := limiter.Allow(key); err != nil || !allowed {
+			t.Fatalf("Request %d after refill should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+	fake.Advance(time.Second)
+	result, err = limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed || result.RejectedBy != "hourly" {
+		t.Errorf("Expected a rejection by hourly, got %+v", result)
+	}
+
+	// The token taken by the burst limiter for the rejected request was given back
+	fake.Advance(time.Hour)
+	for i := 0; i < 2; i++ {
+		if allowed, err := limiter.Allow(key); err != nil || !allowed {
+			t.Errorf("Request %d in the next hour should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+}
+
+func TestCompositeLimiter_Result(t *testing.T) {
+	limiter, _ := newTestComposite(t)
+
+	// The burst limiter has the least quota left, so its quota is reported
+	result, err := limiter.Decide("user1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Allowed || result.RejectedBy != "" {
+		t.Fatalf("Expected the request to be allowed, got %+v", result)
+	}
+	if result.Limit != 2 || result.Remaining != 1 {
+		t.Errorf("Expected limit 2 with 1 remaining, got %d with %d", result.Limit, result.Remaining)
+	}
+}
+
+func TestCompositeLimiter_Concurrency(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	concurrent, _ := NewConcurrencyLimiter(memStore, 1)
+	burst, _ := NewTokenBucketLimiter(memStore, 2, 0.001)
+	defer concurrent.Close()
+	defer burst.Close()
+	limiter, err := NewCompositeLimiter([]CompositeChild{
+		{Name: "burst", Limiter: burst},
+		{Name: "concurrent", Limiter: concurrent},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create composite limiter: %v", err)
+	}
+	key := "user1"
+
+	if allowed, err := limiter.Allow(key); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed || result.RejectedBy != "concurrent" {
+		t.Fatalf("Expected a rejection by concurrent while the slot is held, got %+v", result)
+	}
+
+	// Releasing frees the slot, and the rejected request's token was given back
+	if err := limiter.Release(key); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if allowed, err := limiter.Allow(key); err != nil || !allowed {
+		t.Errorf("Expected the request to be allowed after Release, got %v, %v", allowed, err)
+	}
+}
+
+func TestCompositeLimiter_Nested(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	perUser, _ := NewFixedWindowLimiter(memStore, 1, time.Hour)
+	defer perUser.Close()
+	inner, err := NewCompositeLimiter([]CompositeChild{{Name: "hourly", Limiter: perUser}})
+	if err != nil {
+		t.Fatalf("Failed to create composite limiter: %v", err)
+	}
+	outer, err := NewCompositeLimiter([]CompositeChild{{Name: "user", Limiter: inner}})
+	if err != nil {
+		t.Fatalf("Failed to create composite limiter: %v", err)
+	}
+
+	outer.Allow("user1")
+	result, err := outer.Decide("user1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RejectedBy != "user/hourly" {
+		t.Errorf("Expected rejection by user/hourly, got %q", result.RejectedBy)
+	}
+}
+
+func TestCompositeLimiter_Reserve(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := store.NewMemoryStore(store.WithClock(fake))
+	fast, _ := NewTokenBucketLimiter(memStore, 1, 2, WithClock(fake))
+	slow, _ := NewTokenBucketLimiter(memStore, 1, 0.5, WithClock(fake))
+	defer fast.Close()
+	defer slow.Close()
+	limiter, err := NewCompositeLimiter([]CompositeChild{
+		{Name: "fast", Limiter: fast},
+		{Name: "slow", Limiter: slow},
+	}, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create composite limiter: %v", err)
+	}
+	key := "user1"
+
+	if allowed, _ := limiter.Allow(key); !allowed {
+		t.Fatal("First request should be allowed")
+	}
+	reservation, err := limiter.Reserve(key)
+	if err != nil || !reservation.OK() {
+		t.Fatalf("Expected a delayed reservation, got %v", err)
+	}
+	if delay := reservation.Delay(); delay != 2*time.Second {
+		t.Errorf("Expected the delay of the slowest child, 2s, got %v", delay)
+	}
+
+	// Cancelling gives the tokens back to both children
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	fake.Advance(2 * time.Second)
+	if allowed, _ := limiter.Allow(key); !allowed {
+		t.Error("Expected the cancelled tokens to be available")
+	}
+}
+
+// plainLimiter hides every method of a limiter but those of RateLimiter.
+type plainLimiter struct {
+	RateLimiter
+}
+
+func TestNewCompositeLimiter_Errors(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	child, _ := NewFixedWindowLimiter(memStore, 1, time.Hour)
+	defer child.Close()
+
+	tests := []struct {
+		name     string
+		children []CompositeChild
+	}{
+		{name: "No children"},
+		{name: "Nil limiter", children: []CompositeChild{{Name: "a"}}},
+		{name: "Duplicate names", children: []CompositeChild{{Name: "a", Limiter: child}, {Name: "a", Limiter: child}}},
+		{name: "No reservations", children: []CompositeChild{{Name: "a", Limiter: plainLimiter{child}}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewCompositeLimiter(tt.children); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestCompositeLimiter_Errors(t *testing.T) {
+	limiter, _ := newTestComposite(t)
+
+	// A cost over the burst fails without charging the hourly limit
+	if _, err := limiter.AllowN("user1", 3); !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+	if _, err := limiter.AllowN("user1", 0); !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost, got %v", err)
+	}
+
+	limiter.Close()
+	if _, err := limiter.Allow("user1"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
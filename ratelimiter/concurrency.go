@@ -1,25 +1,36 @@
 package ratelimiter
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
+	"github.com/neelp03/throttlex/clock"
 	"github.com/neelp03/throttlex/store"
 )
 
+// concurrencyWaitInterval is how often Wait checks whether slots have been released.
+const concurrencyWaitInterval = 10 * time.Millisecond
+
 // ConcurrencyLimiter limits the number of concurrent requests per key.
 type ConcurrencyLimiter struct {
 	store           store.Store   // Storage backend to keep track of concurrency counts
 	maxConcurrent   int64         // Maximum number of concurrent requests
 	mutexes         sync.Map      // Map of mutexes for per-key synchronization
-	cleanupTicker   *time.Ticker  // Ticker for periodic mutex cleanup
+	cleanupTicker   clock.Ticker  // Ticker for periodic mutex cleanup
 	cleanupStopCh   chan struct{} // Channel to stop the cleanup goroutine
 	cleanupInterval time.Duration // Interval for mutex cleanup
+	lifecycle                     // Tracks whether the limiter is closed
+	options                       // Optional settings such as the clock
 }
 
-// NewConcurrencyLimiter creates a new ConcurrencyLimiter.
-func NewConcurrencyLimiter(store store.Store, maxConcurrent int64) (*ConcurrencyLimiter, error) {
+// NewConcurrencyLimiter creates a new ConcurrencyLimiter. As with the other policies, the
+// default namespace includes maxConcurrent, so limiters with different maximums sharing a
+// store count their slots apart. Slots held when the maximum changes are then released to
+// the old counter; set a fixed namespace with WithNamespace to keep them counted across
+// such changes.
+func NewConcurrencyLimiter(store store.Store, maxConcurrent int64, opts ...Option) (*ConcurrencyLimiter, error) {
 	if maxConcurrent <= 0 {
 		return nil, errors.New("maxConcurrent must be greater than zero")
 	}
@@ -33,6 +44,7 @@ func NewConcurrencyLimiter(store store.Store, maxConcurrent int64) (*Concurrency
 		mutexes:         sync.Map{},
 		cleanupInterval: time.Minute * 5,
 		cleanupStopCh:   make(chan struct{}),
+		options:         newOptions(defaultNamespace(ConcurrencyPolicy, maxConcurrent), opts),
 	}
 	go limiter.startMutexCleanup()
 	return limiter, nil
@@ -42,58 +54,188 @@ func NewConcurrencyLimiter(store store.Store, maxConcurrent int64) (*Concurrency
 func (cl *ConcurrencyLimiter) getMutex(key string) *keyMutex {
 	mutexInterface, _ := cl.mutexes.LoadOrStore(key, &keyMutex{
 		mu:         &sync.Mutex{},
-		lastAccess: time.Now(),
+		lastAccess: cl.now(),
 	})
 	return mutexInterface.(*keyMutex)
 }
 
 // Allow tries to acquire a slot for processing.
 func (cl *ConcurrencyLimiter) Allow(key string) (bool, error) {
-	// Input validation
-	if err := validateKey(key); err != nil {
+	return cl.AllowN(key, 1)
+}
+
+// AllowN tries to acquire n slots for processing.
+func (cl *ConcurrencyLimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := cl.DecideN(key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (cl *ConcurrencyLimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := cl.DecideNContext(ctx, key, 1)
+	if err != nil {
 		return false, err
 	}
+	return result.Allowed, nil
+}
+
+// Decide tries to acquire a slot for processing and reports the slots left.
+// Slots are only freed by Release, so ResetAt and RetryAfter are always zero.
+func (cl *ConcurrencyLimiter) Decide(key string) (*Result, error) {
+	return cl.DecideN(key, 1)
+}
+
+// DecideN tries to acquire n slots for processing and reports the slots left.
+// ErrCostExceedsCapacity is returned if n exceeds the maximum concurrency.
+func (cl *ConcurrencyLimiter) DecideN(key string, n int64) (*Result, error) {
+	return cl.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (cl *ConcurrencyLimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := cl.reserveN(ctx, key, n)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
+
+// Reserve tries to acquire a slot for processing. Cancelling the reservation releases the slot.
+func (cl *ConcurrencyLimiter) Reserve(key string) (*Reservation, error) {
+	return cl.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN tries to acquire n slots for processing. Slots are only freed by Release, so
+// they cannot be reserved ahead of time: the reservation is OK with no delay if the slots
+// are free now and not OK otherwise, whatever maxDelay is. Cancelling the reservation
+// releases the slots.
+func (cl *ConcurrencyLimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return cl.reserveN(ctx, key, n)
+}
+
+// Wait blocks until a slot is acquired, or the context is done.
+func (cl *ConcurrencyLimiter) Wait(ctx context.Context, key string) error {
+	return cl.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until n slots are acquired, or the context is done. Since there is no way
+// to know when slots will be released, it polls the store until they are free.
+func (cl *ConcurrencyLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	ticker := cl.getClock().NewTicker(concurrencyWaitInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		result, err := cl.DecideNContext(ctx, key, n)
+		if err != nil || result.Allowed {
+			return err
+		}
+
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// reserveN acquires n slots if they are free.
+func (cl *ConcurrencyLimiter) reserveN(ctx context.Context, key string, n int64) (*Reservation, error) {
+	if err := cl.checkOpen(); err != nil {
+		return nil, err
+	}
+	// Input validation
+	key, err := cl.storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCost(n, float64(cl.maxConcurrent)); err != nil {
+		return nil, err
+	}
 
 	km := cl.getMutex(key)
 	km.mu.Lock()
 	defer km.mu.Unlock()
-	km.lastAccess = time.Now()
+	km.lastAccess = cl.now()
 
-	count, err := cl.store.Increment(key, 1, time.Hour*24)
+	count, err := cl.store.IncrementContext(ctx, key, n, time.Hour*24)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	reservation := &Reservation{
+		clock:     cl.getClock(),
+		timeToAct: cl.now(),
+		result:    Result{Limit: cl.maxConcurrent},
 	}
 
 	if count > cl.maxConcurrent {
-		// Exceeded limit, decrement the count
-		_, err = cl.store.Increment(key, -1, time.Hour*24)
+		// Exceeded limit, decrement the count even if the context is cancelled in the meantime
+		count, err = cl.store.IncrementContext(context.WithoutCancel(ctx), key, -n, time.Hour*24)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
-		return false, nil
+		if remaining := cl.maxConcurrent - count; remaining > 0 {
+			reservation.result.Remaining = remaining
+		}
+		return reservation, nil
 	}
 
-	return true, nil
+	reservation.ok = true
+	reservation.cancel = func() error { return cl.release(key, n) }
+	reservation.result.Allowed = true
+	reservation.result.Remaining = cl.maxConcurrent - count
+	return reservation, nil
 }
 
 // Release releases a slot after processing.
 func (cl *ConcurrencyLimiter) Release(key string) error {
+	return cl.ReleaseN(key, 1)
+}
+
+// ReleaseN releases n slots after processing.
+func (cl *ConcurrencyLimiter) ReleaseN(key string, n int64) error {
+	if err := cl.checkOpen(); err != nil {
+		return err
+	}
+	if n <= 0 {
+		return ErrInvalidCost
+	}
+	key, err := cl.storeKey(key)
+	if err != nil {
+		return err
+	}
+	return cl.release(key, n)
+}
+
+// release frees n slots of the store key.
+func (cl *ConcurrencyLimiter) release(key string, n int64) error {
 	km := cl.getMutex(key)
 	km.mu.Lock()
 	defer km.mu.Unlock()
-	km.lastAccess = time.Now()
+	km.lastAccess = cl.now()
 
-	_, err := cl.store.Increment(key, -1, time.Hour*24)
+	_, err := cl.store.Increment(key, -n, time.Hour*24)
 	return err
 }
 
 // startMutexCleanup runs a background goroutine to clean up unused mutexes.
 func (cl *ConcurrencyLimiter) startMutexCleanup() {
-	cl.cleanupTicker = time.NewTicker(cl.cleanupInterval)
+	cl.cleanupTicker = cl.getClock().NewTicker(cl.cleanupInterval)
 	for {
 		select {
-		case <-cl.cleanupTicker.C:
-			now := time.Now()
+		case <-cl.cleanupTicker.C():
+			now := cl.now()
 			cl.mutexes.Range(func(key, value interface{}) bool {
 				km := value.(*keyMutex)
 				km.mu.Lock()
@@ -112,7 +254,51 @@ func (cl *ConcurrencyLimiter) startMutexCleanup() {
 	}
 }
 
-// StopCleanup stops the mutex cleanup goroutine.
+// Close stops the mutex cleanup goroutine and makes later calls fail with ErrClosed. It
+// does not close the store, which may be shared. Closing a closed limiter does nothing.
+func (cl *ConcurrencyLimiter) Close() error {
+	cl.shutdown(func() { close(cl.cleanupStopCh) })
+	return nil
+}
+
+// StopCleanup stops the mutex cleanup goroutine, leaving the limiter usable. Calling it
+// again, or after Close, does nothing.
 func (cl *ConcurrencyLimiter) StopCleanup() {
-	close(cl.cleanupStopCh)
+	cl.stopBackground(func() { close(cl.cleanupStopCh) })
+}
+
+// TrackedKeys returns the number of keys the limiter holds a mutex for. Mutexes of keys
+// left idle for twice the cleanup interval are dropped by the cleanup goroutine.
+func (cl *ConcurrencyLimiter) TrackedKeys() int {
+	return countKeys(&cl.mutexes)
+}
+
+// Inspect returns the slots of key in use.
+func (cl *ConcurrencyLimiter) Inspect(ctx context.Context, key string) (*KeyState, error) {
+	key, inspector, err := inspection(&cl.lifecycle, &cl.options, cl.store, key)
+	if err != nil {
+		return nil, err
+	}
+	state, err := inspectKey(ctx, inspector, ConcurrencyPolicy, key)
+	if err != nil || !state.Exists {
+		return state, err
+	}
+	if state.Count, err = cl.store.GetCounterContext(ctx, key); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Reset frees every slot of key. Slots released afterwards by the requests that held them
+// are ignored, as the count of slots in use never goes below zero, so the key may briefly
+// admit more concurrent requests than its maximum.
+func (cl *ConcurrencyLimiter) Reset(ctx context.Context, key string) error {
+	key, inspector, err := inspection(&cl.lifecycle, &cl.options, cl.store, key)
+	if err != nil {
+		return err
+	}
+	km := cl.getMutex(key)
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	return inspector.Delete(ctx, key)
 }
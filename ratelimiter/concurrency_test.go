@@ -1,6 +1,8 @@
 package ratelimiter
 
 import (
+	"context"
+	"errors"
 	"sync"
 	"testing"
 	"time"
@@ -76,7 +78,7 @@ func TestConcurrencyLimiter_MaxConcurrent(t *testing.T) {
 				return
 			}
 			if allowed {
-				count, err := s.GetCounter(key)
+				count, err := s.GetCounter(mustStoreKey(t, &cl.options, key))
 				if err != nil {
 					t.Errorf("Error on GetCounter(): %v", err)
 					return
@@ -131,7 +133,7 @@ func TestConcurrencyLimiter_Persistence(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error creating ConcurrencyLimiter: %v", err)
 	}
-	count, err := s.GetCounter(key)
+	count, err := s.GetCounter(mustStoreKey(t, &cl.options, key))
 	if err != nil {
 		t.Fatalf("Error on GetCounter(): %v", err)
 	}
@@ -144,7 +146,7 @@ func TestConcurrencyLimiter_Persistence(t *testing.T) {
 		t.Fatalf("Error on Release(): %v", err)
 	}
 
-	count, err = s.GetCounter(key)
+	count, err = s.GetCounter(mustStoreKey(t, &cl.options, key))
 	if err != nil {
 		t.Fatalf("Error on GetCounter(): %v", err)
 	}
@@ -152,3 +154,133 @@ func TestConcurrencyLimiter_Persistence(t *testing.T) {
 		t.Errorf("Expected currentConcurrent to be 1 after Release, got %d", count)
 	}
 }
+
+func TestConcurrencyLimiter_Decide(t *testing.T) {
+	s := store.NewMemoryStore()
+	cl, err := NewConcurrencyLimiter(s, 2)
+	if err != nil {
+		t.Fatalf("Error creating ConcurrencyLimiter: %v", err)
+	}
+	defer cl.StopCleanup()
+
+	key := "test_concurrency_decide"
+
+	result, err := cl.Decide(key)
+	if err != nil {
+		t.Fatalf("Error on Decide(): %v", err)
+	}
+	if !result.Allowed || result.Limit != 2 || result.Remaining != 1 {
+		t.Errorf("Unexpected result for first slot: %+v", result)
+	}
+
+	result, err = cl.Decide(key)
+	if err != nil {
+		t.Fatalf("Error on Decide(): %v", err)
+	}
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Unexpected result for second slot: %+v", result)
+	}
+
+	result, err = cl.Decide(key)
+	if err != nil {
+		t.Fatalf("Error on Decide(): %v", err)
+	}
+	if result.Allowed || result.Remaining != 0 {
+		t.Errorf("Unexpected result when limit reached: %+v", result)
+	}
+	if !result.ResetAt.IsZero() || result.RetryAfter != 0 {
+		t.Errorf("Expected no reset information for concurrency limits, got %+v", result)
+	}
+}
+
+func TestConcurrencyLimiter_AllowN(t *testing.T) {
+	s := store.NewMemoryStore()
+	cl, err := NewConcurrencyLimiter(s, 5)
+	if err != nil {
+		t.Fatalf("Error creating ConcurrencyLimiter: %v", err)
+	}
+	defer cl.StopCleanup()
+
+	key := "test_concurrency_weighted"
+
+	allowed, err := cl.AllowN(key, 3)
+	if err != nil {
+		t.Fatalf("Error on AllowN(): %v", err)
+	}
+	if !allowed {
+		t.Errorf("Expected AllowN() to acquire 3 slots")
+	}
+
+	allowed, err = cl.AllowN(key, 3)
+	if err != nil {
+		t.Fatalf("Error on AllowN(): %v", err)
+	}
+	if allowed {
+		t.Errorf("Expected AllowN() to return false with 2 slots left")
+	}
+
+	// The rejected request must not hold on to any slots
+	count, err := s.GetCounter(mustStoreKey(t, &cl.options, key))
+	if err != nil {
+		t.Fatalf("Error on GetCounter(): %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 slots in use, got %d", count)
+	}
+
+	if err := cl.ReleaseN(key, 3); err != nil {
+		t.Fatalf("Error on ReleaseN(): %v", err)
+	}
+	allowed, err = cl.AllowN(key, 5)
+	if err != nil {
+		t.Fatalf("Error on AllowN(): %v", err)
+	}
+	if !allowed {
+		t.Errorf("Expected AllowN() to acquire all slots after ReleaseN()")
+	}
+
+	_, err = cl.AllowN(key, 6)
+	if !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+}
+
+func TestConcurrencyLimiter_Wait(t *testing.T) {
+	s := store.NewMemoryStore()
+	cl, err := NewConcurrencyLimiter(s, 1)
+	if err != nil {
+		t.Fatalf("Error creating ConcurrencyLimiter: %v", err)
+	}
+	defer cl.StopCleanup()
+
+	key := "test_concurrency_wait"
+
+	if err := cl.Wait(context.Background(), key); err != nil {
+		t.Fatalf("Error on Wait(): %v", err)
+	}
+
+	// The slot is held, so waiting times out
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := cl.Wait(ctx, key); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// Releasing the slot wakes up a waiter
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = cl.Release(key)
+	}()
+	if err := cl.Wait(context.Background(), key); err != nil {
+		t.Fatalf("Error on Wait() after Release(): %v", err)
+	}
+
+	// A reservation that is not OK holds nothing
+	reservation, err := cl.Reserve(key)
+	if err != nil {
+		t.Fatalf("Error on Reserve(): %v", err)
+	}
+	if reservation.OK() {
+		t.Error("Expected reservation not to be OK while the slot is held")
+	}
+}
@@ -0,0 +1,44 @@
+package ratelimiter
+
+import "errors"
+
+var (
+	// ErrInvalidCost is returned when a request cost is not greater than zero.
+	ErrInvalidCost = errors.New("cost must be greater than zero")
+
+	// ErrCostExceedsCapacity is returned when a request costs more than the limiter could
+	// ever admit at once, so retrying it would never succeed.
+	ErrCostExceedsCapacity = errors.New("cost exceeds limiter capacity")
+
+	// ErrWaitExceedsDeadline is returned by Wait when the request could not be admitted
+	// before the context deadline. No capacity is consumed in that case.
+	ErrWaitExceedsDeadline = errors.New("rate limit wait would exceed context deadline")
+
+	// ErrInvalidKey is wrapped by the errors returned for keys rejected by the key policy
+	// of a limiter.
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrClosed is returned by the methods of a limiter after it has been closed.
+	ErrClosed = errors.New("rate limiter is closed")
+
+	// ErrInspectionUnsupported is returned by Inspect and Reset when the store of the
+	// limiter does not implement store.KeyInspector, or the limiter does not implement
+	// Inspector.
+	ErrInspectionUnsupported = errors.New("store does not support key inspection")
+
+	// ErrReservationUnsupported is returned by ReserveN and WaitN, and the limiter wrappers
+	// forwarding to them, when asked to reserve capacity from or wait on a limiter that
+	// does not implement Reserver or WaitN.
+	ErrReservationUnsupported = errors.New("limiter does not support reservations")
+)
+
+// validateCost checks that a request cost is positive and within the limiter capacity.
+func validateCost(n int64, capacity float64) error {
+	if n <= 0 {
+		return ErrInvalidCost
+	}
+	if float64(n) > capacity {
+		return ErrCostExceedsCapacity
+	}
+	return nil
+}
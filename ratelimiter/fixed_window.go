@@ -1,6 +1,7 @@
 package ratelimiter
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"time"
@@ -10,13 +11,15 @@ import (
 
 // FixedWindowLimiter implements the fixed window rate limiting algorithm.
 type FixedWindowLimiter struct {
-	store  store.Store   // Storage backend to keep track of request counts
-	limit  int           // Maximum number of requests allowed in the window
-	window time.Duration // Duration of the fixed time window
+	store     store.Store   // Storage backend to keep track of request counts
+	limit     int           // Maximum number of requests allowed in the window
+	window    time.Duration // Duration of the fixed time window
+	lifecycle               // Tracks whether the limiter is closed
+	options                 // Optional settings such as the clock
 }
 
 // NewFixedWindowLimiter creates a new instance of FixedWindowLimiter.
-func NewFixedWindowLimiter(store store.Store, limit int, window time.Duration) (*FixedWindowLimiter, error) {
+func NewFixedWindowLimiter(store store.Store, limit int, window time.Duration, opts ...Option) (*FixedWindowLimiter, error) {
 	if limit <= 0 {
 		return nil, errors.New("limit must be greater than zero")
 	}
@@ -28,37 +31,208 @@ func NewFixedWindowLimiter(store store.Store, limit int, window time.Duration) (
 	}
 
 	return &FixedWindowLimiter{
-		store:  store,
-		limit:  limit,
-		window: window,
+		store:   store,
+		limit:   limit,
+		window:  window,
+		options: newOptions(defaultNamespace(FixedWindowPolicy, limit, window), opts),
 	}, nil
 }
 
 // Allow checks whether a request associated with the given key is allowed under the rate limit.
 func (l *FixedWindowLimiter) Allow(key string) (bool, error) {
-	// Input validation
-	if err := validateKey(key); err != nil {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks whether a request of cost n associated with the given key is allowed under the rate limit.
+func (l *FixedWindowLimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.DecideN(key, n)
+	if err != nil {
 		return false, err
 	}
+	return result.Allowed, nil
+}
 
-	// Proceed with rate limiting if input validation passes
-	windowKey := l.getWindowKey(key)
-	count, err := l.store.Increment(windowKey, 1, l.window) // Added '1' as delta parameter
+// AllowContext is like Allow but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *FixedWindowLimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.DecideNContext(ctx, key, 1)
 	if err != nil {
 		return false, err
 	}
+	return result.Allowed, nil
+}
+
+// Decide checks whether a request associated with the given key is allowed under the rate limit
+// and reports the quota left in the current window.
+func (l *FixedWindowLimiter) Decide(key string) (*Result, error) {
+	return l.DecideN(key, 1)
+}
+
+// DecideN checks whether a request of cost n associated with the given key is allowed under the
+// rate limit and reports the quota left in the current window. A request is charged n units of the
+// window's limit; ErrCostExceedsCapacity is returned if n exceeds the limit.
+func (l *FixedWindowLimiter) DecideN(key string, n int64) (*Result, error) {
+	return l.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *FixedWindowLimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := l.reserveN(ctx, key, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
+
+// Reserve reserves quota for a request associated with the given key, waiting as long as needed.
+func (l *FixedWindowLimiter) Reserve(key string) (*Reservation, error) {
+	return l.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN reserves n units of quota for a request associated with the given key. If the current
+// window is exhausted, the quota is taken from the first later window that has room and the
+// reservation delay is the time until that window starts; if that exceeds maxDelay nothing is
+// consumed and the reservation is not OK.
+func (l *FixedWindowLimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.reserveN(ctx, key, n, maxDelay)
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *FixedWindowLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until a request of cost n associated with the given key is allowed, or the
+// context is done. It fails immediately with ErrWaitExceedsDeadline, without consuming quota,
+// if no window with room starts before the context deadline.
+func (l *FixedWindowLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	return waitN(ctx, l, l.getClock(), key, n)
+}
+
+// reserveN charges n units to the earliest window starting within maxDelay that has room for them.
+func (l *FixedWindowLimiter) reserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := l.checkOpen(); err != nil {
+		return nil, err
+	}
+	// Input validation
+	key, err := l.storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCost(n, float64(l.limit)); err != nil {
+		return nil, err
+	}
+
+	// Proceed with rate limiting if input validation passes
+	now := l.now()
+	currentWindow := l.getWindowNumber(now)
+
+	// The quota is restored when the next window starts
+	reservation := &Reservation{
+		clock: l.getClock(),
+		result: Result{
+			Limit:   int64(l.limit),
+			ResetAt: l.getWindowStart(currentWindow + 1),
+		},
+	}
 
-	if count > int64(l.limit) {
-		return false, nil // Rate limit exceeded
+	for windowNumber := currentWindow; ; windowNumber++ {
+		wait := l.getWindowStart(windowNumber).Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		reservation.timeToAct = now.Add(wait)
+		if wait > maxDelay {
+			break
+		}
+
+		// Keep the counter until the end of its window
+		windowKey := l.getWindowKey(key, windowNumber)
+		expiration := wait + l.window
+		count, err := l.store.IncrementContext(ctx, windowKey, n, expiration)
+		if err != nil {
+			return nil, err
+		}
+
+		if count <= int64(l.limit) {
+			reservation.ok = true
+			reservation.cancel = func() error {
+				_, err := l.store.Increment(windowKey, -n, expiration)
+				return err
+			}
+			if windowNumber == currentWindow {
+				reservation.result.Remaining = int64(l.limit) - count
+			}
+			break // Request is allowed
+		}
+
+		// Give back the rejected cost so it does not eat into the remaining quota,
+		// even if the context is cancelled in the meantime
+		count, err = l.store.IncrementContext(context.WithoutCancel(ctx), windowKey, -n, expiration)
+		if err != nil {
+			return nil, err
+		}
+		if remaining := int64(l.limit) - count; windowNumber == currentWindow && remaining > 0 {
+			reservation.result.Remaining = remaining
+		}
 	}
-	return true, nil // Request is allowed
+
+	reservation.result.Allowed = reservation.ok && !reservation.timeToAct.After(now)
+	if !reservation.result.Allowed {
+		reservation.result.RetryAfter = reservation.timeToAct.Sub(now) // Rate limit exceeded
+	}
+	return reservation, nil
 }
 
-// getWindowKey generates a unique key for the current time window and client key.
-func (l *FixedWindowLimiter) getWindowKey(key string) string {
-	// Calculate the current window number based on the time
-	windowNumber := time.Now().Unix() / int64(l.window.Seconds())
+// getWindowStart returns the start time of the given window.
+func (l *FixedWindowLimiter) getWindowStart(windowNumber int64) time.Time {
+	return time.Unix(0, windowNumber*l.window.Nanoseconds())
+}
 
+// getWindowNumber returns the number of the fixed window containing the given time.
+func (l *FixedWindowLimiter) getWindowNumber(now time.Time) int64 {
+	return now.UnixNano() / l.window.Nanoseconds()
+}
+
+// getWindowKey generates a unique key for the given time window and client key.
+func (l *FixedWindowLimiter) getWindowKey(key string, windowNumber int64) string {
 	// Combine the client key with the window number to form a unique key
 	return key + ":" + strconv.FormatInt(windowNumber, 10)
 }
+
+// Close makes later calls fail with ErrClosed. It does not close the store, which may be
+// shared. Closing a closed limiter does nothing.
+func (l *FixedWindowLimiter) Close() error {
+	l.shutdown(nil)
+	return nil
+}
+
+// Inspect returns the count of key in the current window.
+func (l *FixedWindowLimiter) Inspect(ctx context.Context, key string) (*KeyState, error) {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return nil, err
+	}
+	state, err := inspectKey(ctx, inspector, FixedWindowPolicy, l.getWindowKey(key, l.getWindowNumber(l.now())))
+	if err != nil || !state.Exists {
+		return state, err
+	}
+	if state.Count, err = l.store.GetCounterContext(ctx, state.StoreKey); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Reset deletes the count of key in the current window. Requests reserved in later windows
+// are kept.
+func (l *FixedWindowLimiter) Reset(ctx context.Context, key string) error {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return err
+	}
+	return inspector.Delete(ctx, l.getWindowKey(key, l.getWindowNumber(l.now())))
+}
@@ -2,6 +2,8 @@
 package ratelimiter
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -187,3 +189,151 @@ func TestFixedWindowLimiter_InvalidKey(t *testing.T) {
 		})
 	}
 }
+
+func TestFixedWindowLimiter_Decide(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewFixedWindowLimiter(memStore, 3, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create FixedWindowLimiter: %v", err)
+	}
+	key := "decideUser"
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Decide(key)
+		if err != nil {
+			t.Fatalf("Unexpected error on request %d: %v", i+1, err)
+		}
+		if !result.Allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+		if result.Limit != 3 {
+			t.Errorf("Expected limit 3, got %d", result.Limit)
+		}
+		if result.Remaining != int64(2-i) {
+			t.Errorf("Expected remaining %d, got %d", 2-i, result.Remaining)
+		}
+		if result.RetryAfter != 0 {
+			t.Errorf("Expected no retry-after for allowed request, got %v", result.RetryAfter)
+		}
+	}
+
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("4th request should not be allowed")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Expected remaining 0, got %d", result.Remaining)
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Minute {
+		t.Errorf("Expected retry-after within the window, got %v", result.RetryAfter)
+	}
+	if result.ResetAt.Sub(time.Now()) > time.Minute {
+		t.Errorf("Expected reset within the window, got %v", result.ResetAt)
+	}
+	if result.ResetAt.UnixNano()%time.Minute.Nanoseconds() != 0 {
+		t.Errorf("Expected reset at a window boundary, got %v", result.ResetAt)
+	}
+}
+
+func TestFixedWindowLimiter_AllowN(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewFixedWindowLimiter(memStore, 10, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create FixedWindowLimiter: %v", err)
+	}
+	key := "weightedUser"
+
+	allowed, err := limiter.AllowN(key, 8)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request of cost 8 should be allowed")
+	}
+
+	// A rejected request must not consume the quota that is left
+	result, err := limiter.DecideN(key, 5)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Request of cost 5 should not be allowed with 2 remaining")
+	}
+	if result.Remaining != 2 {
+		t.Errorf("Expected remaining 2, got %d", result.Remaining)
+	}
+
+	allowed, err = limiter.AllowN(key, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request of cost 2 should be allowed")
+	}
+
+	// Costs that can never be admitted get a distinct error
+	_, err = limiter.AllowN(key, 11)
+	if !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+	_, err = limiter.AllowN(key, 0)
+	if !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost, got %v", err)
+	}
+}
+
+func TestFixedWindowLimiter_ReserveNextWindow(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	window := 200 * time.Millisecond
+	limiter, err := NewFixedWindowLimiter(memStore, 2, window)
+	if err != nil {
+		t.Fatalf("Failed to create FixedWindowLimiter: %v", err)
+	}
+	key := "reserveUser"
+
+	for i := 0; i < 2; i++ {
+		if allowed, err := limiter.Allow(key); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed: %v", i+1, err)
+		}
+	}
+
+	// The third request is reserved in the next window
+	reservation, err := limiter.Reserve(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reservation.OK() {
+		t.Fatal("Reservation should be OK")
+	}
+	delay := reservation.Delay()
+	if delay <= 0 || delay > window {
+		t.Errorf("Expected a delay until the next window, got %v", delay)
+	}
+
+	// Waiting for the next window works, and it then has one slot less
+	if err := limiter.Wait(context.Background(), key); err != nil {
+		t.Fatalf("Unexpected error on Wait: %v", err)
+	}
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Errorf("Next window should be full after a reservation and a wait, got %+v", result)
+	}
+
+	// Cancelling the reservation frees its slot
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on Cancel: %v", err)
+	}
+	allowed, err := limiter.Allow(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request should be allowed after cancelling the reservation")
+	}
+}
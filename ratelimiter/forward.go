@@ -0,0 +1,75 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+)
+
+// The functions of this file call the optional methods of a limiter, failing with the
+// matching error when it lacks them. Wrappers of limiters, such as those of the metrics
+// and tracing packages, forward those methods through them, so that a wrapped limiter can
+// still be a child of a CompositeLimiter, be waited on and be inspected.
+
+// waiter is implemented by limiters that can block until a request is admitted, as all
+// limiters of this package do.
+type waiter interface {
+	WaitN(ctx context.Context, key string, n int64) error
+}
+
+// releaser is implemented by limiters whose requests hold capacity until released, such
+// as ConcurrencyLimiter.
+type releaser interface {
+	ReleaseN(key string, n int64) error
+}
+
+// ReserveN reserves capacity from l for a request of cost n associated with the given key,
+// as l.ReserveN does. It fails with ErrReservationUnsupported if l does not implement
+// Reserver.
+func ReserveN(ctx context.Context, l RateLimiter, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	reserver, ok := l.(Reserver)
+	if !ok {
+		return nil, ErrReservationUnsupported
+	}
+	return reserver.ReserveN(ctx, key, n, maxDelay)
+}
+
+// WaitN blocks until l allows a request of cost n associated with the given key, or the
+// context is done, as l.WaitN does. It fails with ErrReservationUnsupported if l has no
+// WaitN method.
+func WaitN(ctx context.Context, l RateLimiter, key string, n int64) error {
+	w, ok := l.(waiter)
+	if !ok {
+		return ErrReservationUnsupported
+	}
+	return w.WaitN(ctx, key, n)
+}
+
+// Inspect returns the state l holds for key. It fails with ErrInspectionUnsupported if l
+// does not implement Inspector.
+func Inspect(ctx context.Context, l RateLimiter, key string) (*KeyState, error) {
+	inspector, ok := l.(Inspector)
+	if !ok {
+		return nil, ErrInspectionUnsupported
+	}
+	return inspector.Inspect(ctx, key)
+}
+
+// Reset deletes the state l holds for key. It fails with ErrInspectionUnsupported if l
+// does not implement Inspector.
+func Reset(ctx context.Context, l RateLimiter, key string) error {
+	inspector, ok := l.(Inspector)
+	if !ok {
+		return ErrInspectionUnsupported
+	}
+	return inspector.Reset(ctx, key)
+}
+
+// ReleaseN releases n slots l holds for key after processing, as l.ReleaseN does. It does
+// nothing if l has no ReleaseN method, as for limiters whose requests hold no capacity.
+func ReleaseN(l RateLimiter, key string, n int64) error {
+	r, ok := l.(releaser)
+	if !ok {
+		return nil
+	}
+	return r.ReleaseN(key, n)
+}
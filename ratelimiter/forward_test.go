@@ -0,0 +1,88 @@
+// ratelimiter/forward_test.go
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/store"
+)
+
+// TestForward tests that the forwarding functions call the optional methods of a limiter.
+func TestForward(t *testing.T) {
+	ctx := context.Background()
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	limiter, err := NewFixedWindowLimiter(store.NewMemoryStore(store.WithClock(fake)), 1, time.Minute, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+
+	reservation, err := ReserveN(ctx, limiter, "alice", 1, 0)
+	if err != nil || !reservation.OK() {
+		t.Fatalf("Expected the first reservation to be granted, got %+v, %v", reservation, err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := WaitN(waitCtx, limiter, "alice", 1); !errors.Is(err, ErrWaitExceedsDeadline) {
+		t.Errorf("Expected ErrWaitExceedsDeadline, got %v", err)
+	}
+
+	state, err := Inspect(ctx, limiter, "alice")
+	if err != nil {
+		t.Fatalf("Inspect failed: %v", err)
+	}
+	if state.Count != 1 {
+		t.Errorf("Expected a count of 1, got %d", state.Count)
+	}
+	if err := Reset(ctx, limiter, "alice"); err != nil {
+		t.Fatalf("Reset failed: %v", err)
+	}
+	if err := WaitN(ctx, limiter, "alice", 1); err != nil {
+		t.Errorf("Expected the request to be allowed after Reset, got %v", err)
+	}
+
+	concurrent, err := NewConcurrencyLimiter(store.NewMemoryStore(), 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	if allowed, err := concurrent.Allow("alice"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+	if err := ReleaseN(concurrent, "alice", 1); err != nil {
+		t.Fatalf("ReleaseN failed: %v", err)
+	}
+	if allowed, err := concurrent.Allow("alice"); err != nil || !allowed {
+		t.Errorf("Expected the request to be allowed after ReleaseN, got %v, %v", allowed, err)
+	}
+}
+
+// TestForward_Unsupported tests that the forwarding functions report the methods a limiter
+// lacks.
+func TestForward_Unsupported(t *testing.T) {
+	ctx := context.Background()
+	inner, err := NewFixedWindowLimiter(store.NewMemoryStore(), 1, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	bare := struct{ RateLimiter }{inner}
+
+	if _, err := ReserveN(ctx, bare, "alice", 1, 0); !errors.Is(err, ErrReservationUnsupported) {
+		t.Errorf("Expected ErrReservationUnsupported from ReserveN, got %v", err)
+	}
+	if err := WaitN(ctx, bare, "alice", 1); !errors.Is(err, ErrReservationUnsupported) {
+		t.Errorf("Expected ErrReservationUnsupported from WaitN, got %v", err)
+	}
+	if _, err := Inspect(ctx, bare, "alice"); !errors.Is(err, ErrInspectionUnsupported) {
+		t.Errorf("Expected ErrInspectionUnsupported from Inspect, got %v", err)
+	}
+	if err := Reset(ctx, bare, "alice"); !errors.Is(err, ErrInspectionUnsupported) {
+		t.Errorf("Expected ErrInspectionUnsupported from Reset, got %v", err)
+	}
+	if err := ReleaseN(bare, "alice", 1); err != nil {
+		t.Errorf("Expected ReleaseN to do nothing, got %v", err)
+	}
+}
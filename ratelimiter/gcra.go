@@ -0,0 +1,268 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/neelp03/throttlex/store"
+)
+
+// GCRALimiter implements the generic cell rate algorithm (GCRA).
+// It behaves like a token bucket of the given burst refilled at the given rate, but keeps
+// a single theoretical arrival time (TAT) per key instead of a token count and update time.
+// Each request moves the TAT forward by its cost times the emission interval, and is
+// admitted if the TAT stays within the burst tolerance of the current time.
+type GCRALimiter struct {
+	store            store.Store       // Storage backend to keep track of theoretical arrival times
+	updater          store.GCRAUpdater // The store's atomic TAT update
+	burst            int               // Maximum number of requests admitted at once
+	emissionInterval time.Duration     // Time between requests at the sustained rate
+	lifecycle                          // Tracks whether the limiter is closed
+	options                            // Optional settings such as the clock
+}
+
+// NewGCRALimiter creates a new instance of GCRALimiter.
+//
+// Parameters:
+//   - store: Storage backend implementing store.GCRAUpdater (e.g., RedisStore, MemoryStore)
+//   - burst: Maximum number of requests admitted at once
+//   - rate: Sustained number of requests admitted per second
+//
+// Returns:
+//   - A pointer to a GCRALimiter instance
+func NewGCRALimiter(store store.Store, burst int, rate float64, opts ...Option) (*GCRALimiter, error) {
+	if burst <= 0 {
+		return nil, errors.New("burst must be greater than zero")
+	}
+	if rate <= 0 {
+		return nil, errors.New("rate must be greater than zero")
+	}
+	if store == nil {
+		return nil, errors.New("store cannot be nil")
+	}
+	updater, ok := gcraUpdater(store)
+	if !ok {
+		return nil, errors.New("store does not support GCRA")
+	}
+
+	emissionInterval := time.Duration(float64(time.Second) / rate)
+	if emissionInterval <= 0 {
+		return nil, errors.New("rate is too high")
+	}
+
+	return &GCRALimiter{
+		store:            store,
+		updater:          updater,
+		burst:            burst,
+		emissionInterval: emissionInterval,
+		options:          newOptions(defaultNamespace(GCRAPolicy, burst, rate), opts),
+	}, nil
+}
+
+// gcraUpdater returns the atomic TAT update of s, if it has one.
+func gcraUpdater(s store.Store) (store.GCRAUpdater, bool) {
+	updater, ok := s.(store.GCRAUpdater)
+	return updater, ok
+}
+
+// Allow checks whether a request associated with the given key is allowed under the rate limit.
+//
+// Parameters:
+//   - key: A unique identifier for the client (e.g., IP address, user ID)
+//
+// Returns:
+//   - allowed: A boolean indicating whether the request is allowed (true) or should be rate-limited (false)
+//   - err: An error if there was a problem accessing the storage backend
+func (l *GCRALimiter) Allow(key string) (bool, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks whether a request of cost n associated with the given key is allowed under the rate limit.
+func (l *GCRALimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.DecideN(key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *GCRALimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.DecideNContext(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Decide checks whether a request associated with the given key is allowed under the rate limit
+// and reports the burst capacity left.
+//
+// Parameters:
+//   - key: A unique identifier for the client (e.g., IP address, user ID)
+//
+// Returns:
+//   - result: The decision, with Remaining set to the requests that can be admitted at once and ResetAt to the time the full burst is available again
+//   - err: An error if there was a problem accessing the storage backend
+func (l *GCRALimiter) Decide(key string) (*Result, error) {
+	return l.DecideN(key, 1)
+}
+
+// DecideN is like Decide for a request of cost n.
+// ErrCostExceedsCapacity is returned if n exceeds the burst.
+func (l *GCRALimiter) DecideN(key string, n int64) (*Result, error) {
+	return l.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *GCRALimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := l.reserveN(ctx, key, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
+
+// Reserve reserves capacity for a request associated with the given key, waiting as long as needed.
+func (l *GCRALimiter) Reserve(key string) (*Reservation, error) {
+	return l.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN reserves capacity for a request of cost n associated with the given key. The TAT
+// may move beyond the burst tolerance, in which case the reservation delay is the time until
+// it is back within it; if that exceeds maxDelay nothing is reserved and the reservation is
+// not OK.
+func (l *GCRALimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.reserveN(ctx, key, n, maxDelay)
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *GCRALimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until a request of cost n associated with the given key is allowed, or the
+// context is done. It fails immediately with ErrWaitExceedsDeadline, without reserving
+// anything, if the request cannot be admitted before the context deadline.
+func (l *GCRALimiter) WaitN(ctx context.Context, key string, n int64) error {
+	return waitN(ctx, l, l.getClock(), key, n)
+}
+
+// reserveN moves the TAT for the given key forward by n emission intervals if the request
+// can be admitted within maxDelay.
+func (l *GCRALimiter) reserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := l.checkOpen(); err != nil {
+		return nil, err
+	}
+	// Input validation
+	key, err := l.storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCost(n, float64(l.burst)); err != nil {
+		return nil, err
+	}
+	increment := time.Duration(n) * l.emissionInterval
+	now := l.now().UnixNano()
+
+	tat, updated, err := l.updater.UpdateGCRA(ctx, key, store.UpdateGCRARequest{
+		Increment: increment,
+		Tolerance: l.tolerance(),
+		MaxDelay:  maxDelay,
+		Now:       now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Time until the TAT, including this request, is back within the burst tolerance
+	newTAT := tat
+	if !updated {
+		newTAT += increment.Nanoseconds()
+	}
+	wait := max(time.Duration(newTAT-now)-l.tolerance(), 0)
+
+	reservation := &Reservation{ok: updated, timeToAct: time.Unix(0, now).Add(wait), clock: l.getClock()}
+	if updated {
+		reservation.cancel = func() error { return l.refund(key, increment) }
+	}
+	reservation.result = l.result(wait == 0 && updated, tat, wait, now)
+	return reservation, nil
+}
+
+// refund moves the TAT back for a cancelled reservation.
+func (l *GCRALimiter) refund(key string, increment time.Duration) error {
+	_, _, err := l.updater.UpdateGCRA(context.Background(), key, store.UpdateGCRARequest{
+		Increment: -increment,
+		Tolerance: l.tolerance(),
+		MaxDelay:  InfDuration,
+		Now:       l.now().UnixNano(),
+	})
+	return err
+}
+
+// tolerance returns how far the TAT may be ahead of the current time for a request to be
+// admitted, which is the time to emit a full burst.
+func (l *GCRALimiter) tolerance() time.Duration {
+	return time.Duration(l.burst) * l.emissionInterval
+}
+
+// result builds the decision for the given TAT at time now, where wait is the time until
+// the request could be admitted.
+func (l *GCRALimiter) result(allowed bool, tat int64, wait time.Duration, now int64) Result {
+	tat = max(tat, now)
+	result := Result{
+		Allowed: allowed,
+		Limit:   int64(l.burst),
+		ResetAt: time.Unix(0, tat),
+	}
+	if room := l.tolerance() - time.Duration(tat-now); room > 0 {
+		result.Remaining = int64(room / l.emissionInterval)
+	}
+	if !allowed {
+		result.RetryAfter = wait
+	}
+	return result
+}
+
+// Close makes later calls fail with ErrClosed. It does not close the store, which may be
+// shared. Closing a closed limiter does nothing.
+func (l *GCRALimiter) Close() error {
+	l.shutdown(nil)
+	return nil
+}
+
+// Inspect returns the theoretical arrival time of key.
+func (l *GCRALimiter) Inspect(ctx context.Context, key string) (*KeyState, error) {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return nil, err
+	}
+	state, err := inspectKey(ctx, inspector, GCRAPolicy, key)
+	if err != nil || !state.Exists {
+		return state, err
+	}
+	tat, ok, err := inspector.GetGCRA(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		state.TAT = time.Unix(0, tat)
+	}
+	return state, nil
+}
+
+// Reset deletes the theoretical arrival time of key, which has its full burst again.
+func (l *GCRALimiter) Reset(ctx context.Context, key string) error {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return err
+	}
+	return inspector.Delete(ctx, key)
+}
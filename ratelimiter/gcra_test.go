@@ -0,0 +1,157 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/store"
+)
+
+// TestGCRALimiter verifies that a burst is admitted and then requests are spaced by the
+// emission interval.
+func TestGCRALimiter(t *testing.T) {
+	limiter, err := NewGCRALimiter(store.NewMemoryStore(), 3, 10)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	key := "gcraUser"
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Decide(key)
+		if err != nil {
+			t.Fatalf("Unexpected error on request %d: %v", i+1, err)
+		}
+		if !result.Allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+		if result.Remaining != int64(2-i) {
+			t.Errorf("Expected %d remaining after request %d, got %d", 2-i, i+1, result.Remaining)
+		}
+	}
+
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Request exceeding the burst should not be allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > 100*time.Millisecond {
+		t.Errorf("Expected retry-after of at most 100ms, got %v", result.RetryAfter)
+	}
+	if until := time.Until(result.ResetAt); until <= 200*time.Millisecond || until > 300*time.Millisecond {
+		t.Errorf("Expected reset in about 300ms, got %v", until)
+	}
+
+	// One request is admitted per emission interval
+	time.Sleep(result.RetryAfter)
+	allowed, err := limiter.Allow(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request after retry-after should be allowed")
+	}
+	allowed, err = limiter.Allow(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("Second request within the emission interval should not be allowed")
+	}
+}
+
+// TestGCRALimiterAllowN verifies weighted requests and their validation.
+func TestGCRALimiterAllowN(t *testing.T) {
+	limiter, err := NewGCRALimiter(store.NewMemoryStore(), 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	key := "gcraWeightedUser"
+
+	allowed, err := limiter.AllowN(key, 4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request of cost 4 should be allowed")
+	}
+	allowed, err = limiter.AllowN(key, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if allowed {
+		t.Error("Request of cost 2 should not be allowed with 1 left")
+	}
+
+	_, err = limiter.AllowN(key, 6)
+	if !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+	_, err = limiter.AllowN(key, 0)
+	if !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost, got %v", err)
+	}
+}
+
+// TestGCRALimiterReserve verifies that reservations are delayed beyond the burst and that
+// cancelling gives the capacity back.
+func TestGCRALimiterReserve(t *testing.T) {
+	limiter, err := NewGCRALimiter(store.NewMemoryStore(), 1, 1)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	key := "gcraReserveUser"
+
+	if allowed, err := limiter.Allow(key); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+
+	reservation, err := limiter.ReserveN(context.Background(), key, 1, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reservation.OK() {
+		t.Error("Reservation needing a second should not be OK within 100ms")
+	}
+
+	reservation, err = limiter.Reserve(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if delay := reservation.Delay(); delay <= 900*time.Millisecond || delay > time.Second {
+		t.Errorf("Expected delay of about 1s, got %v", delay)
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on cancel: %v", err)
+	}
+
+	// After cancelling, the next reservation waits for the same slot again
+	reservation, err = limiter.Reserve(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if delay := reservation.Delay(); delay > time.Second {
+		t.Errorf("Expected delay of at most 1s after cancel, got %v", delay)
+	}
+}
+
+// TestNewGCRALimiterInvalidParameters verifies parameter and store validation.
+func TestNewGCRALimiterInvalidParameters(t *testing.T) {
+	memStore := store.NewMemoryStore()
+
+	if _, err := NewGCRALimiter(memStore, 0, 1); err == nil {
+		t.Error("Expected error for zero burst")
+	}
+	if _, err := NewGCRALimiter(memStore, 1, 0); err == nil {
+		t.Error("Expected error for zero rate")
+	}
+	if _, err := NewGCRALimiter(nil, 1, 1); err == nil {
+		t.Error("Expected error for nil store")
+	}
+	if _, err := NewGCRALimiter(plainStore{memStore}, 1, 1); err == nil {
+		t.Error("Expected error for a store without GCRA support")
+	}
+}
@@ -0,0 +1,326 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// pathSeparator separates the segments of the keys of a HierarchicalLimiter.
+const pathSeparator = "/"
+
+// HierarchyLevel is a level of quotas of a HierarchicalLimiter, such as the global, tenant
+// or user quota.
+type HierarchyLevel struct {
+	Name   string        // Name reported in RejectedBy, and added to the namespace of the level
+	Config LimiterConfig // Limiter enforcing the quotas of the level
+	Shared bool          // Whether one quota, keyed by the level name, is shared by all keys, like a global quota
+}
+
+// HierarchicalLimiter enforces nested quotas, such as per user within per tenant within a
+// global quota. Keys are paths with one segment per level that is not shared, outermost
+// first, such as "acme/alice" for levels global (shared), tenant and user. Each level
+// limits the path up to its own segment, so the user level limits "acme/alice" and the
+// tenant level limits "acme" across all of its users, while a shared level limits all keys
+// together.
+//
+// A request is charged to every level and only admitted if all of them admit it, as with
+// CompositeLimiter. Levels are charged from the innermost to the outermost, so requests
+// rejected by their user or tenant quota never take capacity from the global quota, and a
+// tenant over its quota cannot starve the others. Levels on a RedisStore share their state
+// across all processes.
+//
+// Each segment is validated and normalized by the KeyPolicy of its level configuration.
+// Slots of Concurrency levels stay held until the request is released with Release or
+// ReleaseN.
+type HierarchicalLimiter struct {
+	levels    []HierarchyLevel   // Levels, outermost first
+	limiters  []reservingLimiter // Limiters of the levels
+	depth     int                // Number of segments of keys: the number of levels not shared
+	lifecycle                    // Tracks whether the limiter is closed
+	options                      // Optional settings such as the clock
+}
+
+// NewHierarchicalLimiter creates a HierarchicalLimiter with the given levels, outermost
+// first. Level names must be unique, valid keys, and at least one level must not be
+// shared. Of the options, only WithClock applies, to the waits of Wait and WaitN.
+//
+// The limiter of each level is created from its configuration, in a namespace that
+// includes the level name, so that levels with the same configuration never share state.
+func NewHierarchicalLimiter(levels []HierarchyLevel, opts ...Option) (*HierarchicalLimiter, error) {
+	if len(levels) == 0 {
+		return nil, errors.New("hierarchical limiter needs at least one level")
+	}
+
+	l := &HierarchicalLimiter{
+		levels:   append([]HierarchyLevel(nil), levels...),
+		limiters: make([]reservingLimiter, 0, len(levels)),
+		options:  newOptions("", opts),
+	}
+	names := make(map[string]bool, len(levels))
+	for _, level := range levels {
+		limiter, err := newLevelLimiter(level)
+		if err == nil && names[level.Name] {
+			limiter.Close()
+			err = errors.New("duplicate level name")
+		}
+		if err != nil {
+			l.closeLevels()
+			return nil, fmt.Errorf("level %q: %w", level.Name, err)
+		}
+		names[level.Name] = true
+		l.limiters = append(l.limiters, limiter)
+		if !level.Shared {
+			l.depth++
+		}
+	}
+	if l.depth == 0 {
+		l.closeLevels()
+		return nil, errors.New("at least one level must not be shared")
+	}
+	return l, nil
+}
+
+// newLevelLimiter creates the limiter of a level.
+func newLevelLimiter(level HierarchyLevel) (reservingLimiter, error) {
+	if level.Name == "" {
+		return nil, errors.New("level name cannot be empty")
+	}
+	if strings.Contains(level.Name, pathSeparator) {
+		return nil, fmt.Errorf("level name cannot contain %q", pathSeparator)
+	}
+	policy := pathKeyPolicy(level.Config.KeyPolicy)
+	if _, err := policy.StoreKey(level.Name); err != nil {
+		return nil, err
+	}
+
+	limiter, err := newRateLimiter(level.Config, WithKeyPolicy(policy), withNamespaceLevel(level.Name))
+	if err != nil {
+		return nil, err
+	}
+	reserving, ok := limiter.(reservingLimiter)
+	if !ok {
+		limiter.Close()
+		return nil, errors.New("limiter does not support reservations")
+	}
+	return reserving, nil
+}
+
+// pathKeyPolicy returns the key policy of a level limiter: p, or DefaultKeyPolicy if nil,
+// applied to each segment of the paths the level limits.
+func pathKeyPolicy(p *KeyPolicy) KeyPolicy {
+	segment := DefaultKeyPolicy()
+	if p != nil {
+		segment = *p
+	}
+
+	policy := KeyPolicy{
+		Validate: func(key string) error {
+			for _, s := range strings.Split(key, pathSeparator) {
+				if s == "" {
+					return fmt.Errorf("%w: path %q has an empty segment", ErrInvalidKey, key)
+				}
+				if segment.Validate != nil {
+					if err := segment.Validate(s); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+		HashOver: segment.HashOver,
+		HashAll:  segment.HashAll,
+	}
+	if segment.Normalize != nil {
+		policy.Normalize = func(key string) string {
+			segments := strings.Split(key, pathSeparator)
+			for i, s := range segments {
+				segments[i] = segment.Normalize(s)
+			}
+			return strings.Join(segments, pathSeparator)
+		}
+	}
+	return policy
+}
+
+// withNamespaceLevel appends the name of a level to the namespace of its limiter.
+func withNamespaceLevel(name string) Option {
+	return func(o *options) {
+		if o.namespace == "" {
+			o.namespace = name
+			return
+		}
+		o.namespace += namespaceSeparator + name
+	}
+}
+
+// Allow checks if a request for the given path is admitted by every level.
+func (l *HierarchicalLimiter) Allow(key string) (bool, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks if a request of cost n for the given path is admitted by every level.
+func (l *HierarchicalLimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.DecideN(key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the levels, so its cancellation
+// and deadline apply to store calls.
+func (l *HierarchicalLimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.DecideNContext(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Decide checks if a request for the given path is admitted by every level. An admitted
+// request reports the quota of the level with the least remaining; a rejected one reports
+// the result of the level that rejected it, named in RejectedBy.
+func (l *HierarchicalLimiter) Decide(key string) (*Result, error) {
+	return l.DecideN(key, 1)
+}
+
+// DecideN is like Decide for a request of cost n, charged n units by every level.
+func (l *HierarchicalLimiter) DecideN(key string, n int64) (*Result, error) {
+	return l.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the levels, so its
+// cancellation and deadline apply to store calls.
+func (l *HierarchicalLimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := l.reserveN(ctx, key, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
+
+// Reserve reserves capacity from every level for a request for the given path, waiting as
+// long as needed.
+func (l *HierarchicalLimiter) Reserve(key string) (*Reservation, error) {
+	return l.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN reserves n units of capacity from every level, to be used no later than
+// maxDelay from now. If a level cannot provide the capacity within maxDelay, nothing is
+// consumed and the reservation is not OK. Cancelling the reservation gives the capacity
+// back to every level.
+func (l *HierarchicalLimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.reserveN(ctx, key, n, maxDelay)
+}
+
+// Wait blocks until a request for the given path is admitted by every level, or the
+// context is done.
+func (l *HierarchicalLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until a request of cost n for the given path is admitted by every level,
+// or the context is done. It fails immediately with ErrWaitExceedsDeadline, without
+// consuming capacity, if a level cannot admit it before the context deadline.
+func (l *HierarchicalLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	return waitN(ctx, l, l.getClock(), key, n)
+}
+
+// Release releases a slot of every Concurrency level after processing a request for the
+// given path.
+func (l *HierarchicalLimiter) Release(key string) error {
+	return l.ReleaseN(key, 1)
+}
+
+// ReleaseN releases n slots of every Concurrency level after processing a request for the
+// given path.
+func (l *HierarchicalLimiter) ReleaseN(key string, n int64) error {
+	if err := l.checkOpen(); err != nil {
+		return err
+	}
+	keys, err := l.levelKeys(key)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, limiter := range l.limiters {
+		if releaser, ok := limiter.(interface {
+			ReleaseN(key string, n int64) error
+		}); ok {
+			if err := releaser.ReleaseN(keys[i], n); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", l.levels[i].Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the limiters of the levels and makes later calls fail with ErrClosed. It
+// does not close their stores. Closing a closed limiter does nothing.
+func (l *HierarchicalLimiter) Close() error {
+	if l.checkOpen() != nil {
+		return nil
+	}
+	l.shutdown(nil)
+	return l.closeLevels()
+}
+
+// closeLevels closes the limiters of the levels.
+func (l *HierarchicalLimiter) closeLevels() error {
+	var errs []error
+	for _, limiter := range l.limiters {
+		if err := limiter.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reserveN reserves capacity from every level, innermost first, giving it back to all of
+// them as soon as one cannot provide it.
+func (l *HierarchicalLimiter) reserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := l.checkOpen(); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, ErrInvalidCost
+	}
+	keys, err := l.levelKeys(key)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]reservationStep, 0, len(l.limiters))
+	for i := len(l.limiters) - 1; i >= 0; i-- {
+		steps = append(steps, reservationStep{name: l.levels[i].Name, limiter: l.limiters[i], key: keys[i]})
+	}
+	return reserveAll(ctx, l.getClock(), steps, n, maxDelay)
+}
+
+// levelKeys returns the key each level limits for the given path: the path up to the
+// segment of the level, or the level name for shared levels.
+func (l *HierarchicalLimiter) levelKeys(key string) ([]string, error) {
+	segments := strings.Split(key, pathSeparator)
+	if len(segments) != l.depth {
+		return nil, fmt.Errorf("%w: path %q must have %d segments separated by %q", ErrInvalidKey, key, l.depth, pathSeparator)
+	}
+
+	keys := make([]string, len(l.levels))
+	depth := 0
+	for i, level := range l.levels {
+		if level.Shared {
+			keys[i] = level.Name
+			continue
+		}
+		depth++
+		keys[i] = strings.Join(segments[:depth], pathSeparator)
+	}
+	return keys, nil
+}
@@ -0,0 +1,216 @@
+// ratelimiter/hierarchical_test.go
+
+package ratelimiter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/store"
+)
+
+// newTestHierarchy returns a hierarchy of a global quota of 5 requests per hour, 3 per
+// tenant and 2 per user.
+func newTestHierarchy(t *testing.T) *HierarchicalLimiter {
+	t.Helper()
+	memStore := store.NewMemoryStore()
+	hourly := func(limit int) LimiterConfig {
+		return LimiterConfig{Policy: FixedWindowPolicy, Store: memStore, Limit: limit, Interval: time.Hour}
+	}
+
+	limiter, err := NewHierarchicalLimiter([]HierarchyLevel{
+		{Name: "global", Config: hourly(5), Shared: true},
+		{Name: "tenant", Config: hourly(3)},
+		{Name: "user", Config: hourly(2)},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create hierarchical limiter: %v", err)
+	}
+	t.Cleanup(func() { limiter.Close() })
+	return limiter
+}
+
+func TestHierarchicalLimiter_Levels(t *testing.T) {
+	limiter := newTestHierarchy(t)
+
+	tests := []struct {
+		key        string
+		allowed    bool
+		rejectedBy string
+	}{
+		{key: "acme/alice", allowed: true},
+		{key: "acme/alice", allowed: true},
+		{key: "acme/alice", rejectedBy: "user"},
+		{key: "acme/bob", allowed: true},
+		{key: "acme/bob", rejectedBy: "tenant"},
+		// The rejected requests took nothing from the global quota, so 2 more fit
+		{key: "globex/carol", allowed: true},
+		{key: "globex/carol", allowed: true},
+		{key: "globex/dave", rejectedBy: "global"},
+	}
+
+	for i, tt := range tests {
+		result, err := limiter.Decide(tt.key)
+		if err != nil {
+			t.Fatalf("Request %d for %s: unexpected error: %v", i+1, tt.key, err)
+		}
+		if result.Allowed != tt.allowed || result.RejectedBy != tt.rejectedBy {
+			t.Errorf("Request %d for %s: expected allowed %v rejected by %q, got %+v", i+1, tt.key, tt.allowed, tt.rejectedBy, result)
+		}
+	}
+}
+
+func TestHierarchicalLimiter_NoStarvation(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewHierarchicalLimiter([]HierarchyLevel{
+		{Name: "global", Config: LimiterConfig{Policy: TokenBucketPolicy, Store: memStore, Capacity: 10, RefillRate: 0.001}, Shared: true},
+		{Name: "tenant", Config: LimiterConfig{Policy: TokenBucketPolicy, Store: memStore, Capacity: 4, RefillRate: 0.001}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create hierarchical limiter: %v", err)
+	}
+	defer limiter.Close()
+
+	// A noisy tenant gets its own quota, however many requests it sends
+	var noisy int
+	for i := 0; i < 100; i++ {
+		if allowed, err := limiter.Allow("noisy"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		} else if allowed {
+			noisy++
+		}
+	}
+	if noisy != 4 {
+		t.Errorf("Expected the noisy tenant to get 4 requests, got %d", noisy)
+	}
+
+	for i := 0; i < 4; i++ {
+		if allowed, err := limiter.Allow("quiet"); err != nil || !allowed {
+			t.Errorf("Request %d of the quiet tenant should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+}
+
+func TestHierarchicalLimiter_Keys(t *testing.T) {
+	limiter := newTestHierarchy(t)
+
+	for _, key := range []string{"acme", "acme/alice/x", "acme/", "/alice", "acme/alice@example.com", ""} {
+		if _, err := limiter.Allow(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Expected ErrInvalidKey for %q, got %v", key, err)
+		}
+	}
+}
+
+func TestHierarchicalLimiter_KeyPolicy(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	policy := &KeyPolicy{Normalize: strings.ToLower, Validate: ValidateUTF8Key}
+	limiter, err := NewHierarchicalLimiter([]HierarchyLevel{
+		{Name: "tenant", Config: LimiterConfig{Policy: FixedWindowPolicy, Store: memStore, Limit: 1, Interval: time.Hour}},
+		{Name: "user", Config: LimiterConfig{Policy: FixedWindowPolicy, Store: memStore, Limit: 1, Interval: time.Hour, KeyPolicy: policy}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create hierarchical limiter: %v", err)
+	}
+	defer limiter.Close()
+
+	// Each segment is checked by the policy of its level
+	if allowed, err := limiter.Allow("acme/Alice@Example.com"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+	if _, err := limiter.Allow("acme@corp/alice"); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("Expected the tenant level to reject the tenant, got %v", err)
+	}
+	result, err := limiter.Decide("acme/alice@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.RejectedBy != "user" {
+		t.Errorf("Expected the normalized user to share its quota, got %+v", result)
+	}
+}
+
+// TestHierarchicalLimiter_Namespaces tests that levels with the same configuration keep
+// separate state, even when a tenant is named after a shared level.
+func TestHierarchicalLimiter_Namespaces(t *testing.T) {
+	config := LimiterConfig{Policy: FixedWindowPolicy, Store: store.NewMemoryStore(), Limit: 1, Interval: time.Hour}
+	limiter, err := NewHierarchicalLimiter([]HierarchyLevel{
+		{Name: "global", Config: config, Shared: true},
+		{Name: "tenant", Config: config},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create hierarchical limiter: %v", err)
+	}
+	defer limiter.Close()
+
+	if allowed, err := limiter.Allow("global"); err != nil || !allowed {
+		t.Errorf("Expected the request to be allowed by both levels, got %v, %v", allowed, err)
+	}
+}
+
+func TestHierarchicalLimiter_Release(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewHierarchicalLimiter([]HierarchyLevel{
+		{Name: "tenant", Config: LimiterConfig{Policy: ConcurrencyPolicy, Store: memStore, Concurrency: 1}},
+		{Name: "user", Config: LimiterConfig{Policy: TokenBucketPolicy, Store: memStore, Capacity: 2, RefillRate: 0.001}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create hierarchical limiter: %v", err)
+	}
+	defer limiter.Close()
+
+	if allowed, err := limiter.Allow("acme/alice"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+	result, err := limiter.Decide("acme/bob")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed || result.RejectedBy != "tenant" {
+		t.Fatalf("Expected a rejection by tenant while its slot is held, got %+v", result)
+	}
+
+	if err := limiter.Release("acme/alice"); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if allowed, err := limiter.Allow("acme/bob"); err != nil || !allowed {
+		t.Errorf("Expected the request to be allowed after Release, got %v, %v", allowed, err)
+	}
+}
+
+func TestNewHierarchicalLimiter_Errors(t *testing.T) {
+	config := LimiterConfig{Policy: FixedWindowPolicy, Store: store.NewMemoryStore(), Limit: 1, Interval: time.Hour}
+
+	tests := []struct {
+		name   string
+		levels []HierarchyLevel
+	}{
+		{name: "No levels"},
+		{name: "Empty name", levels: []HierarchyLevel{{Config: config}}},
+		{name: "Invalid name", levels: []HierarchyLevel{{Name: "a/b", Config: config}}},
+		{name: "Duplicate names", levels: []HierarchyLevel{{Name: "a", Config: config}, {Name: "a", Config: config}}},
+		{name: "Only shared levels", levels: []HierarchyLevel{{Name: "a", Config: config, Shared: true}}},
+		{name: "Invalid config", levels: []HierarchyLevel{{Name: "a", Config: LimiterConfig{Policy: FixedWindowPolicy}}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := NewHierarchicalLimiter(tt.levels); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
+
+func TestHierarchicalLimiter_Close(t *testing.T) {
+	limiter := newTestHierarchy(t)
+
+	if err := limiter.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := limiter.Allow("acme/alice"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+	if err := limiter.Close(); err != nil {
+		t.Errorf("Expected closing twice to do nothing, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package ratelimiter
+
+import (
+	"context"
+	"time"
+
+	"github.com/neelp03/throttlex/store"
+)
+
+// Inspector is implemented by limiters that can report and reset the state they hold for a
+// key, for support tools such as the admin package. All the limiters of this package but
+// CompositeLimiter and HierarchicalLimiter implement it, provided their store implements
+// store.KeyInspector.
+type Inspector interface {
+	// Inspect returns the state of key. Keys are checked and stored as by the decisions
+	// of the limiter.
+	Inspect(ctx context.Context, key string) (*KeyState, error)
+
+	// Reset deletes the state of key, giving it its full quota back.
+	Reset(ctx context.Context, key string) error
+}
+
+// KeyState is the state a limiter holds for a key, as reported by Inspect. Only the fields
+// of the policy of the limiter are set.
+type KeyState struct {
+	Policy   PolicyType
+	StoreKey string        // Key the state is stored under, within the namespace of the limiter
+	Exists   bool          // Whether the store holds state for the key; if not, the key has its full quota
+	TTL      time.Duration // Time before the state expires; zero if it never expires
+
+	// Count is the number of requests in the current window for FixedWindow, SlidingWindow
+	// and SlidingWindowCounter limiters, estimated for the latter, and the number of slots
+	// in use for Concurrency limiters.
+	Count int64
+
+	TokenBucket *store.TokenBucketState // Tokens at the last update, for TokenBucket limiters
+	LeakyBucket *store.LeakyBucketState // Queue at the last leak, for LeakyBucket limiters
+	TAT         time.Time               // Theoretical arrival time, for GCRA limiters
+}
+
+// inspection checks that a limiter is open and its store implements store.KeyInspector,
+// and returns the store key of key.
+func inspection(lc *lifecycle, o *options, s store.Store, key string) (string, store.KeyInspector, error) {
+	if err := lc.checkOpen(); err != nil {
+		return "", nil, err
+	}
+	key, err := o.storeKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	inspector, ok := s.(store.KeyInspector)
+	if !ok {
+		return "", nil, ErrInspectionUnsupported
+	}
+	return key, inspector, nil
+}
+
+// inspectKey returns the state of the store key of a limiter of the given policy, with
+// whether it exists and its expiration set.
+func inspectKey(ctx context.Context, inspector store.KeyInspector, policy PolicyType, storeKey string) (*KeyState, error) {
+	ttl, exists, err := inspector.TTL(ctx, storeKey)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyState{Policy: policy, StoreKey: storeKey, Exists: exists, TTL: ttl}, nil
+}
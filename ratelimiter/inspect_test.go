@@ -0,0 +1,140 @@
+// ratelimiter/inspect_test.go
+
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/store"
+)
+
+// TestInspector tests that every policy reports the state of a key and resets it.
+func TestInspector(t *testing.T) {
+	tests := []struct {
+		config LimiterConfig
+		check  func(t *testing.T, state *KeyState)
+	}{
+		{
+			config: LimiterConfig{Policy: FixedWindowPolicy, Limit: 5, Interval: time.Minute},
+			check: func(t *testing.T, state *KeyState) {
+				if state.Count != 2 || state.StoreKey != "test:alice:28333333" || state.TTL != time.Minute {
+					t.Errorf("Expected a count of 2 in the current window, got %+v", state)
+				}
+			},
+		},
+		{
+			config: LimiterConfig{Policy: SlidingWindowPolicy, Limit: 5, Interval: time.Minute},
+			check: func(t *testing.T, state *KeyState) {
+				if state.Count != 2 || state.StoreKey != "test:alice" {
+					t.Errorf("Expected a count of 2 in the window, got %+v", state)
+				}
+			},
+		},
+		{
+			config: LimiterConfig{Policy: SlidingWindowCounterPolicy, Limit: 5, Interval: time.Minute},
+			check: func(t *testing.T, state *KeyState) {
+				if state.Count != 2 {
+					t.Errorf("Expected an estimated count of 2, got %+v", state)
+				}
+			},
+		},
+		{
+			config: LimiterConfig{Policy: TokenBucketPolicy, Capacity: 5, RefillRate: 1},
+			check: func(t *testing.T, state *KeyState) {
+				if state.TokenBucket == nil || state.TokenBucket.Tokens != 3 {
+					t.Errorf("Expected 3 tokens left, got %+v", state)
+				}
+			},
+		},
+		{
+			config: LimiterConfig{Policy: LeakyBucketPolicy, Capacity: 5, LeakRate: 1},
+			check: func(t *testing.T, state *KeyState) {
+				if state.LeakyBucket == nil || state.LeakyBucket.Queue != 2 {
+					t.Errorf("Expected a queue of 2, got %+v", state)
+				}
+			},
+		},
+		{
+			config: LimiterConfig{Policy: ConcurrencyPolicy, Concurrency: 5},
+			check: func(t *testing.T, state *KeyState) {
+				if state.Count != 2 {
+					t.Errorf("Expected 2 slots in use, got %+v", state)
+				}
+			},
+		},
+		{
+			config: LimiterConfig{Policy: GCRAPolicy, Burst: 5, Rate: 1},
+			check: func(t *testing.T, state *KeyState) {
+				if expected := time.Unix(1700000002, 0); !state.TAT.Equal(expected) || state.TTL != 2*time.Second {
+					t.Errorf("Expected a TAT of %v, got %+v", expected, state)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.config.Policy), func(t *testing.T) {
+			ctx := context.Background()
+			fake := clock.NewFake(time.Unix(1700000000, 0))
+			tt.config.Store = store.NewMemoryStore(store.WithClock(fake))
+			tt.config.Clock = fake
+			tt.config.Namespace = "test"
+			limiter, err := NewRateLimiter(tt.config)
+			if err != nil {
+				t.Fatalf("Failed to create rate limiter: %v", err)
+			}
+			defer limiter.Close()
+			inspector := limiter.(Inspector)
+
+			state, err := inspector.Inspect(ctx, "alice")
+			if err != nil {
+				t.Fatalf("Inspect failed: %v", err)
+			}
+			if state.Exists || state.Policy != tt.config.Policy {
+				t.Errorf("Expected no state for a new key, got %+v", state)
+			}
+
+			for i := 0; i < 2; i++ {
+				if allowed, err := limiter.Allow("alice"); err != nil || !allowed {
+					t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+				}
+			}
+			state, err = inspector.Inspect(ctx, "alice")
+			if err != nil {
+				t.Fatalf("Inspect failed: %v", err)
+			}
+			if !state.Exists {
+				t.Errorf("Expected state for alice, got %+v", state)
+			}
+			tt.check(t, state)
+
+			if err := inspector.Reset(ctx, "alice"); err != nil {
+				t.Fatalf("Reset failed: %v", err)
+			}
+			if state, err := inspector.Inspect(ctx, "alice"); err != nil || state.Exists {
+				t.Errorf("Expected no state after Reset, got %+v, %v", state, err)
+			}
+			if _, err := inspector.Inspect(ctx, ""); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Expected ErrInvalidKey, got %v", err)
+			}
+		})
+	}
+}
+
+// TestInspector_Unsupported tests that inspection fails with a store that cannot inspect keys.
+func TestInspector_Unsupported(t *testing.T) {
+	limiter, err := NewFixedWindowLimiter(struct{ store.Store }{store.NewMemoryStore()}, 5, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	if _, err := limiter.Inspect(context.Background(), "alice"); !errors.Is(err, ErrInspectionUnsupported) {
+		t.Errorf("Expected ErrInspectionUnsupported from Inspect, got %v", err)
+	}
+	if err := limiter.Reset(context.Background(), "alice"); !errors.Is(err, ErrInspectionUnsupported) {
+		t.Errorf("Expected ErrInspectionUnsupported from Reset, got %v", err)
+	}
+}
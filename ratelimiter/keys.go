@@ -0,0 +1,108 @@
+package ratelimiter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxKeyLength is the longest key accepted by ValidateKey.
+const maxKeyLength = 256
+
+// hashedKeyPrefix starts every store key derived by hashing a key.
+const hashedKeyPrefix = "sha256."
+
+// validKeyRegex is a compiled regular expression that matches valid keys.
+var validKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// KeyPolicy decides which keys a limiter accepts and the store key the state of each is
+// kept under. A key is normalized, then validated, then hashed if the policy asks for it.
+//
+// The zero value accepts any non-empty key and stores it as is. Limiters use
+// DefaultKeyPolicy unless configured with WithKeyPolicy.
+type KeyPolicy struct {
+	// Normalize rewrites keys before they are validated, so that equivalent keys share a
+	// quota; strings.ToLower and strings.TrimSpace are common choices. Nil leaves keys
+	// unchanged.
+	Normalize func(key string) string
+
+	// Validate rejects keys the limiter should not accept. Errors not wrapping
+	// ErrInvalidKey are wrapped in it. Nil accepts any non-empty key.
+	Validate func(key string) error
+
+	// HashOver hashes keys longer than this many bytes into a fixed-length store key, so
+	// that long keys such as URLs do not bloat the store. Zero never hashes by length.
+	HashOver int
+
+	// HashAll hashes every key, so that arbitrary bytes never reach the store.
+	HashAll bool
+}
+
+// DefaultKeyPolicy returns the policy limiters use unless configured otherwise: keys are
+// checked by ValidateKey and stored as is.
+func DefaultKeyPolicy() KeyPolicy {
+	return KeyPolicy{Validate: ValidateKey}
+}
+
+// StoreKey applies the policy to key and returns the key its state is stored under, within
+// the namespace of the limiter, or an error wrapping ErrInvalidKey if the key is rejected.
+//
+// Hashed keys are "sha256." followed by the hex SHA-256 of the normalized key. When the
+// policy hashes keys, keys that already start with "sha256." are hashed whatever their
+// length, so a client cannot pick a key that collides with the hash of another.
+func (p KeyPolicy) StoreKey(key string) (string, error) {
+	if p.Normalize != nil {
+		key = p.Normalize(key)
+	}
+	if key == "" {
+		return "", fmt.Errorf("%w: key cannot be empty", ErrInvalidKey)
+	}
+	if p.Validate != nil {
+		if err := p.Validate(key); err != nil {
+			if !errors.Is(err, ErrInvalidKey) {
+				err = fmt.Errorf("%w: %v", ErrInvalidKey, err)
+			}
+			return "", err
+		}
+	}
+
+	hashing := p.HashAll || p.HashOver > 0
+	if p.HashAll || (p.HashOver > 0 && len(key) > p.HashOver) || (hashing && strings.HasPrefix(key, hashedKeyPrefix)) {
+		sum := sha256.Sum256([]byte(key))
+		return hashedKeyPrefix + hex.EncodeToString(sum[:]), nil
+	}
+	return key, nil
+}
+
+// ValidateKey accepts keys of at most 256 ASCII letters, digits, dots, underscores and
+// hyphens. It is the validator of DefaultKeyPolicy.
+func ValidateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("%w: key cannot be empty", ErrInvalidKey)
+	}
+	if len(key) > maxKeyLength {
+		return fmt.Errorf("%w: key length exceeds maximum allowed length", ErrInvalidKey)
+	}
+	if !validKeyRegex.MatchString(key) {
+		return fmt.Errorf("%w: key contains invalid characters", ErrInvalidKey)
+	}
+	return nil
+}
+
+// ValidateUTF8Key accepts any valid UTF-8 key without control characters, such as emails,
+// URL paths, IPv6 addresses, composite "tenant:user" keys and non-ASCII user names. It
+// does not limit the length, so it is usually combined with KeyPolicy.HashOver.
+func ValidateUTF8Key(key string) error {
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("%w: key is not valid UTF-8", ErrInvalidKey)
+	}
+	if strings.IndexFunc(key, unicode.IsControl) >= 0 {
+		return fmt.Errorf("%w: key contains control characters", ErrInvalidKey)
+	}
+	return nil
+}
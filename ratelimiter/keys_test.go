@@ -0,0 +1,180 @@
+// ratelimiter/keys_test.go
+
+package ratelimiter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/store"
+)
+
+func TestKeyPolicy_StoreKey(t *testing.T) {
+	utf8Policy := KeyPolicy{Validate: ValidateUTF8Key}
+	hashOver := KeyPolicy{Validate: ValidateUTF8Key, HashOver: 64}
+	longKey := "/api/v1/search?q=" + strings.Repeat("x", 300)
+
+	tests := []struct {
+		name      string
+		policy    KeyPolicy
+		key       string
+		expected  string
+		hashed    bool
+		expectErr bool
+	}{
+		{name: "Default accepts simple keys", policy: DefaultKeyPolicy(), key: "user_1.a-b", expected: "user_1.a-b"},
+		{name: "Default rejects emails", policy: DefaultKeyPolicy(), key: "alice@example.com", expectErr: true},
+		{name: "Default rejects long keys", policy: DefaultKeyPolicy(), key: strings.Repeat("a", 257), expectErr: true},
+		{name: "Empty key", policy: utf8Policy, key: "", expectErr: true},
+		{name: "Email", policy: utf8Policy, key: "alice@example.com", expected: "alice@example.com"},
+		{name: "URL path", policy: utf8Policy, key: "/api/v1/users", expected: "/api/v1/users"},
+		{name: "IPv6", policy: utf8Policy, key: "2001:db8::1", expected: "2001:db8::1"},
+		{name: "Composite", policy: utf8Policy, key: "acme:bob", expected: "acme:bob"},
+		{name: "UTF-8 user name", policy: utf8Policy, key: "Zoë", expected: "Zoë"},
+		{name: "Control characters", policy: utf8Policy, key: "bob\n", expectErr: true},
+		{name: "Invalid UTF-8", policy: utf8Policy, key: "bob\xff", expectErr: true},
+		{
+			name:     "Normalized",
+			policy:   KeyPolicy{Normalize: strings.ToLower, Validate: ValidateKey},
+			key:      "User1",
+			expected: "user1",
+		},
+		{name: "Normalized to empty", policy: KeyPolicy{Normalize: strings.TrimSpace}, key: "  ", expectErr: true},
+		{name: "Short key not hashed", policy: hashOver, key: "acme:bob", expected: "acme:bob"},
+		{name: "Long key hashed", policy: hashOver, key: longKey, hashed: true},
+		{name: "Hash prefix hashed", policy: hashOver, key: "sha256.abc", hashed: true},
+		{name: "Hash all", policy: KeyPolicy{HashAll: true}, key: "acme:bob", hashed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storeKey, err := tt.policy.StoreKey(tt.key)
+			if tt.expectErr {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("Expected ErrInvalidKey, got %q, %v", storeKey, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.hashed {
+				if !strings.HasPrefix(storeKey, "sha256.") || len(storeKey) != len("sha256.")+64 {
+					t.Errorf("Expected a hashed store key, got %q", storeKey)
+				}
+				if err := ValidateKey(storeKey); err != nil {
+					t.Errorf("Expected the hashed store key to be a valid default key, got %v", err)
+				}
+				return
+			}
+			if storeKey != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, storeKey)
+			}
+		})
+	}
+}
+
+func TestKeyPolicy_HashCollision(t *testing.T) {
+	policy := KeyPolicy{HashOver: 64}
+	longKey := strings.Repeat("k", 100)
+
+	hashed, err := policy.StoreKey(longKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// A client sending the hashed form of another key gets a different store key
+	forged, err := policy.StoreKey(hashed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if forged == hashed {
+		t.Errorf("Expected the forged key %q not to collide with the hashed key", forged)
+	}
+}
+
+func TestKeyPolicy_CustomValidator(t *testing.T) {
+	policy := KeyPolicy{Validate: func(key string) error {
+		if !strings.HasPrefix(key, "tenant:") {
+			return errors.New("key must start with tenant:")
+		}
+		return nil
+	}}
+
+	_, err := policy.StoreKey("user1")
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("Expected the validator error to wrap ErrInvalidKey, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "key must start with tenant:") {
+		t.Errorf("Expected the validator message to be kept, got %q", err)
+	}
+}
+
+// TestWithKeyPolicy tests that every limiter applies its key policy, so that keys that
+// normalize to the same store key share a quota.
+func TestWithKeyPolicy(t *testing.T) {
+	policy := &KeyPolicy{Normalize: strings.ToLower, Validate: ValidateUTF8Key, HashOver: 32}
+	configs := []LimiterConfig{
+		{Policy: FixedWindowPolicy, Limit: 1, Interval: time.Hour},
+		{Policy: SlidingWindowPolicy, Limit: 1, Interval: time.Hour},
+		{Policy: TokenBucketPolicy, Capacity: 1, RefillRate: 0.001},
+		{Policy: LeakyBucketPolicy, Capacity: 1, LeakRate: 0.001},
+		{Policy: ConcurrencyPolicy, Concurrency: 1},
+		{Policy: GCRAPolicy, Burst: 1, Rate: 0.001},
+		{Policy: SlidingWindowCounterPolicy, Limit: 1, Interval: time.Hour},
+	}
+
+	for _, config := range configs {
+		t.Run(string(config.Policy), func(t *testing.T) {
+			config.Store = store.NewMemoryStore()
+			config.KeyPolicy = policy
+			limiter, err := NewRateLimiter(config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer limiter.Close()
+
+			// Keys outside the default character set are accepted, and long ones hashed
+			key := "Tenant:ACME/Alice@Example.com/" + strings.Repeat("x", 40)
+			if allowed, err := limiter.Allow(key); err != nil || !allowed {
+				t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+			}
+			if allowed, err := limiter.Allow(strings.ToLower(key)); err != nil || allowed {
+				t.Errorf("Expected the normalized key to share the quota, got %v, %v", allowed, err)
+			}
+			if _, err := limiter.Allow("bad\x00key"); !errors.Is(err, ErrInvalidKey) {
+				t.Errorf("Expected ErrInvalidKey, got %v", err)
+			}
+		})
+	}
+}
+
+// TestConcurrencyLimiter_KeyPolicyRelease tests that releasing slots, directly or by
+// cancelling a reservation, frees the slot of the same store key.
+func TestConcurrencyLimiter_KeyPolicyRelease(t *testing.T) {
+	limiter, err := NewConcurrencyLimiter(store.NewMemoryStore(), 1, WithKeyPolicy(KeyPolicy{HashAll: true}))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.Close()
+	key := "alice@example.com"
+
+	reservation, err := limiter.Reserve(key)
+	if err != nil || !reservation.OK() {
+		t.Fatalf("Expected a slot to be reserved, got %v", err)
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	if allowed, err := limiter.Allow(key); err != nil || !allowed {
+		t.Fatalf("Expected the cancelled slot to be free, got %v, %v", allowed, err)
+	}
+	if err := limiter.Release(key); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if allowed, err := limiter.Allow(key); err != nil || !allowed {
+		t.Errorf("Expected the released slot to be free, got %v, %v", allowed, err)
+	}
+}
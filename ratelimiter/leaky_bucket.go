@@ -1,10 +1,12 @@
 package ratelimiter
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
+	"github.com/neelp03/throttlex/clock"
 	"github.com/neelp03/throttlex/store"
 )
 
@@ -14,13 +16,15 @@ type LeakyBucketLimiter struct {
 	capacity        int           // Maximum capacity of the bucket
 	leakRate        float64       // Leak rate per second
 	mutexes         sync.Map      // Map of mutexes for per-key synchronization
-	cleanupTicker   *time.Ticker  // Ticker for periodic mutex cleanup
+	cleanupTicker   clock.Ticker  // Ticker for periodic mutex cleanup
 	cleanupStopCh   chan struct{} // Channel to stop the cleanup goroutine
 	cleanupInterval time.Duration // Interval for mutex cleanup
+	lifecycle                     // Tracks whether the limiter is closed
+	options                       // Optional settings such as the clock
 }
 
 // NewLeakyBucketLimiter creates a new instance of LeakyBucketLimiter.
-func NewLeakyBucketLimiter(store store.Store, capacity int, leakRate float64) (*LeakyBucketLimiter, error) {
+func NewLeakyBucketLimiter(store store.Store, capacity int, leakRate float64, opts ...Option) (*LeakyBucketLimiter, error) {
 	if capacity <= 0 {
 		return nil, errors.New("capacity must be greater than zero")
 	}
@@ -38,6 +42,7 @@ func NewLeakyBucketLimiter(store store.Store, capacity int, leakRate float64) (*
 		mutexes:         sync.Map{},
 		cleanupInterval: time.Minute * 5,
 		cleanupStopCh:   make(chan struct{}),
+		options:         newOptions(defaultNamespace(LeakyBucketPolicy, capacity, leakRate), opts),
 	}
 	go limiter.startMutexCleanup()
 	return limiter, nil
@@ -47,74 +52,248 @@ func NewLeakyBucketLimiter(store store.Store, capacity int, leakRate float64) (*
 func (l *LeakyBucketLimiter) getMutex(key string) *keyMutex {
 	mutexInterface, _ := l.mutexes.LoadOrStore(key, &keyMutex{
 		mu:         &sync.Mutex{},
-		lastAccess: time.Now(),
+		lastAccess: l.now(),
 	})
 	return mutexInterface.(*keyMutex)
 }
 
 // Allow checks whether a request associated with the given key is allowed under the rate limit.
 func (l *LeakyBucketLimiter) Allow(key string) (bool, error) {
-	// Input validation
-	if err := validateKey(key); err != nil {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks whether a request of cost n associated with the given key is allowed under the rate limit.
+func (l *LeakyBucketLimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.DecideN(key, n)
+	if err != nil {
 		return false, err
 	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *LeakyBucketLimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.DecideNContext(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Decide checks whether a request associated with the given key is allowed under the rate limit
+// and reports the room left in the bucket.
+func (l *LeakyBucketLimiter) Decide(key string) (*Result, error) {
+	return l.DecideN(key, 1)
+}
+
+// DecideN checks whether a request of cost n associated with the given key is allowed under the
+// rate limit and reports the room left in the bucket. An admitted request enqueues n units;
+// ErrCostExceedsCapacity is returned if n exceeds the bucket capacity.
+func (l *LeakyBucketLimiter) DecideN(key string, n int64) (*Result, error) {
+	return l.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *LeakyBucketLimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := l.reserveN(ctx, key, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
+
+// Reserve reserves room in the bucket for a request associated with the given key, waiting as long as needed.
+func (l *LeakyBucketLimiter) Reserve(key string) (*Reservation, error) {
+	return l.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN reserves room for n units in the bucket for a request associated with the given key.
+// The bucket may be filled beyond its capacity, in which case the reservation delay is the time
+// needed for the excess to leak out; if that exceeds maxDelay nothing is enqueued and the
+// reservation is not OK.
+func (l *LeakyBucketLimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.reserveN(ctx, key, n, maxDelay)
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *LeakyBucketLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until a request of cost n associated with the given key is allowed, or the
+// context is done. It fails immediately with ErrWaitExceedsDeadline, without enqueueing
+// anything, if the bucket cannot leak enough before the context deadline.
+func (l *LeakyBucketLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	return waitN(ctx, l, l.getClock(), key, n)
+}
+
+// reserveN leaks the bucket for the given key and enqueues n units if they fit within maxDelay.
+func (l *LeakyBucketLimiter) reserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := l.checkOpen(); err != nil {
+		return nil, err
+	}
+	// Input validation
+	key, err := l.storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCost(n, float64(l.capacity)); err != nil {
+		return nil, err
+	}
+	cost := int(n)
 
 	km := l.getMutex(key)
 	km.mu.Lock()
 	defer km.mu.Unlock()
-	km.lastAccess = time.Now()
+	km.lastAccess = l.now()
 
-	state, err := l.store.GetLeakyBucket(key)
+	now := l.now()
+	state, added, err := l.fill(ctx, key, cost, maxDelay, now)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	// Time until enough queued requests have leaked out for the request to fit
+	queued := state.Queue
+	if added {
+		queued -= cost
+	}
+	wait := l.wait(queued+cost, state.LastLeakTime, now)
+
+	reservation := &Reservation{ok: added, timeToAct: now.Add(wait), clock: l.getClock()}
+	if added {
+		reservation.cancel = func() error { return l.refund(key, cost) }
+	}
+	reservation.result = l.result(wait == 0 && added, state, wait)
+	return reservation, nil
+}
+
+// fill leaks the bucket for the given key at time now and adds the given number of units
+// to its queue, overfilling it if needed, if they fit within maxDelay. Negative units are
+// removed. It returns the state after the update and whether the units were added. The
+// caller holds the mutex for the key.
+//
+// If the store implements store.LeakyBucketFiller, the update is made atomically by the
+// store, so that limiters sharing it from different processes cannot over-admit.
+// Otherwise the state is read and written back in separate calls, which the mutex
+// only guards against other callers of this limiter.
+func (l *LeakyBucketLimiter) fill(ctx context.Context, key string, units int, maxDelay time.Duration, now time.Time) (*store.LeakyBucketState, bool, error) {
+	if filler, ok := l.store.(store.LeakyBucketFiller); ok {
+		return filler.FillLeakyBucket(ctx, key, store.FillLeakyBucketRequest{
+			Capacity:   l.capacity,
+			LeakRate:   l.leakRate,
+			Units:      units,
+			MaxDelay:   maxDelay,
+			Now:        now,
+			Expiration: time.Hour * 24,
+		})
 	}
 
-	now := time.Now()
+	state, err := l.store.GetLeakyBucketContext(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
 
+	l.leak(state, now)
 	if state == nil {
 		// Initialize state
 		state = &store.LeakyBucketState{
 			Queue:        0,
 			LastLeakTime: now,
 		}
-	} else {
-		// Leak tokens based on elapsed time
-		elapsed := now.Sub(state.LastLeakTime).Seconds()
-		leaked := int(elapsed * l.leakRate)
-		if leaked > 0 {
-			state.Queue -= leaked
-			if state.Queue < 0 {
-				state.Queue = 0
-			}
-			// Update LastLeakTime
-			state.LastLeakTime = state.LastLeakTime.Add(time.Duration(float64(leaked)/l.leakRate) * time.Second)
-		}
 	}
 
-	if state.Queue < l.capacity {
-		state.Queue++
-		err = l.store.SetLeakyBucket(key, state, time.Hour*24)
-		if err != nil {
-			return false, err
+	added := false
+	if l.wait(state.Queue+units, state.LastLeakTime, now) <= maxDelay {
+		state.Queue += units
+		if state.Queue < 0 {
+			state.Queue = 0
 		}
-		return true, nil
-	} else {
-		// Update the state even if not allowed
-		err = l.store.SetLeakyBucket(key, state, time.Hour*24)
-		if err != nil {
-			return false, err
+		added = true
+	}
+
+	// Update the state even if nothing was added
+	err = l.store.SetLeakyBucketContext(ctx, key, state, time.Hour*24)
+	if err != nil {
+		return nil, false, err
+	}
+	return state, added, nil
+}
+
+// wait returns how long it takes, from now, for a bucket last leaked at lastLeakTime to leak
+// enough for a queue of the given length to fit.
+func (l *LeakyBucketLimiter) wait(queue int, lastLeakTime, now time.Time) time.Duration {
+	overflow := queue - l.capacity
+	if overflow <= 0 {
+		return 0
+	}
+	wait := lastLeakTime.Add(secondsToDuration(float64(overflow) / l.leakRate)).Sub(now)
+	if wait <= 0 {
+		// The next leak is due now but has not been applied yet
+		wait = 1
+	}
+	return wait
+}
+
+// leak removes the requests that have leaked out of the bucket since its last leak.
+func (l *LeakyBucketLimiter) leak(state *store.LeakyBucketState, now time.Time) {
+	if state == nil {
+		return
+	}
+
+	// Leak tokens based on elapsed time
+	elapsed := now.Sub(state.LastLeakTime).Seconds()
+	leaked := int(elapsed * l.leakRate)
+	if leaked > 0 {
+		state.Queue -= leaked
+		if state.Queue < 0 {
+			state.Queue = 0
 		}
-		return false, nil
+		// Update LastLeakTime
+		state.LastLeakTime = state.LastLeakTime.Add(secondsToDuration(float64(leaked) / l.leakRate))
 	}
 }
 
+// refund removes units enqueued by a cancelled reservation from the bucket.
+func (l *LeakyBucketLimiter) refund(key string, units int) error {
+	km := l.getMutex(key)
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.lastAccess = l.now()
+
+	_, _, err := l.fill(context.Background(), key, -units, InfDuration, l.now())
+	return err
+}
+
+// result builds the decision for the given bucket state, where wait is the time until the
+// request could be admitted.
+func (l *LeakyBucketLimiter) result(allowed bool, state *store.LeakyBucketState, wait time.Duration) Result {
+	result := Result{
+		Allowed: allowed,
+		Limit:   int64(l.capacity),
+		ResetAt: state.LastLeakTime.Add(secondsToDuration(float64(state.Queue) / l.leakRate)),
+	}
+	if remaining := l.capacity - state.Queue; remaining > 0 {
+		result.Remaining = int64(remaining)
+	}
+	if !allowed {
+		result.RetryAfter = wait
+	}
+	return result
+}
+
 // startMutexCleanup runs a background goroutine to clean up unused mutexes.
 func (l *LeakyBucketLimiter) startMutexCleanup() {
-	l.cleanupTicker = time.NewTicker(l.cleanupInterval)
+	l.cleanupTicker = l.getClock().NewTicker(l.cleanupInterval)
 	for {
 		select {
-		case <-l.cleanupTicker.C:
-			now := time.Now()
+		case <-l.cleanupTicker.C():
+			now := l.now()
 			l.mutexes.Range(func(key, value interface{}) bool {
 				km := value.(*keyMutex)
 				km.mu.Lock()
@@ -133,7 +312,46 @@ func (l *LeakyBucketLimiter) startMutexCleanup() {
 	}
 }
 
-// StopCleanup stops the mutex cleanup goroutine.
+// Close stops the mutex cleanup goroutine and makes later calls fail with ErrClosed. It
+// does not close the store, which may be shared. Closing a closed limiter does nothing.
+func (l *LeakyBucketLimiter) Close() error {
+	l.shutdown(func() { close(l.cleanupStopCh) })
+	return nil
+}
+
+// StopCleanup stops the mutex cleanup goroutine, leaving the limiter usable. Calling it
+// again, or after Close, does nothing.
 func (l *LeakyBucketLimiter) StopCleanup() {
-	close(l.cleanupStopCh)
+	l.stopBackground(func() { close(l.cleanupStopCh) })
+}
+
+// TrackedKeys returns the number of keys the limiter holds a mutex for. Mutexes of keys
+// left idle for twice the cleanup interval are dropped by the cleanup goroutine.
+func (l *LeakyBucketLimiter) TrackedKeys() int {
+	return countKeys(&l.mutexes)
+}
+
+// Inspect returns the leaky bucket of key, as of its last leak.
+func (l *LeakyBucketLimiter) Inspect(ctx context.Context, key string) (*KeyState, error) {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return nil, err
+	}
+	state, err := inspectKey(ctx, inspector, LeakyBucketPolicy, key)
+	if err != nil || !state.Exists {
+		return state, err
+	}
+	if state.LeakyBucket, err = l.store.GetLeakyBucketContext(ctx, key); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Reset deletes the leaky bucket of key, which is empty again.
+func (l *LeakyBucketLimiter) Reset(ctx context.Context, key string) error {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return err
+	}
+	return inspector.Delete(ctx, key)
 }
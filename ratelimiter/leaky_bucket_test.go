@@ -1,6 +1,8 @@
 package ratelimiter
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -63,7 +65,7 @@ func TestLeakyBucketLimiter_Persistence(t *testing.T) {
 		Queue:        3,
 		LastLeakTime: time.Now().Add(-2 * time.Second),
 	}
-	err = s.SetLeakyBucket(key, state, time.Hour*24)
+	err = s.SetLeakyBucket(mustStoreKey(t, &lb.options, key), state, time.Hour*24)
 	if err != nil {
 		t.Fatalf("Error setting state: %v", err)
 	}
@@ -105,7 +107,7 @@ func TestLeakyBucketLimiter_Concurrency(t *testing.T) {
 	}
 
 	// Verify that the queue size is 100
-	state, err := s.GetLeakyBucket(key)
+	state, err := s.GetLeakyBucket(mustStoreKey(t, &lb.options, key))
 	if err != nil {
 		t.Fatalf("Error getting state: %v", err)
 	}
@@ -113,3 +115,175 @@ func TestLeakyBucketLimiter_Concurrency(t *testing.T) {
 		t.Errorf("Expected queue size to be 100, got %v", state.Queue)
 	}
 }
+
+func TestLeakyBucketLimiter_Decide(t *testing.T) {
+	s := store.NewMemoryStore()
+	lb, err := NewLeakyBucketLimiter(s, 2, 4.0)
+	if err != nil {
+		t.Fatalf("Error creating LeakyBucketLimiter: %v", err)
+	}
+	defer lb.StopCleanup()
+
+	key := "test_key"
+
+	for i := 0; i < 2; i++ {
+		result, err := lb.Decide(key)
+		if err != nil {
+			t.Fatalf("Error on Decide(): %v", err)
+		}
+		if !result.Allowed || result.Limit != 2 || result.Remaining != int64(1-i) {
+			t.Errorf("Unexpected result at iteration %d: %+v", i, result)
+		}
+	}
+
+	result, err := lb.Decide(key)
+	if err != nil {
+		t.Fatalf("Error on Decide(): %v", err)
+	}
+	if result.Allowed {
+		t.Errorf("Expected Decide() to deny when bucket is full")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > 250*time.Millisecond {
+		t.Errorf("Expected retry-after of at most 250ms, got %v", result.RetryAfter)
+	}
+	if untilReset := time.Until(result.ResetAt); untilReset <= 250*time.Millisecond || untilReset > 500*time.Millisecond {
+		t.Errorf("Expected the bucket to drain in about 500ms, got %v", untilReset)
+	}
+
+	// A fractional leak period must not be truncated to whole seconds
+	time.Sleep(result.RetryAfter)
+
+	allowed, err := lb.Allow(key)
+	if err != nil {
+		t.Fatalf("Error on Allow(): %v", err)
+	}
+	if !allowed {
+		t.Errorf("Expected Allow() to return true after retry-after")
+	}
+}
+
+func TestLeakyBucketLimiter_AllowN(t *testing.T) {
+	s := store.NewMemoryStore()
+	lb, err := NewLeakyBucketLimiter(s, 5, 1.0)
+	if err != nil {
+		t.Fatalf("Error creating LeakyBucketLimiter: %v", err)
+	}
+	defer lb.StopCleanup()
+
+	key := "test_key"
+
+	allowed, err := lb.AllowN(key, 4)
+	if err != nil {
+		t.Fatalf("Error on AllowN(): %v", err)
+	}
+	if !allowed {
+		t.Errorf("Expected AllowN() to enqueue 4 requests")
+	}
+
+	allowed, err = lb.AllowN(key, 2)
+	if err != nil {
+		t.Fatalf("Error on AllowN(): %v", err)
+	}
+	if allowed {
+		t.Errorf("Expected AllowN() to return false when the cost overflows the bucket")
+	}
+
+	state, err := s.GetLeakyBucket(mustStoreKey(t, &lb.options, key))
+	if err != nil {
+		t.Fatalf("Error getting state: %v", err)
+	}
+	if state.Queue != 4 {
+		t.Errorf("Expected queue size to be 4, got %v", state.Queue)
+	}
+
+	_, err = lb.AllowN(key, 6)
+	if !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+}
+
+func TestLeakyBucketLimiter_Wait(t *testing.T) {
+	s := store.NewMemoryStore()
+	lb, err := NewLeakyBucketLimiter(s, 1, 10.0)
+	if err != nil {
+		t.Fatalf("Error creating LeakyBucketLimiter: %v", err)
+	}
+	defer lb.StopCleanup()
+
+	key := "test_key"
+
+	if err := lb.Wait(context.Background(), key); err != nil {
+		t.Fatalf("Error on first Wait(): %v", err)
+	}
+
+	start := time.Now()
+	if err := lb.Wait(context.Background(), key); err != nil {
+		t.Fatalf("Error on second Wait(): %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("Expected second Wait() to block until a request leaked, took %v", elapsed)
+	}
+
+	// Cancelling a reservation removes it from the queue
+	reservation, err := lb.Reserve(key)
+	if err != nil {
+		t.Fatalf("Error on Reserve(): %v", err)
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Error on Cancel(): %v", err)
+	}
+	state, err := s.GetLeakyBucket(mustStoreKey(t, &lb.options, key))
+	if err != nil {
+		t.Fatalf("Error getting state: %v", err)
+	}
+	if state.Queue > 1 {
+		t.Errorf("Expected queue size of at most 1 after Cancel(), got %v", state.Queue)
+	}
+}
+
+func TestLeakyBucketLimiter_WithoutFiller(t *testing.T) {
+	lb, err := NewLeakyBucketLimiter(plainStore{store.NewMemoryStore()}, 3, 1.0)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	defer lb.StopCleanup()
+	key := "plain_key"
+
+	for i := 0; i < 3; i++ {
+		allowed, err := lb.Allow(key)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+	result, err := lb.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Request exceeding capacity should not be allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("Expected retry-after of at most 1s, got %v", result.RetryAfter)
+	}
+
+	reservation, err := lb.ReserveN(context.Background(), key, 1, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reservation.OK() {
+		t.Fatal("Reservation within a second should be OK")
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on cancel: %v", err)
+	}
+	state, err := lb.store.GetLeakyBucket(mustStoreKey(t, &lb.options, key))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state.Queue != 3 {
+		t.Errorf("Expected queue of 3 after cancel, got %d", state.Queue)
+	}
+}
@@ -0,0 +1,36 @@
+// ratelimiter/lifecycle.go
+
+package ratelimiter
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// lifecycle tracks whether a limiter has been closed and stops its background work once.
+// Its zero value is an open limiter.
+type lifecycle struct {
+	closed   atomic.Bool // Set by Close
+	stopOnce sync.Once   // Guards stopping the background work
+}
+
+// shutdown marks the limiter closed and stops its background work, if any.
+func (lc *lifecycle) shutdown(stop func()) {
+	lc.closed.Store(true)
+	if stop != nil {
+		lc.stopBackground(stop)
+	}
+}
+
+// stopBackground calls stop unless it has been called before.
+func (lc *lifecycle) stopBackground(stop func()) {
+	lc.stopOnce.Do(stop)
+}
+
+// checkOpen returns ErrClosed if the limiter is closed.
+func (lc *lifecycle) checkOpen() error {
+	if lc.closed.Load() {
+		return ErrClosed
+	}
+	return nil
+}
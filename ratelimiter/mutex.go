@@ -12,3 +12,13 @@ type keyMutex struct {
 	mu         *sync.Mutex
 	lastAccess time.Time
 }
+
+// countKeys returns the number of keys in mutexes.
+func countKeys(mutexes *sync.Map) int {
+	n := 0
+	mutexes.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
@@ -0,0 +1,105 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+)
+
+// Option configures optional behavior of a limiter.
+type Option func(*options)
+
+// namespaceSeparator separates the namespace of a limiter from the keys it stores.
+const namespaceSeparator = ":"
+
+// options holds the optional settings shared by all limiters. Its zero value applies the
+// defaults, apart from the namespace, which newOptions sets.
+type options struct {
+	clock     clock.Clock // Source of time; the real clock if nil
+	keyPolicy *KeyPolicy  // Keys accepted and how they are stored; DefaultKeyPolicy if nil
+	namespace string      // Prefix of every store key; none if empty
+}
+
+// newOptions applies opts to the default settings of a limiter whose default namespace is
+// defaultNamespace.
+func newOptions(defaultNamespace string, opts []Option) options {
+	o := options{namespace: defaultNamespace}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// defaultNamespace returns the namespace of a limiter of the given policy and parameters,
+// such as "TokenBucket:10:0.5", so that limiters with different policies or parameters
+// sharing a store never touch each other's keys.
+func defaultNamespace(policy PolicyType, params ...interface{}) string {
+	parts := make([]string, 0, len(params)+1)
+	parts = append(parts, string(policy))
+	for _, param := range params {
+		parts = append(parts, fmt.Sprint(param))
+	}
+	return strings.Join(parts, namespaceSeparator)
+}
+
+// WithClock makes the limiter read the time, wait and schedule its background work with c
+// instead of the real clock. A nil clock selects the real clock.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithKeyPolicy makes the limiter accept, normalize and store keys as p says instead of
+// following DefaultKeyPolicy.
+func WithKeyPolicy(p KeyPolicy) Option {
+	return func(o *options) {
+		o.keyPolicy = &p
+	}
+}
+
+// WithNamespace sets the prefix of every store key the limiter touches, in place of the
+// default derived from its policy and parameters. A fixed namespace keeps the state of
+// keys when the parameters of the limiter change, while the default starts afresh. Two
+// limiters must only share a namespace and a store if they are meant to share state. An
+// empty namespace stores keys unprefixed, as earlier versions did.
+func WithNamespace(ns string) Option {
+	return func(o *options) {
+		o.namespace = ns
+	}
+}
+
+// Namespace returns the prefix of the store keys of the limiter, or an empty string if
+// keys are stored unprefixed.
+func (o *options) Namespace() string {
+	return o.namespace
+}
+
+// getClock returns the clock of the limiter.
+func (o *options) getClock() clock.Clock {
+	if o.clock == nil {
+		return clock.New()
+	}
+	return o.clock
+}
+
+// now returns the current time of the limiter's clock.
+func (o *options) now() time.Time {
+	return o.getClock().Now()
+}
+
+// storeKey applies the key policy of the limiter to key and prefixes it with the
+// namespace, returning the key its state is stored under.
+func (o *options) storeKey(key string) (string, error) {
+	policy := DefaultKeyPolicy()
+	if o.keyPolicy != nil {
+		policy = *o.keyPolicy
+	}
+	key, err := policy.StoreKey(key)
+	if err != nil || o.namespace == "" {
+		return key, err
+	}
+	return o.namespace + namespaceSeparator + key, nil
+}
@@ -0,0 +1,289 @@
+// ratelimiter/options_test.go
+
+package ratelimiter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/store"
+)
+
+// TestWithClock_Refill tests that a limiter refills as its clock moves, not as real time passes.
+func TestWithClock_Refill(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := store.NewMemoryStore(store.WithClock(fake))
+	limiter, err := NewTokenBucketLimiter(memStore, 2, 1, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+	key := "user1"
+
+	for i := 0; i < 2; i++ {
+		if allowed, err := limiter.Allow(key); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Fatal("Request exceeding capacity should not be allowed")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("Expected RetryAfter of 1s, got %v", result.RetryAfter)
+	}
+
+	fake.Advance(time.Second)
+	if allowed, err := limiter.Allow(key); err != nil || !allowed {
+		t.Errorf("Request after refill should be allowed, got %v, %v", allowed, err)
+	}
+}
+
+// TestWithClock_Wait tests that Wait returns once the clock reaches the reserved time.
+func TestWithClock_Wait(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := store.NewMemoryStore(store.WithClock(fake))
+	limiter, err := NewGCRALimiter(memStore, 1, 0.1, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	key := "user1"
+
+	if allowed, err := limiter.Allow(key); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- limiter.Wait(context.Background(), key)
+	}()
+
+	// The waiter's timer is the only one pending
+	fake.BlockUntil(1)
+	fake.Advance(10*time.Second - time.Nanosecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Wait returned before the reserved time: %v", err)
+	default:
+	}
+
+	fake.Advance(time.Nanosecond)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Unexpected error from Wait: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return at the reserved time")
+	}
+}
+
+// TestNewRateLimiter_Clock tests that the factory passes the configured clock on.
+func TestNewRateLimiter_Clock(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	limiter, err := NewRateLimiter(LimiterConfig{
+		Policy:   FixedWindowPolicy,
+		Store:    store.NewMemoryStore(store.WithClock(fake)),
+		Limit:    1,
+		Interval: time.Minute,
+		Clock:    fake,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.Close()
+	key := "user1"
+
+	if allowed, _ := limiter.Allow(key); !allowed {
+		t.Fatal("First request should be allowed")
+	}
+	if allowed, _ := limiter.Allow(key); allowed {
+		t.Fatal("Second request in the window should not be allowed")
+	}
+	fake.Advance(time.Minute)
+	if allowed, _ := limiter.Allow(key); !allowed {
+		t.Error("Request in the next window should be allowed")
+	}
+}
+
+// TestNamespace_Isolation tests that limiters sharing a store and a key do not touch each
+// other's state.
+func TestNamespace_Isolation(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs [2]LimiterConfig
+	}{
+		{
+			// Both store window counters under the key and the window number
+			name: "FixedWindow and SlidingWindowCounter",
+			configs: [2]LimiterConfig{
+				{Policy: FixedWindowPolicy, Limit: 1, Interval: time.Hour},
+				{Policy: SlidingWindowCounterPolicy, Limit: 1, Interval: time.Hour},
+			},
+		},
+		{
+			name: "TokenBucket and LeakyBucket",
+			configs: [2]LimiterConfig{
+				{Policy: TokenBucketPolicy, Capacity: 1, RefillRate: 0.001},
+				{Policy: LeakyBucketPolicy, Capacity: 1, LeakRate: 0.001},
+			},
+		},
+		{
+			name: "Concurrency and FixedWindow",
+			configs: [2]LimiterConfig{
+				{Policy: ConcurrencyPolicy, Concurrency: 1},
+				{Policy: FixedWindowPolicy, Limit: 1, Interval: time.Hour},
+			},
+		},
+		{
+			name: "Per-second and per-hour windows",
+			configs: [2]LimiterConfig{
+				{Policy: FixedWindowPolicy, Limit: 1, Interval: time.Second},
+				{Policy: FixedWindowPolicy, Limit: 1, Interval: time.Hour},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memStore := store.NewMemoryStore()
+			for i, config := range tt.configs {
+				config.Store = memStore
+				limiter, err := NewRateLimiter(config)
+				if err != nil {
+					t.Fatalf("Failed to create rate limiter: %v", err)
+				}
+				defer limiter.Close()
+
+				// Each limiter has its full quota of one request
+				if allowed, err := limiter.Allow("user1"); err != nil || !allowed {
+					t.Fatalf("Limiter %d: first request should be allowed, got %v, %v", i+1, allowed, err)
+				}
+				if allowed, err := limiter.Allow("user1"); err != nil || allowed {
+					t.Errorf("Limiter %d: second request should not be allowed, got %v, %v", i+1, allowed, err)
+				}
+			}
+		})
+	}
+}
+
+// TestNamespace_ConcurrencyIsolation tests that concurrency limiters with different maximums
+// sharing a store count their slots apart.
+func TestNamespace_ConcurrencyIsolation(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	uploads, err := NewConcurrencyLimiter(memStore, 1)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer uploads.Close()
+	search, err := NewConcurrencyLimiter(memStore, 2)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer search.Close()
+
+	if allowed, err := uploads.Allow("user1"); err != nil || !allowed {
+		t.Fatalf("First upload should be allowed, got %v, %v", allowed, err)
+	}
+	for i := 0; i < 2; i++ {
+		if allowed, err := search.Allow("user1"); err != nil || !allowed {
+			t.Errorf("Search %d should be allowed while an upload holds a slot, got %v, %v", i+1, allowed, err)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	tokenBucket, _ := NewTokenBucketLimiter(memStore, 10, 0.5)
+	fixedWindow, _ := NewFixedWindowLimiter(memStore, 100, time.Minute)
+	concurrency, _ := NewConcurrencyLimiter(memStore, 5)
+	custom, _ := NewGCRALimiter(memStore, 5, 1, WithNamespace("api.v2"))
+	defer tokenBucket.Close()
+	defer fixedWindow.Close()
+	defer concurrency.Close()
+	defer custom.Close()
+
+	tests := []struct {
+		name     string
+		limiter  interface{ Namespace() string }
+		expected string
+	}{
+		{name: "TokenBucket", limiter: tokenBucket, expected: "TokenBucket:10:0.5"},
+		{name: "FixedWindow", limiter: fixedWindow, expected: "FixedWindow:100:1m0s"},
+		{name: "Concurrency", limiter: concurrency, expected: "Concurrency:5"},
+		{name: "Custom", limiter: custom, expected: "api.v2"},
+	}
+
+	for _, tt := range tests {
+		if ns := tt.limiter.Namespace(); ns != tt.expected {
+			t.Errorf("%s: expected namespace %q, got %q", tt.name, tt.expected, ns)
+		}
+	}
+}
+
+// TestWithNamespace_ParameterChange tests that a fixed namespace keeps the state of keys
+// when the parameters of a limiter change, while the default namespace starts afresh.
+func TestWithNamespace_ParameterChange(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	key := "user1"
+
+	limiter, err := NewTokenBucketLimiter(memStore, 2, 0.001, WithNamespace("api"))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.Close()
+	for i := 0; i < 2; i++ {
+		if allowed, err := limiter.Allow(key); err != nil || !allowed {
+			t.Fatalf("Request %d should be allowed, got %v, %v", i+1, allowed, err)
+		}
+	}
+
+	// A larger bucket in the same namespace sees the tokens already taken
+	resized, err := NewTokenBucketLimiter(memStore, 3, 0.001, WithNamespace("api"))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer resized.Close()
+	if allowed, err := resized.Allow(key); err != nil || allowed {
+		t.Errorf("Expected the state to be kept in a fixed namespace, got %v, %v", allowed, err)
+	}
+
+	// In the default namespace, the new parameters start with a full bucket
+	fresh, err := NewTokenBucketLimiter(memStore, 3, 0.001)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer fresh.Close()
+	if allowed, err := fresh.Allow(key); err != nil || !allowed {
+		t.Errorf("Expected a fresh bucket in the default namespace, got %v, %v", allowed, err)
+	}
+}
+
+func TestWithNamespace_Empty(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewFixedWindowLimiter(memStore, 5, time.Hour, WithNamespace(""))
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.Close()
+
+	if storeKey := mustStoreKey(t, &limiter.options, "user1"); storeKey != "user1" {
+		t.Errorf("Expected the key to be stored unprefixed, got %q", storeKey)
+	}
+}
+
+// mustStoreKey returns the key the state of key is stored under by a limiter with the
+// given options.
+func mustStoreKey(t *testing.T, o *options, key string) string {
+	t.Helper()
+	storeKey, err := o.storeKey(key)
+	if err != nil {
+		t.Fatalf("Invalid key %q: %v", key, err)
+	}
+	return storeKey
+}
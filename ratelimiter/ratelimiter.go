@@ -1,9 +1,11 @@
 package ratelimiter
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/neelp03/throttlex/clock"
 	"github.com/neelp03/throttlex/store"
 )
 
@@ -11,6 +13,28 @@ import (
 type RateLimiter interface {
 	// Allow checks if a request associated with the given key is allowed to proceed.
 	Allow(key string) (bool, error)
+
+	// Decide checks if a request associated with the given key is allowed to proceed
+	// and reports the remaining quota, reset time and retry-after duration.
+	Decide(key string) (*Result, error)
+
+	// AllowN checks if a request of cost n associated with the given key is allowed to proceed.
+	AllowN(key string, n int64) (bool, error)
+
+	// DecideN is like Decide for a request of cost n.
+	DecideN(key string, n int64) (*Result, error)
+
+	// AllowContext is like Allow but passes the context on to the store, so its
+	// cancellation and deadline apply to store calls.
+	AllowContext(ctx context.Context, key string) (bool, error)
+
+	// DecideNContext is like DecideN but passes the context on to the store, so its
+	// cancellation and deadline apply to store calls.
+	DecideNContext(ctx context.Context, key string, n int64) (*Result, error)
+
+	// Close stops the background work of the limiter and makes later calls fail with
+	// ErrClosed. It does not close the store. Closing a closed limiter does nothing.
+	Close() error
 }
 
 // PolicyType represents the type of rate-limiting policy.
@@ -22,8 +46,43 @@ const (
 	TokenBucketPolicy   PolicyType = "TokenBucket"
 	LeakyBucketPolicy   PolicyType = "LeakyBucket"
 	ConcurrencyPolicy   PolicyType = "Concurrency"
+	GCRAPolicy          PolicyType = "GCRA"
+
+	// SlidingWindowCounterPolicy approximates SlidingWindowPolicy with two counters per key;
+	// see SlidingWindowCounterLimiter for its error bound.
+	SlidingWindowCounterPolicy PolicyType = "SlidingWindowCounter"
 )
 
+// PolicyName returns the name of the policy of l, for metrics and traces: the policy
+// reported by a Policy method of l, such as that of a config.Limiter, the PolicyType of
+// the limiters of this package, "Composite" or "Hierarchical", and "unknown" otherwise.
+func PolicyName(l RateLimiter) string {
+	switch l := l.(type) {
+	case interface{ Policy() PolicyType }:
+		return string(l.Policy())
+	case *FixedWindowLimiter:
+		return string(FixedWindowPolicy)
+	case *SlidingWindowLimiter:
+		return string(SlidingWindowPolicy)
+	case *SlidingWindowCounterLimiter:
+		return string(SlidingWindowCounterPolicy)
+	case *TokenBucketLimiter:
+		return string(TokenBucketPolicy)
+	case *LeakyBucketLimiter:
+		return string(LeakyBucketPolicy)
+	case *ConcurrencyLimiter:
+		return string(ConcurrencyPolicy)
+	case *GCRALimiter:
+		return string(GCRAPolicy)
+	case *CompositeLimiter:
+		return "Composite"
+	case *HierarchicalLimiter:
+		return "Hierarchical"
+	default:
+		return "unknown"
+	}
+}
+
 // LimiterConfig holds configuration for a rate limiter.
 type LimiterConfig struct {
 	Policy      PolicyType
@@ -34,21 +93,44 @@ type LimiterConfig struct {
 	RefillRate  float64       // For TokenBucket
 	LeakRate    float64       // For LeakyBucket
 	Concurrency int64         // For ConcurrencyLimiter
+	Burst       int           // For GCRA
+	Rate        float64       // For GCRA, in requests per second
+	Clock       clock.Clock   // Source of time; the real clock if nil
+	KeyPolicy   *KeyPolicy    // Keys accepted and how they are stored; DefaultKeyPolicy if nil
+	Namespace   string        // Prefix of store keys; derived from the policy and parameters if empty
 }
 
 // NewRateLimiter is a factory function that creates a RateLimiter based on the specified policy.
 func NewRateLimiter(config LimiterConfig) (RateLimiter, error) {
+	return newRateLimiter(config)
+}
+
+// newRateLimiter is NewRateLimiter with options applied after those of the configuration.
+func newRateLimiter(config LimiterConfig, extra ...Option) (RateLimiter, error) {
+	opts := []Option{WithClock(config.Clock)}
+	if config.KeyPolicy != nil {
+		opts = append(opts, WithKeyPolicy(*config.KeyPolicy))
+	}
+	if config.Namespace != "" {
+		opts = append(opts, WithNamespace(config.Namespace))
+	}
+	opts = append(opts, extra...)
+
 	switch config.Policy {
 	case FixedWindowPolicy:
-		return NewFixedWindowLimiter(config.Store, config.Limit, config.Interval)
+		return NewFixedWindowLimiter(config.Store, config.Limit, config.Interval, opts...)
 	case SlidingWindowPolicy:
-		return NewSlidingWindowLimiter(config.Store, config.Limit, config.Interval)
+		return NewSlidingWindowLimiter(config.Store, config.Limit, config.Interval, opts...)
 	case TokenBucketPolicy:
-		return NewTokenBucketLimiter(config.Store, config.Capacity, config.RefillRate)
+		return NewTokenBucketLimiter(config.Store, config.Capacity, config.RefillRate, opts...)
 	case LeakyBucketPolicy:
-		return NewLeakyBucketLimiter(config.Store, int(config.Capacity), config.LeakRate)
+		return NewLeakyBucketLimiter(config.Store, int(config.Capacity), config.LeakRate, opts...)
 	case ConcurrencyPolicy:
-		return NewConcurrencyLimiter(config.Store, config.Concurrency)
+		return NewConcurrencyLimiter(config.Store, config.Concurrency, opts...)
+	case GCRAPolicy:
+		return NewGCRALimiter(config.Store, config.Burst, config.Rate, opts...)
+	case SlidingWindowCounterPolicy:
+		return NewSlidingWindowCounterLimiter(config.Store, config.Limit, config.Interval, opts...)
 	default:
 		return nil, fmt.Errorf("unknown rate limiting policy: %s", config.Policy)
 	}
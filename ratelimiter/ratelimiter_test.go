@@ -1,6 +1,8 @@
 package ratelimiter
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
 
@@ -64,6 +66,26 @@ func TestNewRateLimiter(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "GCRAPolicy",
+			config: LimiterConfig{
+				Policy: GCRAPolicy,
+				Store:  memStore,
+				Burst:  10,
+				Rate:   1,
+			},
+			expectError: false,
+		},
+		{
+			name: "SlidingWindowCounterPolicy",
+			config: LimiterConfig{
+				Policy:   SlidingWindowCounterPolicy,
+				Store:    memStore,
+				Limit:    5,
+				Interval: time.Second,
+			},
+			expectError: false,
+		},
 		{
 			name: "UnknownPolicy",
 			config: LimiterConfig{
@@ -110,7 +132,110 @@ func TestNewRateLimiter(t *testing.T) {
 				if _, ok := limiter.(*ConcurrencyLimiter); !ok {
 					t.Errorf("Expected ConcurrencyLimiter, got %T", limiter)
 				}
+			case GCRAPolicy:
+				if _, ok := limiter.(*GCRALimiter); !ok {
+					t.Errorf("Expected GCRALimiter, got %T", limiter)
+				}
+			case SlidingWindowCounterPolicy:
+				if _, ok := limiter.(*SlidingWindowCounterLimiter); !ok {
+					t.Errorf("Expected SlidingWindowCounterLimiter, got %T", limiter)
+				}
+			}
+		})
+	}
+}
+
+func TestAllowContext_Cancelled(t *testing.T) {
+	memStore := store.NewMemoryStore()
+
+	configs := []LimiterConfig{
+		{Policy: FixedWindowPolicy, Store: memStore, Limit: 5, Interval: time.Second},
+		{Policy: SlidingWindowPolicy, Store: memStore, Limit: 5, Interval: time.Second},
+		{Policy: TokenBucketPolicy, Store: memStore, Capacity: 5, RefillRate: 1},
+		{Policy: LeakyBucketPolicy, Store: memStore, Capacity: 5, LeakRate: 1},
+		{Policy: ConcurrencyPolicy, Store: memStore, Concurrency: 5},
+		{Policy: GCRAPolicy, Store: memStore, Burst: 5, Rate: 1},
+		{Policy: SlidingWindowCounterPolicy, Store: memStore, Limit: 5, Interval: time.Minute},
+	}
+
+	for _, config := range configs {
+		t.Run(string(config.Policy), func(t *testing.T) {
+			limiter, err := NewRateLimiter(config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			allowed, err := limiter.AllowContext(ctx, "cancelledUser")
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected context.Canceled, got %v", err)
+			}
+			if allowed {
+				t.Error("Request with a cancelled context should not be allowed")
+			}
+
+			// Nothing was consumed by the cancelled request
+			result, err := limiter.DecideNContext(context.Background(), "cancelledUser", 5)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Allowed {
+				t.Errorf("Full quota should be available after a cancelled request, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestClose(t *testing.T) {
+	memStore := store.NewMemoryStore()
+
+	configs := []LimiterConfig{
+		{Policy: FixedWindowPolicy, Store: memStore, Limit: 5, Interval: time.Second},
+		{Policy: SlidingWindowPolicy, Store: memStore, Limit: 5, Interval: time.Second},
+		{Policy: TokenBucketPolicy, Store: memStore, Capacity: 5, RefillRate: 1},
+		{Policy: LeakyBucketPolicy, Store: memStore, Capacity: 5, LeakRate: 1},
+		{Policy: ConcurrencyPolicy, Store: memStore, Concurrency: 5},
+		{Policy: GCRAPolicy, Store: memStore, Burst: 5, Rate: 1},
+		{Policy: SlidingWindowCounterPolicy, Store: memStore, Limit: 5, Interval: time.Minute},
+	}
+
+	for _, config := range configs {
+		t.Run(string(config.Policy), func(t *testing.T) {
+			limiter, err := NewRateLimiter(config)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if allowed, err := limiter.Allow("closedUser"); err != nil || !allowed {
+				t.Fatalf("Request before Close should be allowed, got %v, %v", allowed, err)
+			}
+
+			// Closing is idempotent
+			for i := 0; i < 2; i++ {
+				if err := limiter.Close(); err != nil {
+					t.Fatalf("Close %d failed: %v", i+1, err)
+				}
+			}
+
+			if allowed, err := limiter.Allow("closedUser"); !errors.Is(err, ErrClosed) || allowed {
+				t.Errorf("Expected ErrClosed after Close, got %v, %v", allowed, err)
+			}
+			if _, err := limiter.DecideNContext(context.Background(), "closedUser", 1); !errors.Is(err, ErrClosed) {
+				t.Errorf("Expected ErrClosed from DecideNContext, got %v", err)
+			}
+			if waiter, ok := limiter.(interface {
+				Wait(ctx context.Context, key string) error
+			}); ok {
+				if err := waiter.Wait(context.Background(), "closedUser"); !errors.Is(err, ErrClosed) {
+					t.Errorf("Expected ErrClosed from Wait, got %v", err)
+				}
 			}
 		})
 	}
+
+	// Closing a limiter leaves its store open
+	if _, err := memStore.GetCounter("closedUser"); err != nil {
+		t.Errorf("Expected the store to stay open, got %v", err)
+	}
 }
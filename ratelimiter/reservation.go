@@ -0,0 +1,119 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+)
+
+// InfDuration is the maximum delay a reservation can be made with, meaning the caller is
+// willing to wait however long it takes.
+const InfDuration = time.Duration(math.MaxInt64)
+
+// Reserver is implemented by limiters that can take capacity ahead of time.
+type Reserver interface {
+	// ReserveN reserves capacity for a request of cost n associated with the given key, to be
+	// used no later than maxDelay from now. If the capacity cannot be available within maxDelay,
+	// nothing is consumed and the returned reservation is not OK.
+	ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error)
+}
+
+// Reservation holds capacity taken from a limiter for a request that may proceed now or
+// after a delay. A reservation that will not be used should be cancelled so the capacity
+// is returned to the limiter.
+type Reservation struct {
+	clock     clock.Clock  // Clock of the limiter; the real clock if nil
+	ok        bool         // Whether the capacity was reserved
+	timeToAct time.Time    // When the reserved request may proceed, or could have if not OK
+	result    Result       // Quota information at the time of the reservation
+	cancel    func() error // Returns the reserved capacity to the store
+	mu        sync.Mutex   // Guards cancelled
+	cancelled bool         // Whether Cancel has already run
+}
+
+// OK reports whether the capacity was reserved.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long the caller must wait before proceeding with the reserved request.
+// It returns InfDuration if the reservation is not OK.
+func (r *Reservation) Delay() time.Duration {
+	if r.clock == nil {
+		return r.DelayFrom(time.Now())
+	}
+	return r.DelayFrom(r.clock.Now())
+}
+
+// DelayFrom returns how long the caller must wait, from the given time, before proceeding
+// with the reserved request. It returns InfDuration if the reservation is not OK.
+func (r *Reservation) DelayFrom(now time.Time) time.Duration {
+	if !r.ok {
+		return InfDuration
+	}
+	if delay := r.timeToAct.Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// Cancel returns the reserved capacity to the limiter. It is safe to call more than once
+// and does nothing for a reservation that is not OK.
+func (r *Reservation) Cancel() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ok || r.cancelled || r.cancel == nil {
+		return nil
+	}
+	if err := r.cancel(); err != nil {
+		return err
+	}
+	r.cancelled = true
+	return nil
+}
+
+// waitN reserves capacity from r and blocks, on clock c, until the reservation may be used.
+// It fails immediately, without consuming anything, if the context deadline comes before
+// that. Context deadlines are in real time, so the time left until the deadline is taken
+// as the longest delay on c.
+func waitN(ctx context.Context, r Reserver, c clock.Clock, key string, n int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	maxDelay := InfDuration
+	if deadline, ok := ctx.Deadline(); ok {
+		maxDelay = time.Until(deadline)
+	}
+
+	reservation, err := r.ReserveN(ctx, key, n, maxDelay)
+	if err != nil {
+		return err
+	}
+	if !reservation.OK() {
+		return ErrWaitExceedsDeadline
+	}
+
+	delay := reservation.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := c.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		// The request will not be made, so give the capacity back
+		if err := reservation.Cancel(); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,142 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/store"
+)
+
+func TestReservation_DelayAndCancel(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewTokenBucketLimiter(memStore, 2, 10) // 2 tokens, refill 10 tokens per second
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+	key := "reserveUser"
+
+	// Tokens in the bucket are available immediately
+	for i := 0; i < 2; i++ {
+		reservation, err := limiter.Reserve(key)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !reservation.OK() || reservation.Delay() != 0 {
+			t.Errorf("Reservation %d should be usable immediately, got delay %v", i+1, reservation.Delay())
+		}
+	}
+
+	// The next token has to be refilled first
+	reservation, err := limiter.Reserve(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reservation.OK() {
+		t.Fatal("Reservation should be OK when waiting is allowed")
+	}
+	if delay := reservation.Delay(); delay <= 0 || delay > 100*time.Millisecond {
+		t.Errorf("Expected a delay of at most 100ms, got %v", delay)
+	}
+
+	// Cancelling gives the token back, and cancelling twice does not give it back twice
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on Cancel: %v", err)
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on second Cancel: %v", err)
+	}
+	state, err := memStore.GetTokenBucket(mustStoreKey(t, &limiter.options, key))
+	if err != nil {
+		t.Fatalf("GetTokenBucket failed: %v", err)
+	}
+	if state.Tokens < 0 || state.Tokens >= 1 {
+		t.Errorf("Expected the borrowed token to be returned, got %f tokens", state.Tokens)
+	}
+
+	// A reservation that does not fit within maxDelay consumes nothing
+	reservation, err = limiter.ReserveN(context.Background(), key, 2, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reservation.OK() {
+		t.Error("Reservation should not be OK when no delay is allowed")
+	}
+	if reservation.Delay() != InfDuration {
+		t.Errorf("Expected InfDuration delay for a reservation that is not OK, got %v", reservation.Delay())
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Errorf("Cancel on a reservation that is not OK should do nothing, got %v", err)
+	}
+}
+
+func TestWait_DeadlineTooShort(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewTokenBucketLimiter(memStore, 1, 1) // 1 token, refill 1 token per second
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+	key := "waitUser"
+
+	if err := limiter.Wait(context.Background(), key); err != nil {
+		t.Fatalf("First Wait should succeed immediately: %v", err)
+	}
+
+	// The next token is a second away, so a 100ms deadline fails without waiting
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = limiter.Wait(ctx, key)
+	if !errors.Is(err, ErrWaitExceedsDeadline) {
+		t.Errorf("Expected ErrWaitExceedsDeadline, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Wait should fail immediately, took %v", elapsed)
+	}
+
+	// Nothing was consumed by the failed wait
+	state, err := memStore.GetTokenBucket(mustStoreKey(t, &limiter.options, key))
+	if err != nil {
+		t.Fatalf("GetTokenBucket failed: %v", err)
+	}
+	if state.Tokens < 0 {
+		t.Errorf("Failed wait should not borrow tokens, got %f tokens", state.Tokens)
+	}
+}
+
+func TestWait_ContextCancelled(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewTokenBucketLimiter(memStore, 1, 2) // 1 token, refill 2 tokens per second
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+	key := "cancelUser"
+
+	if err := limiter.Wait(context.Background(), key); err != nil {
+		t.Fatalf("First Wait should succeed immediately: %v", err)
+	}
+
+	// Cancel while waiting for the next token
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	err = limiter.Wait(ctx, key)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	// The reservation made by the cancelled wait was returned
+	state, err := memStore.GetTokenBucket(mustStoreKey(t, &limiter.options, key))
+	if err != nil {
+		t.Fatalf("GetTokenBucket failed: %v", err)
+	}
+	if state.Tokens < 0 {
+		t.Errorf("Cancelled wait should return its token, got %f tokens", state.Tokens)
+	}
+}
@@ -0,0 +1,14 @@
+package ratelimiter
+
+import "time"
+
+// Result describes the outcome of a rate-limiting decision together with the
+// quota information callers need to tell clients when to back off.
+type Result struct {
+	Allowed    bool          // Whether the request is allowed to proceed
+	Limit      int64         // Maximum number of requests the policy admits at once
+	Remaining  int64         // Requests that can still be admitted right now
+	ResetAt    time.Time     // Time at which the quota is fully replenished; zero if unknown
+	RetryAfter time.Duration // How long to wait before retrying; zero when allowed
+	RejectedBy string        // Name of the CompositeLimiter child that rejected the request; empty otherwise
+}
@@ -1,10 +1,13 @@
 package ratelimiter
 
 import (
+	"context"
 	"errors"
+	"math"
 	"sync"
 	"time"
 
+	"github.com/neelp03/throttlex/clock"
 	"github.com/neelp03/throttlex/store"
 )
 
@@ -14,13 +17,15 @@ type SlidingWindowLimiter struct {
 	limit           int
 	window          time.Duration
 	mutexes         sync.Map
-	cleanupTicker   *time.Ticker
+	cleanupTicker   clock.Ticker
 	cleanupStopCh   chan struct{}
 	cleanupInterval time.Duration
+	lifecycle       // Tracks whether the limiter is closed
+	options         // Optional settings such as the clock
 }
 
 // NewSlidingWindowLimiter creates a new instance of SlidingWindowLimiter.
-func NewSlidingWindowLimiter(store store.Store, limit int, window time.Duration) (*SlidingWindowLimiter, error) {
+func NewSlidingWindowLimiter(store store.Store, limit int, window time.Duration, opts ...Option) (*SlidingWindowLimiter, error) {
 	if limit <= 0 {
 		return nil, errors.New("limit must be greater than zero")
 	}
@@ -38,6 +43,7 @@ func NewSlidingWindowLimiter(store store.Store, limit int, window time.Duration)
 		mutexes:         sync.Map{},
 		cleanupInterval: time.Minute * 5,
 		cleanupStopCh:   make(chan struct{}),
+		options:         newOptions(defaultNamespace(SlidingWindowPolicy, limit, window), opts),
 	}
 	go limiter.startMutexCleanup()
 	return limiter, nil
@@ -47,50 +53,233 @@ func NewSlidingWindowLimiter(store store.Store, limit int, window time.Duration)
 func (l *SlidingWindowLimiter) getMutex(key string) *keyMutex {
 	mutexInterface, _ := l.mutexes.LoadOrStore(key, &keyMutex{
 		mu:         &sync.Mutex{},
-		lastAccess: time.Now(),
+		lastAccess: l.now(),
 	})
 	return mutexInterface.(*keyMutex)
 }
 
 // Allow checks whether a request associated with the given key is allowed.
 func (l *SlidingWindowLimiter) Allow(key string) (bool, error) {
-	if err := validateKey(key); err != nil {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks whether a request of cost n associated with the given key is allowed.
+func (l *SlidingWindowLimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.DecideN(key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *SlidingWindowLimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.DecideNContext(ctx, key, 1)
+	if err != nil {
 		return false, err
 	}
+	return result.Allowed, nil
+}
+
+// Decide checks whether a request associated with the given key is allowed
+// and reports the quota left in the sliding window.
+func (l *SlidingWindowLimiter) Decide(key string) (*Result, error) {
+	return l.DecideN(key, 1)
+}
+
+// DecideN checks whether a request of cost n associated with the given key is allowed
+// and reports the quota left in the sliding window. An admitted request records n entries
+// in the window; ErrCostExceedsCapacity is returned if n exceeds the limit.
+func (l *SlidingWindowLimiter) DecideN(key string, n int64) (*Result, error) {
+	return l.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *SlidingWindowLimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := l.reserveN(ctx, key, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
 
+// Reserve reserves room in the window for a request associated with the given key, waiting as long as needed.
+func (l *SlidingWindowLimiter) Reserve(key string) (*Reservation, error) {
+	return l.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN reserves room for n entries in the window for a request associated with the given key.
+// If the window is full, the entries are recorded at the time enough of the oldest entries have
+// left the window and the reservation delay is the time until then; if that exceeds maxDelay
+// nothing is recorded and the reservation is not OK.
+func (l *SlidingWindowLimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.reserveN(ctx, key, n, maxDelay)
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *SlidingWindowLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until a request of cost n associated with the given key is allowed, or the
+// context is done. It fails immediately with ErrWaitExceedsDeadline, without recording
+// anything, if the window does not have room before the context deadline.
+func (l *SlidingWindowLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	return waitN(ctx, l, l.getClock(), key, n)
+}
+
+// reserveN records n entries in the window at the earliest time within maxDelay that they fit.
+func (l *SlidingWindowLimiter) reserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := l.checkOpen(); err != nil {
+		return nil, err
+	}
+	key, err := l.storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCost(n, float64(l.limit)); err != nil {
+		return nil, err
+	}
 	km := l.getMutex(key)
 	km.mu.Lock()
 	defer km.mu.Unlock()
-	km.lastAccess = time.Now()
+	km.lastAccess = l.now()
+
+	now := l.now().UnixNano()
+	recorded, err := l.record(ctx, key, n, maxDelay, now)
+	if err != nil {
+		return nil, err
+	}
+	wait := time.Duration(recorded.At - now)
+
+	reservation := &Reservation{
+		clock:     l.getClock(),
+		ok:        recorded.Recorded,
+		timeToAct: time.Unix(0, recorded.At),
+		result:    Result{Limit: int64(l.limit)},
+	}
+	if recorded.Recorded {
+		reservation.cancel = func() error { return l.refund(key, recorded.Timestamps) }
+	}
+
+	if wait == 0 && reservation.ok {
+		reservation.result.Allowed = true
+		reservation.result.Remaining = int64(l.limit) - recorded.Count - n
+		reservation.result.ResetAt = time.Unix(0, now+l.window.Nanoseconds())
+		return reservation, nil
+	}
+
+	if recorded.Count < int64(l.limit) {
+		reservation.result.Remaining = int64(l.limit) - recorded.Count
+	}
+	// The quota is fully replenished once the newest entry leaves the window
+	newest := recorded.Newest
+	if recorded.Count == 0 {
+		newest = now
+	}
+	reservation.result.RetryAfter = wait
+	reservation.result.ResetAt = time.Unix(0, newest+l.window.Nanoseconds()+1)
+	return reservation, nil
+}
+
+// record counts the entries in the window for the given key at time now and records n
+// new entries at the earliest time within maxDelay that they fit. The caller holds the
+// mutex for the key.
+//
+// If the store implements store.SlidingWindowRecorder, this is done atomically by the
+// store, so that limiters sharing it from different processes cannot over-admit.
+// Otherwise the entries are counted and added in separate calls, which the mutex
+// only guards against other callers of this limiter.
+func (l *SlidingWindowLimiter) record(ctx context.Context, key string, n int64, maxDelay time.Duration, now int64) (*store.RecordTimestampsResult, error) {
+	if recorder, ok := l.store.(store.SlidingWindowRecorder); ok {
+		return recorder.RecordTimestamps(ctx, key, store.RecordTimestampsRequest{
+			Limit:    int64(l.limit),
+			Window:   l.window,
+			Count:    n,
+			MaxDelay: maxDelay,
+			Now:      now,
+		})
+	}
 
-	now := time.Now().UnixNano()
 	windowStart := now - l.window.Nanoseconds()
 
-	count, err := l.store.CountTimestamps(key, windowStart, now)
+	// Entries reserved for the future still hold their place in the window
+	count, err := l.store.CountTimestampsContext(ctx, key, windowStart, math.MaxInt64)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	result := &store.RecordTimestampsResult{Count: count, At: now}
 
-	allowed := count < int64(l.limit)
-	if !allowed {
-		return false, nil
+	if count > 0 {
+		result.Newest, _, err = l.store.TimestampAtContext(ctx, key, windowStart, count-1)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if count+n > int64(l.limit) {
+		// The request fits once enough of the oldest timestamps leave the window
+		result.At, err = l.expiryOf(ctx, key, windowStart, count+n-int64(l.limit)-1, now)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	err = l.store.AddTimestamp(key, now, l.window)
-	if err != nil {
-		return false, err
+	wait := time.Duration(result.At - now)
+	if wait <= maxDelay {
+		// Each unit of cost is a distinct entry so that it is counted separately
+		for i := int64(0); i < n; i++ {
+			err = l.store.AddTimestampContext(ctx, key, result.At-i, l.window+wait)
+			if err != nil {
+				return nil, err
+			}
+			result.Timestamps = append(result.Timestamps, result.At-i)
+		}
+		result.Recorded = true
+	}
+	return result, nil
+}
+
+// refund removes the entries recorded by a cancelled reservation.
+func (l *SlidingWindowLimiter) refund(key string, timestamps []int64) error {
+	km := l.getMutex(key)
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.lastAccess = l.now()
+
+	for _, ts := range timestamps {
+		if err := l.store.RemoveTimestamp(key, ts); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return true, nil
+// expiryOf returns the time, in Unix nanoseconds, at which the timestamp with the given
+// rank in the window leaves it. If the timestamp is not found, a full window from now is assumed.
+func (l *SlidingWindowLimiter) expiryOf(ctx context.Context, key string, windowStart, rank, now int64) (int64, error) {
+	timestamp, ok, err := l.store.TimestampAtContext(ctx, key, windowStart, rank)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		timestamp = now
+	}
+	// Timestamps exactly a window old are still counted
+	return timestamp + l.window.Nanoseconds() + 1, nil
 }
 
 // startMutexCleanup runs a background goroutine to clean up unused mutexes.
 func (l *SlidingWindowLimiter) startMutexCleanup() {
-	l.cleanupTicker = time.NewTicker(l.cleanupInterval)
+	l.cleanupTicker = l.getClock().NewTicker(l.cleanupInterval)
 	for {
 		select {
-		case <-l.cleanupTicker.C:
-			now := time.Now()
+		case <-l.cleanupTicker.C():
+			now := l.now()
 			l.mutexes.Range(func(key, value interface{}) bool {
 				km := value.(*keyMutex)
 				km.mu.Lock()
@@ -109,7 +298,47 @@ func (l *SlidingWindowLimiter) startMutexCleanup() {
 	}
 }
 
-// StopCleanup stops the mutex cleanup goroutine.
+// Close stops the mutex cleanup goroutine and makes later calls fail with ErrClosed. It
+// does not close the store, which may be shared. Closing a closed limiter does nothing.
+func (l *SlidingWindowLimiter) Close() error {
+	l.shutdown(func() { close(l.cleanupStopCh) })
+	return nil
+}
+
+// StopCleanup stops the mutex cleanup goroutine, leaving the limiter usable. Calling it
+// again, or after Close, does nothing.
 func (l *SlidingWindowLimiter) StopCleanup() {
-	close(l.cleanupStopCh)
+	l.stopBackground(func() { close(l.cleanupStopCh) })
+}
+
+// TrackedKeys returns the number of keys the limiter holds a mutex for. Mutexes of keys
+// left idle for twice the cleanup interval are dropped by the cleanup goroutine.
+func (l *SlidingWindowLimiter) TrackedKeys() int {
+	return countKeys(&l.mutexes)
+}
+
+// Inspect returns the count of key in the window ending now.
+func (l *SlidingWindowLimiter) Inspect(ctx context.Context, key string) (*KeyState, error) {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return nil, err
+	}
+	state, err := inspectKey(ctx, inspector, SlidingWindowPolicy, key)
+	if err != nil || !state.Exists {
+		return state, err
+	}
+	windowStart := l.now().UnixNano() - l.window.Nanoseconds()
+	if state.Count, err = l.store.CountTimestampsContext(ctx, key, windowStart, math.MaxInt64); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Reset deletes the requests of key in the window.
+func (l *SlidingWindowLimiter) Reset(ctx context.Context, key string) error {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return err
+	}
+	return inspector.Delete(ctx, key)
 }
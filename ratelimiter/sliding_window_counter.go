@@ -0,0 +1,360 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/neelp03/throttlex/store"
+)
+
+// SlidingWindowCounterLimiter implements the sliding window counter rate-limiting algorithm.
+// Like FixedWindowLimiter it keeps one counter per fixed window, but it admits a request
+// only if the number of requests in the sliding window ending now, estimated as
+//
+//	previous * (window - elapsed) / window + current
+//
+// stays within the limit, where previous and current are the counts of the previous and
+// current fixed windows and elapsed is the time since the current one started. It needs
+// two counters per key however large the limit, unlike SlidingWindowLimiter, which keeps
+// every admitted request.
+//
+// The estimate assumes the requests of the previous window were spread evenly over it.
+// Compared with the exact sliding log, the true number of requests in the sliding window
+// ending now is at most previous * (window - elapsed) / window below the estimate, if none
+// of the previous window's requests fall in the sliding window, and at most
+// previous * elapsed / window above it, if all of them do. Since previous never exceeds
+// the limit, up to twice the limit can be admitted in a sliding window straddling two
+// fixed windows in the worst case, when the previous window's requests all arrived at its
+// end. Requests spread evenly over time are limited exactly.
+type SlidingWindowCounterLimiter struct {
+	store     store.Store   // Storage backend to keep track of request counts
+	limit     int           // Maximum number of requests allowed in the sliding window
+	window    time.Duration // Duration of the sliding window and of each fixed window
+	lifecycle               // Tracks whether the limiter is closed
+	options                 // Optional settings such as the clock
+}
+
+// NewSlidingWindowCounterLimiter creates a new instance of SlidingWindowCounterLimiter.
+func NewSlidingWindowCounterLimiter(store store.Store, limit int, window time.Duration, opts ...Option) (*SlidingWindowCounterLimiter, error) {
+	if limit <= 0 {
+		return nil, errors.New("limit must be greater than zero")
+	}
+	if window <= 0 {
+		return nil, errors.New("window duration must be greater than zero")
+	}
+	if store == nil {
+		return nil, errors.New("store cannot be nil")
+	}
+
+	return &SlidingWindowCounterLimiter{
+		store:   store,
+		limit:   limit,
+		window:  window,
+		options: newOptions(defaultNamespace(SlidingWindowCounterPolicy, limit, window), opts),
+	}, nil
+}
+
+// Allow checks whether a request associated with the given key is allowed under the rate limit.
+func (l *SlidingWindowCounterLimiter) Allow(key string) (bool, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks whether a request of cost n associated with the given key is allowed under the rate limit.
+func (l *SlidingWindowCounterLimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.DecideN(key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *SlidingWindowCounterLimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.DecideNContext(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Decide checks whether a request associated with the given key is allowed under the rate limit
+// and reports the quota left in the sliding window, as estimated from the counters.
+func (l *SlidingWindowCounterLimiter) Decide(key string) (*Result, error) {
+	return l.DecideN(key, 1)
+}
+
+// DecideN is like Decide for a request of cost n.
+// ErrCostExceedsCapacity is returned if n exceeds the limit.
+func (l *SlidingWindowCounterLimiter) DecideN(key string, n int64) (*Result, error) {
+	return l.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *SlidingWindowCounterLimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := l.reserveN(ctx, key, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
+
+// Reserve reserves room in the window for a request associated with the given key, waiting as long as needed.
+func (l *SlidingWindowCounterLimiter) Reserve(key string) (*Reservation, error) {
+	return l.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN reserves room for a request of cost n associated with the given key. The request
+// is counted straight away in the fixed window it proceeds in, so it holds its place until
+// it proceeds and is counted in full once it does, and the reservation delay is the time
+// until the estimate leaves room for it; if that exceeds maxDelay nothing is counted and
+// the reservation is not OK.
+func (l *SlidingWindowCounterLimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.reserveN(ctx, key, n, maxDelay)
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *SlidingWindowCounterLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until a request of cost n associated with the given key is allowed, or the
+// context is done. It fails immediately with ErrWaitExceedsDeadline, without counting
+// anything, if the window does not have room before the context deadline.
+func (l *SlidingWindowCounterLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	return waitN(ctx, l, l.getClock(), key, n)
+}
+
+// reserveN counts n requests in the current window and keeps them if the estimate leaves
+// room for them within maxDelay.
+func (l *SlidingWindowCounterLimiter) reserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := l.checkOpen(); err != nil {
+		return nil, err
+	}
+	// Input validation
+	key, err := l.storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCost(n, float64(l.limit)); err != nil {
+		return nil, err
+	}
+
+	now := l.now()
+	currentWindow := l.getWindowNumber(now)
+
+	// Count the request first so that concurrent requests see each other, and keep the
+	// counter until the end of the next window, where it is the previous one
+	windowKey := l.getWindowKey(key, currentWindow)
+	expiration := l.getWindowStart(currentWindow + 2).Sub(now)
+	current, err := l.store.IncrementContext(ctx, windowKey, n, expiration)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := l.store.GetCounterContext(ctx, l.getWindowKey(key, currentWindow-1))
+	if err != nil {
+		// Give back the cost on a best-effort basis, even if the context is cancelled
+		_, _ = l.store.IncrementContext(context.WithoutCancel(ctx), windowKey, -n, expiration)
+		return nil, err
+	}
+
+	reservation := &Reservation{
+		clock:     l.getClock(),
+		timeToAct: now,
+		result:    Result{Limit: int64(l.limit)},
+	}
+	weight := l.previousWeight(now, currentWindow)
+	if estimate := float64(previous)*weight + float64(current); estimate <= float64(l.limit) {
+		reservation.ok = true
+		reservation.cancel = l.canceller(windowKey, n, expiration)
+		reservation.result.Allowed = true
+		reservation.result.Remaining = int64(float64(l.limit) - estimate)
+		reservation.result.ResetAt = l.getWindowStart(currentWindow + 2)
+		return reservation, nil
+	}
+
+	current -= n
+	at, fits := l.fitIn(previous, current, n, currentWindow)
+	if fits && !at.After(now) {
+		// The estimate is just over the limit at the current time
+		at = now.Add(1)
+	}
+	window, counted := currentWindow, fits && at.Sub(now) <= maxDelay
+	if !counted {
+		// Give back the cost so it does not eat into the remaining quota, even if the
+		// context is cancelled in the meantime
+		if _, err := l.store.IncrementContext(context.WithoutCancel(ctx), windowKey, -n, expiration); err != nil {
+			return nil, err
+		}
+	}
+	if !fits {
+		// A request proceeding in a later window must be counted in that window, where
+		// the current one only weighs in part
+		at, window, counted, err = l.reserveLater(ctx, key, current, n, now, currentWindow, maxDelay)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	wait := at.Sub(now)
+	reservation.timeToAct = at
+	if counted {
+		reservation.ok = true
+		reservation.cancel = l.canceller(l.getWindowKey(key, window), n, l.getWindowStart(window+2).Sub(now))
+	}
+
+	if remaining := float64(l.limit) - float64(previous)*weight - float64(current); remaining > 0 {
+		reservation.result.Remaining = int64(remaining)
+	}
+	reservation.result.RetryAfter = wait
+	reservation.result.ResetAt = l.getWindowStart(currentWindow + 2)
+	if counted && window > currentWindow {
+		reservation.result.ResetAt = l.getWindowStart(window + 2)
+	} else if current == 0 {
+		// Only the previous window is left, which stops counting when the current one ends
+		reservation.result.ResetAt = l.getWindowStart(currentWindow + 1)
+	}
+	return reservation, nil
+}
+
+// reserveLater finds the earliest window after the current one in which the estimate leaves
+// room for a request of cost n, given the count of the current window, and counts the
+// request in it if that is within maxDelay. It returns when the request fits, in which
+// window, and whether it was counted. Each window is counted in before its estimate is
+// checked, so that concurrent reservations see each other. Windows starting after maxDelay
+// are assumed to be empty, since nothing can be reserved in them.
+func (l *SlidingWindowCounterLimiter) reserveLater(ctx context.Context, key string, previous, n int64, now time.Time, currentWindow int64, maxDelay time.Duration) (time.Time, int64, bool, error) {
+	for window := currentWindow + 1; ; window++ {
+		if l.getWindowStart(window).Sub(now) > maxDelay {
+			if at, fits := l.fitIn(previous, 0, n, window); fits {
+				return at, window, false, nil
+			}
+			// Only a request of the full limit does not fit, until the window is over
+			return l.getWindowStart(window + 1), window + 1, false, nil
+		}
+
+		windowKey := l.getWindowKey(key, window)
+		expiration := l.getWindowStart(window + 2).Sub(now)
+		count, err := l.store.IncrementContext(ctx, windowKey, n, expiration)
+		if err != nil {
+			return time.Time{}, 0, false, err
+		}
+		at, fits := l.fitIn(previous, count-n, n, window)
+		if fits && at.Sub(now) <= maxDelay {
+			return at, window, true, nil
+		}
+		if _, err := l.store.IncrementContext(context.WithoutCancel(ctx), windowKey, -n, expiration); err != nil {
+			return time.Time{}, 0, false, err
+		}
+		if fits {
+			return at, window, false, nil
+		}
+		previous = count - n
+	}
+}
+
+// canceller returns a function that removes a reserved request of cost n from its window.
+func (l *SlidingWindowCounterLimiter) canceller(windowKey string, n int64, expiration time.Duration) func() error {
+	return func() error {
+		_, err := l.store.Increment(windowKey, -n, expiration)
+		return err
+	}
+}
+
+// fitIn returns the earliest time in the given window at which the estimate leaves room for
+// a request of cost n, given the counts of the window and of the one before it, and whether
+// there is such a time.
+func (l *SlidingWindowCounterLimiter) fitIn(previous, current, n int64, window int64) (time.Time, bool) {
+	room := float64(l.limit) - float64(current) - float64(n)
+	if room < 0 {
+		return time.Time{}, false
+	}
+	// The request fits once the previous window weighs little enough
+	at := l.getWindowStart(window)
+	if room < float64(previous) {
+		at = at.Add(l.fractionOfWindow(1 - room/float64(previous)))
+	}
+	return at, at.Before(l.getWindowStart(window + 1))
+}
+
+// previousWeight returns the share of the previous window that overlaps the sliding window
+// ending now.
+func (l *SlidingWindowCounterLimiter) previousWeight(now time.Time, currentWindow int64) float64 {
+	elapsed := now.Sub(l.getWindowStart(currentWindow))
+	return 1 - float64(elapsed)/float64(l.window)
+}
+
+// fractionOfWindow returns the given fraction of the window, rounded up to the next nanosecond.
+func (l *SlidingWindowCounterLimiter) fractionOfWindow(fraction float64) time.Duration {
+	return time.Duration(math.Ceil(fraction * float64(l.window)))
+}
+
+// getWindowStart returns the start time of the given window.
+func (l *SlidingWindowCounterLimiter) getWindowStart(windowNumber int64) time.Time {
+	return time.Unix(0, windowNumber*l.window.Nanoseconds())
+}
+
+// getWindowNumber returns the number of the fixed window containing the given time.
+func (l *SlidingWindowCounterLimiter) getWindowNumber(now time.Time) int64 {
+	return now.UnixNano() / l.window.Nanoseconds()
+}
+
+// getWindowKey generates a unique key for the given time window and client key.
+func (l *SlidingWindowCounterLimiter) getWindowKey(key string, windowNumber int64) string {
+	return key + ":" + strconv.FormatInt(windowNumber, 10)
+}
+
+// Close makes later calls fail with ErrClosed. It does not close the store, which may be
+// shared. Closing a closed limiter does nothing.
+func (l *SlidingWindowCounterLimiter) Close() error {
+	l.shutdown(nil)
+	return nil
+}
+
+// Inspect returns the estimated count of key in the sliding window ending now, rounded up.
+// The store key and expiration are those of the counter of the current window.
+func (l *SlidingWindowCounterLimiter) Inspect(ctx context.Context, key string) (*KeyState, error) {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return nil, err
+	}
+	now := l.now()
+	currentWindow := l.getWindowNumber(now)
+	state, err := inspectKey(ctx, inspector, SlidingWindowCounterPolicy, l.getWindowKey(key, currentWindow))
+	if err != nil {
+		return nil, err
+	}
+	current, err := l.store.GetCounterContext(ctx, state.StoreKey)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := l.store.GetCounterContext(ctx, l.getWindowKey(key, currentWindow-1))
+	if err != nil {
+		return nil, err
+	}
+	state.Exists = state.Exists || previous > 0
+	state.Count = int64(math.Ceil(float64(previous)*l.previousWeight(now, currentWindow) + float64(current)))
+	return state, nil
+}
+
+// Reset deletes the counters of key in the current and previous windows, and in the next
+// window, which holds the requests reserved for it.
+func (l *SlidingWindowCounterLimiter) Reset(ctx context.Context, key string) error {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return err
+	}
+	currentWindow := l.getWindowNumber(l.now())
+	return inspector.Delete(ctx,
+		l.getWindowKey(key, currentWindow-1),
+		l.getWindowKey(key, currentWindow),
+		l.getWindowKey(key, currentWindow+1),
+	)
+}
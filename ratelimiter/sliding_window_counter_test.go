@@ -0,0 +1,206 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/store"
+)
+
+// TestSlidingWindowCounterLimiter verifies that the limit applies within a window and that
+// the retry-after accounts for the current window becoming the previous one.
+func TestSlidingWindowCounterLimiter(t *testing.T) {
+	limiter, err := NewSlidingWindowCounterLimiter(store.NewMemoryStore(), 5, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	key := "counterUser"
+
+	for i := 0; i < 5; i++ {
+		result, err := limiter.Decide(key)
+		if err != nil {
+			t.Fatalf("Unexpected error on request %d: %v", i+1, err)
+		}
+		if !result.Allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+
+	now := time.Now()
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Request exceeding the limit should not be allowed")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("Expected no remaining quota, got %d", result.Remaining)
+	}
+
+	// With 5 requests in the previous window, one more fits once a fifth of the next
+	// window has passed
+	currentWindow := limiter.getWindowNumber(now)
+	expected := limiter.getWindowStart(currentWindow + 1).Add(time.Hour / 5).Sub(now)
+	if diff := result.RetryAfter - expected; diff < -time.Second || diff > time.Second {
+		t.Errorf("Expected retry-after of about %v, got %v", expected, result.RetryAfter)
+	}
+
+	// The rejected request was not counted
+	count, err := limiter.store.GetCounter(limiter.getWindowKey(mustStoreKey(t, &limiter.options, key), currentWindow))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 5 {
+		t.Errorf("Expected counter of 5, got %d", count)
+	}
+}
+
+// TestSlidingWindowCounterLimiterInterpolation verifies that the previous window's count is
+// weighted by its overlap with the sliding window.
+func TestSlidingWindowCounterLimiterInterpolation(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limit := 100
+	limiter, err := NewSlidingWindowCounterLimiter(memStore, limit, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	key := "interpolatedUser"
+
+	// A full previous window
+	now := time.Now()
+	currentWindow := limiter.getWindowNumber(now)
+	if _, err := memStore.Increment(limiter.getWindowKey(mustStoreKey(t, &limiter.options, key), currentWindow-1), int64(limit), 2*time.Hour); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	allowed := 0
+	for i := 0; i < limit; i++ {
+		ok, err := limiter.Allow(key)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if ok {
+			allowed++
+		}
+	}
+
+	// Only the share of the window that has elapsed is available again
+	elapsed := float64(now.Sub(limiter.getWindowStart(currentWindow))) / float64(time.Hour)
+	expected := int(float64(limit) * elapsed)
+	if allowed < expected-1 || allowed > expected+1 {
+		t.Errorf("Expected about %d requests allowed, got %d", expected, allowed)
+	}
+}
+
+// TestSlidingWindowCounterLimiterReserve verifies that a reservation holds its place in the
+// window it proceeds in until it is cancelled.
+func TestSlidingWindowCounterLimiterReserve(t *testing.T) {
+	limiter, err := NewSlidingWindowCounterLimiter(store.NewMemoryStore(), 2, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	key := "counterReserveUser"
+
+	if allowed, err := limiter.AllowN(key, 2); err != nil || !allowed {
+		t.Fatalf("Request of cost 2 should be allowed, got %v, %v", allowed, err)
+	}
+
+	reservation, err := limiter.ReserveN(context.Background(), key, 1, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reservation.OK() {
+		t.Error("Reservation should not be OK within a second")
+	}
+
+	reservation, err = limiter.Reserve(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reservation.OK() || reservation.Delay() <= 0 {
+		t.Fatalf("Expected a delayed reservation, got OK=%v delay=%v", reservation.OK(), reservation.Delay())
+	}
+	// The current window is full, so the request proceeds and is counted in the next one
+	currentWindow := limiter.getWindowNumber(time.Now())
+	storeKey := mustStoreKey(t, &limiter.options, key)
+	if count, _ := limiter.store.GetCounter(limiter.getWindowKey(storeKey, currentWindow)); count != 2 {
+		t.Errorf("Expected the current window to be unchanged, got %d", count)
+	}
+	count, err := limiter.store.GetCounter(limiter.getWindowKey(storeKey, currentWindow+1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected the reservation to be counted in the next window, got %d", count)
+	}
+
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on cancel: %v", err)
+	}
+	count, err = limiter.store.GetCounter(limiter.getWindowKey(storeKey, currentWindow+1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected the cancelled reservation to be removed, got %d", count)
+	}
+
+	_, err = limiter.AllowN(key, 3)
+	if !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+}
+
+// TestSlidingWindowCounterLimiterReserveLaterWindow verifies that requests reserved for a
+// later window are counted in full when they proceed, so they cannot push the estimate
+// over the limit.
+func TestSlidingWindowCounterLimiterReserveLaterWindow(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0).Truncate(time.Minute))
+	limiter, err := NewSlidingWindowCounterLimiter(store.NewMemoryStore(store.WithClock(fake)), 4, time.Minute, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	key := "counterLaterUser"
+
+	// Fill the window late, so that it weighs little once the next one starts
+	fake.Advance(50 * time.Second)
+	if allowed, err := limiter.AllowN(key, 4); err != nil || !allowed {
+		t.Fatalf("Request of cost 4 should be allowed, got %v, %v", allowed, err)
+	}
+	reservation, err := limiter.ReserveN(context.Background(), key, 2, InfDuration)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reservation.OK() {
+		t.Fatal("Expected a delayed reservation")
+	}
+
+	// Half of the previous window weighs 2, which with the reservation fills the limit
+	delay := reservation.Delay()
+	if expected := 40 * time.Second; delay != expected {
+		t.Errorf("Expected a delay of %v, got %v", expected, delay)
+	}
+	fake.Advance(delay)
+	if allowed, err := limiter.Allow(key); err != nil || allowed {
+		t.Errorf("Expected the reserved request to fill the window, got %v, %v", allowed, err)
+	}
+}
+
+// TestNewSlidingWindowCounterLimiterInvalidParameters verifies parameter validation.
+func TestNewSlidingWindowCounterLimiterInvalidParameters(t *testing.T) {
+	memStore := store.NewMemoryStore()
+
+	if _, err := NewSlidingWindowCounterLimiter(memStore, 0, time.Second); err == nil {
+		t.Error("Expected error for zero limit")
+	}
+	if _, err := NewSlidingWindowCounterLimiter(memStore, 1, 0); err == nil {
+		t.Error("Expected error for zero window")
+	}
+	if _, err := NewSlidingWindowCounterLimiter(nil, 1, time.Second); err == nil {
+		t.Error("Expected error for nil store")
+	}
+}
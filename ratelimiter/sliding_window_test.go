@@ -1,7 +1,9 @@
 package ratelimiter
 
 import (
+	"context"
 	"errors"
+	"math"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -70,6 +72,12 @@ func (m *MockStore) AddTimestamp(key string, timestamp int64, expiration time.Du
 func (m *MockStore) CountTimestamps(key string, start int64, end int64) (int64, error) {
 	return 0, errors.New("mock error")
 }
+func (m *MockStore) TimestampAt(key string, start int64, rank int64) (int64, bool, error) {
+	return 0, false, errors.New("mock error")
+}
+func (m *MockStore) RemoveTimestamp(key string, timestamp int64) error {
+	return errors.New("mock error")
+}
 func (m *MockStore) GetTokenBucket(key string) (*store.TokenBucketState, error) {
 	return nil, errors.New("mock error")
 }
@@ -83,6 +91,41 @@ func (m *MockStore) SetLeakyBucket(key string, state *store.LeakyBucketState, ex
 	return errors.New("mock error")
 }
 
+// Context variants delegate to the methods above.
+func (m *MockStore) IncrementContext(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	return m.Increment(key, delta, expiration)
+}
+func (m *MockStore) GetCounterContext(ctx context.Context, key string) (int64, error) {
+	return m.GetCounter(key)
+}
+func (m *MockStore) AddTimestampContext(ctx context.Context, key string, timestamp int64, expiration time.Duration) error {
+	return m.AddTimestamp(key, timestamp, expiration)
+}
+func (m *MockStore) CountTimestampsContext(ctx context.Context, key string, start int64, end int64) (int64, error) {
+	return m.CountTimestamps(key, start, end)
+}
+func (m *MockStore) TimestampAtContext(ctx context.Context, key string, start int64, rank int64) (int64, bool, error) {
+	return m.TimestampAt(key, start, rank)
+}
+func (m *MockStore) RemoveTimestampContext(ctx context.Context, key string, timestamp int64) error {
+	return m.RemoveTimestamp(key, timestamp)
+}
+func (m *MockStore) GetTokenBucketContext(ctx context.Context, key string) (*store.TokenBucketState, error) {
+	return m.GetTokenBucket(key)
+}
+func (m *MockStore) SetTokenBucketContext(ctx context.Context, key string, state *store.TokenBucketState, expiration time.Duration) error {
+	return m.SetTokenBucket(key, state, expiration)
+}
+func (m *MockStore) GetLeakyBucketContext(ctx context.Context, key string) (*store.LeakyBucketState, error) {
+	return m.GetLeakyBucket(key)
+}
+func (m *MockStore) SetLeakyBucketContext(ctx context.Context, key string, state *store.LeakyBucketState, expiration time.Duration) error {
+	return m.SetLeakyBucket(key, state, expiration)
+}
+func (m *MockStore) Close() error {
+	return nil
+}
+
 // MockStorePartial simulates a store that returns an error on CountTimestamps.
 type MockStorePartial struct{}
 
@@ -100,6 +143,12 @@ func (m *MockStorePartial) Increment(key string, delta int64, expiration time.Du
 func (m *MockStorePartial) GetCounter(key string) (int64, error) {
 	return 0, nil
 }
+func (m *MockStorePartial) TimestampAt(key string, start int64, rank int64) (int64, bool, error) {
+	return 0, false, nil
+}
+func (m *MockStorePartial) RemoveTimestamp(key string, timestamp int64) error {
+	return nil
+}
 func (m *MockStorePartial) GetTokenBucket(key string) (*store.TokenBucketState, error) {
 	return nil, nil
 }
@@ -113,6 +162,41 @@ func (m *MockStorePartial) SetLeakyBucket(key string, state *store.LeakyBucketSt
 	return nil
 }
 
+// Context variants delegate to the methods above.
+func (m *MockStorePartial) IncrementContext(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	return m.Increment(key, delta, expiration)
+}
+func (m *MockStorePartial) GetCounterContext(ctx context.Context, key string) (int64, error) {
+	return m.GetCounter(key)
+}
+func (m *MockStorePartial) AddTimestampContext(ctx context.Context, key string, timestamp int64, expiration time.Duration) error {
+	return m.AddTimestamp(key, timestamp, expiration)
+}
+func (m *MockStorePartial) CountTimestampsContext(ctx context.Context, key string, start int64, end int64) (int64, error) {
+	return m.CountTimestamps(key, start, end)
+}
+func (m *MockStorePartial) TimestampAtContext(ctx context.Context, key string, start int64, rank int64) (int64, bool, error) {
+	return m.TimestampAt(key, start, rank)
+}
+func (m *MockStorePartial) RemoveTimestampContext(ctx context.Context, key string, timestamp int64) error {
+	return m.RemoveTimestamp(key, timestamp)
+}
+func (m *MockStorePartial) GetTokenBucketContext(ctx context.Context, key string) (*store.TokenBucketState, error) {
+	return m.GetTokenBucket(key)
+}
+func (m *MockStorePartial) SetTokenBucketContext(ctx context.Context, key string, state *store.TokenBucketState, expiration time.Duration) error {
+	return m.SetTokenBucket(key, state, expiration)
+}
+func (m *MockStorePartial) GetLeakyBucketContext(ctx context.Context, key string) (*store.LeakyBucketState, error) {
+	return m.GetLeakyBucket(key)
+}
+func (m *MockStorePartial) SetLeakyBucketContext(ctx context.Context, key string, state *store.LeakyBucketState, expiration time.Duration) error {
+	return m.SetLeakyBucket(key, state, expiration)
+}
+func (m *MockStorePartial) Close() error {
+	return nil
+}
+
 // TestSlidingWindowLimiterStoreErrors tests the limiter's behavior when the store returns errors.
 func TestSlidingWindowLimiterStoreErrors(t *testing.T) {
 	mockStore := &MockStore{}
@@ -248,6 +332,30 @@ func TestSlidingWindowLimiterStopCleanup(t *testing.T) {
 	}
 }
 
+// TestSlidingWindowLimiterStopCleanupTwice tests that stopping the cleanup more than once,
+// then closing the limiter, does not panic and that the limiter stays usable until closed.
+func TestSlidingWindowLimiterStopCleanupTwice(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewSlidingWindowLimiter(memStore, 5, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create SlidingWindowLimiter: %v", err)
+	}
+
+	limiter.StopCleanup()
+	limiter.StopCleanup()
+	if allowed, err := limiter.Allow("testKey"); err != nil || !allowed {
+		t.Errorf("Request after StopCleanup should be allowed, got %v, %v", allowed, err)
+	}
+
+	if err := limiter.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	limiter.StopCleanup()
+	if _, err := limiter.Allow("testKey"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+}
+
 // TestSlidingWindowLimiterConcurrency tests the limiter under concurrent requests.
 func TestSlidingWindowLimiterConcurrency(t *testing.T) {
 	memStore := store.NewMemoryStore()
@@ -444,3 +552,214 @@ func TestSlidingWindowLimiterVariableRequests(t *testing.T) {
 		t.Error("Request after window reset should be allowed")
 	}
 }
+
+// TestSlidingWindowLimiterDecide verifies the quota reported by Decide.
+func TestSlidingWindowLimiterDecide(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	window := time.Millisecond * 500
+	limiter, err := NewSlidingWindowLimiter(memStore, 2, window)
+	if err != nil {
+		t.Fatalf("Failed to create SlidingWindowLimiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+
+	key := "decideUser"
+
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error on 1st request: %v", err)
+	}
+	if !result.Allowed || result.Remaining != 1 || result.Limit != 2 {
+		t.Errorf("Unexpected result for 1st request: %+v", result)
+	}
+
+	time.Sleep(time.Millisecond * 200)
+
+	result, err = limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error on 2nd request: %v", err)
+	}
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Unexpected result for 2nd request: %+v", result)
+	}
+
+	result, err = limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error on 3rd request: %v", err)
+	}
+	if result.Allowed {
+		t.Error("3rd request should be blocked, limit reached")
+	}
+
+	// The first request leaves the window about 300ms from now, the second about 500ms from now
+	if result.RetryAfter <= time.Millisecond*200 || result.RetryAfter > time.Millisecond*300 {
+		t.Errorf("Expected retry-after of about 300ms, got %v", result.RetryAfter)
+	}
+	untilReset := time.Until(result.ResetAt)
+	if untilReset <= time.Millisecond*400 || untilReset > window {
+		t.Errorf("Expected reset in about 500ms, got %v", untilReset)
+	}
+
+	time.Sleep(result.RetryAfter)
+
+	allowed, err := limiter.Allow(key)
+	if err != nil {
+		t.Fatalf("Unexpected error after retry-after: %v", err)
+	}
+	if !allowed {
+		t.Error("Request after retry-after should be allowed")
+	}
+}
+
+// TestSlidingWindowLimiterAllowN verifies that weighted requests record one entry per unit of cost.
+func TestSlidingWindowLimiterAllowN(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewSlidingWindowLimiter(memStore, 5, time.Second*1)
+	if err != nil {
+		t.Fatalf("Failed to create SlidingWindowLimiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+
+	key := "weightedUser"
+
+	allowed, err := limiter.AllowN(key, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request of cost 3 should be allowed")
+	}
+
+	now := time.Now().UnixNano()
+	count, err := memStore.CountTimestamps(mustStoreKey(t, &limiter.options, key), now-time.Second.Nanoseconds(), now)
+	if err != nil {
+		t.Fatalf("CountTimestamps failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 entries in the window, got %d", count)
+	}
+
+	result, err := limiter.DecideN(key, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed || result.Remaining != 2 {
+		t.Errorf("Request of cost 3 should be denied with 2 remaining, got %+v", result)
+	}
+
+	allowed, err = limiter.AllowN(key, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request of cost 2 should be allowed")
+	}
+
+	_, err = limiter.AllowN(key, 6)
+	if !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+}
+
+// TestSlidingWindowLimiterWait verifies that Wait blocks until the oldest entry leaves the window.
+func TestSlidingWindowLimiterWait(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	window := time.Millisecond * 200
+	limiter, err := NewSlidingWindowLimiter(memStore, 1, window)
+	if err != nil {
+		t.Fatalf("Failed to create SlidingWindowLimiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+
+	key := "waitUser"
+
+	if err := limiter.Wait(context.Background(), key); err != nil {
+		t.Fatalf("First Wait should succeed immediately: %v", err)
+	}
+
+	// A deadline shorter than the window fails straight away
+	ctx, cancel := context.WithTimeout(context.Background(), window/4)
+	defer cancel()
+	if err := limiter.Wait(ctx, key); !errors.Is(err, ErrWaitExceedsDeadline) {
+		t.Errorf("Expected ErrWaitExceedsDeadline, got %v", err)
+	}
+
+	start := time.Now()
+	if err := limiter.Wait(context.Background(), key); err != nil {
+		t.Fatalf("Second Wait should succeed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < window/2 {
+		t.Errorf("Second Wait should block until the first entry leaves the window, took %v", elapsed)
+	}
+
+	// A reserved entry holds its place until it is cancelled
+	reservation, err := limiter.Reserve(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reservation.OK() || reservation.Delay() == 0 {
+		t.Fatalf("Expected a delayed reservation, got delay %v", reservation.Delay())
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on Cancel: %v", err)
+	}
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Window should still be full from the second Wait")
+	}
+	if result.RetryAfter > window {
+		t.Errorf("Cancelled reservation should not delay retries, got %v", result.RetryAfter)
+	}
+}
+
+// TestSlidingWindowLimiterWithoutRecorder verifies the fallback for stores that cannot
+// record entries atomically.
+func TestSlidingWindowLimiterWithoutRecorder(t *testing.T) {
+	limiter, err := NewSlidingWindowLimiter(plainStore{store.NewMemoryStore()}, 3, time.Second)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+	key := "plain_key"
+
+	for i := 0; i < 3; i++ {
+		allowed, err := limiter.Allow(key)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Request exceeding the limit should not be allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("Expected retry-after of at most 1s, got %v", result.RetryAfter)
+	}
+
+	reservation, err := limiter.ReserveN(context.Background(), key, 1, 2*time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reservation.OK() {
+		t.Fatal("Reservation within two seconds should be OK")
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on cancel: %v", err)
+	}
+	count, err := limiter.store.CountTimestamps(mustStoreKey(t, &limiter.options, key), 0, math.MaxInt64)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 entries after cancel, got %d", count)
+	}
+}
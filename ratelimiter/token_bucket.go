@@ -1,10 +1,12 @@
 package ratelimiter
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
+	"github.com/neelp03/throttlex/clock"
 	"github.com/neelp03/throttlex/store"
 )
 
@@ -15,9 +17,11 @@ type TokenBucketLimiter struct {
 	capacity        float64       // Maximum number of tokens in the bucket (burst capacity)
 	refillRate      float64       // Tokens added to the bucket per second
 	mutexes         sync.Map      // Map of mutexes for per-key synchronization
-	cleanupTicker   *time.Ticker  // Ticker for periodic mutex cleanup
+	cleanupTicker   clock.Ticker  // Ticker for periodic mutex cleanup
 	cleanupStopCh   chan struct{} // Channel to stop the cleanup goroutine
 	cleanupInterval time.Duration // Interval for mutex cleanup
+	lifecycle                     // Tracks whether the limiter is closed
+	options                       // Optional settings such as the clock
 }
 
 // NewTokenBucketLimiter creates a new instance of TokenBucketLimiter.
@@ -29,7 +33,7 @@ type TokenBucketLimiter struct {
 //
 // Returns:
 //   - A pointer to a TokenBucketLimiter instance
-func NewTokenBucketLimiter(store store.Store, capacity, refillRate float64) (*TokenBucketLimiter, error) {
+func NewTokenBucketLimiter(store store.Store, capacity, refillRate float64, opts ...Option) (*TokenBucketLimiter, error) {
 	if capacity <= 0 {
 		return nil, errors.New("capacity must be greater than zero")
 	}
@@ -47,6 +51,7 @@ func NewTokenBucketLimiter(store store.Store, capacity, refillRate float64) (*To
 		mutexes:         sync.Map{},
 		cleanupInterval: time.Minute * 5,
 		cleanupStopCh:   make(chan struct{}),
+		options:         newOptions(defaultNamespace(TokenBucketPolicy, capacity, refillRate), opts),
 	}
 	go limiter.startMutexCleanup()
 	return limiter, nil
@@ -57,7 +62,7 @@ func NewTokenBucketLimiter(store store.Store, capacity, refillRate float64) (*To
 func (l *TokenBucketLimiter) getMutex(key string) *keyMutex {
 	mutexInterface, _ := l.mutexes.LoadOrStore(key, &keyMutex{
 		mu:         &sync.Mutex{},
-		lastAccess: time.Now(),
+		lastAccess: l.now(),
 	})
 	return mutexInterface.(*keyMutex)
 }
@@ -72,68 +77,220 @@ func (l *TokenBucketLimiter) getMutex(key string) *keyMutex {
 //   - allowed: A boolean indicating whether the request is allowed (true) or should be rate-limited (false)
 //   - err: An error if there was a problem accessing the storage backend
 func (l *TokenBucketLimiter) Allow(key string) (bool, error) {
-	// Input validation
-	if err := validateKey(key); err != nil {
+	return l.AllowN(key, 1)
+}
+
+// AllowN checks whether a request of cost n associated with the given key is allowed under the rate limit.
+// It consumes n tokens if that many are available.
+func (l *TokenBucketLimiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.DecideN(key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *TokenBucketLimiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.DecideNContext(ctx, key, 1)
+	if err != nil {
 		return false, err
 	}
+	return result.Allowed, nil
+}
+
+// Decide checks whether a request associated with the given key is allowed under the rate limit
+// and reports the tokens left in the bucket.
+//
+// Parameters:
+//   - key: A unique identifier for the client (e.g., IP address, user ID)
+//
+// Returns:
+//   - result: The decision, with Remaining set to the whole tokens left and ResetAt to the time the bucket is full again
+//   - err: An error if there was a problem accessing the storage backend
+func (l *TokenBucketLimiter) Decide(key string) (*Result, error) {
+	return l.DecideN(key, 1)
+}
+
+// DecideN is like Decide for a request that consumes n tokens.
+// ErrCostExceedsCapacity is returned if n exceeds the bucket capacity.
+func (l *TokenBucketLimiter) DecideN(key string, n int64) (*Result, error) {
+	return l.DecideNContext(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but passes the context on to the store, so its cancellation
+// and deadline apply to store calls.
+func (l *TokenBucketLimiter) DecideNContext(ctx context.Context, key string, n int64) (*Result, error) {
+	reservation, err := l.reserveN(ctx, key, n, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &reservation.result, nil
+}
+
+// Reserve reserves a token for a request associated with the given key, waiting as long as needed.
+func (l *TokenBucketLimiter) Reserve(key string) (*Reservation, error) {
+	return l.ReserveN(context.Background(), key, 1, InfDuration)
+}
+
+// ReserveN reserves n tokens for a request associated with the given key. Tokens may be
+// borrowed from future refills, in which case the reservation delay is the time needed to
+// refill them; if that exceeds maxDelay nothing is consumed and the reservation is not OK.
+func (l *TokenBucketLimiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return l.reserveN(ctx, key, n, maxDelay)
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *TokenBucketLimiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until a request of cost n associated with the given key is allowed, or the
+// context is done. It fails immediately with ErrWaitExceedsDeadline, without consuming
+// tokens, if the tokens cannot be refilled before the context deadline.
+func (l *TokenBucketLimiter) WaitN(ctx context.Context, key string, n int64) error {
+	return waitN(ctx, l, l.getClock(), key, n)
+}
+
+// reserveN refills the bucket for the given key and takes n tokens from it if they are
+// available within maxDelay.
+func (l *TokenBucketLimiter) reserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*Reservation, error) {
+	if err := l.checkOpen(); err != nil {
+		return nil, err
+	}
+	// Input validation
+	key, err := l.storeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCost(n, l.capacity); err != nil {
+		return nil, err
+	}
+	cost := float64(n)
 
 	km := l.getMutex(key)
 	km.mu.Lock()
 	defer km.mu.Unlock()
-	km.lastAccess = time.Now()
+	km.lastAccess = l.now()
+
+	now := l.now().UnixNano()
+	state, taken, err := l.takeTokens(ctx, key, cost, maxDelay, now)
+	if err != nil {
+		return nil, err
+	}
+
+	// Time until enough tokens have been refilled for the request
+	available := state.Tokens
+	if taken {
+		available += cost
+	}
+	var wait time.Duration
+	if available < cost {
+		wait = secondsToDuration((cost - available) / l.refillRate)
+	}
 
-	now := time.Now().UnixNano()
+	reservation := &Reservation{ok: taken, timeToAct: time.Unix(0, now).Add(wait), clock: l.getClock()}
+	if taken {
+		reservation.cancel = func() error { return l.refund(key, cost) }
+	}
+	reservation.result = l.result(wait == 0 && taken, state.Tokens, wait, now)
+	return reservation, nil
+}
+
+// takeTokens refills the bucket for the given key at time now and takes the given number
+// of tokens from it, borrowing from future refills, if they are available within maxDelay.
+// Negative tokens are put back. It returns the state after the update and whether the
+// tokens were taken. The caller holds the mutex for the key.
+//
+// If the store implements store.TokenBucketTaker, the update is made atomically by the
+// store, so that limiters sharing it from different processes cannot over-admit.
+// Otherwise the state is read and written back in separate calls, which the mutex
+// only guards against other callers of this limiter.
+func (l *TokenBucketLimiter) takeTokens(ctx context.Context, key string, tokens float64, maxDelay time.Duration, now int64) (*store.TokenBucketState, bool, error) {
+	if taker, ok := l.store.(store.TokenBucketTaker); ok {
+		return taker.TakeTokens(ctx, key, store.TakeTokensRequest{
+			Capacity:   l.capacity,
+			RefillRate: l.refillRate,
+			Tokens:     tokens,
+			MaxDelay:   maxDelay,
+			Now:        now,
+			Expiration: time.Hour * 24, // Set expiration as needed
+		})
+	}
 
 	// Retrieve the current token bucket state
-	state, err := l.store.GetTokenBucket(key)
+	state, err := l.store.GetTokenBucketContext(ctx, key)
 	if err != nil {
-		return false, err
+		return nil, false, err
 	}
 
 	if state == nil {
-		// Initialize a new token bucket state
+		// Initialize a new, full token bucket state
 		state = &store.TokenBucketState{
-			Tokens:         l.capacity - 1, // Consume one token
+			Tokens:         l.capacity,
 			LastUpdateTime: now,
 		}
-		err = l.store.SetTokenBucket(key, state, time.Hour*24) // Set expiration as needed
-		if err != nil {
-			return false, err
-		}
-		return true, nil // Request is allowed
+	} else {
+		// Refill tokens based on the elapsed time
+		elapsedTime := float64(now-state.LastUpdateTime) / float64(time.Second)
+		refillTokens := elapsedTime * l.refillRate
+		state.Tokens = min(state.Tokens+refillTokens, l.capacity)
+		state.LastUpdateTime = now
 	}
 
-	// Refill tokens based on the elapsed time
-	elapsedTime := float64(now-state.LastUpdateTime) / float64(time.Second)
-	refillTokens := elapsedTime * l.refillRate
-	state.Tokens = min(state.Tokens+refillTokens, l.capacity)
-	state.LastUpdateTime = now
-
-	if state.Tokens >= 1 {
-		// Consume a token
-		state.Tokens -= 1
-		err = l.store.SetTokenBucket(key, state, time.Hour*24)
-		if err != nil {
-			return false, err
-		}
-		return true, nil // Request is allowed
+	taken := false
+	if (tokens-state.Tokens)/l.refillRate <= maxDelay.Seconds() {
+		state.Tokens = min(state.Tokens-tokens, l.capacity)
+		taken = true
 	}
 
-	// Not enough tokens
-	err = l.store.SetTokenBucket(key, state, time.Hour*24)
+	// Store the state even if nothing was taken to record the refill
+	err = l.store.SetTokenBucketContext(ctx, key, state, time.Hour*24) // Set expiration as needed
 	if err != nil {
-		return false, err
+		return nil, false, err
+	}
+	return state, taken, nil
+}
+
+// refund puts tokens taken by a cancelled reservation back into the bucket.
+func (l *TokenBucketLimiter) refund(key string, tokens float64) error {
+	km := l.getMutex(key)
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.lastAccess = l.now()
+
+	_, _, err := l.takeTokens(context.Background(), key, -tokens, InfDuration, l.now().UnixNano())
+	return err
+}
+
+// result builds the decision for a bucket holding the given number of tokens at time now,
+// where wait is the time until the request could be admitted.
+func (l *TokenBucketLimiter) result(allowed bool, tokens float64, wait time.Duration, now int64) Result {
+	result := Result{
+		Allowed: allowed,
+		Limit:   int64(l.capacity),
+		ResetAt: time.Unix(0, now).Add(secondsToDuration((l.capacity - tokens) / l.refillRate)),
+	}
+	if tokens > 0 {
+		result.Remaining = int64(tokens)
 	}
-	return false, nil // Rate limit exceeded
+	if !allowed {
+		result.RetryAfter = wait
+	}
+	return result
 }
 
 // startMutexCleanup runs a background goroutine to clean up unused mutexes.
 func (l *TokenBucketLimiter) startMutexCleanup() {
-	l.cleanupTicker = time.NewTicker(l.cleanupInterval)
+	l.cleanupTicker = l.getClock().NewTicker(l.cleanupInterval)
 	for {
 		select {
-		case <-l.cleanupTicker.C:
-			now := time.Now()
+		case <-l.cleanupTicker.C():
+			now := l.now()
 			l.mutexes.Range(func(key, value interface{}) bool {
 				km := value.(*keyMutex)
 				km.mu.Lock()
@@ -152,7 +309,46 @@ func (l *TokenBucketLimiter) startMutexCleanup() {
 	}
 }
 
-// StopCleanup stops the mutex cleanup goroutine.
+// Close stops the mutex cleanup goroutine and makes later calls fail with ErrClosed. It
+// does not close the store, which may be shared. Closing a closed limiter does nothing.
+func (l *TokenBucketLimiter) Close() error {
+	l.shutdown(func() { close(l.cleanupStopCh) })
+	return nil
+}
+
+// StopCleanup stops the mutex cleanup goroutine, leaving the limiter usable. Calling it
+// again, or after Close, does nothing.
 func (l *TokenBucketLimiter) StopCleanup() {
-	close(l.cleanupStopCh)
+	l.stopBackground(func() { close(l.cleanupStopCh) })
+}
+
+// TrackedKeys returns the number of keys the limiter holds a mutex for. Mutexes of keys
+// left idle for twice the cleanup interval are dropped by the cleanup goroutine.
+func (l *TokenBucketLimiter) TrackedKeys() int {
+	return countKeys(&l.mutexes)
+}
+
+// Inspect returns the token bucket of key, as of its last update.
+func (l *TokenBucketLimiter) Inspect(ctx context.Context, key string) (*KeyState, error) {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return nil, err
+	}
+	state, err := inspectKey(ctx, inspector, TokenBucketPolicy, key)
+	if err != nil || !state.Exists {
+		return state, err
+	}
+	if state.TokenBucket, err = l.store.GetTokenBucketContext(ctx, key); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Reset deletes the token bucket of key, which is full again.
+func (l *TokenBucketLimiter) Reset(ctx context.Context, key string) error {
+	key, inspector, err := inspection(&l.lifecycle, &l.options, l.store, key)
+	if err != nil {
+		return err
+	}
+	return inspector.Delete(ctx, key)
 }
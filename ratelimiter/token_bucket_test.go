@@ -3,6 +3,10 @@
 package ratelimiter
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -174,3 +178,186 @@ func TestTokenBucketLimiterMultipleClients(t *testing.T) {
 		}
 	}
 }
+
+// TestTokenBucketLimiterDecide verifies the quota reported by Decide.
+func TestTokenBucketLimiterDecide(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewTokenBucketLimiter(memStore, 2, 4) // 2 tokens, refill 4 tokens per second
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+	key := "decideUser"
+
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Allowed || result.Limit != 2 || result.Remaining != 1 {
+		t.Errorf("Unexpected result for 1st request: %+v", result)
+	}
+
+	result, err = limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Unexpected result for 2nd request: %+v", result)
+	}
+	if untilReset := time.Until(result.ResetAt); untilReset <= 0 || untilReset > time.Millisecond*500 {
+		t.Errorf("Expected the bucket to refill within 500ms, got %v", untilReset)
+	}
+
+	result, err = limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Request exceeding capacity should not be allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Millisecond*250 {
+		t.Errorf("Expected retry-after of at most 250ms, got %v", result.RetryAfter)
+	}
+
+	time.Sleep(result.RetryAfter)
+
+	allowed, err := limiter.Allow(key)
+	if err != nil {
+		t.Fatalf("Unexpected error after retry-after: %v", err)
+	}
+	if !allowed {
+		t.Error("Request after retry-after should be allowed")
+	}
+}
+
+// TestTokenBucketLimiterAllowN verifies that weighted requests consume several tokens.
+func TestTokenBucketLimiterAllowN(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	limiter, err := NewTokenBucketLimiter(memStore, 10, 1)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+	key := "weightedUser"
+
+	allowed, err := limiter.AllowN(key, 7)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request of cost 7 should be allowed")
+	}
+
+	result, err := limiter.DecideN(key, 4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Request of cost 4 should not be allowed with 3 tokens left")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("Expected retry-after of at most 1s, got %v", result.RetryAfter)
+	}
+
+	allowed, err = limiter.AllowN(key, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !allowed {
+		t.Error("Request of cost 3 should be allowed")
+	}
+
+	_, err = limiter.AllowN(key, 11)
+	if !errors.Is(err, ErrCostExceedsCapacity) {
+		t.Errorf("Expected ErrCostExceedsCapacity, got %v", err)
+	}
+	_, err = limiter.AllowN(key, -1)
+	if !errors.Is(err, ErrInvalidCost) {
+		t.Errorf("Expected ErrInvalidCost, got %v", err)
+	}
+}
+
+// plainStore hides the optional capabilities of the store it wraps, so limiters fall back
+// to the basic Store methods.
+type plainStore struct {
+	store.Store
+}
+
+// TestTokenBucketLimiterWithoutTaker verifies the fallback for stores that cannot take
+// tokens atomically.
+func TestTokenBucketLimiterWithoutTaker(t *testing.T) {
+	limiter, err := NewTokenBucketLimiter(plainStore{store.NewMemoryStore()}, 3, 1)
+	if err != nil {
+		t.Fatalf("Failed to create rate limiter: %v", err)
+	}
+	defer limiter.StopCleanup()
+	key := "plainUser"
+
+	for i := 0; i < 3; i++ {
+		allowed, err := limiter.Allow(key)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !allowed {
+			t.Errorf("Request %d should be allowed", i+1)
+		}
+	}
+	result, err := limiter.Decide(key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Allowed {
+		t.Error("Request exceeding capacity should not be allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > time.Second {
+		t.Errorf("Expected retry-after of at most 1s, got %v", result.RetryAfter)
+	}
+
+	reservation, err := limiter.ReserveN(context.Background(), key, 1, time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reservation.OK() {
+		t.Fatal("Reservation within a second should be OK")
+	}
+	if err := reservation.Cancel(); err != nil {
+		t.Fatalf("Unexpected error on cancel: %v", err)
+	}
+}
+
+// TestTokenBucketLimiterSharedStore verifies that limiters sharing a store that takes
+// tokens atomically do not admit more requests than the bucket holds.
+func TestTokenBucketLimiterSharedStore(t *testing.T) {
+	memStore := store.NewMemoryStore()
+	capacity := 20
+	key := "sharedUser"
+
+	var allowed int64
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		limiter, err := NewTokenBucketLimiter(memStore, float64(capacity), 0.001)
+		if err != nil {
+			t.Fatalf("Failed to create rate limiter: %v", err)
+		}
+		defer limiter.StopCleanup()
+		for j := 0; j < 25; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ok, err := limiter.Allow(key)
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+				if ok {
+					atomic.AddInt64(&allowed, 1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if allowed != int64(capacity) {
+		t.Errorf("Expected exactly %d requests allowed, got %d", capacity, allowed)
+	}
+}
@@ -0,0 +1,6 @@
+package store
+
+import "errors"
+
+// ErrClosed is returned by the methods of a store after it has been closed.
+var ErrClosed = errors.New("store is closed")
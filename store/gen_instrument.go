@@ -0,0 +1,58 @@
+//go:build ignore
+
+// gen_instrument.go writes instrument_gen.go, which combines the methods of Store with
+// every subset of the optional store interfaces for Instrument. Run it with go generate.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+)
+
+// capability is an optional store interface, in the order of the has constants of
+// instrument.go.
+type capability struct {
+	field    string // Field of capabilities holding its instrumented methods
+	typeName string // Type of that field
+}
+
+var capabilities = []capability{
+	{"tokenBucketTaker", "instrumentedTokenBucketTaker"},
+	{"leakyBucketFiller", "instrumentedLeakyBucketFiller"},
+	{"slidingWindowRecorder", "instrumentedSlidingWindowRecorder"},
+	{"gcraUpdater", "instrumentedGCRAUpdater"},
+	{"scoreKeeper", "instrumentedScoreKeeper"},
+	{"keyInspector", "instrumentedKeyInspector"},
+}
+
+func main() {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by gen_instrument.go; DO NOT EDIT.\n\n")
+	buf.WriteString("package store\n\n")
+	buf.WriteString("// wrap returns s extended with the optional store interfaces in c.mask.\n")
+	buf.WriteString("func (c capabilities) wrap(s *instrumentedStore) Store {\n")
+	buf.WriteString("switch c.mask {\n")
+	for mask := 1; mask < 1<<len(capabilities); mask++ {
+		types := "*instrumentedStore"
+		values := "s"
+		for i, capability := range capabilities {
+			if mask&(1<<i) != 0 {
+				types += "; " + capability.typeName
+				values += ", c." + capability.field
+			}
+		}
+		fmt.Fprintf(&buf, "case %d:\nreturn struct {\n%s\n}{%s}\n", mask, types, values)
+	}
+	buf.WriteString("}\nreturn s\n}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile("instrument_gen.go", src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Operation describes a call to a store made by Instrument.
+type Operation struct {
+	Method   string        // Store method, without the Context suffix, such as "Increment" or "Close"
+	Key      string        // Key the call is about; the keys separated by spaces for TopScores and Delete, and empty for Close
+	Duration time.Duration // Time the call took
+	Err      error         // Error returned by the call, if any
+}
+
+// Instrument returns a store that serves its calls with s and passes each of them to hook
+// once it returns, with the context of the call. The hook runs on the caller's goroutine,
+// so it should be quick.
+//
+// The returned store implements each optional store interface, such as TokenBucketTaker
+// or KeyInspector, that s implements, so limiters keep their atomic paths whichever of
+// them s supports.
+func Instrument(s Store, hook func(ctx context.Context, op Operation)) Store {
+	instrumented := &instrumentedStore{store: s, hook: hook}
+	var caps capabilities
+	if taker, ok := s.(TokenBucketTaker); ok {
+		caps.mask |= hasTokenBucketTaker
+		caps.tokenBucketTaker = instrumentedTokenBucketTaker{instrumented, taker}
+	}
+	if filler, ok := s.(LeakyBucketFiller); ok {
+		caps.mask |= hasLeakyBucketFiller
+		caps.leakyBucketFiller = instrumentedLeakyBucketFiller{instrumented, filler}
+	}
+	if recorder, ok := s.(SlidingWindowRecorder); ok {
+		caps.mask |= hasSlidingWindowRecorder
+		caps.slidingWindowRecorder = instrumentedSlidingWindowRecorder{instrumented, recorder}
+	}
+	if updater, ok := s.(GCRAUpdater); ok {
+		caps.mask |= hasGCRAUpdater
+		caps.gcraUpdater = instrumentedGCRAUpdater{instrumented, updater}
+	}
+	if keeper, ok := s.(ScoreKeeper); ok {
+		caps.mask |= hasScoreKeeper
+		caps.scoreKeeper = instrumentedScoreKeeper{instrumented, keeper}
+	}
+	if inspector, ok := s.(KeyInspector); ok {
+		caps.mask |= hasKeyInspector
+		caps.keyInspector = instrumentedKeyInspector{instrumented, inspector}
+	}
+	return caps.wrap(instrumented)
+}
+
+//go:generate go run gen_instrument.go
+
+// Optional store interfaces implemented by the store passed to Instrument.
+const (
+	hasTokenBucketTaker = 1 << iota
+	hasLeakyBucketFiller
+	hasSlidingWindowRecorder
+	hasGCRAUpdater
+	hasScoreKeeper
+	hasKeyInspector
+)
+
+// capabilities holds the instrumented optional store interfaces of a store made by
+// Instrument; wrap, generated by gen_instrument.go, combines those in mask with the
+// methods of Store.
+type capabilities struct {
+	mask                  int
+	tokenBucketTaker      instrumentedTokenBucketTaker
+	leakyBucketFiller     instrumentedLeakyBucketFiller
+	slidingWindowRecorder instrumentedSlidingWindowRecorder
+	gcraUpdater           instrumentedGCRAUpdater
+	scoreKeeper           instrumentedScoreKeeper
+	keyInspector          instrumentedKeyInspector
+}
+
+// instrumentedStore is a store made by Instrument.
+type instrumentedStore struct {
+	store Store                                   // Store serving the calls
+	hook  func(ctx context.Context, op Operation) // Called after each call
+}
+
+// instrumentedTokenBucketTaker instruments the TokenBucketTaker of a store.
+type instrumentedTokenBucketTaker struct {
+	s     *instrumentedStore
+	taker TokenBucketTaker
+}
+
+// instrumentedLeakyBucketFiller instruments the LeakyBucketFiller of a store.
+type instrumentedLeakyBucketFiller struct {
+	s      *instrumentedStore
+	filler LeakyBucketFiller
+}
+
+// instrumentedSlidingWindowRecorder instruments the SlidingWindowRecorder of a store.
+type instrumentedSlidingWindowRecorder struct {
+	s        *instrumentedStore
+	recorder SlidingWindowRecorder
+}
+
+// instrumentedGCRAUpdater instruments the GCRAUpdater of a store.
+type instrumentedGCRAUpdater struct {
+	s       *instrumentedStore
+	updater GCRAUpdater
+}
+
+// instrumentedScoreKeeper instruments the ScoreKeeper of a store.
+type instrumentedScoreKeeper struct {
+	s      *instrumentedStore
+	keeper ScoreKeeper
+}
+
+// instrumentedKeyInspector instruments the KeyInspector of a store.
+type instrumentedKeyInspector struct {
+	s         *instrumentedStore
+	inspector KeyInspector
+}
+
+// observe passes a call of the given method that started at start and failed with *err,
+// if not nil, to the hook.
+func (s *instrumentedStore) observe(ctx context.Context, method, key string, start time.Time, err *error) {
+	s.hook(ctx, Operation{Method: method, Key: key, Duration: time.Since(start), Err: *err})
+}
+
+// Increment calls Increment on the store and passes the call to the hook.
+func (s *instrumentedStore) Increment(key string, delta int64, expiration time.Duration) (count int64, err error) {
+	defer s.observe(context.Background(), "Increment", key, time.Now(), &err)
+	return s.store.Increment(key, delta, expiration)
+}
+
+// IncrementContext calls IncrementContext on the store and passes the call to the hook.
+func (s *instrumentedStore) IncrementContext(ctx context.Context, key string, delta int64, expiration time.Duration) (count int64, err error) {
+	defer s.observe(ctx, "Increment", key, time.Now(), &err)
+	return s.store.IncrementContext(ctx, key, delta, expiration)
+}
+
+// GetCounter calls GetCounter on the store and passes the call to the hook.
+func (s *instrumentedStore) GetCounter(key string) (count int64, err error) {
+	defer s.observe(context.Background(), "GetCounter", key, time.Now(), &err)
+	return s.store.GetCounter(key)
+}
+
+// GetCounterContext calls GetCounterContext on the store and passes the call to the hook.
+func (s *instrumentedStore) GetCounterContext(ctx context.Context, key string) (count int64, err error) {
+	defer s.observe(ctx, "GetCounter", key, time.Now(), &err)
+	return s.store.GetCounterContext(ctx, key)
+}
+
+// AddTimestamp calls AddTimestamp on the store and passes the call to the hook.
+func (s *instrumentedStore) AddTimestamp(key string, timestamp int64, expiration time.Duration) (err error) {
+	defer s.observe(context.Background(), "AddTimestamp", key, time.Now(), &err)
+	return s.store.AddTimestamp(key, timestamp, expiration)
+}
+
+// AddTimestampContext calls AddTimestampContext on the store and passes the call to the hook.
+func (s *instrumentedStore) AddTimestampContext(ctx context.Context, key string, timestamp int64, expiration time.Duration) (err error) {
+	defer s.observe(ctx, "AddTimestamp", key, time.Now(), &err)
+	return s.store.AddTimestampContext(ctx, key, timestamp, expiration)
+}
+
+// CountTimestamps calls CountTimestamps on the store and passes the call to the hook.
+func (s *instrumentedStore) CountTimestamps(key string, start int64, end int64) (count int64, err error) {
+	defer s.observe(context.Background(), "CountTimestamps", key, time.Now(), &err)
+	return s.store.CountTimestamps(key, start, end)
+}
+
+// CountTimestampsContext calls CountTimestampsContext on the store and passes the call to the hook.
+func (s *instrumentedStore) CountTimestampsContext(ctx context.Context, key string, start int64, end int64) (count int64, err error) {
+	defer s.observe(ctx, "CountTimestamps", key, time.Now(), &err)
+	return s.store.CountTimestampsContext(ctx, key, start, end)
+}
+
+// TimestampAt calls TimestampAt on the store and passes the call to the hook.
+func (s *instrumentedStore) TimestampAt(key string, start int64, rank int64) (timestamp int64, ok bool, err error) {
+	defer s.observe(context.Background(), "TimestampAt", key, time.Now(), &err)
+	return s.store.TimestampAt(key, start, rank)
+}
+
+// TimestampAtContext calls TimestampAtContext on the store and passes the call to the hook.
+func (s *instrumentedStore) TimestampAtContext(ctx context.Context, key string, start int64, rank int64) (timestamp int64, ok bool, err error) {
+	defer s.observe(ctx, "TimestampAt", key, time.Now(), &err)
+	return s.store.TimestampAtContext(ctx, key, start, rank)
+}
+
+// RemoveTimestamp calls RemoveTimestamp on the store and passes the call to the hook.
+func (s *instrumentedStore) RemoveTimestamp(key string, timestamp int64) (err error) {
+	defer s.observe(context.Background(), "RemoveTimestamp", key, time.Now(), &err)
+	return s.store.RemoveTimestamp(key, timestamp)
+}
+
+// RemoveTimestampContext calls RemoveTimestampContext on the store and passes the call to the hook.
+func (s *instrumentedStore) RemoveTimestampContext(ctx context.Context, key string, timestamp int64) (err error) {
+	defer s.observe(ctx, "RemoveTimestamp", key, time.Now(), &err)
+	return s.store.RemoveTimestampContext(ctx, key, timestamp)
+}
+
+// GetTokenBucket calls GetTokenBucket on the store and passes the call to the hook.
+func (s *instrumentedStore) GetTokenBucket(key string) (state *TokenBucketState, err error) {
+	defer s.observe(context.Background(), "GetTokenBucket", key, time.Now(), &err)
+	return s.store.GetTokenBucket(key)
+}
+
+// GetTokenBucketContext calls GetTokenBucketContext on the store and passes the call to the hook.
+func (s *instrumentedStore) GetTokenBucketContext(ctx context.Context, key string) (state *TokenBucketState, err error) {
+	defer s.observe(ctx, "GetTokenBucket", key, time.Now(), &err)
+	return s.store.GetTokenBucketContext(ctx, key)
+}
+
+// SetTokenBucket calls SetTokenBucket on the store and passes the call to the hook.
+func (s *instrumentedStore) SetTokenBucket(key string, state *TokenBucketState, expiration time.Duration) (err error) {
+	defer s.observe(context.Background(), "SetTokenBucket", key, time.Now(), &err)
+	return s.store.SetTokenBucket(key, state, expiration)
+}
+
+// SetTokenBucketContext calls SetTokenBucketContext on the store and passes the call to the hook.
+func (s *instrumentedStore) SetTokenBucketContext(ctx context.Context, key string, state *TokenBucketState, expiration time.Duration) (err error) {
+	defer s.observe(ctx, "SetTokenBucket", key, time.Now(), &err)
+	return s.store.SetTokenBucketContext(ctx, key, state, expiration)
+}
+
+// GetLeakyBucket calls GetLeakyBucket on the store and passes the call to the hook.
+func (s *instrumentedStore) GetLeakyBucket(key string) (state *LeakyBucketState, err error) {
+	defer s.observe(context.Background(), "GetLeakyBucket", key, time.Now(), &err)
+	return s.store.GetLeakyBucket(key)
+}
+
+// GetLeakyBucketContext calls GetLeakyBucketContext on the store and passes the call to the hook.
+func (s *instrumentedStore) GetLeakyBucketContext(ctx context.Context, key string) (state *LeakyBucketState, err error) {
+	defer s.observe(ctx, "GetLeakyBucket", key, time.Now(), &err)
+	return s.store.GetLeakyBucketContext(ctx, key)
+}
+
+// SetLeakyBucket calls SetLeakyBucket on the store and passes the call to the hook.
+func (s *instrumentedStore) SetLeakyBucket(key string, state *LeakyBucketState, expiration time.Duration) (err error) {
+	defer s.observe(context.Background(), "SetLeakyBucket", key, time.Now(), &err)
+	return s.store.SetLeakyBucket(key, state, expiration)
+}
+
+// SetLeakyBucketContext calls SetLeakyBucketContext on the store and passes the call to the hook.
+func (s *instrumentedStore) SetLeakyBucketContext(ctx context.Context, key string, state *LeakyBucketState, expiration time.Duration) (err error) {
+	defer s.observe(ctx, "SetLeakyBucket", key, time.Now(), &err)
+	return s.store.SetLeakyBucketContext(ctx, key, state, expiration)
+}
+
+// Close closes the store and passes the call to the hook.
+func (s *instrumentedStore) Close() (err error) {
+	defer s.observe(context.Background(), "Close", "", time.Now(), &err)
+	return s.store.Close()
+}
+
+// TakeTokens calls TakeTokens on the store and passes the call to the hook.
+func (c instrumentedTokenBucketTaker) TakeTokens(ctx context.Context, key string, req TakeTokensRequest) (state *TokenBucketState, taken bool, err error) {
+	defer c.s.observe(ctx, "TakeTokens", key, time.Now(), &err)
+	return c.taker.TakeTokens(ctx, key, req)
+}
+
+// FillLeakyBucket calls FillLeakyBucket on the store and passes the call to the hook.
+func (c instrumentedLeakyBucketFiller) FillLeakyBucket(ctx context.Context, key string, req FillLeakyBucketRequest) (state *LeakyBucketState, added bool, err error) {
+	defer c.s.observe(ctx, "FillLeakyBucket", key, time.Now(), &err)
+	return c.filler.FillLeakyBucket(ctx, key, req)
+}
+
+// RecordTimestamps calls RecordTimestamps on the store and passes the call to the hook.
+func (c instrumentedSlidingWindowRecorder) RecordTimestamps(ctx context.Context, key string, req RecordTimestampsRequest) (result *RecordTimestampsResult, err error) {
+	defer c.s.observe(ctx, "RecordTimestamps", key, time.Now(), &err)
+	return c.recorder.RecordTimestamps(ctx, key, req)
+}
+
+// UpdateGCRA calls UpdateGCRA on the store and passes the call to the hook.
+func (c instrumentedGCRAUpdater) UpdateGCRA(ctx context.Context, key string, req UpdateGCRARequest) (tat int64, updated bool, err error) {
+	defer c.s.observe(ctx, "UpdateGCRA", key, time.Now(), &err)
+	return c.updater.UpdateGCRA(ctx, key, req)
+}
+
+// AddScores calls AddScores on the store and passes the call to the hook.
+func (c instrumentedScoreKeeper) AddScores(ctx context.Context, key string, scores map[string]float64, maxMembers int, expiration time.Duration) (err error) {
+	defer c.s.observe(ctx, "AddScores", key, time.Now(), &err)
+	return c.keeper.AddScores(ctx, key, scores, maxMembers, expiration)
+}
+
+// TopScores calls TopScores on the store and passes the call to the hook.
+func (c instrumentedScoreKeeper) TopScores(ctx context.Context, keys []string, n int) (top []Score, err error) {
+	defer c.s.observe(ctx, "TopScores", strings.Join(keys, " "), time.Now(), &err)
+	return c.keeper.TopScores(ctx, keys, n)
+}
+
+// Delete calls Delete on the store and passes the call to the hook.
+func (c instrumentedKeyInspector) Delete(ctx context.Context, keys ...string) (err error) {
+	defer c.s.observe(ctx, "Delete", strings.Join(keys, " "), time.Now(), &err)
+	return c.inspector.Delete(ctx, keys...)
+}
+
+// TTL calls TTL on the store and passes the call to the hook.
+func (c instrumentedKeyInspector) TTL(ctx context.Context, key string) (ttl time.Duration, exists bool, err error) {
+	defer c.s.observe(ctx, "TTL", key, time.Now(), &err)
+	return c.inspector.TTL(ctx, key)
+}
+
+// GetGCRA calls GetGCRA on the store and passes the call to the hook.
+func (c instrumentedKeyInspector) GetGCRA(ctx context.Context, key string) (tat int64, ok bool, err error) {
+	defer c.s.observe(ctx, "GetGCRA", key, time.Now(), &err)
+	return c.inspector.GetGCRA(ctx, key)
+}
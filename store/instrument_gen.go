@@ -0,0 +1,454 @@
+// Code generated by gen_instrument.go; DO NOT EDIT.
+
+package store
+
+// wrap returns s extended with the optional store interfaces in c.mask.
+func (c capabilities) wrap(s *instrumentedStore) Store {
+	switch c.mask {
+	case 1:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+		}{s, c.tokenBucketTaker}
+	case 2:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+		}{s, c.leakyBucketFiller}
+	case 3:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller}
+	case 4:
+		return struct {
+			*instrumentedStore
+			instrumentedSlidingWindowRecorder
+		}{s, c.slidingWindowRecorder}
+	case 5:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedSlidingWindowRecorder
+		}{s, c.tokenBucketTaker, c.slidingWindowRecorder}
+	case 6:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+		}{s, c.leakyBucketFiller, c.slidingWindowRecorder}
+	case 7:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.slidingWindowRecorder}
+	case 8:
+		return struct {
+			*instrumentedStore
+			instrumentedGCRAUpdater
+		}{s, c.gcraUpdater}
+	case 9:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedGCRAUpdater
+		}{s, c.tokenBucketTaker, c.gcraUpdater}
+	case 10:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedGCRAUpdater
+		}{s, c.leakyBucketFiller, c.gcraUpdater}
+	case 11:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedGCRAUpdater
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.gcraUpdater}
+	case 12:
+		return struct {
+			*instrumentedStore
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+		}{s, c.slidingWindowRecorder, c.gcraUpdater}
+	case 13:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+		}{s, c.tokenBucketTaker, c.slidingWindowRecorder, c.gcraUpdater}
+	case 14:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+		}{s, c.leakyBucketFiller, c.slidingWindowRecorder, c.gcraUpdater}
+	case 15:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.slidingWindowRecorder, c.gcraUpdater}
+	case 16:
+		return struct {
+			*instrumentedStore
+			instrumentedScoreKeeper
+		}{s, c.scoreKeeper}
+	case 17:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedScoreKeeper
+		}{s, c.tokenBucketTaker, c.scoreKeeper}
+	case 18:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedScoreKeeper
+		}{s, c.leakyBucketFiller, c.scoreKeeper}
+	case 19:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedScoreKeeper
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.scoreKeeper}
+	case 20:
+		return struct {
+			*instrumentedStore
+			instrumentedSlidingWindowRecorder
+			instrumentedScoreKeeper
+		}{s, c.slidingWindowRecorder, c.scoreKeeper}
+	case 21:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedSlidingWindowRecorder
+			instrumentedScoreKeeper
+		}{s, c.tokenBucketTaker, c.slidingWindowRecorder, c.scoreKeeper}
+	case 22:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedScoreKeeper
+		}{s, c.leakyBucketFiller, c.slidingWindowRecorder, c.scoreKeeper}
+	case 23:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedScoreKeeper
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.slidingWindowRecorder, c.scoreKeeper}
+	case 24:
+		return struct {
+			*instrumentedStore
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+		}{s, c.gcraUpdater, c.scoreKeeper}
+	case 25:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+		}{s, c.tokenBucketTaker, c.gcraUpdater, c.scoreKeeper}
+	case 26:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+		}{s, c.leakyBucketFiller, c.gcraUpdater, c.scoreKeeper}
+	case 27:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.gcraUpdater, c.scoreKeeper}
+	case 28:
+		return struct {
+			*instrumentedStore
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+		}{s, c.slidingWindowRecorder, c.gcraUpdater, c.scoreKeeper}
+	case 29:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+		}{s, c.tokenBucketTaker, c.slidingWindowRecorder, c.gcraUpdater, c.scoreKeeper}
+	case 30:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+		}{s, c.leakyBucketFiller, c.slidingWindowRecorder, c.gcraUpdater, c.scoreKeeper}
+	case 31:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.slidingWindowRecorder, c.gcraUpdater, c.scoreKeeper}
+	case 32:
+		return struct {
+			*instrumentedStore
+			instrumentedKeyInspector
+		}{s, c.keyInspector}
+	case 33:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.keyInspector}
+	case 34:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedKeyInspector
+		}{s, c.leakyBucketFiller, c.keyInspector}
+	case 35:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.keyInspector}
+	case 36:
+		return struct {
+			*instrumentedStore
+			instrumentedSlidingWindowRecorder
+			instrumentedKeyInspector
+		}{s, c.slidingWindowRecorder, c.keyInspector}
+	case 37:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedSlidingWindowRecorder
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.slidingWindowRecorder, c.keyInspector}
+	case 38:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedKeyInspector
+		}{s, c.leakyBucketFiller, c.slidingWindowRecorder, c.keyInspector}
+	case 39:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.slidingWindowRecorder, c.keyInspector}
+	case 40:
+		return struct {
+			*instrumentedStore
+			instrumentedGCRAUpdater
+			instrumentedKeyInspector
+		}{s, c.gcraUpdater, c.keyInspector}
+	case 41:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedGCRAUpdater
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.gcraUpdater, c.keyInspector}
+	case 42:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedGCRAUpdater
+			instrumentedKeyInspector
+		}{s, c.leakyBucketFiller, c.gcraUpdater, c.keyInspector}
+	case 43:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedGCRAUpdater
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.gcraUpdater, c.keyInspector}
+	case 44:
+		return struct {
+			*instrumentedStore
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedKeyInspector
+		}{s, c.slidingWindowRecorder, c.gcraUpdater, c.keyInspector}
+	case 45:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.slidingWindowRecorder, c.gcraUpdater, c.keyInspector}
+	case 46:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedKeyInspector
+		}{s, c.leakyBucketFiller, c.slidingWindowRecorder, c.gcraUpdater, c.keyInspector}
+	case 47:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.slidingWindowRecorder, c.gcraUpdater, c.keyInspector}
+	case 48:
+		return struct {
+			*instrumentedStore
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.scoreKeeper, c.keyInspector}
+	case 49:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.scoreKeeper, c.keyInspector}
+	case 50:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.leakyBucketFiller, c.scoreKeeper, c.keyInspector}
+	case 51:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.scoreKeeper, c.keyInspector}
+	case 52:
+		return struct {
+			*instrumentedStore
+			instrumentedSlidingWindowRecorder
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.slidingWindowRecorder, c.scoreKeeper, c.keyInspector}
+	case 53:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedSlidingWindowRecorder
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.slidingWindowRecorder, c.scoreKeeper, c.keyInspector}
+	case 54:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.leakyBucketFiller, c.slidingWindowRecorder, c.scoreKeeper, c.keyInspector}
+	case 55:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.slidingWindowRecorder, c.scoreKeeper, c.keyInspector}
+	case 56:
+		return struct {
+			*instrumentedStore
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.gcraUpdater, c.scoreKeeper, c.keyInspector}
+	case 57:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.gcraUpdater, c.scoreKeeper, c.keyInspector}
+	case 58:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.leakyBucketFiller, c.gcraUpdater, c.scoreKeeper, c.keyInspector}
+	case 59:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.gcraUpdater, c.scoreKeeper, c.keyInspector}
+	case 60:
+		return struct {
+			*instrumentedStore
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.slidingWindowRecorder, c.gcraUpdater, c.scoreKeeper, c.keyInspector}
+	case 61:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.slidingWindowRecorder, c.gcraUpdater, c.scoreKeeper, c.keyInspector}
+	case 62:
+		return struct {
+			*instrumentedStore
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.leakyBucketFiller, c.slidingWindowRecorder, c.gcraUpdater, c.scoreKeeper, c.keyInspector}
+	case 63:
+		return struct {
+			*instrumentedStore
+			instrumentedTokenBucketTaker
+			instrumentedLeakyBucketFiller
+			instrumentedSlidingWindowRecorder
+			instrumentedGCRAUpdater
+			instrumentedScoreKeeper
+			instrumentedKeyInspector
+		}{s, c.tokenBucketTaker, c.leakyBucketFiller, c.slidingWindowRecorder, c.gcraUpdater, c.scoreKeeper, c.keyInspector}
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInstrument(t *testing.T) {
+	var ops []Operation
+	s := Instrument(NewMemoryStore(), func(_ context.Context, op Operation) {
+		op.Duration = 0
+		ops = append(ops, op)
+	})
+
+	s.Increment("a", 1, time.Minute)
+	s.(TokenBucketTaker).TakeTokens(context.Background(), "b", TakeTokensRequest{Capacity: 1, RefillRate: 1, Tokens: 1})
+	s.Close()
+	_, err := s.GetCounterContext(context.Background(), "a")
+
+	expected := []Operation{
+		{Method: "Increment", Key: "a"},
+		{Method: "TakeTokens", Key: "b"},
+		{Method: "Close"},
+		{Method: "GetCounter", Key: "a", Err: err},
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, ops)
+	}
+	if !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed, got %v", err)
+	}
+}
+
+func TestInstrument_OptionalInterfaces(t *testing.T) {
+	hook := func(context.Context, Operation) {}
+
+	s := Instrument(NewMemoryStore(), hook)
+	if _, ok := s.(GCRAUpdater); !ok {
+		t.Error("Expected the optional interfaces of MemoryStore to be kept")
+	}
+	if _, ok := s.(ScoreKeeper); !ok {
+		t.Error("Expected the ScoreKeeper interface of MemoryStore to be kept")
+	}
+
+	// Only the methods of Store are promoted
+	s = Instrument(struct{ Store }{NewMemoryStore()}, hook)
+	if _, ok := s.(TokenBucketTaker); ok {
+		t.Error("Expected a store without the optional interfaces not to gain them")
+	}
+}
+
+// partialStore implements only some of the optional store interfaces.
+type partialStore struct {
+	Store
+	TokenBucketTaker
+	GCRAUpdater
+}
+
+func TestInstrument_PartialStore(t *testing.T) {
+	memory := NewMemoryStore()
+	var ops []Operation
+	s := Instrument(partialStore{memory, memory, memory}, func(_ context.Context, op Operation) {
+		op.Duration = 0
+		ops = append(ops, op)
+	})
+
+	taker, ok := s.(TokenBucketTaker)
+	if !ok {
+		t.Fatal("Expected the TokenBucketTaker interface of the store to be kept")
+	}
+	updater, ok := s.(GCRAUpdater)
+	if !ok {
+		t.Fatal("Expected the GCRAUpdater interface of the store to be kept")
+	}
+	if _, ok := s.(LeakyBucketFiller); ok {
+		t.Error("Expected the store not to gain LeakyBucketFiller")
+	}
+	if _, ok := s.(ScoreKeeper); ok {
+		t.Error("Expected the store not to gain ScoreKeeper")
+	}
+	if _, ok := s.(KeyInspector); ok {
+		t.Error("Expected the store not to gain KeyInspector")
+	}
+
+	ctx := context.Background()
+	taker.TakeTokens(ctx, "a", TakeTokensRequest{Capacity: 1, RefillRate: 1, Tokens: 1})
+	updater.UpdateGCRA(ctx, "b", UpdateGCRARequest{Increment: time.Second, Tolerance: time.Second, Now: time.Now().UnixNano()})
+
+	expected := []Operation{
+		{Method: "TakeTokens", Key: "a"},
+		{Method: "UpdateGCRA", Key: "b"},
+	}
+	if !reflect.DeepEqual(ops, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, ops)
+	}
+}
@@ -1,17 +1,40 @@
 package store
 
 import (
+	"context"
+	"math"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/neelp03/throttlex/clock"
 )
 
 // MemoryStore is an in-memory implementation of the Store interface.
+// Its Context methods fail with the context's error if it is done before they run, and
+// all its methods fail with ErrClosed once it is closed.
 type MemoryStore struct {
 	mu             sync.Mutex
 	counters       map[string]*memoryCounter
 	slidingWindows map[string][]int64
 	tokenBuckets   map[string]*TokenBucketState
 	leakyBuckets   map[string]*LeakyBucketState
+	tats           map[string]int64
+	scoreSets      map[string]map[string]float64
+	expirations    map[entryID]*memoryExpiration // Pending deletions, at most one per entry
+	closed         bool                          // Set by Close
+	clock          clock.Clock                   // Source of time for expirations; the real clock if nil
+}
+
+// MemoryStoreOption configures optional behavior of a MemoryStore.
+type MemoryStoreOption func(*MemoryStore)
+
+// WithClock makes the store expire entries with c instead of the real clock. A nil clock
+// selects the real clock.
+func WithClock(c clock.Clock) MemoryStoreOption {
+	return func(s *MemoryStore) {
+		s.clock = c
+	}
 }
 
 type memoryCounter struct {
@@ -19,72 +42,249 @@ type memoryCounter struct {
 	expiration time.Time
 }
 
+// entryKind identifies the map of a MemoryStore an entry is kept in.
+type entryKind int
+
+const (
+	counterEntry entryKind = iota
+	slidingWindowEntry
+	tokenBucketEntry
+	leakyBucketEntry
+	tatEntry
+	scoreSetEntry
+)
+
+// entryID identifies an entry of a MemoryStore.
+type entryID struct {
+	kind entryKind
+	key  string
+}
+
+// memoryExpiration is the scheduled deletion of an entry.
+type memoryExpiration struct {
+	timer    clock.Timer // Fires at or after the deadline
+	deadline time.Time   // When the entry expires
+}
+
 // NewMemoryStore initializes a new MemoryStore.
-func NewMemoryStore() *MemoryStore {
-	return &MemoryStore{
+func NewMemoryStore(opts ...MemoryStoreOption) *MemoryStore {
+	s := &MemoryStore{
 		counters:       make(map[string]*memoryCounter),
 		slidingWindows: make(map[string][]int64),
 		tokenBuckets:   make(map[string]*TokenBucketState),
 		leakyBuckets:   make(map[string]*LeakyBucketState),
+		tats:           make(map[string]int64),
+		scoreSets:      make(map[string]map[string]float64),
+		expirations:    make(map[entryID]*memoryExpiration),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-// Increment increments the counter by delta and sets expiration.
-func (s *MemoryStore) Increment(key string, delta int64, expiration time.Duration) (int64, error) {
+// getClock returns the clock of the store.
+func (s *MemoryStore) getClock() clock.Clock {
+	if s.clock == nil {
+		return clock.New()
+	}
+	return s.clock
+}
+
+// lock fails with the error of ctx if it is done, and otherwise acquires s.mu, failing with
+// ErrClosed if the store is closed. The caller releases s.mu if lock succeeds.
+func (s *MemoryStore) lock(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	return nil
+}
+
+// expireAfter schedules the entry to be deleted after expiration, replacing any earlier
+// schedule, so that an entry written over and over holds a single timer. The caller holds s.mu.
+func (s *MemoryStore) expireAfter(id entryID, expiration time.Duration) {
+	deadline := s.getClock().Now().Add(expiration)
+	if e, ok := s.expirations[id]; ok {
+		e.deadline = deadline
+		e.timer.Reset(expiration)
+		return
+	}
+
+	e := &memoryExpiration{deadline: deadline}
+	e.timer = s.getClock().AfterFunc(expiration, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.expirations[id] != e || s.getClock().Now().Before(e.deadline) {
+			// Rescheduled while the timer was firing
+			return
+		}
+		delete(s.expirations, id)
+		s.deleteEntry(id)
+	})
+	s.expirations[id] = e
+}
+
+// extendExpiration schedules the entry to be deleted after expiration unless it is already
+// scheduled to be deleted later, so that its expiration is never shortened. The caller
+// holds s.mu.
+func (s *MemoryStore) extendExpiration(id entryID, expiration time.Duration) {
+	if e, ok := s.expirations[id]; ok && !e.deadline.Before(s.getClock().Now().Add(expiration)) {
+		return
+	}
+	s.expireAfter(id, expiration)
+}
+
+// removeEntry deletes the entry and cancels its expiration. The caller holds s.mu.
+func (s *MemoryStore) removeEntry(id entryID) {
+	if e, ok := s.expirations[id]; ok {
+		e.timer.Stop()
+		delete(s.expirations, id)
+	}
+	s.deleteEntry(id)
+}
+
+// deleteEntry deletes the entry. The caller holds s.mu.
+func (s *MemoryStore) deleteEntry(id entryID) {
+	switch id.kind {
+	case counterEntry:
+		delete(s.counters, id.key)
+	case slidingWindowEntry:
+		delete(s.slidingWindows, id.key)
+	case tokenBucketEntry:
+		delete(s.tokenBuckets, id.key)
+	case leakyBucketEntry:
+		delete(s.leakyBuckets, id.key)
+	case tatEntry:
+		delete(s.tats, id.key)
+	case scoreSetEntry:
+		delete(s.scoreSets, id.key)
+	}
+}
+
+// Len returns the number of entries in the store, counting each key once per kind of
+// state it holds. It is zero once the store is closed.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.counters) + len(s.slidingWindows) + len(s.tokenBuckets) + len(s.leakyBuckets) + len(s.tats) + len(s.scoreSets)
+}
+
+// Close stops the expiration timers and drops every entry. Later calls fail with ErrClosed.
+// Closing a closed store does nothing.
+func (s *MemoryStore) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	for _, e := range s.expirations {
+		e.timer.Stop()
+	}
+	s.counters = make(map[string]*memoryCounter)
+	s.slidingWindows = make(map[string][]int64)
+	s.tokenBuckets = make(map[string]*TokenBucketState)
+	s.leakyBuckets = make(map[string]*LeakyBucketState)
+	s.tats = make(map[string]int64)
+	s.scoreSets = make(map[string]map[string]float64)
+	s.expirations = make(map[entryID]*memoryExpiration)
+	return nil
+}
+
+// Increment is like IncrementContext with a background context.
+func (s *MemoryStore) Increment(key string, delta int64, expiration time.Duration) (int64, error) {
+	return s.IncrementContext(context.Background(), key, delta, expiration)
+}
+
+// IncrementContext increments the counter by delta and sets expiration.
+func (s *MemoryStore) IncrementContext(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
 
 	counter, exists := s.counters[key]
-	if !exists || time.Now().After(counter.expiration) {
+	if !exists || s.getClock().Now().After(counter.expiration) {
 		counter = &memoryCounter{
 			count:      delta,
-			expiration: time.Now().Add(expiration),
+			expiration: s.getClock().Now().Add(expiration),
 		}
 		s.counters[key] = counter
+		s.expireAfter(entryID{counterEntry, key}, expiration)
 	} else {
 		counter.count += delta
 	}
+	if counter.count < 0 {
+		// Counters never go below zero, matching RedisStore
+		counter.count = 0
+	}
 	return counter.count, nil
 }
 
-// GetCounter retrieves the current value of the counter.
+// GetCounter is like GetCounterContext with a background context.
 func (s *MemoryStore) GetCounter(key string) (int64, error) {
-	s.mu.Lock()
+	return s.GetCounterContext(context.Background(), key)
+}
+
+// GetCounterContext retrieves the current value of the counter.
+func (s *MemoryStore) GetCounterContext(ctx context.Context, key string) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
 	defer s.mu.Unlock()
 
 	counter, exists := s.counters[key]
-	if !exists || time.Now().After(counter.expiration) {
+	if !exists || s.getClock().Now().After(counter.expiration) {
 		return 0, nil
 	}
 	return counter.count, nil
 }
 
-// AddTimestamp adds a timestamp with expiration to the sliding window list for a given key.
+// AddTimestamp is like AddTimestampContext with a background context.
 func (s *MemoryStore) AddTimestamp(key string, timestamp int64, expiration time.Duration) error {
-	return s.addTimestampWithCleanup(key, timestamp, expiration, false)
+	return s.AddTimestampContext(context.Background(), key, timestamp, expiration)
+}
+
+// AddTimestampContext adds a timestamp to the sliding window list for a given key, and
+// extends, but never shortens, the expiration of the list.
+func (s *MemoryStore) AddTimestampContext(ctx context.Context, key string, timestamp int64, expiration time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.addTimestampWithCleanup(key, timestamp, expiration, true)
 }
 
 // addTimestampWithCleanup adds a timestamp and, if requested, sets up cleanup after expiration.
 func (s *MemoryStore) addTimestampWithCleanup(key string, timestamp int64, expiration time.Duration, cleanup bool) error {
-	s.mu.Lock()
+	if err := s.lock(context.Background()); err != nil {
+		return err
+	}
 	defer s.mu.Unlock()
 
 	s.slidingWindows[key] = append(s.slidingWindows[key], timestamp)
 
 	if cleanup {
-		go func() {
-			time.Sleep(expiration)
-			s.mu.Lock()
-			defer s.mu.Unlock()
-			delete(s.slidingWindows, key)
-		}()
+		s.extendExpiration(entryID{slidingWindowEntry, key}, expiration)
 	}
 	return nil
 }
 
-// CountTimestamps counts timestamps in a given range [start, end].
+// CountTimestamps is like CountTimestampsContext with a background context.
 func (s *MemoryStore) CountTimestamps(key string, start int64, end int64) (int64, error) {
-	s.mu.Lock()
+	return s.CountTimestampsContext(context.Background(), key, start, end)
+}
+
+// CountTimestampsContext counts timestamps in a given range [start, end].
+func (s *MemoryStore) CountTimestampsContext(ctx context.Context, key string, start int64, end int64) (int64, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, err
+	}
 	defer s.mu.Unlock()
 
 	timestamps, exists := s.slidingWindows[key]
@@ -101,9 +301,112 @@ func (s *MemoryStore) CountTimestamps(key string, start int64, end int64) (int64
 	return count, nil
 }
 
-// GetTokenBucket retrieves the token bucket state.
+// TimestampAt is like TimestampAtContext with a background context.
+func (s *MemoryStore) TimestampAt(key string, start int64, rank int64) (int64, bool, error) {
+	return s.TimestampAtContext(context.Background(), key, start, rank)
+}
+
+// TimestampAtContext returns the timestamp at the given rank among the timestamps not older than start.
+func (s *MemoryStore) TimestampAtContext(ctx context.Context, key string, start int64, rank int64) (int64, bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, false, err
+	}
+	defer s.mu.Unlock()
+
+	var inRange []int64
+	for _, ts := range s.slidingWindows[key] {
+		if ts >= start {
+			inRange = append(inRange, ts)
+		}
+	}
+	if rank < 0 || rank >= int64(len(inRange)) {
+		return 0, false, nil
+	}
+
+	sort.Slice(inRange, func(i, j int) bool { return inRange[i] < inRange[j] })
+	return inRange[rank], true, nil
+}
+
+// RemoveTimestamp is like RemoveTimestampContext with a background context.
+func (s *MemoryStore) RemoveTimestamp(key string, timestamp int64) error {
+	return s.RemoveTimestampContext(context.Background(), key, timestamp)
+}
+
+// RemoveTimestampContext removes one occurrence of a timestamp from the sliding window list for a given key.
+func (s *MemoryStore) RemoveTimestampContext(ctx context.Context, key string, timestamp int64) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	timestamps := s.slidingWindows[key]
+	for i, ts := range timestamps {
+		if ts == timestamp {
+			s.slidingWindows[key] = append(timestamps[:i], timestamps[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// RecordTimestamps counts the entries of the sliding window and records new ones while
+// holding the store lock. The window expires once the recorded entries have left it.
+func (s *MemoryStore) RecordTimestamps(ctx context.Context, key string, req RecordTimestampsRequest) (*RecordTimestampsResult, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	// Drop entries that have left the window
+	windowStart := req.Now - req.Window.Nanoseconds()
+	var timestamps []int64
+	for _, ts := range s.slidingWindows[key] {
+		if ts >= windowStart {
+			timestamps = append(timestamps, ts)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+
+	result := &RecordTimestampsResult{Count: int64(len(timestamps)), At: req.Now}
+	if result.Count > 0 {
+		result.Newest = timestamps[result.Count-1]
+	}
+	if overflow := result.Count + req.Count - req.Limit; overflow > 0 {
+		// The entries fit once enough of the oldest ones leave the window; entries exactly
+		// a window old are still counted
+		result.At = timestamps[overflow-1] + req.Window.Nanoseconds() + 1
+	}
+
+	id := entryID{slidingWindowEntry, key}
+	if wait := time.Duration(result.At - req.Now); wait <= req.MaxDelay {
+		for i := int64(0); i < req.Count; i++ {
+			timestamps = append(timestamps, result.At-i)
+			result.Timestamps = append(result.Timestamps, result.At-i)
+		}
+		result.Recorded = true
+		s.extendExpiration(id, req.Window+wait)
+	}
+	if len(timestamps) == 0 {
+		s.removeEntry(id)
+		return result, nil
+	}
+	s.slidingWindows[key] = timestamps
+	return result, nil
+}
+
+// GetTokenBucket is like GetTokenBucketContext with a background context.
 func (s *MemoryStore) GetTokenBucket(key string) (*TokenBucketState, error) {
-	s.mu.Lock()
+	return s.GetTokenBucketContext(context.Background(), key)
+}
+
+// GetTokenBucketContext retrieves the token bucket state.
+func (s *MemoryStore) GetTokenBucketContext(ctx context.Context, key string) (*TokenBucketState, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
 	defer s.mu.Unlock()
 
 	state, exists := s.tokenBuckets[key]
@@ -113,24 +416,55 @@ func (s *MemoryStore) GetTokenBucket(key string) (*TokenBucketState, error) {
 	return state, nil
 }
 
-// SetTokenBucket sets the token bucket state and expiration.
+// SetTokenBucket is like SetTokenBucketContext with a background context.
 func (s *MemoryStore) SetTokenBucket(key string, state *TokenBucketState, expiration time.Duration) error {
-	s.mu.Lock()
+	return s.SetTokenBucketContext(context.Background(), key, state, expiration)
+}
+
+// SetTokenBucketContext sets the token bucket state and expiration.
+func (s *MemoryStore) SetTokenBucketContext(ctx context.Context, key string, state *TokenBucketState, expiration time.Duration) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
 	defer s.mu.Unlock()
 
 	s.tokenBuckets[key] = state
-	go func() {
-		time.Sleep(expiration)
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		delete(s.tokenBuckets, key)
-	}()
+	s.expireAfter(entryID{tokenBucketEntry, key}, expiration)
 	return nil
 }
 
-// GetLeakyBucket retrieves the leaky bucket state.
+// TakeTokens refills the token bucket and takes tokens from it while holding the store lock.
+func (s *MemoryStore) TakeTokens(ctx context.Context, key string, req TakeTokensRequest) (*TokenBucketState, bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, false, err
+	}
+	defer s.mu.Unlock()
+
+	tokens := req.refill(s.tokenBuckets[key])
+	taken := false
+	if (req.Tokens-tokens)/req.RefillRate <= req.MaxDelay.Seconds() {
+		tokens = math.Min(tokens-req.Tokens, req.Capacity)
+		taken = true
+	}
+
+	s.tokenBuckets[key] = &TokenBucketState{
+		Tokens:         tokens,
+		LastUpdateTime: req.Now,
+	}
+	s.expireAfter(entryID{tokenBucketEntry, key}, req.Expiration)
+	return &TokenBucketState{Tokens: tokens, LastUpdateTime: req.Now}, taken, nil
+}
+
+// GetLeakyBucket is like GetLeakyBucketContext with a background context.
 func (s *MemoryStore) GetLeakyBucket(key string) (*LeakyBucketState, error) {
-	s.mu.Lock()
+	return s.GetLeakyBucketContext(context.Background(), key)
+}
+
+// GetLeakyBucketContext retrieves the leaky bucket state.
+func (s *MemoryStore) GetLeakyBucketContext(ctx context.Context, key string) (*LeakyBucketState, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
 	defer s.mu.Unlock()
 
 	state, exists := s.leakyBuckets[key]
@@ -140,17 +474,190 @@ func (s *MemoryStore) GetLeakyBucket(key string) (*LeakyBucketState, error) {
 	return state, nil
 }
 
-// SetLeakyBucket sets the leaky bucket state and expiration.
+// FillLeakyBucket leaks the bucket and adds to its queue while holding the store lock.
+func (s *MemoryStore) FillLeakyBucket(ctx context.Context, key string, req FillLeakyBucketRequest) (*LeakyBucketState, bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, false, err
+	}
+	defer s.mu.Unlock()
+
+	state := req.leak(s.leakyBuckets[key])
+	added := false
+	if req.wait(state) <= req.MaxDelay {
+		state.Queue = max(state.Queue+req.Units, 0)
+		added = true
+	}
+
+	stored := state
+	s.leakyBuckets[key] = &stored
+	s.expireAfter(entryID{leakyBucketEntry, key}, req.Expiration)
+	return &state, added, nil
+}
+
+// SetLeakyBucket is like SetLeakyBucketContext with a background context.
 func (s *MemoryStore) SetLeakyBucket(key string, state *LeakyBucketState, expiration time.Duration) error {
-	s.mu.Lock()
+	return s.SetLeakyBucketContext(context.Background(), key, state, expiration)
+}
+
+// SetLeakyBucketContext sets the leaky bucket state and expiration.
+func (s *MemoryStore) SetLeakyBucketContext(ctx context.Context, key string, state *LeakyBucketState, expiration time.Duration) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
 	defer s.mu.Unlock()
 
 	s.leakyBuckets[key] = state
-	go func() {
-		time.Sleep(expiration)
-		s.mu.Lock()
-		defer s.mu.Unlock()
-		delete(s.leakyBuckets, key)
-	}()
+	s.expireAfter(entryID{leakyBucketEntry, key}, expiration)
+	return nil
+}
+
+// UpdateGCRA advances the theoretical arrival time while holding the store lock.
+func (s *MemoryStore) UpdateGCRA(ctx context.Context, key string, req UpdateGCRARequest) (int64, bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, false, err
+	}
+	defer s.mu.Unlock()
+
+	tat := max(s.tats[key], req.Now)
+	newTAT := tat + req.Increment.Nanoseconds()
+	if time.Duration(newTAT-req.Now)-req.Tolerance > req.MaxDelay {
+		return tat, false, nil
+	}
+
+	if newTAT <= req.Now {
+		delete(s.tats, key)
+	} else {
+		// The TAT is no longer needed once it is in the past
+		s.tats[key] = newTAT
+		s.expireAfter(entryID{tatEntry, key}, time.Duration(newTAT-req.Now))
+	}
+	return newTAT, true, nil
+}
+
+// AddScores adds the scores to the members of the set while holding the store lock.
+func (s *MemoryStore) AddScores(ctx context.Context, key string, scores map[string]float64, maxMembers int, expiration time.Duration) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	set, exists := s.scoreSets[key]
+	if !exists {
+		set = make(map[string]float64, len(scores))
+		s.scoreSets[key] = set
+	}
+	for member, score := range scores {
+		set[member] += score
+	}
+	if len(set) > maxMembers {
+		kept := make(map[string]float64, maxMembers)
+		for _, score := range topScores(set, maxMembers) {
+			kept[score.Member] = score.Score
+		}
+		s.scoreSets[key] = kept
+	}
+	s.expireAfter(entryID{scoreSetEntry, key}, expiration)
+	return nil
+}
+
+// TopScores returns the members with the highest total score over the sets.
+func (s *MemoryStore) TopScores(ctx context.Context, keys []string, n int) ([]Score, error) {
+	if err := s.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+
+	totals := make(map[string]float64)
+	for _, key := range keys {
+		for member, score := range s.scoreSets[key] {
+			totals[member] += score
+		}
+	}
+	return topScores(totals, n), nil
+}
+
+// entryKinds lists the kinds of entries of a MemoryStore.
+var entryKinds = []entryKind{counterEntry, slidingWindowEntry, tokenBucketEntry, leakyBucketEntry, tatEntry, scoreSetEntry}
+
+// Delete removes the entries of every kind held under the keys.
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	if err := s.lock(ctx); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+
+	for _, key := range keys {
+		for _, kind := range entryKinds {
+			s.removeEntry(entryID{kind, key})
+		}
+	}
 	return nil
 }
+
+// TTL returns the time left before the entry held under key expires. If the key holds
+// entries of several kinds, the longest lived one is reported.
+func (s *MemoryStore) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, false, err
+	}
+	defer s.mu.Unlock()
+
+	now := s.getClock().Now()
+	var ttl time.Duration
+	exists := false
+	for _, kind := range entryKinds {
+		if !s.hasEntry(kind, key, now) {
+			continue
+		}
+		e, ok := s.expirations[entryID{kind, key}]
+		if !ok {
+			// The entry never expires
+			return 0, true, nil
+		}
+		if left := e.deadline.Sub(now); left > 0 {
+			exists = true
+			ttl = max(ttl, left)
+		}
+	}
+	return ttl, exists, nil
+}
+
+// hasEntry reports whether the store holds an entry of the kind under key that has not
+// expired at now. The caller holds s.mu.
+func (s *MemoryStore) hasEntry(kind entryKind, key string, now time.Time) bool {
+	switch kind {
+	case counterEntry:
+		counter, ok := s.counters[key]
+		return ok && !now.After(counter.expiration)
+	case slidingWindowEntry:
+		_, ok := s.slidingWindows[key]
+		return ok
+	case tokenBucketEntry:
+		_, ok := s.tokenBuckets[key]
+		return ok
+	case leakyBucketEntry:
+		_, ok := s.leakyBuckets[key]
+		return ok
+	case tatEntry:
+		_, ok := s.tats[key]
+		return ok
+	case scoreSetEntry:
+		_, ok := s.scoreSets[key]
+		return ok
+	}
+	return false
+}
+
+// GetGCRA returns the theoretical arrival time stored by UpdateGCRA.
+func (s *MemoryStore) GetGCRA(ctx context.Context, key string) (int64, bool, error) {
+	if err := s.lock(ctx); err != nil {
+		return 0, false, err
+	}
+	defer s.mu.Unlock()
+
+	tat, ok := s.tats[key]
+	if !ok || tat <= s.getClock().Now().UnixNano() {
+		return 0, false, nil
+	}
+	return tat, true, nil
+}
@@ -1,8 +1,14 @@
 package store
 
 import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/neelp03/throttlex/clock"
 )
 
 func TestMemoryStore_Increment(t *testing.T) {
@@ -93,6 +99,58 @@ func TestMemoryStore_CountTimestamps(t *testing.T) {
 	}
 }
 
+func TestMemoryStore_TimestampAt(t *testing.T) {
+	memStore := NewMemoryStore()
+	key := "test_key"
+	start := time.Now().UnixNano()
+	expiration := time.Minute
+
+	// Add timestamps out of order
+	_ = memStore.AddTimestamp(key, start+30, expiration)
+	_ = memStore.AddTimestamp(key, start+10, expiration)
+	_ = memStore.AddTimestamp(key, start+20, expiration)
+
+	// Ranks are counted oldest first from the start of the range
+	ts, ok, err := memStore.TimestampAt(key, start+15, 0)
+	if err != nil {
+		t.Fatalf("TimestampAt failed: %v", err)
+	}
+	if !ok || ts != start+20 {
+		t.Errorf("Expected timestamp %d, got %d (ok=%v)", start+20, ts, ok)
+	}
+
+	// Out of range rank
+	_, ok, err = memStore.TimestampAt(key, start, 3)
+	if err != nil {
+		t.Fatalf("TimestampAt failed: %v", err)
+	}
+	if ok {
+		t.Error("Expected no timestamp for out of range rank")
+	}
+}
+
+func TestMemoryStore_RemoveTimestamp(t *testing.T) {
+	memStore := NewMemoryStore()
+	key := "test_key"
+	timestamp := time.Now().UnixNano()
+	expiration := time.Minute
+
+	// Add the same timestamp twice and remove it once
+	_ = memStore.AddTimestamp(key, timestamp, expiration)
+	_ = memStore.AddTimestamp(key, timestamp, expiration)
+	if err := memStore.RemoveTimestamp(key, timestamp); err != nil {
+		t.Fatalf("RemoveTimestamp failed: %v", err)
+	}
+
+	count, err := memStore.CountTimestamps(key, timestamp, timestamp)
+	if err != nil {
+		t.Fatalf("CountTimestamps failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected count 1, got %d", count)
+	}
+}
+
 func TestMemoryStore_TokenBucket(t *testing.T) {
 	memStore := NewMemoryStore()
 	key := "test_token_bucket"
@@ -125,6 +183,189 @@ func TestMemoryStore_TokenBucket(t *testing.T) {
 	}
 }
 
+func TestMemoryStore_TakeTokens(t *testing.T) {
+	memStore := NewMemoryStore()
+	key := "test_take_tokens"
+	now := time.Now().UnixNano()
+	req := TakeTokensRequest{Capacity: 5, RefillRate: 1, Tokens: 3, Now: now, Expiration: time.Minute}
+
+	// A new bucket starts full
+	state, taken, err := memStore.TakeTokens(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("TakeTokens failed: %v", err)
+	}
+	if !taken || state.Tokens != 2 {
+		t.Errorf("Expected 3 tokens taken leaving 2, got taken=%v tokens=%v", taken, state.Tokens)
+	}
+
+	// Not enough tokens and no delay allowed
+	state, taken, err = memStore.TakeTokens(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("TakeTokens failed: %v", err)
+	}
+	if taken || state.Tokens != 2 {
+		t.Errorf("Expected nothing taken leaving 2, got taken=%v tokens=%v", taken, state.Tokens)
+	}
+
+	// Borrowing is allowed within the maximum delay
+	req.MaxDelay = time.Second
+	state, taken, err = memStore.TakeTokens(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("TakeTokens failed: %v", err)
+	}
+	if !taken || state.Tokens != -1 {
+		t.Errorf("Expected 3 tokens borrowed leaving -1, got taken=%v tokens=%v", taken, state.Tokens)
+	}
+
+	// Tokens refill with time and are capped at capacity when put back
+	req.Tokens = -3
+	req.Now = now + 2*time.Second.Nanoseconds()
+	state, _, err = memStore.TakeTokens(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("TakeTokens failed: %v", err)
+	}
+	if state.Tokens != 4 {
+		t.Errorf("Expected 4 tokens, got %v", state.Tokens)
+	}
+	req.Now += 2 * time.Second.Nanoseconds()
+	state, _, err = memStore.TakeTokens(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("TakeTokens failed: %v", err)
+	}
+	if state.Tokens != 5 {
+		t.Errorf("Expected tokens capped at 5, got %v", state.Tokens)
+	}
+}
+
+func TestMemoryStore_RecordTimestamps(t *testing.T) {
+	memStore := NewMemoryStore()
+	key := "test_record_timestamps"
+	now := time.Now().UnixNano()
+	req := RecordTimestampsRequest{Limit: 3, Window: time.Second, Count: 2, Now: now}
+
+	result, err := memStore.RecordTimestamps(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	if !result.Recorded || result.Count != 0 || result.At != now {
+		t.Errorf("Expected entries recorded now in an empty window, got %+v", result)
+	}
+	if len(result.Timestamps) != 2 || result.Timestamps[0] != now || result.Timestamps[1] != now-1 {
+		t.Errorf("Expected timestamps now and now-1, got %v", result.Timestamps)
+	}
+
+	// Only one more entry fits; the second waits for the oldest entry to leave the window
+	result, err = memStore.RecordTimestamps(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	if result.Recorded || result.Count != 2 || result.Newest != now {
+		t.Errorf("Expected nothing recorded with 2 entries, got %+v", result)
+	}
+	if want := now - 1 + time.Second.Nanoseconds() + 1; result.At != want {
+		t.Errorf("Expected entries to fit at %d, got %d", want, result.At)
+	}
+
+	// Entries that have left the window are dropped
+	req.Now = now + 2*time.Second.Nanoseconds()
+	result, err = memStore.RecordTimestamps(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	if !result.Recorded || result.Count != 0 {
+		t.Errorf("Expected entries recorded in an expired window, got %+v", result)
+	}
+	count, err := memStore.CountTimestamps(key, 0, req.Now)
+	if err != nil {
+		t.Fatalf("CountTimestamps failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 entries stored, got %d", count)
+	}
+}
+
+func TestMemoryStore_FillLeakyBucket(t *testing.T) {
+	memStore := NewMemoryStore()
+	key := "test_fill_leaky_bucket"
+	now := time.Now()
+	req := FillLeakyBucketRequest{Capacity: 3, LeakRate: 1, Units: 2, Now: now, Expiration: time.Minute}
+
+	state, added, err := memStore.FillLeakyBucket(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("FillLeakyBucket failed: %v", err)
+	}
+	if !added || state.Queue != 2 {
+		t.Errorf("Expected 2 units added, got added=%v queue=%d", added, state.Queue)
+	}
+
+	// The bucket is full and no delay is allowed
+	state, added, err = memStore.FillLeakyBucket(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("FillLeakyBucket failed: %v", err)
+	}
+	if added || state.Queue != 2 {
+		t.Errorf("Expected nothing added, got added=%v queue=%d", added, state.Queue)
+	}
+
+	// Overfilling is allowed within the maximum delay
+	req.MaxDelay = time.Second
+	state, added, err = memStore.FillLeakyBucket(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("FillLeakyBucket failed: %v", err)
+	}
+	if !added || state.Queue != 4 {
+		t.Errorf("Expected bucket overfilled to 4, got added=%v queue=%d", added, state.Queue)
+	}
+
+	// Requests leak out with time and removing units never empties the queue below zero
+	req.Units = -3
+	req.Now = now.Add(2 * time.Second)
+	state, _, err = memStore.FillLeakyBucket(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("FillLeakyBucket failed: %v", err)
+	}
+	if state.Queue != 0 || !state.LastLeakTime.Equal(req.Now) {
+		t.Errorf("Expected empty queue last leaked at %v, got %+v", req.Now, state)
+	}
+}
+
+func TestMemoryStore_UpdateGCRA(t *testing.T) {
+	memStore := NewMemoryStore()
+	key := "test_update_gcra"
+	now := time.Now().UnixNano()
+	req := UpdateGCRARequest{Increment: time.Second, Tolerance: 2 * time.Second, Now: now}
+
+	// A missing TAT starts at the current time
+	for i := int64(1); i <= 2; i++ {
+		tat, updated, err := memStore.UpdateGCRA(context.Background(), key, req)
+		if err != nil {
+			t.Fatalf("UpdateGCRA failed: %v", err)
+		}
+		if want := now + i*time.Second.Nanoseconds(); !updated || tat != want {
+			t.Errorf("Expected TAT %d, got updated=%v tat=%d", want, updated, tat)
+		}
+	}
+
+	// Beyond the tolerance without delay the TAT is left unchanged
+	tat, updated, err := memStore.UpdateGCRA(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("UpdateGCRA failed: %v", err)
+	}
+	if want := now + 2*time.Second.Nanoseconds(); updated || tat != want {
+		t.Errorf("Expected unchanged TAT %d, got updated=%v tat=%d", want, updated, tat)
+	}
+
+	// Moving the TAT back to the current time removes the state
+	req.Increment = -3 * time.Second
+	req.MaxDelay = time.Hour
+	if _, _, err := memStore.UpdateGCRA(context.Background(), key, req); err != nil {
+		t.Fatalf("UpdateGCRA failed: %v", err)
+	}
+	if _, exists := memStore.tats[key]; exists {
+		t.Error("Expected TAT in the past to be removed")
+	}
+}
+
 func TestMemoryStore_LeakyBucket(t *testing.T) {
 	memStore := NewMemoryStore()
 	key := "test_leaky_bucket"
@@ -156,3 +397,265 @@ func TestMemoryStore_LeakyBucket(t *testing.T) {
 		t.Errorf("Expected nil state after expiration, got %v", state)
 	}
 }
+
+func TestMemoryStore_ContextCancelled(t *testing.T) {
+	memStore := NewMemoryStore()
+	key := "test_key"
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := memStore.IncrementContext(ctx, key, 1, time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from IncrementContext, got %v", err)
+	}
+	if err := memStore.AddTimestampContext(ctx, key, time.Now().UnixNano(), time.Minute); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from AddTimestampContext, got %v", err)
+	}
+	if _, err := memStore.GetTokenBucketContext(ctx, key); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled from GetTokenBucketContext, got %v", err)
+	}
+
+	// The cancelled increment did not happen
+	count, err := memStore.GetCounter(key)
+	if err != nil {
+		t.Fatalf("GetCounter failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected count 0, got %d", count)
+	}
+}
+
+func TestMemoryStore_WithClock(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := NewMemoryStore(WithClock(fake))
+	expiration := time.Minute
+
+	if _, err := memStore.Increment("counter", 1, expiration); err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+	state := &TokenBucketState{Tokens: 10, LastUpdateTime: fake.Now().UnixNano()}
+	if err := memStore.SetTokenBucket("bucket", state, expiration); err != nil {
+		t.Fatalf("SetTokenBucket failed: %v", err)
+	}
+
+	// Nothing expires until the clock is advanced, however long the test takes
+	fake.Advance(expiration - time.Nanosecond)
+	if count, _ := memStore.GetCounter("counter"); count != 1 {
+		t.Errorf("Expected count 1 before expiration, got %d", count)
+	}
+	if got, _ := memStore.GetTokenBucket("bucket"); got == nil {
+		t.Error("Expected the token bucket to exist before expiration")
+	}
+
+	fake.Advance(time.Second)
+	if count, _ := memStore.GetCounter("counter"); count != 0 {
+		t.Errorf("Expected count 0 after expiration, got %d", count)
+	}
+	if got, _ := memStore.GetTokenBucket("bucket"); got != nil {
+		t.Errorf("Expected nil token bucket after expiration, got %v", got)
+	}
+}
+
+func TestMemoryStore_SlidingWindowExpiration(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := NewMemoryStore(WithClock(fake))
+	ctx := context.Background()
+	now := fake.Now().UnixNano()
+
+	// A shorter expiration does not cut the longer one short
+	if err := memStore.AddTimestamp("added", now, time.Minute); err != nil {
+		t.Fatalf("AddTimestamp failed: %v", err)
+	}
+	if err := memStore.AddTimestamp("added", now, time.Second); err != nil {
+		t.Fatalf("AddTimestamp failed: %v", err)
+	}
+	req := RecordTimestampsRequest{Limit: 1, Window: time.Minute, Count: 1, MaxDelay: 2 * time.Minute, Now: now}
+	if _, err := memStore.RecordTimestamps(ctx, "recorded", req); err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	// The second entry waits a window for the first to leave, so the key lives two windows
+	if _, err := memStore.RecordTimestamps(ctx, "recorded", req); err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	if ttl, exists, _ := memStore.TTL(ctx, "recorded"); !exists || ttl <= time.Minute {
+		t.Errorf("Expected the window to outlive the delayed entry, got %v, %v", ttl, exists)
+	}
+
+	fake.Advance(time.Minute + time.Second)
+	if count, _ := memStore.CountTimestamps("added", 0, math.MaxInt64); count != 0 {
+		t.Errorf("Expected the added window to expire, got %d entries", count)
+	}
+	if count, _ := memStore.CountTimestamps("recorded", 0, math.MaxInt64); count != 2 {
+		t.Errorf("Expected the recorded window to be kept, got %d entries", count)
+	}
+	fake.Advance(time.Minute)
+	if n := memStore.Len(); n != 0 {
+		t.Errorf("Expected no entries left, got %d", n)
+	}
+}
+
+func TestMemoryStore_RecordTimestampsValidation(t *testing.T) {
+	memStore := NewMemoryStore()
+	now := time.Now().UnixNano()
+
+	tests := []RecordTimestampsRequest{
+		{Limit: 2, Window: time.Second, Count: 3, Now: now},
+		{Limit: 2, Window: time.Second, Count: 0, Now: now},
+		{Limit: 0, Window: time.Second, Count: 1, Now: now},
+		{Limit: 2, Window: 0, Count: 1, Now: now},
+	}
+	for _, req := range tests {
+		if _, err := memStore.RecordTimestamps(context.Background(), "key", req); err == nil {
+			t.Errorf("Expected an error for %+v", req)
+		}
+	}
+}
+
+func TestMemoryStore_RewriteKeepsOneExpiration(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	fake := clock.NewFake(start)
+	memStore := NewMemoryStore(WithClock(fake))
+	key := "bucket"
+	expiration := time.Minute
+
+	// Every write pushes the expiration back instead of adding a timer
+	for i := 0; i < 100; i++ {
+		state := &TokenBucketState{Tokens: float64(i), LastUpdateTime: fake.Now().UnixNano()}
+		if err := memStore.SetTokenBucket(key, state, expiration); err != nil {
+			t.Fatalf("SetTokenBucket failed: %v", err)
+		}
+		fake.Advance(time.Second)
+	}
+	if n := len(memStore.expirations); n != 1 {
+		t.Errorf("Expected 1 pending expiration, got %d", n)
+	}
+
+	// The first write's expiration has passed, but the last write's has not
+	fake.Set(start.Add(expiration + 30*time.Second))
+	if state, _ := memStore.GetTokenBucket(key); state == nil || state.Tokens != 99 {
+		t.Fatalf("Expected the last state to survive, got %v", state)
+	}
+
+	fake.Advance(expiration)
+	if state, _ := memStore.GetTokenBucket(key); state != nil {
+		t.Errorf("Expected nil state after expiration, got %v", state)
+	}
+	if n := len(memStore.expirations); n != 0 {
+		t.Errorf("Expected no pending expirations, got %d", n)
+	}
+}
+
+func TestMemoryStore_Close(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := NewMemoryStore(WithClock(fake))
+	if _, err := memStore.Increment("counter", 1, time.Minute); err != nil {
+		t.Fatalf("Increment failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := memStore.Close(); err != nil {
+			t.Fatalf("Close %d failed: %v", i+1, err)
+		}
+	}
+
+	if _, err := memStore.Increment("counter", 1, time.Minute); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Increment, got %v", err)
+	}
+	if _, err := memStore.GetTokenBucket("bucket"); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from GetTokenBucket, got %v", err)
+	}
+	if err := memStore.AddTimestamp("window", 1, time.Minute); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from AddTimestamp, got %v", err)
+	}
+	if _, _, err := memStore.UpdateGCRA(context.Background(), "tat", UpdateGCRARequest{Increment: time.Second}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from UpdateGCRA, got %v", err)
+	}
+
+	// The expiration timers were stopped and nothing fires later
+	fake.Advance(time.Hour)
+	if n := len(memStore.expirations); n != 0 {
+		t.Errorf("Expected no pending expirations, got %d", n)
+	}
+}
+
+func TestMemoryStore_Scores(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := NewMemoryStore(WithClock(fake))
+	ctx := context.Background()
+
+	if err := memStore.AddScores(ctx, "a", map[string]float64{"alice": 3, "bob": 1, "carol": 2}, 2, time.Minute); err != nil {
+		t.Fatalf("AddScores failed: %v", err)
+	}
+	if err := memStore.AddScores(ctx, "b", map[string]float64{"bob": 4, "dave": 2}, 2, 2*time.Minute); err != nil {
+		t.Fatalf("AddScores failed: %v", err)
+	}
+
+	// The lowest score of a, bob's, was trimmed
+	top, err := memStore.TopScores(ctx, []string{"a", "b", "missing"}, 3)
+	if err != nil {
+		t.Fatalf("TopScores failed: %v", err)
+	}
+	expected := []Score{{Member: "bob", Score: 4}, {Member: "alice", Score: 3}, {Member: "carol", Score: 2}}
+	if !reflect.DeepEqual(top, expected) {
+		t.Errorf("Expected %v, got %v", expected, top)
+	}
+
+	fake.Advance(time.Minute)
+	top, err = memStore.TopScores(ctx, []string{"a", "b"}, 3)
+	if err != nil {
+		t.Fatalf("TopScores failed: %v", err)
+	}
+	expected = []Score{{Member: "bob", Score: 4}, {Member: "dave", Score: 2}}
+	if !reflect.DeepEqual(top, expected) {
+		t.Errorf("Expected %v after a expired, got %v", expected, top)
+	}
+}
+
+func TestMemoryStore_KeyInspector(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	memStore := NewMemoryStore(WithClock(fake))
+	ctx := context.Background()
+
+	memStore.Increment("counter", 3, time.Minute)
+	memStore.SetTokenBucket("bucket", &TokenBucketState{Tokens: 1}, 2*time.Minute)
+	memStore.UpdateGCRA(ctx, "tat", UpdateGCRARequest{Increment: time.Second, Tolerance: time.Minute, Now: fake.Now().UnixNano()})
+	memStore.AddTimestamp("window", 1, time.Minute)
+
+	tests := []struct {
+		key    string
+		ttl    time.Duration
+		exists bool
+	}{
+		{key: "counter", ttl: time.Minute, exists: true},
+		{key: "bucket", ttl: 2 * time.Minute, exists: true},
+		{key: "tat", ttl: time.Second, exists: true},
+		{key: "window", ttl: time.Minute, exists: true},
+		{key: "missing", ttl: 0, exists: false},
+	}
+	for _, tt := range tests {
+		ttl, exists, err := memStore.TTL(ctx, tt.key)
+		if err != nil {
+			t.Fatalf("TTL failed: %v", err)
+		}
+		if ttl != tt.ttl || exists != tt.exists {
+			t.Errorf("%s: expected %v, %v, got %v, %v", tt.key, tt.ttl, tt.exists, ttl, exists)
+		}
+	}
+
+	tat, ok, err := memStore.GetGCRA(ctx, "tat")
+	if err != nil {
+		t.Fatalf("GetGCRA failed: %v", err)
+	}
+	if expected := fake.Now().Add(time.Second).UnixNano(); !ok || tat != expected {
+		t.Errorf("Expected TAT %d, got %d, %v", expected, tat, ok)
+	}
+
+	if err := memStore.Delete(ctx, "counter", "bucket", "tat", "window", "missing"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if n := memStore.Len(); n != 0 {
+		t.Errorf("Expected no entries after Delete, got %d", n)
+	}
+	if n := len(memStore.expirations); n != 0 {
+		t.Errorf("Expected no pending expirations after Delete, got %d", n)
+	}
+}
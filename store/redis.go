@@ -4,40 +4,263 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// incrementScript increments a counter, clamping it at zero, and sets its expiration
+// in milliseconds when it is created.
+var incrementScript = redis.NewScript(`
+	local count = redis.call('INCRBY', KEYS[1], ARGV[1])
+	if tonumber(count) < 0 then
+		redis.call('SET', KEYS[1], 0, 'PX', ARGV[2])
+		count = 0
+	end
+	if tonumber(count) == tonumber(ARGV[1]) then
+		redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	end
+	return count
+`)
+
+// addTimestampScript adds a timestamp to a sorted set and extends, but never shortens,
+// its expiration in milliseconds.
+var addTimestampScript = redis.NewScript(`
+	redis.call('ZADD', KEYS[1], ARGV[1], ARGV[1])
+	if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[2]) then
+		redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	end
+	return 1
+`)
+
+// tokenBucketScript refills a token bucket for the elapsed time and takes tokens from it
+// if they are available within the maximum delay, returning the tokens left and whether
+// they were taken. Timestamps are passed and stored as strings to keep their precision,
+// and the elapsed time is computed with the helpers of luaTimestamps.
+var tokenBucketScript = redis.NewScript(luaTimestamps + `
+	local capacity = tonumber(ARGV[1])
+	local refill_rate = tonumber(ARGV[2])
+	local requested = tonumber(ARGV[3])
+	local max_delay = tonumber(ARGV[4])
+	local now = ARGV[5]
+
+	local tokens = capacity
+	local state = redis.call('HMGET', KEYS[1], 'tokens', 'last_update')
+	if state[1] and state[2] then
+		local elapsed = offset(now, state[2]) / 1e9
+		tokens = math.min(tonumber(state[1]) + elapsed * refill_rate, capacity)
+	end
+
+	local taken = 0
+	if (requested - tokens) / refill_rate <= max_delay then
+		tokens = math.min(tokens - requested, capacity)
+		taken = 1
+	end
+
+	local encoded = string.format('%.17g', tokens)
+	redis.call('HSET', KEYS[1], 'tokens', encoded, 'last_update', now)
+	redis.call('PEXPIRE', KEYS[1], ARGV[6])
+	return {encoded, taken}
+`)
+
+// luaTimestamps defines Lua helpers for Unix timestamps in nanoseconds, which are passed
+// and stored as strings because they exceed the integer precision of Lua numbers. They are
+// handled as whole seconds and nanoseconds, so differences and offsets up to about 100
+// days are exact.
+const luaTimestamps = `
+	local function split_timestamp(ts)
+		return tonumber(string.sub(ts, 1, -10)) or 0, tonumber(string.sub(ts, -9))
+	end
+
+	-- offset returns ts - base in nanoseconds
+	local function offset(ts, base)
+		local ts_secs, ts_nanos = split_timestamp(ts)
+		local base_secs, base_nanos = split_timestamp(base)
+		return (ts_secs - base_secs) * 1e9 + (ts_nanos - base_nanos)
+	end
+
+	-- add returns the timestamp delta nanoseconds after ts
+	local function add(ts, delta)
+		local secs, nanos = split_timestamp(ts)
+		nanos = nanos + delta
+		secs = secs + math.floor(nanos / 1e9)
+		nanos = nanos % 1e9
+		if secs == 0 then
+			return string.format('%d', nanos)
+		end
+		return string.format('%d%09d', secs, nanos)
+	end
+`
+
+// leakyBucketScript leaks a leaky bucket for the elapsed time and adds units to its queue
+// if they fit within the maximum delay, returning the queue, the last leak time and whether
+// the units were added.
+var leakyBucketScript = redis.NewScript(luaTimestamps + `
+	local capacity = tonumber(ARGV[1])
+	local leak_rate = tonumber(ARGV[2])
+	local units = tonumber(ARGV[3])
+	local max_delay = tonumber(ARGV[4])
+	local now = ARGV[5]
+
+	local queue = 0
+	local last_leak_time = now
+	local state = redis.call('HMGET', KEYS[1], 'queue', 'last_leak_time')
+	if state[1] and state[2] then
+		queue = tonumber(state[1])
+		last_leak_time = state[2]
+		local leaked = math.floor(offset(now, last_leak_time) / 1e9 * leak_rate)
+		if leaked > 0 then
+			queue = math.max(queue - leaked, 0)
+			last_leak_time = add(last_leak_time, math.ceil(leaked / leak_rate * 1e9))
+		end
+	end
+
+	-- The next leak may be due now but not applied yet
+	local wait = 0
+	local overflow = queue + units - capacity
+	if overflow > 0 then
+		wait = math.max(offset(last_leak_time, now) + math.ceil(overflow / leak_rate * 1e9), 1)
+	end
+
+	local added = 0
+	if wait <= max_delay then
+		queue = math.max(queue + units, 0)
+		added = 1
+	end
+
+	redis.call('HSET', KEYS[1], 'queue', queue, 'last_leak_time', last_leak_time)
+	redis.call('PEXPIRE', KEYS[1], ARGV[6])
+	return {queue, last_leak_time, added}
+`)
+
+// slidingWindowScript drops the entries that have left a sliding window, counts the rest
+// and records new entries at the earliest time they fit if that is within the maximum
+// delay. It returns the count, the newest entry, the time the new entries fit and the
+// recorded timestamps, which are moved earlier if needed to keep them distinct.
+var slidingWindowScript = redis.NewScript(luaTimestamps + `
+	local limit = tonumber(ARGV[1])
+	local window = tonumber(ARGV[2])
+	local entries = tonumber(ARGV[3])
+	local max_delay = tonumber(ARGV[4])
+	local now = ARGV[5]
+	local window_start = ARGV[6]
+
+	redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. window_start)
+	local count = redis.call('ZCOUNT', KEYS[1], window_start, '+inf')
+	local newest = redis.call('ZREVRANGEBYSCORE', KEYS[1], '+inf', window_start, 'LIMIT', 0, 1)[1] or '0'
+
+	-- Entries exactly a window old are still counted
+	local at = now
+	if count + entries > limit then
+		local oldest = redis.call('ZRANGEBYSCORE', KEYS[1], window_start, '+inf', 'LIMIT', count + entries - limit - 1, 1)[1] or now
+		at = add(oldest, window + 1)
+	end
+	local wait = offset(at, now)
+
+	local recorded = {}
+	if wait <= max_delay then
+		local ts = at
+		for i = 1, entries do
+			while redis.call('ZSCORE', KEYS[1], ts) do
+				ts = add(ts, -1)
+			end
+			redis.call('ZADD', KEYS[1], ts, ts)
+			recorded[i] = ts
+			ts = add(ts, -1)
+		end
+		local ttl = math.ceil((window + wait) / 1e6)
+		if redis.call('PTTL', KEYS[1]) < ttl then
+			redis.call('PEXPIRE', KEYS[1], ttl)
+		end
+	end
+	return {count, newest, at, recorded}
+`)
+
+// gcraScript advances the theoretical arrival time of a GCRA limiter if the result is
+// within the tolerance plus the maximum delay, and expires it once it is reached. It
+// returns the TAT and whether it was updated.
+var gcraScript = redis.NewScript(luaTimestamps + `
+	local increment = tonumber(ARGV[1])
+	local tolerance = tonumber(ARGV[2])
+	local max_delay = tonumber(ARGV[3])
+	local now = ARGV[4]
+
+	local tat = redis.call('GET', KEYS[1])
+	if not tat or offset(tat, now) < 0 then
+		tat = now
+	end
+
+	local new_tat = add(tat, increment)
+	local ttl = offset(new_tat, now)
+	if ttl - tolerance > max_delay then
+		return {tat, 0}
+	end
+
+	if ttl > 0 then
+		redis.call('SET', KEYS[1], new_tat, 'PX', math.ceil(ttl / 1e6))
+	else
+		redis.call('DEL', KEYS[1])
+	end
+	return {new_tat, 1}
+`)
+
+// addScoresScript adds scores to the members of a sorted set, keeps only the members with
+// the highest scores and sets its expiration in milliseconds. ARGV holds the number of
+// members to keep, the expiration, then pairs of member and score.
+var addScoresScript = redis.NewScript(`
+	local max_members = tonumber(ARGV[1])
+	for i = 3, #ARGV, 2 do
+		redis.call('ZINCRBY', KEYS[1], ARGV[i + 1], ARGV[i])
+	end
+	local excess = redis.call('ZCARD', KEYS[1]) - max_members
+	if excess > 0 then
+		redis.call('ZREMRANGEBYRANK', KEYS[1], 0, excess - 1)
+	end
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+`)
+
 // RedisStore is a Redis-based implementation of the Store interface.
 type RedisStore struct {
 	client *redis.Client
-	ctx    context.Context
+	closed atomic.Bool // Set by Close
 }
 
 // NewRedisStore creates a new RedisStore with the given Redis client.
 func NewRedisStore(client *redis.Client) *RedisStore {
 	return &RedisStore{
 		client: client,
-		ctx:    context.Background(),
 	}
 }
 
-// Increment increments the counter for the given key by delta in Redis.
+// Close makes later calls fail with ErrClosed. It does not close the Redis client, which
+// belongs to the caller and may be shared with other stores. Closing a closed store does
+// nothing.
+func (r *RedisStore) Close() error {
+	r.closed.Store(true)
+	return nil
+}
+
+// checkOpen returns ErrClosed if the store is closed.
+func (r *RedisStore) checkOpen() error {
+	if r.closed.Load() {
+		return ErrClosed
+	}
+	return nil
+}
+
+// Increment is like IncrementContext with a background context.
 func (r *RedisStore) Increment(key string, delta int64, expiration time.Duration) (int64, error) {
-	script := redis.NewScript(`
-        local count = redis.call('INCRBY', KEYS[1], ARGV[1])
-        if tonumber(count) < 0 then
-            redis.call('SET', KEYS[1], 0)
-            count = 0
-        end
-        if tonumber(count) == tonumber(ARGV[1]) then
-            redis.call('EXPIRE', KEYS[1], ARGV[2])
-        end
-        return count
-    `)
-
-	result, err := script.Run(r.ctx, r.client, []string{key}, delta, int64(expiration.Seconds())).Result()
+	return r.IncrementContext(context.Background(), key, delta, expiration)
+}
+
+// IncrementContext increments the counter for the given key by delta in Redis.
+func (r *RedisStore) IncrementContext(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error) {
+	if err := r.checkOpen(); err != nil {
+		return 0, err
+	}
+	result, err := incrementScript.Run(ctx, r.client, []string{key}, delta, expiration.Milliseconds()).Result()
 	if err != nil {
 		return 0, err
 	}
@@ -48,9 +271,17 @@ func (r *RedisStore) Increment(key string, delta int64, expiration time.Duration
 	return count, nil
 }
 
-// GetCounter retrieves the current value of the counter.
+// GetCounter is like GetCounterContext with a background context.
 func (r *RedisStore) GetCounter(key string) (int64, error) {
-	count, err := r.client.Get(r.ctx, key).Int64()
+	return r.GetCounterContext(context.Background(), key)
+}
+
+// GetCounterContext retrieves the current value of the counter.
+func (r *RedisStore) GetCounterContext(ctx context.Context, key string) (int64, error) {
+	if err := r.checkOpen(); err != nil {
+		return 0, err
+	}
+	count, err := r.client.Get(ctx, key).Int64()
 	if err == redis.Nil {
 		return 0, nil
 	} else if err != nil {
@@ -59,45 +290,161 @@ func (r *RedisStore) GetCounter(key string) (int64, error) {
 	return count, nil
 }
 
-// AddTimestamp adds a timestamp to a sorted set associated with the key.
+// AddTimestamp is like AddTimestampContext with a background context.
 func (r *RedisStore) AddTimestamp(key string, timestamp int64, expiration time.Duration) error {
-	err := r.client.ZAdd(r.ctx, key, &redis.Z{
-		Score:  float64(timestamp),
-		Member: timestamp,
-	}).Err()
-	if err != nil {
+	return r.AddTimestampContext(context.Background(), key, timestamp, expiration)
+}
+
+// AddTimestampContext adds a timestamp to a sorted set associated with the key.
+// The expiration of the key is only ever extended, so that timestamps added
+// with a longer expiration are kept.
+func (r *RedisStore) AddTimestampContext(ctx context.Context, key string, timestamp int64, expiration time.Duration) error {
+	if err := r.checkOpen(); err != nil {
 		return err
 	}
+	return addTimestampScript.Run(ctx, r.client, []string{key}, timestamp, expiration.Milliseconds()).Err()
+}
 
-	// Set the expiration on the key
-	err = r.client.Expire(r.ctx, key, expiration).Err()
-	if err != nil {
+// RemoveTimestamp is like RemoveTimestampContext with a background context.
+func (r *RedisStore) RemoveTimestamp(key string, timestamp int64) error {
+	return r.RemoveTimestampContext(context.Background(), key, timestamp)
+}
+
+// RemoveTimestampContext removes a timestamp from the sorted set associated with the key.
+func (r *RedisStore) RemoveTimestampContext(ctx context.Context, key string, timestamp int64) error {
+	if err := r.checkOpen(); err != nil {
 		return err
 	}
-
-	return nil
+	return r.client.ZRem(ctx, key, timestamp).Err()
 }
 
-// CountTimestamps counts the number of timestamps within the given range [start, end].
+// CountTimestamps is like CountTimestampsContext with a background context.
 func (r *RedisStore) CountTimestamps(key string, start int64, end int64) (int64, error) {
+	return r.CountTimestampsContext(context.Background(), key, start, end)
+}
+
+// CountTimestampsContext counts the number of timestamps within the given range [start, end].
+func (r *RedisStore) CountTimestampsContext(ctx context.Context, key string, start int64, end int64) (int64, error) {
+	if err := r.checkOpen(); err != nil {
+		return 0, err
+	}
 	// Remove timestamps that are older than the start time
-	err := r.client.ZRemRangeByScore(r.ctx, key, "0", fmt.Sprintf("(%d", start)).Err()
+	err := r.client.ZRemRangeByScore(ctx, key, "0", fmt.Sprintf("(%d", start)).Err()
 	if err != nil {
 		return 0, err
 	}
 
 	// Count the number of timestamps within the score range
-	count, err := r.client.ZCount(r.ctx, key, fmt.Sprintf("%d", start), fmt.Sprintf("%d", end)).Result()
+	count, err := r.client.ZCount(ctx, key, fmt.Sprintf("%d", start), fmt.Sprintf("%d", end)).Result()
 	if err != nil {
 		return 0, err
 	}
 	return count, nil
 }
 
-// GetTokenBucket retrieves the current state of the token bucket.
+// TimestampAt is like TimestampAtContext with a background context.
+func (r *RedisStore) TimestampAt(key string, start int64, rank int64) (int64, bool, error) {
+	return r.TimestampAtContext(context.Background(), key, start, rank)
+}
+
+// TimestampAtContext returns the timestamp at the given rank among the timestamps not older than start.
+func (r *RedisStore) TimestampAtContext(ctx context.Context, key string, start int64, rank int64) (int64, bool, error) {
+	if err := r.checkOpen(); err != nil {
+		return 0, false, err
+	}
+	if rank < 0 {
+		return 0, false, nil
+	}
+
+	// Scores are the timestamps themselves, so ordering by score orders oldest first
+	result, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:    fmt.Sprintf("%d", start),
+		Max:    "+inf",
+		Offset: rank,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	if len(result) == 0 {
+		return 0, false, nil
+	}
+
+	// Members hold the exact timestamp, which scores lose to floating point precision
+	timestamp, err := strconv.ParseInt(result[0], 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return timestamp, true, nil
+}
+
+// RecordTimestamps counts the entries of the sliding window and records new ones in a
+// single Lua script, so that concurrent callers sharing the window cannot over-admit.
+func (r *RedisStore) RecordTimestamps(ctx context.Context, key string, req RecordTimestampsRequest) (*RecordTimestampsResult, error) {
+	if err := r.checkOpen(); err != nil {
+		return nil, err
+	}
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	windowStart := req.Now - req.Window.Nanoseconds()
+	result, err := slidingWindowScript.Run(ctx, r.client, []string{key},
+		req.Limit, req.Window.Nanoseconds(), req.Count, req.MaxDelay.Nanoseconds(), req.Now, windowStart).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 4 {
+		return nil, fmt.Errorf("unexpected result type: %T", result)
+	}
+	count, ok := values[0].(int64)
+	if !ok {
+		return nil, fmt.Errorf("unexpected count type: %T", values[0])
+	}
+	newest, err := parseTimestamp(values[1])
+	if err != nil {
+		return nil, err
+	}
+	at, err := parseTimestamp(values[2])
+	if err != nil {
+		return nil, err
+	}
+	recorded, ok := values[3].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected recorded type: %T", values[3])
+	}
+
+	timestamps := make([]int64, 0, len(recorded))
+	for _, value := range recorded {
+		ts, err := parseTimestamp(value)
+		if err != nil {
+			return nil, err
+		}
+		timestamps = append(timestamps, ts)
+	}
+
+	return &RecordTimestampsResult{
+		Count:      count,
+		Newest:     newest,
+		At:         at,
+		Recorded:   len(timestamps) > 0,
+		Timestamps: timestamps,
+	}, nil
+}
+
+// GetTokenBucket is like GetTokenBucketContext with a background context.
 func (r *RedisStore) GetTokenBucket(key string) (*TokenBucketState, error) {
+	return r.GetTokenBucketContext(context.Background(), key)
+}
+
+// GetTokenBucketContext retrieves the current state of the token bucket.
+func (r *RedisStore) GetTokenBucketContext(ctx context.Context, key string) (*TokenBucketState, error) {
+	if err := r.checkOpen(); err != nil {
+		return nil, err
+	}
 	// Use HGETALL to get all fields in the hash
-	result, err := r.client.HGetAll(r.ctx, key).Result()
+	result, err := r.client.HGetAll(ctx, key).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -130,10 +477,18 @@ func (r *RedisStore) GetTokenBucket(key string) (*TokenBucketState, error) {
 	}, nil
 }
 
-// SetTokenBucket updates the state of the token bucket.
+// SetTokenBucket is like SetTokenBucketContext with a background context.
 func (r *RedisStore) SetTokenBucket(key string, state *TokenBucketState, expiration time.Duration) error {
+	return r.SetTokenBucketContext(context.Background(), key, state, expiration)
+}
+
+// SetTokenBucketContext updates the state of the token bucket.
+func (r *RedisStore) SetTokenBucketContext(ctx context.Context, key string, state *TokenBucketState, expiration time.Duration) error {
+	if err := r.checkOpen(); err != nil {
+		return err
+	}
 	// Use HMSET to set multiple fields in the hash
-	err := r.client.HMSet(r.ctx, key, map[string]interface{}{
+	err := r.client.HMSet(ctx, key, map[string]interface{}{
 		"tokens":      state.Tokens,
 		"last_update": state.LastUpdateTime,
 	}).Err()
@@ -142,7 +497,7 @@ func (r *RedisStore) SetTokenBucket(key string, state *TokenBucketState, expirat
 	}
 
 	// Set the expiration on the key
-	err = r.client.Expire(r.ctx, key, expiration).Err()
+	err = r.client.Expire(ctx, key, expiration).Err()
 	if err != nil {
 		return err
 	}
@@ -150,10 +505,85 @@ func (r *RedisStore) SetTokenBucket(key string, state *TokenBucketState, expirat
 	return nil
 }
 
-// GetLeakyBucket retrieves the current state of the leaky bucket.
+// TakeTokens refills the token bucket and takes tokens from it in a single Lua script,
+// so that concurrent callers sharing the bucket cannot over-admit.
+func (r *RedisStore) TakeTokens(ctx context.Context, key string, req TakeTokensRequest) (*TokenBucketState, bool, error) {
+	if err := r.checkOpen(); err != nil {
+		return nil, false, err
+	}
+	result, err := tokenBucketScript.Run(ctx, r.client, []string{key},
+		req.Capacity, req.RefillRate, req.Tokens, req.MaxDelay.Seconds(), req.Now, req.Expiration.Milliseconds()).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return nil, false, fmt.Errorf("unexpected result type: %T", result)
+	}
+	tokensStr, ok := values[0].(string)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected tokens type: %T", values[0])
+	}
+	taken, ok := values[1].(int64)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected taken type: %T", values[1])
+	}
+
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return nil, false, err
+	}
+	return &TokenBucketState{Tokens: tokens, LastUpdateTime: req.Now}, taken == 1, nil
+}
+
+// FillLeakyBucket leaks the bucket and adds to its queue in a single Lua script, so that
+// concurrent callers sharing the bucket cannot over-admit.
+func (r *RedisStore) FillLeakyBucket(ctx context.Context, key string, req FillLeakyBucketRequest) (*LeakyBucketState, bool, error) {
+	if err := r.checkOpen(); err != nil {
+		return nil, false, err
+	}
+	result, err := leakyBucketScript.Run(ctx, r.client, []string{key},
+		req.Capacity, req.LeakRate, req.Units, req.MaxDelay.Nanoseconds(), req.Now.UnixNano(), req.Expiration.Milliseconds()).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 3 {
+		return nil, false, fmt.Errorf("unexpected result type: %T", result)
+	}
+	queue, ok := values[0].(int64)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected queue type: %T", values[0])
+	}
+	lastLeakTime, err := parseTimestamp(values[1])
+	if err != nil {
+		return nil, false, err
+	}
+	added, ok := values[2].(int64)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected added type: %T", values[2])
+	}
+
+	return &LeakyBucketState{
+		Queue:        int(queue),
+		LastLeakTime: time.Unix(0, lastLeakTime),
+	}, added == 1, nil
+}
+
+// GetLeakyBucket is like GetLeakyBucketContext with a background context.
 func (r *RedisStore) GetLeakyBucket(key string) (*LeakyBucketState, error) {
+	return r.GetLeakyBucketContext(context.Background(), key)
+}
+
+// GetLeakyBucketContext retrieves the current state of the leaky bucket.
+func (r *RedisStore) GetLeakyBucketContext(ctx context.Context, key string) (*LeakyBucketState, error) {
+	if err := r.checkOpen(); err != nil {
+		return nil, err
+	}
 	// Use HGETALL to get all fields in the hash
-	result, err := r.client.HGetAll(r.ctx, key).Result()
+	result, err := r.client.HGetAll(ctx, key).Result()
 	if err != nil {
 		return nil, err
 	}
@@ -187,10 +617,18 @@ func (r *RedisStore) GetLeakyBucket(key string) (*LeakyBucketState, error) {
 	}, nil
 }
 
-// SetLeakyBucket updates the state of the leaky bucket.
+// SetLeakyBucket is like SetLeakyBucketContext with a background context.
 func (r *RedisStore) SetLeakyBucket(key string, state *LeakyBucketState, expiration time.Duration) error {
+	return r.SetLeakyBucketContext(context.Background(), key, state, expiration)
+}
+
+// SetLeakyBucketContext updates the state of the leaky bucket.
+func (r *RedisStore) SetLeakyBucketContext(ctx context.Context, key string, state *LeakyBucketState, expiration time.Duration) error {
+	if err := r.checkOpen(); err != nil {
+		return err
+	}
 	// Use HMSET to set multiple fields in the hash
-	err := r.client.HMSet(r.ctx, key, map[string]interface{}{
+	err := r.client.HMSet(ctx, key, map[string]interface{}{
 		"queue":          state.Queue,
 		"last_leak_time": state.LastLeakTime.UnixNano(),
 	}).Err()
@@ -199,10 +637,136 @@ func (r *RedisStore) SetLeakyBucket(key string, state *LeakyBucketState, expirat
 	}
 
 	// Set the expiration on the key
-	err = r.client.Expire(r.ctx, key, expiration).Err()
+	err = r.client.Expire(ctx, key, expiration).Err()
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// UpdateGCRA advances the theoretical arrival time in a single Lua script, so that
+// concurrent callers sharing the key cannot over-admit.
+func (r *RedisStore) UpdateGCRA(ctx context.Context, key string, req UpdateGCRARequest) (int64, bool, error) {
+	if err := r.checkOpen(); err != nil {
+		return 0, false, err
+	}
+	result, err := gcraScript.Run(ctx, r.client, []string{key},
+		req.Increment.Nanoseconds(), req.Tolerance.Nanoseconds(), req.MaxDelay.Nanoseconds(), req.Now).Result()
+	if err != nil {
+		return 0, false, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 2 {
+		return 0, false, fmt.Errorf("unexpected result type: %T", result)
+	}
+	tat, err := parseTimestamp(values[0])
+	if err != nil {
+		return 0, false, err
+	}
+	updated, ok := values[1].(int64)
+	if !ok {
+		return 0, false, fmt.Errorf("unexpected updated type: %T", values[1])
+	}
+	return tat, updated == 1, nil
+}
+
+// parseTimestamp parses a timestamp returned by a Lua script as a string.
+func parseTimestamp(value interface{}) (int64, error) {
+	str, ok := value.(string)
+	if !ok {
+		return 0, fmt.Errorf("unexpected timestamp type: %T", value)
+	}
+	return strconv.ParseInt(str, 10, 64)
+}
+
+// AddScores adds the scores to the members of a sorted set in a single Lua script.
+func (r *RedisStore) AddScores(ctx context.Context, key string, scores map[string]float64, maxMembers int, expiration time.Duration) error {
+	if err := r.checkOpen(); err != nil {
+		return err
+	}
+	args := make([]interface{}, 0, 2+2*len(scores))
+	args = append(args, maxMembers, expiration.Milliseconds())
+	for member, score := range scores {
+		args = append(args, member, strconv.FormatFloat(score, 'g', -1, 64))
+	}
+	return addScoresScript.Run(ctx, r.client, []string{key}, args...).Err()
+}
+
+// TopScores reads the sorted sets in a single pipeline and adds up their scores.
+func (r *RedisStore) TopScores(ctx context.Context, keys []string, n int) ([]Score, error) {
+	if err := r.checkOpen(); err != nil {
+		return nil, err
+	}
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.ZSliceCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.ZRangeWithScores(ctx, key, 0, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]float64)
+	for _, cmd := range cmds {
+		for _, z := range cmd.Val() {
+			member, ok := z.Member.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected member type: %T", z.Member)
+			}
+			totals[member] += z.Score
+		}
+	}
+	return topScores(totals, n), nil
+}
+
+// Delete removes the keys with a single DEL.
+func (r *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if err := r.checkOpen(); err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// TTL returns the time left before key expires, as reported by PTTL.
+func (r *RedisStore) TTL(ctx context.Context, key string) (time.Duration, bool, error) {
+	if err := r.checkOpen(); err != nil {
+		return 0, false, err
+	}
+	ttl, err := r.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, false, err
+	}
+	// PTTL replies -2 for missing keys and -1 for keys without an expiration, which go-redis
+	// passes on as durations of that many nanoseconds
+	switch ttl {
+	case -2:
+		return 0, false, nil
+	case -1:
+		return 0, true, nil
+	}
+	return ttl, true, nil
+}
+
+// GetGCRA returns the theoretical arrival time stored by UpdateGCRA.
+func (r *RedisStore) GetGCRA(ctx context.Context, key string) (int64, bool, error) {
+	if err := r.checkOpen(); err != nil {
+		return 0, false, err
+	}
+	result, err := r.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	tat, err := strconv.ParseInt(result, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return tat, true, nil
+}
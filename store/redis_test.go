@@ -2,6 +2,10 @@ package store
 
 import (
 	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -226,3 +230,569 @@ func TestRedisStore_SetLeakyBucket_ErrorHandling(t *testing.T) {
 	// Cleanup
 	client.Del(context.Background(), key)
 }
+
+func TestRedisStore_TimestampAt(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	key := "test_timestamp_at_key"
+	base := time.Now().UnixNano()
+	ms := time.Millisecond.Nanoseconds()
+	expiration := time.Minute
+	client.Del(context.Background(), key)
+
+	// Add timestamps out of order
+	for _, ts := range []int64{base + 30*ms, base + 10*ms, base + 20*ms} {
+		if err := store.AddTimestamp(key, ts, expiration); err != nil {
+			t.Fatalf("AddTimestamp failed: %v", err)
+		}
+	}
+
+	// Ranks are counted oldest first from the start of the range
+	ts, ok, err := store.TimestampAt(key, base+15*ms, 0)
+	if err != nil {
+		t.Fatalf("TimestampAt failed: %v", err)
+	}
+	if !ok || ts != base+20*ms {
+		t.Errorf("Expected timestamp %d, got %d (ok=%v)", base+20*ms, ts, ok)
+	}
+	ts, ok, err = store.TimestampAt(key, base, 2)
+	if err != nil {
+		t.Fatalf("TimestampAt failed: %v", err)
+	}
+	if !ok || ts != base+30*ms {
+		t.Errorf("Expected timestamp %d, got %d (ok=%v)", base+30*ms, ts, ok)
+	}
+
+	// Out of range rank
+	_, ok, err = store.TimestampAt(key, base, 3)
+	if err != nil {
+		t.Fatalf("TimestampAt failed: %v", err)
+	}
+	if ok {
+		t.Error("Expected no timestamp for out of range rank")
+	}
+
+	// Simulate Redis error
+	client.Close()
+	_, _, err = store.TimestampAt(key, base, 0)
+	if err == nil {
+		t.Fatalf("Expected Redis error on TimestampAt, got nil")
+	}
+	client = setupTestRedisClient()
+
+	// Cleanup
+	client.Del(context.Background(), key)
+}
+
+func TestRedisStore_RemoveTimestamp(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	key := "test_remove_timestamp_key"
+	timestamp := time.Now().UnixNano()
+	client.Del(context.Background(), key)
+
+	// A timestamp added with a longer expiration keeps the key alive
+	if err := store.AddTimestamp(key, timestamp, time.Minute); err != nil {
+		t.Fatalf("AddTimestamp failed: %v", err)
+	}
+	if err := store.AddTimestamp(key, timestamp+time.Millisecond.Nanoseconds(), time.Second); err != nil {
+		t.Fatalf("AddTimestamp failed: %v", err)
+	}
+	ttl, err := client.PTTL(context.Background(), key).Result()
+	if err != nil {
+		t.Fatalf("PTTL failed: %v", err)
+	}
+	if ttl <= time.Second {
+		t.Errorf("Expected expiration not to be shortened, got %v", ttl)
+	}
+
+	if err := store.RemoveTimestamp(key, timestamp); err != nil {
+		t.Fatalf("RemoveTimestamp failed: %v", err)
+	}
+	count, err := store.CountTimestamps(key, timestamp, timestamp)
+	if err != nil {
+		t.Fatalf("CountTimestamps failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected count 0 after removal, got %d", count)
+	}
+
+	// Simulate Redis error
+	client.Close()
+	if err := store.RemoveTimestamp(key, timestamp); err == nil {
+		t.Fatalf("Expected Redis error on RemoveTimestamp, got nil")
+	}
+	client = setupTestRedisClient()
+
+	// Cleanup
+	client.Del(context.Background(), key)
+}
+
+func TestRedisStore_TakeTokens(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	key := "test_take_tokens_key"
+	client.Del(context.Background(), key)
+	now := time.Now().UnixNano()
+	req := TakeTokensRequest{Capacity: 5, RefillRate: 1, Tokens: 3, Now: now, Expiration: time.Minute}
+
+	state, taken, err := store.TakeTokens(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("TakeTokens failed: %v", err)
+	}
+	if !taken || state.Tokens != 2 {
+		t.Errorf("Expected 3 tokens taken leaving 2, got taken=%v tokens=%v", taken, state.Tokens)
+	}
+
+	state, taken, err = store.TakeTokens(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("TakeTokens failed: %v", err)
+	}
+	if taken || state.Tokens != 2 {
+		t.Errorf("Expected nothing taken leaving 2, got taken=%v tokens=%v", taken, state.Tokens)
+	}
+
+	// The state stays readable by GetTokenBucket with full timestamp precision
+	req.Tokens = 1
+	req.Now = now + 500*time.Millisecond.Nanoseconds() + 1
+	if _, _, err := store.TakeTokens(context.Background(), key, req); err != nil {
+		t.Fatalf("TakeTokens failed: %v", err)
+	}
+	retrieved, err := store.GetTokenBucket(key)
+	if err != nil {
+		t.Fatalf("GetTokenBucket failed: %v", err)
+	}
+	if retrieved.LastUpdateTime != req.Now {
+		t.Errorf("Expected LastUpdateTime %d, got %d", req.Now, retrieved.LastUpdateTime)
+	}
+	if retrieved.Tokens < 1.49 || retrieved.Tokens > 1.51 {
+		t.Errorf("Expected about 1.5 tokens, got %v", retrieved.Tokens)
+	}
+	ttl, err := client.PTTL(context.Background(), key).Result()
+	if err != nil {
+		t.Fatalf("PTTL failed: %v", err)
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected expiration within a minute, got %v", ttl)
+	}
+
+	// Simulate Redis error
+	client.Close()
+	if _, _, err := store.TakeTokens(context.Background(), key, req); err == nil {
+		t.Fatalf("Expected Redis error on TakeTokens, got nil")
+	}
+	client = setupTestRedisClient()
+
+	// Cleanup
+	client.Del(context.Background(), key)
+}
+
+func TestRedisStore_TakeTokens_Precision(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	key := "test_take_tokens_precision_key"
+	client.Del(context.Background(), key)
+	defer client.Del(context.Background(), key)
+
+	// One token per nanosecond, so the refill shows any rounding of the timestamps
+	now := time.Now().UnixNano()
+	req := TakeTokensRequest{Capacity: 1e9, RefillRate: 1e9, Tokens: 1e9, Now: now, Expiration: time.Minute}
+	if _, taken, err := store.TakeTokens(context.Background(), key, req); err != nil || !taken {
+		t.Fatalf("Expected the bucket to be emptied, got %v, %v", taken, err)
+	}
+
+	req.Tokens = 1
+	req.Now = now + 101
+	state, taken, err := store.TakeTokens(context.Background(), key, req)
+	if err != nil || !taken {
+		t.Fatalf("Expected a token to be taken, got %v, %v", taken, err)
+	}
+	if state.Tokens != 100 {
+		t.Errorf("Expected 100 tokens left, got %v", state.Tokens)
+	}
+}
+
+func TestRedisStore_TakeTokens_Concurrent(t *testing.T) {
+	const (
+		stores     = 4
+		goroutines = 50
+		capacity   = 20
+	)
+	key := "test_take_tokens_concurrent_key"
+	cleanup := setupTestRedisClient()
+	cleanup.Del(context.Background(), key)
+	defer cleanup.Del(context.Background(), key)
+
+	// Each store has its own client, like separate processes sharing the bucket
+	var taken int64
+	var wg sync.WaitGroup
+	now := time.Now().UnixNano()
+	for i := 0; i < stores; i++ {
+		client := setupTestRedisClient()
+		defer client.Close()
+		store := NewRedisStore(client)
+		for j := 0; j < goroutines; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, ok, err := store.TakeTokens(context.Background(), key, TakeTokensRequest{
+					Capacity:   capacity,
+					RefillRate: 0.001,
+					Tokens:     1,
+					Now:        now,
+					Expiration: time.Minute,
+				})
+				if err != nil {
+					t.Errorf("TakeTokens failed: %v", err)
+					return
+				}
+				if ok {
+					atomic.AddInt64(&taken, 1)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if taken != capacity {
+		t.Errorf("Expected exactly %d tokens taken, got %d", capacity, taken)
+	}
+}
+
+func TestRedisStore_RecordTimestamps(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	key := "test_record_timestamps_key"
+	client.Del(context.Background(), key)
+	now := time.Now().UnixNano()
+	req := RecordTimestampsRequest{Limit: 3, Window: time.Second, Count: 2, Now: now}
+
+	result, err := store.RecordTimestamps(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	if !result.Recorded || result.Count != 0 || result.At != now {
+		t.Errorf("Expected entries recorded now in an empty window, got %+v", result)
+	}
+	if len(result.Timestamps) != 2 || result.Timestamps[0] != now || result.Timestamps[1] != now-1 {
+		t.Errorf("Expected timestamps now and now-1 at full precision, got %v", result.Timestamps)
+	}
+
+	// Entries recorded at the same time by another caller are kept distinct
+	req.Count = 1
+	result, err = store.RecordTimestamps(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	if len(result.Timestamps) != 1 || result.Timestamps[0] != now-2 {
+		t.Errorf("Expected timestamp now-2, got %v", result.Timestamps)
+	}
+
+	// The window is full; the entry fits once the oldest leaves it
+	result, err = store.RecordTimestamps(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	if result.Recorded || result.Count != 3 || result.Newest != now {
+		t.Errorf("Expected nothing recorded with 3 entries, got %+v", result)
+	}
+	if want := now - 2 + time.Second.Nanoseconds() + 1; result.At != want {
+		t.Errorf("Expected entry to fit at %d, got %d", want, result.At)
+	}
+
+	// Entries that have left the window are dropped
+	req.Now = now + 2*time.Second.Nanoseconds()
+	result, err = store.RecordTimestamps(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("RecordTimestamps failed: %v", err)
+	}
+	if !result.Recorded || result.Count != 0 {
+		t.Errorf("Expected entry recorded in an expired window, got %+v", result)
+	}
+	count, err := client.ZCard(context.Background(), key).Result()
+	if err != nil {
+		t.Fatalf("ZCard failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 entry stored, got %d", count)
+	}
+
+	// Simulate Redis error
+	client.Close()
+	if _, err := store.RecordTimestamps(context.Background(), key, req); err == nil {
+		t.Fatalf("Expected Redis error on RecordTimestamps, got nil")
+	}
+	client = setupTestRedisClient()
+
+	// Cleanup
+	client.Del(context.Background(), key)
+}
+
+func TestRedisStore_FillLeakyBucket(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	key := "test_fill_leaky_bucket_key"
+	client.Del(context.Background(), key)
+	now := time.Now()
+	req := FillLeakyBucketRequest{Capacity: 3, LeakRate: 3, Units: 2, Now: now, Expiration: time.Minute}
+
+	state, added, err := store.FillLeakyBucket(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("FillLeakyBucket failed: %v", err)
+	}
+	if !added || state.Queue != 2 || !state.LastLeakTime.Equal(now) {
+		t.Errorf("Expected 2 units added at %v, got added=%v state=%+v", now, added, state)
+	}
+
+	state, added, err = store.FillLeakyBucket(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("FillLeakyBucket failed: %v", err)
+	}
+	if added || state.Queue != 2 {
+		t.Errorf("Expected nothing added, got added=%v queue=%d", added, state.Queue)
+	}
+
+	// One request leaks out after a third of a second, which is not a whole nanosecond
+	req.Now = now.Add(500 * time.Millisecond)
+	state, added, err = store.FillLeakyBucket(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("FillLeakyBucket failed: %v", err)
+	}
+	if want := now.Add(333333334); !added || state.Queue != 3 || !state.LastLeakTime.Equal(want) {
+		t.Errorf("Expected queue 3 last leaked at %v, got added=%v state=%+v", want, added, state)
+	}
+
+	// The state stays readable by GetLeakyBucket
+	retrieved, err := store.GetLeakyBucket(key)
+	if err != nil {
+		t.Fatalf("GetLeakyBucket failed: %v", err)
+	}
+	if retrieved.Queue != state.Queue || !retrieved.LastLeakTime.Equal(state.LastLeakTime) {
+		t.Errorf("Expected %+v, got %+v", state, retrieved)
+	}
+
+	// Simulate Redis error
+	client.Close()
+	if _, _, err := store.FillLeakyBucket(context.Background(), key, req); err == nil {
+		t.Fatalf("Expected Redis error on FillLeakyBucket, got nil")
+	}
+	client = setupTestRedisClient()
+
+	// Cleanup
+	client.Del(context.Background(), key)
+}
+
+func TestRedisStore_UpdateGCRA(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	key := "test_update_gcra_key"
+	client.Del(context.Background(), key)
+	now := time.Now().UnixNano()
+	req := UpdateGCRARequest{Increment: time.Second + 1, Tolerance: 2*time.Second + 2, Now: now}
+
+	tat, updated, err := store.UpdateGCRA(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("UpdateGCRA failed: %v", err)
+	}
+	if want := now + time.Second.Nanoseconds() + 1; !updated || tat != want {
+		t.Errorf("Expected TAT %d at full precision, got updated=%v tat=%d", want, updated, tat)
+	}
+	ttl, err := client.PTTL(context.Background(), key).Result()
+	if err != nil {
+		t.Fatalf("PTTL failed: %v", err)
+	}
+	if ttl <= time.Second || ttl > 2*time.Second {
+		t.Errorf("Expected the key to expire when the TAT is reached, got %v", ttl)
+	}
+
+	// Beyond the tolerance without delay the TAT is left unchanged
+	if _, _, err := store.UpdateGCRA(context.Background(), key, req); err != nil {
+		t.Fatalf("UpdateGCRA failed: %v", err)
+	}
+	tat, updated, err = store.UpdateGCRA(context.Background(), key, req)
+	if err != nil {
+		t.Fatalf("UpdateGCRA failed: %v", err)
+	}
+	if want := now + 2*(time.Second.Nanoseconds()+1); updated || tat != want {
+		t.Errorf("Expected unchanged TAT %d, got updated=%v tat=%d", want, updated, tat)
+	}
+
+	// Moving the TAT back to the current time removes the key
+	req.Increment = -3 * time.Second
+	req.MaxDelay = time.Hour
+	if _, _, err := store.UpdateGCRA(context.Background(), key, req); err != nil {
+		t.Fatalf("UpdateGCRA failed: %v", err)
+	}
+	exists, err := client.Exists(context.Background(), key).Result()
+	if err != nil {
+		t.Fatalf("Exists failed: %v", err)
+	}
+	if exists != 0 {
+		t.Error("Expected TAT in the past to be removed")
+	}
+
+	// Simulate Redis error
+	client.Close()
+	if _, _, err := store.UpdateGCRA(context.Background(), key, req); err == nil {
+		t.Fatalf("Expected Redis error on UpdateGCRA, got nil")
+	}
+	client = setupTestRedisClient()
+
+	// Cleanup
+	client.Del(context.Background(), key)
+}
+
+func TestRedisStore_ContextCancelled(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	key := "test_context_key"
+	client.Del(context.Background(), key)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.IncrementContext(ctx, key, 1, time.Minute); err == nil {
+		t.Fatalf("Expected error from IncrementContext with a cancelled context, got nil")
+	}
+	if _, err := store.GetTokenBucketContext(ctx, key); err == nil {
+		t.Fatalf("Expected error from GetTokenBucketContext with a cancelled context, got nil")
+	}
+
+	// The cancelled increment did not reach Redis
+	count, err := store.GetCounter(key)
+	if err != nil {
+		t.Fatalf("GetCounter failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected count 0, got %d", count)
+	}
+
+	// Cleanup
+	client.Del(context.Background(), key)
+}
+
+func TestRedisStore_Close(t *testing.T) {
+	client := setupTestRedisClient()
+	defer client.Close()
+	store := NewRedisStore(client)
+
+	for i := 0; i < 2; i++ {
+		if err := store.Close(); err != nil {
+			t.Fatalf("Close %d failed: %v", i+1, err)
+		}
+	}
+
+	if _, err := store.Increment("test_closed_key", 1, time.Minute); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from Increment, got %v", err)
+	}
+	if _, _, err := store.TakeTokens(context.Background(), "test_closed_key", TakeTokensRequest{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Expected ErrClosed from TakeTokens, got %v", err)
+	}
+
+	// The client still belongs to the caller
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Errorf("Expected the client to stay open, got %v", err)
+	}
+}
+
+func TestRedisStore_Scores(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	ctx := context.Background()
+	keys := []string{"test_scores_a", "test_scores_b"}
+	client.Del(ctx, keys...)
+
+	if err := store.AddScores(ctx, keys[0], map[string]float64{"alice": 3, "bob": 1, "carol": 2}, 2, time.Minute); err != nil {
+		t.Fatalf("AddScores failed: %v", err)
+	}
+	if err := store.AddScores(ctx, keys[0], map[string]float64{"carol": 0.5}, 2, time.Minute); err != nil {
+		t.Fatalf("AddScores failed: %v", err)
+	}
+	if err := store.AddScores(ctx, keys[1], map[string]float64{"bob": 4, "dave": 2}, 2, time.Minute); err != nil {
+		t.Fatalf("AddScores failed: %v", err)
+	}
+
+	// The lowest score of the first set, bob's, was trimmed
+	top, err := store.TopScores(ctx, append(keys, "test_scores_missing"), 3)
+	if err != nil {
+		t.Fatalf("TopScores failed: %v", err)
+	}
+	expected := []Score{{Member: "bob", Score: 4}, {Member: "alice", Score: 3}, {Member: "carol", Score: 2.5}}
+	if !reflect.DeepEqual(top, expected) {
+		t.Errorf("Expected %v, got %v", expected, top)
+	}
+	ttl, err := client.PTTL(ctx, keys[0]).Result()
+	if err != nil {
+		t.Fatalf("PTTL failed: %v", err)
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Errorf("Expected the set to expire within a minute, got %v", ttl)
+	}
+
+	// Simulate Redis error
+	client.Close()
+	if _, err := store.TopScores(ctx, keys, 3); err == nil {
+		t.Fatalf("Expected Redis error on TopScores, got nil")
+	}
+	client = setupTestRedisClient()
+
+	// Cleanup
+	client.Del(ctx, keys...)
+}
+
+func TestRedisStore_KeyInspector(t *testing.T) {
+	client := setupTestRedisClient()
+	store := NewRedisStore(client)
+	ctx := context.Background()
+	keys := []string{"test_inspect_counter", "test_inspect_tat", "test_inspect_persistent"}
+	client.Del(ctx, keys...)
+
+	store.Increment(keys[0], 3, time.Minute)
+	now := time.Now().UnixNano()
+	store.UpdateGCRA(ctx, keys[1], UpdateGCRARequest{Increment: time.Second, Tolerance: time.Minute, Now: now})
+	client.Set(ctx, keys[2], 1, 0)
+
+	tests := []struct {
+		key    string
+		exists bool
+		ttl    func(time.Duration) bool
+	}{
+		{key: keys[0], exists: true, ttl: func(ttl time.Duration) bool { return ttl > 0 && ttl <= time.Minute }},
+		{key: keys[1], exists: true, ttl: func(ttl time.Duration) bool { return ttl > 0 && ttl <= time.Second }},
+		{key: keys[2], exists: true, ttl: func(ttl time.Duration) bool { return ttl == 0 }},
+		{key: "test_inspect_missing", exists: false, ttl: func(ttl time.Duration) bool { return ttl == 0 }},
+	}
+	for _, tt := range tests {
+		ttl, exists, err := store.TTL(ctx, tt.key)
+		if err != nil {
+			t.Fatalf("TTL failed: %v", err)
+		}
+		if exists != tt.exists || !tt.ttl(ttl) {
+			t.Errorf("%s: unexpected TTL %v, exists %v", tt.key, ttl, exists)
+		}
+	}
+
+	tat, ok, err := store.GetGCRA(ctx, keys[1])
+	if err != nil {
+		t.Fatalf("GetGCRA failed: %v", err)
+	}
+	if expected := now + time.Second.Nanoseconds(); !ok || tat != expected {
+		t.Errorf("Expected TAT %d, got %d, %v", expected, tat, ok)
+	}
+	if _, ok, err := store.GetGCRA(ctx, "test_inspect_missing"); err != nil || ok {
+		t.Errorf("Expected no TAT for a missing key, got %v, %v", ok, err)
+	}
+
+	if err := store.Delete(ctx, keys...); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if n, err := client.Exists(ctx, keys...).Result(); err != nil || n != 0 {
+		t.Errorf("Expected the keys to be deleted, got %d, %v", n, err)
+	}
+
+	// Simulate Redis error
+	client.Close()
+	if err := store.Delete(ctx, keys...); err == nil {
+		t.Fatalf("Expected Redis error on Delete, got nil")
+	}
+}
@@ -1,24 +1,247 @@
 package store
 
-import "time"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
 
 // Store is an interface for storage backends used by rate limiters.
+//
+// Every method has a Context variant that honors the cancellation and deadline of
+// the given context; the methods without a context use context.Background.
 type Store interface {
 	// Fixed Window methods
 	Increment(key string, delta int64, expiration time.Duration) (int64, error)
+	IncrementContext(ctx context.Context, key string, delta int64, expiration time.Duration) (int64, error)
 	GetCounter(key string) (int64, error)
+	GetCounterContext(ctx context.Context, key string) (int64, error)
 
-	// Sliding Window methods
+	// Sliding Window methods; AddTimestamp extends the expiration of the set at key to at
+	// least expiration but never shortens it
 	AddTimestamp(key string, timestamp int64, expiration time.Duration) error
+	AddTimestampContext(ctx context.Context, key string, timestamp int64, expiration time.Duration) error
 	CountTimestamps(key string, start int64, end int64) (int64, error)
+	CountTimestampsContext(ctx context.Context, key string, start int64, end int64) (int64, error)
+	// TimestampAt returns the timestamp at the given zero-based rank among the timestamps
+	// not older than start, ordered oldest first. ok is false if there is no such timestamp.
+	TimestampAt(key string, start int64, rank int64) (timestamp int64, ok bool, err error)
+	TimestampAtContext(ctx context.Context, key string, start int64, rank int64) (timestamp int64, ok bool, err error)
+	RemoveTimestamp(key string, timestamp int64) error
+	RemoveTimestampContext(ctx context.Context, key string, timestamp int64) error
 
 	// Token Bucket methods
 	GetTokenBucket(key string) (*TokenBucketState, error)
+	GetTokenBucketContext(ctx context.Context, key string) (*TokenBucketState, error)
 	SetTokenBucket(key string, state *TokenBucketState, expiration time.Duration) error
+	SetTokenBucketContext(ctx context.Context, key string, state *TokenBucketState, expiration time.Duration) error
 
 	// Leaky Bucket methods
 	GetLeakyBucket(key string) (*LeakyBucketState, error)
+	GetLeakyBucketContext(ctx context.Context, key string) (*LeakyBucketState, error)
 	SetLeakyBucket(key string, state *LeakyBucketState, expiration time.Duration) error
+	SetLeakyBucketContext(ctx context.Context, key string, state *LeakyBucketState, expiration time.Duration) error
+
+	// Close stops any background work of the store and makes later calls fail with
+	// ErrClosed. Closing a closed store does nothing.
+	Close() error
+}
+
+// TokenBucketTaker is implemented by stores that can refill a token bucket and take
+// tokens from it in a single atomic operation, which keeps the bucket consistent when
+// several processes share it. Rate limiters use it in preference to GetTokenBucket
+// followed by SetTokenBucket.
+type TokenBucketTaker interface {
+	// TakeTokens refills the bucket for the elapsed time and takes req.Tokens from it if they
+	// are available within req.MaxDelay, borrowing from future refills if needed. It returns
+	// the state of the bucket after the operation and whether the tokens were taken.
+	TakeTokens(ctx context.Context, key string, req TakeTokensRequest) (state *TokenBucketState, taken bool, err error)
+}
+
+// TakeTokensRequest describes a TakeTokens operation.
+type TakeTokensRequest struct {
+	Capacity   float64       // Maximum number of tokens in the bucket
+	RefillRate float64       // Tokens added to the bucket per second
+	Tokens     float64       // Tokens to take; a negative value puts tokens back
+	MaxDelay   time.Duration // Longest time the caller will wait for the tokens to be refilled
+	Now        int64         // Current time as a Unix timestamp in nanoseconds
+	Expiration time.Duration // Expiration of the bucket state
+}
+
+// refill returns the tokens in the bucket described by state at the time of the request.
+func (req TakeTokensRequest) refill(state *TokenBucketState) float64 {
+	if state == nil {
+		return req.Capacity
+	}
+	elapsed := float64(req.Now-state.LastUpdateTime) / float64(time.Second)
+	return math.Min(state.Tokens+elapsed*req.RefillRate, req.Capacity)
+}
+
+// LeakyBucketFiller is implemented by stores that can leak a leaky bucket and add to its
+// queue in a single atomic operation. Rate limiters use it in preference to GetLeakyBucket
+// followed by SetLeakyBucket.
+type LeakyBucketFiller interface {
+	// FillLeakyBucket leaks the bucket for the elapsed time and adds req.Units to its queue if
+	// they fit within req.MaxDelay, overfilling the bucket if needed. It returns the state of
+	// the bucket after the operation and whether the units were added.
+	FillLeakyBucket(ctx context.Context, key string, req FillLeakyBucketRequest) (state *LeakyBucketState, added bool, err error)
+}
+
+// FillLeakyBucketRequest describes a FillLeakyBucket operation.
+type FillLeakyBucketRequest struct {
+	Capacity   int           // Maximum number of requests in the bucket
+	LeakRate   float64       // Requests leaked per second
+	Units      int           // Units to add to the queue; a negative value removes units
+	MaxDelay   time.Duration // Longest time the caller will wait for the units to fit
+	Now        time.Time     // Current time
+	Expiration time.Duration // Expiration of the bucket state
+}
+
+// leak returns the bucket described by state after leaking it at the time of the request.
+func (req FillLeakyBucketRequest) leak(state *LeakyBucketState) LeakyBucketState {
+	if state == nil {
+		return LeakyBucketState{LastLeakTime: req.Now}
+	}
+	leaked := int(req.Now.Sub(state.LastLeakTime).Seconds() * req.LeakRate)
+	if leaked <= 0 {
+		return *state
+	}
+	return LeakyBucketState{
+		Queue:        max(state.Queue-leaked, 0),
+		LastLeakTime: state.LastLeakTime.Add(secondsToDuration(float64(leaked) / req.LeakRate)),
+	}
+}
+
+// wait returns how long the units of the request must wait to fit in the bucket.
+func (req FillLeakyBucketRequest) wait(state LeakyBucketState) time.Duration {
+	overflow := state.Queue + req.Units - req.Capacity
+	if overflow <= 0 {
+		return 0
+	}
+	// The next leak may be due now but not applied yet
+	return max(state.LastLeakTime.Add(secondsToDuration(float64(overflow)/req.LeakRate)).Sub(req.Now), 1)
+}
+
+// SlidingWindowRecorder is implemented by stores that can count the entries of a sliding
+// window and record new ones in a single atomic operation. Rate limiters use it in
+// preference to CountTimestamps followed by AddTimestamp.
+type SlidingWindowRecorder interface {
+	// RecordTimestamps counts the entries in the window ending at req.Now, including entries
+	// recorded for the future, and records req.Count new entries at the earliest time they fit
+	// if that is within req.MaxDelay. Entries older than the window are dropped.
+	RecordTimestamps(ctx context.Context, key string, req RecordTimestampsRequest) (*RecordTimestampsResult, error)
+}
+
+// RecordTimestampsRequest describes a RecordTimestamps operation.
+type RecordTimestampsRequest struct {
+	Limit    int64         // Maximum number of entries in the window
+	Window   time.Duration // Length of the window
+	Count    int64         // Entries to record
+	MaxDelay time.Duration // Longest time the caller will wait for the entries to fit
+	Now      int64         // Current time as a Unix timestamp in nanoseconds
+}
+
+// validate checks that the request can be served: the limit and window are positive and
+// the entries to record fit in an empty window.
+func (req RecordTimestampsRequest) validate() error {
+	if req.Limit <= 0 {
+		return errors.New("limit must be greater than zero")
+	}
+	if req.Window <= 0 {
+		return errors.New("window must be greater than zero")
+	}
+	if req.Count <= 0 || req.Count > req.Limit {
+		return fmt.Errorf("count must be between 1 and the limit of %d, got %d", req.Limit, req.Count)
+	}
+	return nil
+}
+
+// RecordTimestampsResult is the outcome of a RecordTimestamps operation.
+type RecordTimestampsResult struct {
+	Count      int64   // Entries in the window before recording
+	Newest     int64   // Newest entry in the window before recording; zero if it was empty
+	At         int64   // Time at which the new entries fit in the window
+	Recorded   bool    // Whether the new entries were recorded
+	Timestamps []int64 // Timestamps of the recorded entries, at or just before At
+}
+
+// GCRAUpdater is implemented by stores that can hold the theoretical arrival time (TAT)
+// of a GCRA limiter and update it in a single atomic operation. The TAT is the only state
+// kept per key.
+type GCRAUpdater interface {
+	// UpdateGCRA advances the TAT for the key by req.Increment, starting from req.Now if the
+	// TAT is in the past, if the result is within req.Tolerance of req.Now plus req.MaxDelay.
+	// It returns the TAT after the operation and whether it was updated. A TAT that is not
+	// after req.Now is equivalent to no state, so the key expires when the TAT is reached.
+	UpdateGCRA(ctx context.Context, key string, req UpdateGCRARequest) (tat int64, updated bool, err error)
+}
+
+// UpdateGCRARequest describes an UpdateGCRA operation.
+type UpdateGCRARequest struct {
+	Increment time.Duration // Emission interval times the cost; a negative value gives capacity back
+	Tolerance time.Duration // How far the TAT may be ahead of the current time, the burst times the emission interval
+	MaxDelay  time.Duration // Longest time the caller will wait for the TAT to fall within the tolerance
+	Now       int64         // Current time as a Unix timestamp in nanoseconds
+}
+
+// ScoreKeeper is implemented by stores that can keep sets of members with scores, such as
+// the request counts of keys that heavy-hitter trackers of several processes add up.
+type ScoreKeeper interface {
+	// AddScores adds the scores to the members of the set at key, then keeps only the
+	// maxMembers members with the highest scores and sets the expiration of the set.
+	AddScores(ctx context.Context, key string, scores map[string]float64, maxMembers int, expiration time.Duration) error
+
+	// TopScores returns the n members with the highest total score over the sets at keys,
+	// highest first, ties broken by member. Missing sets are empty.
+	TopScores(ctx context.Context, keys []string, n int) ([]Score, error)
+}
+
+// KeyInspector is implemented by stores that can look up and delete keys whatever the
+// operations that wrote them, for admin tools that inspect and reset the state of keys.
+type KeyInspector interface {
+	// Delete removes the keys, whatever state they hold. Missing keys are ignored.
+	Delete(ctx context.Context, keys ...string) error
+
+	// TTL returns how long key lives before it expires, or zero if it never expires, and
+	// whether it exists.
+	TTL(ctx context.Context, key string) (ttl time.Duration, exists bool, err error)
+
+	// GetGCRA returns the theoretical arrival time stored at key by UpdateGCRA, as a Unix
+	// timestamp in nanoseconds, and whether there is one.
+	GetGCRA(ctx context.Context, key string) (tat int64, ok bool, err error)
+}
+
+// Score is the score of a member of a set kept by a ScoreKeeper.
+type Score struct {
+	Member string
+	Score  float64
+}
+
+// topScores returns the n members with the highest scores, highest first, ties broken by
+// member.
+func topScores(scores map[string]float64, n int) []Score {
+	top := make([]Score, 0, len(scores))
+	for member, score := range scores {
+		top = append(top, Score{Member: member, Score: score})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Score != top[j].Score {
+			return top[i].Score > top[j].Score
+		}
+		return top[i].Member < top[j].Member
+	})
+	if len(top) > n {
+		top = top[:max(n, 0)]
+	}
+	return top
+}
+
+// secondsToDuration converts seconds to a duration, rounding up to the next nanosecond.
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
 }
 
 // TokenBucketState represents the state of a token bucket.
@@ -0,0 +1,236 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/neelp03/throttlex/httplimit"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+const (
+	distributedProcesses = 8  // RedisStore instances, each with its own client, like separate processes
+	distributedRequests  = 50 // Concurrent requests per process
+	distributedLimit     = 25 // Requests the shared limit admits
+)
+
+// runDistributed sends concurrent requests for the same key through limiters built by
+// newLimiter, each over its own RedisStore, and returns how many were admitted.
+func runDistributed(t *testing.T, key string, newLimiter func(store.Store) (ratelimiter.RateLimiter, error)) int64 {
+	t.Helper()
+
+	// Limiters store the key under their namespace
+	cleanup := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer cleanup.Close()
+	defer func() {
+		keys, _ := cleanup.Keys(context.Background(), "*"+key+"*").Result()
+		if len(keys) > 0 {
+			cleanup.Del(context.Background(), keys...)
+		}
+	}()
+
+	limiters := make([]ratelimiter.RateLimiter, distributedProcesses)
+	for i := range limiters {
+		client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+		defer client.Close()
+		limiter, err := newLimiter(store.NewRedisStore(client))
+		if err != nil {
+			t.Fatalf("Error creating limiter: %v", err)
+		}
+		defer limiter.Close()
+		limiters[i] = limiter
+	}
+
+	var admitted int64
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, limiter := range limiters {
+		for j := 0; j < distributedRequests; j++ {
+			wg.Add(1)
+			go func(limiter ratelimiter.RateLimiter) {
+				defer wg.Done()
+				<-start
+				allowed, err := limiter.Allow(key)
+				if err != nil {
+					t.Errorf("Error on Allow(): %v", err)
+					return
+				}
+				if allowed {
+					atomic.AddInt64(&admitted, 1)
+				}
+			}(limiter)
+		}
+	}
+	close(start)
+	wg.Wait()
+	return admitted
+}
+
+func TestIntegration_Redis_NoOverAdmission(t *testing.T) {
+	tests := []struct {
+		name       string
+		newLimiter func(store.Store) (ratelimiter.RateLimiter, error)
+	}{
+		{
+			name: "FixedWindow",
+			newLimiter: func(s store.Store) (ratelimiter.RateLimiter, error) {
+				return ratelimiter.NewFixedWindowLimiter(s, distributedLimit, time.Minute)
+			},
+		},
+		{
+			name: "SlidingWindow",
+			newLimiter: func(s store.Store) (ratelimiter.RateLimiter, error) {
+				return ratelimiter.NewSlidingWindowLimiter(s, distributedLimit, time.Minute)
+			},
+		},
+		{
+			name: "TokenBucket",
+			newLimiter: func(s store.Store) (ratelimiter.RateLimiter, error) {
+				return ratelimiter.NewTokenBucketLimiter(s, distributedLimit, 0.001)
+			},
+		},
+		{
+			name: "LeakyBucket",
+			newLimiter: func(s store.Store) (ratelimiter.RateLimiter, error) {
+				return ratelimiter.NewLeakyBucketLimiter(s, distributedLimit, 0.001)
+			},
+		},
+		{
+			name: "SlidingWindowCounter",
+			newLimiter: func(s store.Store) (ratelimiter.RateLimiter, error) {
+				return ratelimiter.NewSlidingWindowCounterLimiter(s, distributedLimit, time.Hour)
+			},
+		},
+		{
+			name: "GCRA",
+			newLimiter: func(s store.Store) (ratelimiter.RateLimiter, error) {
+				return ratelimiter.NewGCRALimiter(s, distributedLimit, 0.001)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A fresh key per run, so that state left by an interrupted run does not count
+			key := fmt.Sprintf("distributed_%s_%d", tt.name, time.Now().UnixNano())
+			admitted := runDistributed(t, key, tt.newLimiter)
+			if admitted != distributedLimit {
+				t.Errorf("Expected exactly %d requests admitted across processes, got %d", distributedLimit, admitted)
+			}
+		})
+	}
+}
+
+func TestIntegration_Redis_TransportBackoff(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	cleanup := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer cleanup.Close()
+	cleanup.Del(context.Background(), "127.0.0.1:backoff")
+	defer cleanup.Del(context.Background(), "127.0.0.1:backoff")
+
+	// Workers with their own limiters and clients, sharing backoffs through Redis
+	workers := make([]*httplimit.Transport, 3)
+	for i := range workers {
+		client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+		defer client.Close()
+		limiter, err := ratelimiter.NewTokenBucketLimiter(store.NewMemoryStore(), 100, 100)
+		if err != nil {
+			t.Fatalf("Error creating limiter: %v", err)
+		}
+		defer limiter.Close()
+		workers[i], err = httplimit.NewTransport(nil, limiter, httplimit.WithBackoffStore(store.NewRedisStore(client)))
+		if err != nil {
+			t.Fatalf("Error creating transport: %v", err)
+		}
+	}
+
+	resp, err := (&http.Client{Transport: workers[0]}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("First request should be sent: %v", err)
+	}
+	resp.Body.Close()
+
+	// The 429 seen by one worker makes every worker back off
+	for i, worker := range workers {
+		if _, err := (&http.Client{Transport: worker}).Get(server.URL); !errors.Is(err, httplimit.ErrRateLimited) {
+			t.Errorf("Worker %d: expected ErrRateLimited, got %v", i, err)
+		}
+	}
+}
+
+func TestIntegration_Redis_Hierarchy(t *testing.T) {
+	// A fresh tenant per run, so that state left by an interrupted run does not count
+	tenant := fmt.Sprintf("hierarchy_%d", time.Now().UnixNano())
+	cleanup := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer cleanup.Close()
+	defer func() {
+		keys, _ := cleanup.Keys(context.Background(), "*"+tenant+"*").Result()
+		if len(keys) > 0 {
+			cleanup.Del(context.Background(), keys...)
+		}
+	}()
+
+	// Replicas with their own limiters and clients, sharing the hierarchy through Redis
+	replicas := make([]*ratelimiter.HierarchicalLimiter, distributedProcesses)
+	for i := range replicas {
+		client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+		defer client.Close()
+		redisStore := store.NewRedisStore(client)
+		limiter, err := ratelimiter.NewHierarchicalLimiter([]ratelimiter.HierarchyLevel{
+			{Name: "tenant", Config: ratelimiter.LimiterConfig{Policy: ratelimiter.FixedWindowPolicy, Store: redisStore, Limit: distributedLimit, Interval: time.Minute}},
+			{Name: "user", Config: ratelimiter.LimiterConfig{Policy: ratelimiter.FixedWindowPolicy, Store: redisStore, Limit: 20, Interval: time.Minute}},
+		})
+		if err != nil {
+			t.Fatalf("Error creating limiter: %v", err)
+		}
+		defer limiter.Close()
+		replicas[i] = limiter
+	}
+
+	users := []string{"alice", "bob"}
+	var admitted [2]int64
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, limiter := range replicas {
+		for j := 0; j < distributedRequests; j++ {
+			wg.Add(1)
+			go func(limiter *ratelimiter.HierarchicalLimiter, user int) {
+				defer wg.Done()
+				<-start
+				allowed, err := limiter.Allow(tenant + "/" + users[user])
+				if err != nil {
+					t.Errorf("Error on Allow(): %v", err)
+					return
+				}
+				if allowed {
+					atomic.AddInt64(&admitted[user], 1)
+				}
+			}(limiter, j%2)
+		}
+	}
+	close(start)
+	wg.Wait()
+
+	if total := admitted[0] + admitted[1]; total != distributedLimit {
+		t.Errorf("Expected exactly %d requests admitted for the tenant across replicas, got %d", distributedLimit, total)
+	}
+	for i, user := range users {
+		if admitted[i] > 20 {
+			t.Errorf("Expected at most 20 requests admitted for %s, got %d", user, admitted[i])
+		}
+	}
+}
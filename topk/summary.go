@@ -0,0 +1,82 @@
+package topk
+
+import "container/heap"
+
+// item is a key of a limiter, counted by a summary.
+type item struct {
+	limiter string
+	key     string
+}
+
+// summary counts the items of a stream with the Space-Saving algorithm, in at most
+// capacity counters. When every counter is taken, a new item replaces the item with the
+// smallest count and inherits that count as its error, so counts never fall below the
+// true counts and an item counted more than 1/capacity of the stream always has a counter.
+type summary struct {
+	capacity int
+	counters map[item]*counter
+	heap     counterHeap // The counters, smallest count first
+}
+
+// counter is the count of an item of a summary.
+type counter struct {
+	item  item
+	count int64 // Estimated count, at least the true count
+	err   int64 // Largest overestimate of count
+	index int   // Index in the heap
+}
+
+// newSummary returns an empty summary of the given capacity.
+func newSummary(capacity int) *summary {
+	return &summary{capacity: capacity, counters: make(map[item]*counter)}
+}
+
+// add counts n occurrences of the item.
+func (s *summary) add(it item, n int64) {
+	if c, ok := s.counters[it]; ok {
+		c.count += n
+		heap.Fix(&s.heap, c.index)
+		return
+	}
+	if len(s.counters) < s.capacity {
+		c := &counter{item: it, count: n}
+		s.counters[it] = c
+		heap.Push(&s.heap, c)
+		return
+	}
+
+	// Replace the item with the smallest count
+	c := s.heap[0]
+	delete(s.counters, c.item)
+	c.item = it
+	c.err = c.count
+	c.count += n
+	s.counters[it] = c
+	heap.Fix(&s.heap, 0)
+}
+
+// counterHeap is a min-heap of counters by count.
+type counterHeap []*counter
+
+func (h counterHeap) Len() int           { return len(h) }
+func (h counterHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h counterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *counterHeap) Push(x interface{}) {
+	c := x.(*counter)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *counterHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,485 @@
+// Package topk tracks the heavy hitters of rate limiters: the keys with the most requests
+// and the most denied requests over a sliding period, in memory bounded regardless of how
+// many keys are seen. Counts can be added up across processes in a shared store.
+package topk
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/observe"
+	"github.com/neelp03/throttlex/store"
+)
+
+// Defaults of a Tracker.
+const (
+	DefaultCapacity = 1000
+	DefaultPeriod   = time.Minute
+	DefaultSlots    = 6
+)
+
+// ErrNotShared is returned by the methods of a Tracker that need a store when it was created
+// without WithStore.
+var ErrNotShared = errors.New("tracker has no shared store")
+
+// Count is the estimated number of requests of a key of a limiter.
+type Count struct {
+	Limiter string // Name the limiter was wrapped under
+	Key     string
+	Count   int64 // Estimated count, never below the true count
+	Error   int64 // Largest overestimate of Count; zero for counts read from the shared store
+}
+
+// Tracker is an observe.Observer that counts the requests and denied requests of each key
+// of the limiters it observes, and reports the keys with the highest counts.
+//
+// Counts cover a sliding period divided into slots: the current slot and the slots before
+// it that fit in the period. Each slot keeps at most the configured capacity of keys with
+// the Space-Saving algorithm, so memory does not grow with the number of keys, and a key
+// making more than 1/capacity of the requests of a slot is always counted. Counts of keys
+// that were replaced may be overestimated, by at most their Error.
+type Tracker struct {
+	capacity   int
+	period     time.Duration
+	numSlots   int
+	slotLength time.Duration
+	clock      clock.Clock
+
+	store  store.Store       // Shared store set by WithStore
+	keeper store.ScoreKeeper // Shared store the counts are published to; nil if not shared
+	name   string            // Prefix of the keys of the shared store
+
+	mu          sync.Mutex
+	slots       []*slot // Ring of slots, by index modulo its length
+	publishStop chan struct{}
+	publishDone chan struct{}
+	closed      bool
+}
+
+// slot holds the counts of a slot of the period.
+type slot struct {
+	index   int64   // Index of the slot since the Unix epoch, in slot lengths
+	counts  counts  // Counts of the slot
+	pending *counts // Counts not published to the shared store yet; nil if not shared
+}
+
+// counts holds the requests and denied requests of a slot.
+type counts struct {
+	requested *summary
+	denied    *summary
+}
+
+// kinds of counts, in the keys of the shared store.
+const (
+	requestedKind = "requested"
+	deniedKind    = "denied"
+)
+
+// Option configures optional behavior of a Tracker.
+type Option func(*Tracker)
+
+// WithCapacity sets the number of keys counted in each slot. The default is
+// DefaultCapacity.
+func WithCapacity(n int) Option {
+	return func(t *Tracker) {
+		t.capacity = n
+	}
+}
+
+// WithPeriod sets the period the counts cover and the number of slots it is divided into.
+// More slots make the period slide more smoothly, at the cost of more memory. The default
+// is DefaultPeriod in DefaultSlots slots.
+func WithPeriod(period time.Duration, slots int) Option {
+	return func(t *Tracker) {
+		t.period = period
+		t.numSlots = slots
+	}
+}
+
+// WithClock makes the tracker measure the period with c instead of the real clock.
+func WithClock(c clock.Clock) Option {
+	return func(t *Tracker) {
+		t.clock = c
+	}
+}
+
+// WithStore makes the tracker publish its counts to s, under keys prefixed with name, so
+// that the shared counts of the trackers of several processes can be read. s must
+// implement store.ScoreKeeper, like MemoryStore and RedisStore. The trackers sharing a
+// store must use the same name, capacity and period.
+func WithStore(s store.Store, name string) Option {
+	return func(t *Tracker) {
+		t.store = s
+		t.name = name
+	}
+}
+
+// NewTracker creates a tracker.
+func NewTracker(opts ...Option) (*Tracker, error) {
+	t := &Tracker{
+		capacity: DefaultCapacity,
+		period:   DefaultPeriod,
+		numSlots: DefaultSlots,
+		clock:    clock.New(),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	if t.capacity <= 0 {
+		return nil, errors.New("capacity must be greater than zero")
+	}
+	if t.numSlots <= 0 {
+		return nil, errors.New("slots must be greater than zero")
+	}
+	if t.period < time.Duration(t.numSlots) {
+		return nil, errors.New("period must be at least one nanosecond per slot")
+	}
+	if t.clock == nil {
+		return nil, errors.New("clock cannot be nil")
+	}
+	if t.store != nil {
+		keeper, ok := t.store.(store.ScoreKeeper)
+		if !ok {
+			return nil, errors.New("store does not implement store.ScoreKeeper")
+		}
+		if t.name == "" {
+			return nil, errors.New("name cannot be empty")
+		}
+		t.keeper = keeper
+	}
+	t.slots = make([]*slot, t.numSlots)
+	t.slotLength = t.period / time.Duration(t.numSlots)
+	return t, nil
+}
+
+// ObserveDecision counts a decision in the current slot: every decision as a request, and
+// denied requests as denials. Failed decisions are not counted.
+func (t *Tracker) ObserveDecision(d observe.Decision) {
+	if d.Err != nil {
+		return
+	}
+	it := item{limiter: d.Limiter, key: d.Key}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.slot(t.currentIndex())
+	s.counts.requested.add(it, 1)
+	if s.pending != nil {
+		s.pending.requested.add(it, 1)
+	}
+	if !d.Allowed {
+		s.counts.denied.add(it, 1)
+		if s.pending != nil {
+			s.pending.denied.add(it, 1)
+		}
+	}
+}
+
+// ObserveStoreError does nothing: store errors are not counted.
+func (t *Tracker) ObserveStoreError(observe.StoreError) {}
+
+// TopRequested returns the n keys with the most requests over the period, most first.
+func (t *Tracker) TopRequested(n int) []Count {
+	return t.top(n, func(c counts) *summary { return c.requested })
+}
+
+// TopDenied returns the n keys with the most denied requests over the period, most first.
+func (t *Tracker) TopDenied(n int) []Count {
+	return t.top(n, func(c counts) *summary { return c.denied })
+}
+
+// top adds up the counts of the summaries selected from the slots of the period and
+// returns the n highest.
+func (t *Tracker) top(n int, selectSummary func(counts) *summary) []Count {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// A key missing from a full summary may have been counted up to its smallest count
+	var summaries []*summary
+	var floors int64
+	totals := make(map[item]*Count)
+	for _, s := range t.window() {
+		sum := selectSummary(s.counts)
+		summaries = append(summaries, sum)
+		if len(sum.counters) == sum.capacity {
+			floors += sum.heap[0].count
+		}
+		for it := range sum.counters {
+			if totals[it] == nil {
+				totals[it] = &Count{Limiter: it.limiter, Key: it.key}
+			}
+		}
+	}
+	for it, total := range totals {
+		total.Count, total.Error = floors, floors
+		for _, sum := range summaries {
+			c, ok := sum.counters[it]
+			if !ok {
+				continue
+			}
+			if len(sum.counters) == sum.capacity {
+				total.Count -= sum.heap[0].count
+				total.Error -= sum.heap[0].count
+			}
+			total.Count += c.count
+			total.Error += c.err
+		}
+	}
+
+	top := make([]Count, 0, len(totals))
+	for _, total := range totals {
+		top = append(top, *total)
+	}
+	sortCounts(top)
+	if len(top) > n {
+		top = top[:max(n, 0)]
+	}
+	return top
+}
+
+// Publish adds the counts observed since the last call to the shared store. Counts that
+// cannot be published are kept for the next call.
+func (t *Tracker) Publish(ctx context.Context) error {
+	if t.keeper == nil {
+		return ErrNotShared
+	}
+
+	// Take the pending counts, so that decisions are not blocked by the store
+	t.mu.Lock()
+	var published []*slot
+	for _, s := range t.window() {
+		if len(s.pending.requested.counters) == 0 {
+			continue
+		}
+		published = append(published, &slot{index: s.index, pending: s.pending})
+		s.pending = t.newCounts()
+	}
+	t.mu.Unlock()
+
+	var errs []error
+	for i, p := range published {
+		err := t.publishSummary(ctx, requestedKind, p.index, p.pending.requested)
+		if err == nil {
+			p.pending.requested = nil
+			err = t.publishSummary(ctx, deniedKind, p.index, p.pending.denied)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			t.restore(published[i:])
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// publishSummary adds the counts of a summary to the set of the shared store of a kind
+// and slot.
+func (t *Tracker) publishSummary(ctx context.Context, kind string, index int64, sum *summary) error {
+	if len(sum.counters) == 0 {
+		return nil
+	}
+	scores := make(map[string]float64, len(sum.counters))
+	for it, c := range sum.counters {
+		scores[encodeMember(it)] = float64(c.count)
+	}
+	return t.keeper.AddScores(ctx, t.storeKey(kind, index), scores, t.capacity, t.period+t.slotLength)
+}
+
+// restore adds back the counts of slots that could not be published to the pending counts
+// of the slots, if they are still in the period.
+func (t *Tracker) restore(failed []*slot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	oldest := t.currentIndex() - int64(t.numSlots) + 1
+	for _, f := range failed {
+		if f.index < oldest {
+			continue
+		}
+		s := t.slot(f.index)
+		if f.pending.requested != nil {
+			for it, c := range f.pending.requested.counters {
+				s.pending.requested.add(it, c.count)
+			}
+		}
+		for it, c := range f.pending.denied.counters {
+			s.pending.denied.add(it, c.count)
+		}
+	}
+}
+
+// SharedTopRequested returns the n keys with the most requests over the period across the
+// trackers sharing the store, most first.
+func (t *Tracker) SharedTopRequested(ctx context.Context, n int) ([]Count, error) {
+	return t.sharedTop(ctx, requestedKind, n)
+}
+
+// SharedTopDenied returns the n keys with the most denied requests over the period across
+// the trackers sharing the store, most first.
+func (t *Tracker) SharedTopDenied(ctx context.Context, n int) ([]Count, error) {
+	return t.sharedTop(ctx, deniedKind, n)
+}
+
+// sharedTop returns the n highest counts of a kind in the shared store over the period.
+func (t *Tracker) sharedTop(ctx context.Context, kind string, n int) ([]Count, error) {
+	if t.keeper == nil {
+		return nil, ErrNotShared
+	}
+	t.mu.Lock()
+	current := t.currentIndex()
+	t.mu.Unlock()
+
+	keys := make([]string, 0, t.numSlots)
+	for index := current - int64(t.numSlots) + 1; index <= current; index++ {
+		keys = append(keys, t.storeKey(kind, index))
+	}
+	scores, err := t.keeper.TopScores(ctx, keys, n)
+	if err != nil {
+		return nil, err
+	}
+	top := make([]Count, 0, len(scores))
+	for _, score := range scores {
+		it := decodeMember(score.Member)
+		top = append(top, Count{Limiter: it.limiter, Key: it.key, Count: int64(score.Score)})
+	}
+	return top, nil
+}
+
+// PublishEvery publishes the counts to the shared store every interval in the background,
+// until Close is called. Errors are passed to onError if not nil.
+func (t *Tracker) PublishEvery(interval time.Duration, onError func(error)) error {
+	if interval <= 0 {
+		return errors.New("interval must be greater than zero")
+	}
+	if t.keeper == nil {
+		return ErrNotShared
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return errors.New("tracker is closed")
+	}
+	if t.publishStop != nil {
+		return errors.New("tracker is already publishing")
+	}
+	t.publishStop = make(chan struct{})
+	t.publishDone = make(chan struct{})
+
+	ticker := t.clock.NewTicker(interval)
+	go t.publishLoop(ticker, t.publishStop, t.publishDone, onError)
+	return nil
+}
+
+// publishLoop publishes the counts on every tick until stop is closed.
+func (t *Tracker) publishLoop(ticker clock.Ticker, stop, done chan struct{}, onError func(error)) {
+	defer close(done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			if err := t.Publish(context.Background()); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close stops publishing in the background and publishes the pending counts a last time.
+// It does not close the shared store.
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	stop, done := t.publishStop, t.publishDone
+	t.mu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+	return t.Publish(context.Background())
+}
+
+// currentIndex returns the index of the current slot. The caller holds t.mu.
+func (t *Tracker) currentIndex() int64 {
+	return t.clock.Now().UnixNano() / int64(t.slotLength)
+}
+
+// slot returns the slot of an index in the period, resetting the ring entry it replaces.
+// The caller holds t.mu.
+func (t *Tracker) slot(index int64) *slot {
+	pos := index % int64(t.numSlots)
+	if pos < 0 {
+		pos += int64(t.numSlots)
+	}
+	s := t.slots[pos]
+	if s == nil || s.index != index {
+		s = &slot{index: index, counts: *t.newCounts()}
+		if t.keeper != nil {
+			s.pending = t.newCounts()
+		}
+		t.slots[pos] = s
+	}
+	return s
+}
+
+// window returns the slots of the current period that have counts. The caller holds t.mu.
+func (t *Tracker) window() []*slot {
+	oldest := t.currentIndex() - int64(t.numSlots) + 1
+	var slots []*slot
+	for _, s := range t.slots {
+		if s != nil && s.index >= oldest {
+			slots = append(slots, s)
+		}
+	}
+	return slots
+}
+
+// newCounts returns empty counts.
+func (t *Tracker) newCounts() *counts {
+	return &counts{requested: newSummary(t.capacity), denied: newSummary(t.capacity)}
+}
+
+// storeKey returns the key of the set of the shared store of a kind and slot.
+func (t *Tracker) storeKey(kind string, index int64) string {
+	return t.name + ":" + kind + ":" + strconv.FormatInt(index, 10)
+}
+
+// memberSeparator separates the limiter from the key in the members of the shared store.
+const memberSeparator = "\x00"
+
+// encodeMember returns the member of the shared store of an item.
+func encodeMember(it item) string {
+	return it.limiter + memberSeparator + it.key
+}
+
+// decodeMember returns the item of a member of the shared store.
+func decodeMember(member string) item {
+	limiter, key, _ := strings.Cut(member, memberSeparator)
+	return item{limiter: limiter, key: key}
+}
+
+// sortCounts sorts counts from the highest, ties broken by limiter and key.
+func sortCounts(counts []Count) {
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		if counts[i].Limiter != counts[j].Limiter {
+			return counts[i].Limiter < counts[j].Limiter
+		}
+		return counts[i].Key < counts[j].Key
+	})
+}
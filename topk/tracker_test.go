@@ -0,0 +1,276 @@
+// topk/tracker_test.go
+
+package topk
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/observe"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// observeN notifies the tracker of n decisions for a key of the api limiter.
+func observeN(tracker *Tracker, key string, n int, allowed bool) {
+	for i := 0; i < n; i++ {
+		tracker.ObserveDecision(observe.Decision{Limiter: "api", Key: key, Cost: 1, Allowed: allowed})
+	}
+}
+
+func TestSummary_SpaceSaving(t *testing.T) {
+	s := newSummary(2)
+	s.add(item{key: "alice"}, 5)
+	s.add(item{key: "bob"}, 3)
+	s.add(item{key: "carol"}, 1)
+
+	if _, ok := s.counters[item{key: "bob"}]; ok {
+		t.Error("Expected bob, with the smallest count, to be replaced")
+	}
+	c := s.counters[item{key: "carol"}]
+	if c == nil || c.count != 4 || c.err != 3 {
+		t.Errorf("Expected carol to inherit the count of bob, got %+v", c)
+	}
+	if c := s.counters[item{key: "alice"}]; c == nil || c.count != 5 || c.err != 0 {
+		t.Errorf("Expected the exact count of alice, got %+v", c)
+	}
+}
+
+func TestTracker_Top(t *testing.T) {
+	tracker, err := NewTracker(WithClock(clock.NewFake(time.Unix(1700000000, 0))))
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	notifier := observe.NewNotifier(tracker)
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 2, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := notifier.WrapLimiter("api", inner)
+	defer limiter.Close()
+
+	for i := 0; i < 5; i++ {
+		limiter.Allow("alice")
+	}
+	limiter.Allow("bob")
+	limiter.Allow("")
+	notifier.Close()
+
+	requested := []Count{{Limiter: "api", Key: "alice", Count: 5}, {Limiter: "api", Key: "bob", Count: 1}}
+	if top := tracker.TopRequested(10); !reflect.DeepEqual(top, requested) {
+		t.Errorf("Expected %v, got %v", requested, top)
+	}
+	denied := []Count{{Limiter: "api", Key: "alice", Count: 3}}
+	if top := tracker.TopDenied(10); !reflect.DeepEqual(top, denied) {
+		t.Errorf("Expected %v, got %v", denied, top)
+	}
+	if top := tracker.TopRequested(1); len(top) != 1 || top[0].Key != "alice" {
+		t.Errorf("Expected only alice, got %v", top)
+	}
+}
+
+func TestTracker_SlidingPeriod(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	tracker, err := NewTracker(WithPeriod(time.Minute, 6), WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+
+	observeN(tracker, "alice", 3, true)
+	fake.Advance(30 * time.Second)
+	observeN(tracker, "alice", 1, true)
+	observeN(tracker, "bob", 2, true)
+
+	tests := []struct {
+		advance  time.Duration
+		expected []Count
+	}{
+		{
+			advance:  20 * time.Second,
+			expected: []Count{{Limiter: "api", Key: "alice", Count: 4}, {Limiter: "api", Key: "bob", Count: 2}},
+		},
+		{
+			advance:  20 * time.Second,
+			expected: []Count{{Limiter: "api", Key: "bob", Count: 2}, {Limiter: "api", Key: "alice", Count: 1}},
+		},
+		{
+			advance:  time.Minute,
+			expected: []Count{},
+		},
+	}
+	for i, tt := range tests {
+		fake.Advance(tt.advance)
+		if top := tracker.TopRequested(10); !reflect.DeepEqual(top, tt.expected) {
+			t.Errorf("Step %d: expected %v, got %v", i+1, tt.expected, top)
+		}
+	}
+}
+
+func TestTracker_BoundedMemory(t *testing.T) {
+	tracker, err := NewTracker(WithCapacity(10), WithPeriod(time.Minute, 1), WithClock(clock.NewFake(time.Unix(1700000000, 0))))
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+
+	for i := 0; i < 10000; i++ {
+		observeN(tracker, "user-"+strconv.Itoa(i), 1, false)
+		if i%5 == 0 {
+			observeN(tracker, "abuser", 1, false)
+		}
+	}
+
+	for _, s := range tracker.slots {
+		if s != nil && (len(s.counts.requested.counters) > 10 || len(s.counts.denied.counters) > 10) {
+			t.Fatalf("Expected at most 10 counted keys, got %d", len(s.counts.requested.counters))
+		}
+	}
+	top := tracker.TopDenied(1)
+	if len(top) != 1 || top[0].Key != "abuser" {
+		t.Fatalf("Expected abuser to be the top denied key, got %v", top)
+	}
+	if top[0].Count < 2000 || top[0].Count-top[0].Error > 2000 {
+		t.Errorf("Expected a count bounding the 2000 requests of abuser, got %+v", top[0])
+	}
+}
+
+func TestTracker_Shared(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	shared := store.NewMemoryStore(store.WithClock(fake))
+	newTracker := func() *Tracker {
+		tracker, err := NewTracker(WithStore(shared, "hitters"), WithClock(fake))
+		if err != nil {
+			t.Fatalf("Failed to create tracker: %v", err)
+		}
+		return tracker
+	}
+	first, second := newTracker(), newTracker()
+	ctx := context.Background()
+
+	observeN(first, "alice", 2, false)
+	observeN(second, "alice", 1, false)
+	observeN(second, "bob", 2, true)
+	for _, tracker := range []*Tracker{first, second} {
+		if err := tracker.Publish(ctx); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	// Publishing again adds only the new counts
+	fake.Advance(15 * time.Second)
+	observeN(first, "bob", 2, true)
+	if err := first.Publish(ctx); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := first.Publish(ctx); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	requested, err := second.SharedTopRequested(ctx, 10)
+	if err != nil {
+		t.Fatalf("SharedTopRequested failed: %v", err)
+	}
+	expected := []Count{{Limiter: "api", Key: "bob", Count: 4}, {Limiter: "api", Key: "alice", Count: 3}}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Errorf("Expected %v, got %v", expected, requested)
+	}
+	denied, err := second.SharedTopDenied(ctx, 10)
+	if err != nil {
+		t.Fatalf("SharedTopDenied failed: %v", err)
+	}
+	expected = []Count{{Limiter: "api", Key: "alice", Count: 3}}
+	if !reflect.DeepEqual(denied, expected) {
+		t.Errorf("Expected %v, got %v", expected, denied)
+	}
+
+	// The shared counts slide with the period
+	fake.Advance(time.Minute)
+	if requested, err := second.SharedTopRequested(ctx, 10); err != nil || len(requested) != 0 {
+		t.Errorf("Expected no shared counts after the period, got %v, %v", requested, err)
+	}
+}
+
+func TestTracker_PublishFailure(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	shared := store.NewMemoryStore(store.WithClock(fake))
+	tracker, err := NewTracker(WithStore(shared, "hitters"), WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	ctx := context.Background()
+
+	observeN(tracker, "alice", 2, true)
+	shared.Close()
+	if err := tracker.Publish(ctx); !errors.Is(err, store.ErrClosed) {
+		t.Fatalf("Expected ErrClosed, got %v", err)
+	}
+
+	// The counts are published by the next call
+	shared = store.NewMemoryStore(store.WithClock(fake))
+	tracker.keeper = shared
+	if err := tracker.Publish(ctx); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	expected := []Count{{Limiter: "api", Key: "alice", Count: 2}}
+	if requested, err := tracker.SharedTopRequested(ctx, 10); err != nil || !reflect.DeepEqual(requested, expected) {
+		t.Errorf("Expected %v, got %v, %v", expected, requested, err)
+	}
+}
+
+func TestTracker_PublishEvery(t *testing.T) {
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	shared := store.NewMemoryStore(store.WithClock(fake))
+	tracker, err := NewTracker(WithStore(shared, "hitters"), WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	if err := tracker.PublishEvery(time.Hour, nil); err != nil {
+		t.Fatalf("PublishEvery failed: %v", err)
+	}
+	if err := tracker.PublishEvery(time.Hour, nil); err == nil {
+		t.Error("Expected an error when already publishing")
+	}
+
+	// Close publishes the counts not published yet
+	observeN(tracker, "alice", 1, true)
+	if err := tracker.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	requested, err := tracker.SharedTopRequested(context.Background(), 10)
+	if err != nil || len(requested) != 1 {
+		t.Errorf("Expected the count of alice to be published on Close, got %v, %v", requested, err)
+	}
+}
+
+func TestNewTracker_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "zero capacity", opts: []Option{WithCapacity(0)}},
+		{name: "zero slots", opts: []Option{WithPeriod(time.Minute, 0)}},
+		{name: "zero period", opts: []Option{WithPeriod(0, 6)}},
+		{name: "nil clock", opts: []Option{WithClock(nil)}},
+		{name: "store without scores", opts: []Option{WithStore(struct{ store.Store }{store.NewMemoryStore()}, "hitters")}},
+		{name: "empty name", opts: []Option{WithStore(store.NewMemoryStore(), "")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTracker(tt.opts...); err == nil {
+				t.Error("Expected an error, got nil")
+			}
+		})
+	}
+
+	tracker, err := NewTracker()
+	if err != nil {
+		t.Fatalf("Failed to create tracker: %v", err)
+	}
+	if err := tracker.Publish(context.Background()); !errors.Is(err, ErrNotShared) {
+		t.Errorf("Expected ErrNotShared, got %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+)
+
+// Names of the spans recorded by Limiter.
+const (
+	DecisionSpanName    = "throttlex.Allow"   // Span of each decision
+	ReservationSpanName = "throttlex.Reserve" // Span of each reservation
+	WaitSpanName        = "throttlex.Wait"    // Span of each wait, until the request is admitted
+)
+
+// Limiter is a rate limiter that records a span for each of its decisions. It implements
+// ratelimiter.RateLimiter, ratelimiter.Reserver and ratelimiter.Inspector, forwarding
+// reservations, waits and inspections to the wrapped limiter, so it can be a child of a
+// CompositeLimiter or be waited on by an httplimit.Transport.
+type Limiter struct {
+	limiter ratelimiter.RateLimiter // Limiter making the decisions
+	name    string                  // Value of the throttlex.limiter attribute
+	tracer  trace.Tracer
+	keys    bool // Whether to record the throttlex.key attribute
+}
+
+// WrapLimiter returns a limiter that makes its decisions with l and records a span for
+// each of them, with the given name in the throttlex.limiter attribute. The span is a
+// child of the span in the context given to AllowContext or DecideNContext, and is passed
+// on to the store, so the spans of Redis commands recorded by InstrumentRedis are its
+// children. Closing the returned limiter closes l.
+func WrapLimiter(name string, l ratelimiter.RateLimiter, opts ...Option) *Limiter {
+	o := newOptions(opts)
+	return &Limiter{limiter: l, name: name, tracer: o.tracer(), keys: o.keys}
+}
+
+// Name returns the name recorded in the spans.
+func (l *Limiter) Name() string {
+	return l.name
+}
+
+// Unwrap returns the limiter making the decisions.
+func (l *Limiter) Unwrap() ratelimiter.RateLimiter {
+	return l.limiter
+}
+
+// Policy returns the policy of the wrapped limiter, as named by ratelimiter.PolicyName.
+func (l *Limiter) Policy() ratelimiter.PolicyType {
+	return ratelimiter.PolicyType(ratelimiter.PolicyName(l.limiter))
+}
+
+// start starts a span of the given name for a request of cost n.
+func (l *Limiter) start(ctx context.Context, name, key string, n int64) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		LimiterKey.String(l.name),
+		PolicyKey.String(string(l.Policy())),
+		CostKey.Int64(n),
+	}
+	if l.keys {
+		attrs = append(attrs, RequestKey.String(key))
+	}
+	return l.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// fail records err as the outcome of the span.
+func fail(span trace.Span, err error) {
+	span.SetAttributes(DecisionKey.String("error"))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// decide makes a decision for a request of cost n within a span.
+func (l *Limiter) decide(ctx context.Context, key string, n int64) (*ratelimiter.Result, error) {
+	ctx, span := l.start(ctx, DecisionSpanName, key, n)
+	defer span.End()
+
+	result, err := l.limiter.DecideNContext(ctx, key, n)
+	if err != nil {
+		fail(span, err)
+		return nil, err
+	}
+
+	decision := "denied"
+	if result.Allowed {
+		decision = "allowed"
+	}
+	span.SetAttributes(
+		DecisionKey.String(decision),
+		RemainingKey.Int64(result.Remaining),
+		LimitKey.Int64(result.Limit),
+	)
+	if result.RejectedBy != "" {
+		span.SetAttributes(RejectedByKey.String(result.RejectedBy))
+	}
+	return result, nil
+}
+
+// Allow checks if a request associated with the given key is allowed to proceed.
+func (l *Limiter) Allow(key string) (bool, error) {
+	return l.AllowContext(context.Background(), key)
+}
+
+// AllowN checks if a request of cost n associated with the given key is allowed to proceed.
+func (l *Limiter) AllowN(key string, n int64) (bool, error) {
+	result, err := l.decide(context.Background(), key, n)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// AllowContext is like Allow but records the span as a child of the span in ctx, and
+// passes ctx on to the store.
+func (l *Limiter) AllowContext(ctx context.Context, key string) (bool, error) {
+	result, err := l.decide(ctx, key, 1)
+	if err != nil {
+		return false, err
+	}
+	return result.Allowed, nil
+}
+
+// Decide checks if a request associated with the given key is allowed to proceed and
+// reports the remaining quota.
+func (l *Limiter) Decide(key string) (*ratelimiter.Result, error) {
+	return l.decide(context.Background(), key, 1)
+}
+
+// DecideN is like Decide for a request of cost n.
+func (l *Limiter) DecideN(key string, n int64) (*ratelimiter.Result, error) {
+	return l.decide(context.Background(), key, n)
+}
+
+// DecideNContext is like DecideN but records the span as a child of the span in ctx, and
+// passes ctx on to the store.
+func (l *Limiter) DecideNContext(ctx context.Context, key string, n int64) (*ratelimiter.Result, error) {
+	return l.decide(ctx, key, n)
+}
+
+// ReserveN reserves capacity from the wrapped limiter for a request of cost n associated
+// with the given key, within a span that records an OK reservation as allowed.
+func (l *Limiter) ReserveN(ctx context.Context, key string, n int64, maxDelay time.Duration) (*ratelimiter.Reservation, error) {
+	ctx, span := l.start(ctx, ReservationSpanName, key, n)
+	defer span.End()
+
+	reservation, err := ratelimiter.ReserveN(ctx, l.limiter, key, n, maxDelay)
+	if err != nil {
+		fail(span, err)
+		return nil, err
+	}
+	decision := "denied"
+	if reservation.OK() {
+		decision = "allowed"
+	}
+	span.SetAttributes(DecisionKey.String(decision))
+	return reservation, nil
+}
+
+// Wait blocks until a request associated with the given key is allowed, or the context is done.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN blocks until the wrapped limiter allows a request of cost n associated with the
+// given key, or the context is done, within a span. A request that cannot be admitted
+// before the context deadline is recorded as denied.
+func (l *Limiter) WaitN(ctx context.Context, key string, n int64) error {
+	ctx, span := l.start(ctx, WaitSpanName, key, n)
+	defer span.End()
+
+	err := ratelimiter.WaitN(ctx, l.limiter, key, n)
+	switch {
+	case errors.Is(err, ratelimiter.ErrWaitExceedsDeadline):
+		span.SetAttributes(DecisionKey.String("denied"))
+	case err != nil:
+		fail(span, err)
+	default:
+		span.SetAttributes(DecisionKey.String("allowed"))
+	}
+	return err
+}
+
+// Inspect returns the state of key in the wrapped limiter, without a span.
+func (l *Limiter) Inspect(ctx context.Context, key string) (*ratelimiter.KeyState, error) {
+	return ratelimiter.Inspect(ctx, l.limiter, key)
+}
+
+// Reset deletes the state of key in the wrapped limiter, without a span.
+func (l *Limiter) Reset(ctx context.Context, key string) error {
+	return ratelimiter.Reset(ctx, l.limiter, key)
+}
+
+// Release releases a slot of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) Release(key string) error {
+	return l.ReleaseN(key, 1)
+}
+
+// ReleaseN releases n slots of a Concurrency limiter after processing. It does nothing for
+// other policies.
+func (l *Limiter) ReleaseN(key string, n int64) error {
+	return ratelimiter.ReleaseN(l.limiter, key, n)
+}
+
+// Close closes the wrapped limiter.
+func (l *Limiter) Close() error {
+	return l.limiter.Close()
+}
@@ -0,0 +1,183 @@
+// tracing/limiter_test.go
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/neelp03/throttlex/clock"
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+// newTestProvider returns a tracer provider that exports spans to the returned exporter
+// as soon as they end.
+func newTestProvider() (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	return sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)), exporter
+}
+
+// attributes returns the attributes of a span by key.
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestLimiter_Spans(t *testing.T) {
+	tp, exporter := newTestProvider()
+	inner, err := ratelimiter.NewFixedWindowLimiter(store.NewMemoryStore(), 1, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := WrapLimiter("login", inner, WithTracerProvider(tp))
+	defer limiter.Close()
+
+	limiter.Allow("alice")
+	limiter.Allow("alice")
+	if _, err := limiter.Allow(""); err == nil {
+		t.Fatal("Expected an error for an empty key")
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	tests := []struct {
+		decision  string
+		remaining int64
+	}{
+		{decision: "allowed", remaining: 0},
+		{decision: "denied", remaining: 0},
+		{decision: "error"},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		attrs := attributes(span)
+		if span.Name != DecisionSpanName {
+			t.Errorf("Span %d: expected name %q, got %q", i+1, DecisionSpanName, span.Name)
+		}
+		if attrs[LimiterKey].AsString() != "login" || attrs[PolicyKey].AsString() != "FixedWindow" {
+			t.Errorf("Span %d: expected the limiter and policy, got %v", i+1, span.Attributes)
+		}
+		if attrs[DecisionKey].AsString() != tt.decision {
+			t.Errorf("Span %d: expected decision %q, got %q", i+1, tt.decision, attrs[DecisionKey].AsString())
+		}
+		if _, ok := attrs[RequestKey]; ok {
+			t.Errorf("Span %d: expected no key by default", i+1)
+		}
+		if tt.decision == "error" {
+			if span.Status.Code != codes.Error {
+				t.Errorf("Span %d: expected an error status, got %v", i+1, span.Status)
+			}
+			continue
+		}
+		if remaining, ok := attrs[RemainingKey]; !ok || remaining.AsInt64() != tt.remaining {
+			t.Errorf("Span %d: expected %d remaining, got %v", i+1, tt.remaining, span.Attributes)
+		}
+	}
+}
+
+func TestLimiter_ParentSpan(t *testing.T) {
+	tp, exporter := newTestProvider()
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := WrapLimiter("api", inner, WithTracerProvider(tp), WithKeys())
+	defer limiter.Close()
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	if _, err := limiter.DecideNContext(ctx, "alice", 2); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parent.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	decision := spans[0]
+	if decision.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected the decision span to be a child of the request span")
+	}
+	attrs := attributes(decision)
+	if attrs[RequestKey].AsString() != "alice" || attrs[CostKey].AsInt64() != 2 {
+		t.Errorf("Expected the key and cost to be recorded, got %v", decision.Attributes)
+	}
+	if attrs[RemainingKey].AsInt64() != 3 {
+		t.Errorf("Expected 3 remaining, got %v", attrs[RemainingKey].AsInt64())
+	}
+}
+
+func TestLimiter_Close(t *testing.T) {
+	tp, _ := newTestProvider()
+	inner, err := ratelimiter.NewGCRALimiter(store.NewMemoryStore(), 5, 1)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := WrapLimiter("api", inner, WithTracerProvider(tp))
+
+	if err := limiter.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := inner.Allow("alice"); !errors.Is(err, ratelimiter.ErrClosed) {
+		t.Errorf("Expected the wrapped limiter to be closed, got %v", err)
+	}
+}
+
+func TestLimiter_Reservations(t *testing.T) {
+	tp, exporter := newTestProvider()
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	inner, err := ratelimiter.NewFixedWindowLimiter(store.NewMemoryStore(store.WithClock(fake)), 1, time.Minute, ratelimiter.WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := WrapLimiter("api", inner, WithTracerProvider(tp))
+	defer limiter.Close()
+
+	composite, err := ratelimiter.NewCompositeLimiter([]ratelimiter.CompositeChild{{Name: "api", Limiter: limiter}})
+	if err != nil {
+		t.Fatalf("Expected the wrapped limiter to be a composite child, got %v", err)
+	}
+	if allowed, err := composite.Allow("alice"); err != nil || !allowed {
+		t.Fatalf("First request should be allowed, got %v, %v", allowed, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := limiter.Wait(ctx, "alice"); !errors.Is(err, ratelimiter.ErrWaitExceedsDeadline) {
+		t.Errorf("Expected ErrWaitExceedsDeadline, got %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	tests := []struct {
+		name     string
+		decision string
+	}{
+		{name: ReservationSpanName, decision: "allowed"},
+		{name: WaitSpanName, decision: "denied"},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name != tt.name {
+			t.Errorf("Span %d: expected name %q, got %q", i+1, tt.name, span.Name)
+		}
+		if decision := attributes(span)[DecisionKey].AsString(); decision != tt.decision {
+			t.Errorf("Span %d: expected decision %q, got %q", i+1, tt.decision, decision)
+		}
+	}
+
+}
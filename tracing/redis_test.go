@@ -0,0 +1,81 @@
+// tracing/redis_test.go
+
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/neelp03/throttlex/ratelimiter"
+	"github.com/neelp03/throttlex/store"
+)
+
+func TestInstrumentRedis(t *testing.T) {
+	tp, exporter := newTestProvider()
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+	InstrumentRedis(client, WithTracerProvider(tp))
+
+	inner, err := ratelimiter.NewTokenBucketLimiter(store.NewRedisStore(client), 10, 1, ratelimiter.WithNamespace("tracing_test"))
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter := WrapLimiter("api", inner, WithTracerProvider(tp))
+	defer limiter.Close()
+	defer client.Del(context.Background(), "tracing_test:alice")
+
+	if allowed, err := limiter.AllowContext(context.Background(), "alice"); err != nil || !allowed {
+		t.Fatalf("Expected the request to be allowed, got %v, %v", allowed, err)
+	}
+
+	var decision trace.SpanContext
+	for _, span := range exporter.GetSpans() {
+		if span.Name == DecisionSpanName {
+			decision = span.SpanContext
+		}
+	}
+	var commands int
+	for _, span := range exporter.GetSpans() {
+		if !strings.HasPrefix(span.Name, "redis.") {
+			continue
+		}
+		commands++
+		if span.Parent.SpanID() != decision.SpanID() {
+			t.Errorf("Expected %s to be a child of the decision span", span.Name)
+		}
+		if span.SpanKind != trace.SpanKindClient {
+			t.Errorf("Expected %s to be a client span, got %v", span.Name, span.SpanKind)
+		}
+	}
+	// The script runs with EVALSHA, followed by EVAL the first time
+	if commands == 0 {
+		t.Error("Expected spans for the Redis commands")
+	}
+}
+
+func TestInstrumentRedis_Errors(t *testing.T) {
+	tp, exporter := newTestProvider()
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+	defer client.Close()
+	InstrumentRedis(client, WithTracerProvider(tp))
+
+	// A missing key is not an error
+	client.Get(context.Background(), "tracing_test:missing")
+	client.Do(context.Background(), "NOSUCHCOMMAND")
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].Name != "redis.get" || spans[0].Status.Code == codes.Error {
+		t.Errorf("Expected a successful redis.get span, got %s with %v", spans[0].Name, spans[0].Status)
+	}
+	if spans[1].Status.Code != codes.Error {
+		t.Errorf("Expected an error status for an unknown command, got %v", spans[1].Status)
+	}
+}
@@ -0,0 +1,82 @@
+// Package tracing adds OpenTelemetry spans to ThrottleX rate limiters and Redis clients.
+//
+// WrapLimiter records a span for each decision of a limiter, and InstrumentRedis records
+// a span for each command a Redis client sends. Commands sent by a RedisStore while a
+// wrapped limiter decides appear as children of the decision, which shows whether a slow
+// request spent its time in the limiter or in Redis:
+//
+//	client := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	tracing.InstrumentRedis(client)
+//
+//	limiter, err := ratelimiter.NewTokenBucketLimiter(store.NewRedisStore(client), 100, 10)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	api := tracing.WrapLimiter("api", limiter)
+//	allowed, err := api.AllowContext(r.Context(), key)
+//
+// Spans are recorded with the global tracer provider unless WithTracerProvider is given.
+package tracing
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is the name of the tracer of the spans.
+const instrumentationName = "github.com/neelp03/throttlex/tracing"
+
+// Attributes of the decision spans.
+const (
+	LimiterKey    = attribute.Key("throttlex.limiter")     // Name given to WrapLimiter
+	PolicyKey     = attribute.Key("throttlex.policy")      // Policy, as named by ratelimiter.PolicyName
+	RequestKey    = attribute.Key("throttlex.key")         // Key of the request; only recorded with WithKeys
+	CostKey       = attribute.Key("throttlex.cost")        // Cost of the request
+	DecisionKey   = attribute.Key("throttlex.decision")    // "allowed", "denied" or "error"
+	RemainingKey  = attribute.Key("throttlex.remaining")   // Quota remaining after the decision
+	LimitKey      = attribute.Key("throttlex.limit")       // Limit of the policy
+	RejectedByKey = attribute.Key("throttlex.rejected_by") // Child or level that rejected the request, if any
+)
+
+// options holds the settings of WrapLimiter and InstrumentRedis.
+type options struct {
+	tracerProvider trace.TracerProvider
+	keys           bool
+}
+
+// Option configures optional behavior of WrapLimiter and InstrumentRedis.
+type Option func(*options)
+
+// WithTracerProvider records spans with tp instead of the global tracer provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracerProvider = tp
+	}
+}
+
+// WithKeys records the key of each request in the throttlex.key attribute of its decision
+// span. Keys are off by default because they often identify users.
+func WithKeys() Option {
+	return func(o *options) {
+		o.keys = true
+	}
+}
+
+// newOptions applies opts to the default options.
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// tracer returns the tracer of the spans.
+func (o options) tracer() trace.Tracer {
+	tp := o.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(instrumentationName)
+}